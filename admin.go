@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"social/internal/services"
+	"sort"
+)
+
+// adminInput flags of admin subcommands, each uses the ones it needs
+type adminInput struct {
+	username  string
+	email     string
+	unsuspend bool
+	revoke    bool
+	dryRun    bool
+}
+
+var adminCommands = map[string]struct {
+	usage    string
+	username bool
+	run      func(ctx context.Context, s *services.Service, in adminInput) (interface{}, error)
+}{
+	"create-user": {"-email EMAIL -username USERNAME", true,
+		func(ctx context.Context, s *services.Service, in adminInput) (interface{}, error) {
+			return s.AdminCreateUser(ctx, in.email, in.username, in.dryRun)
+		}},
+	"suspend-user": {"-username USERNAME [-unsuspend]", true,
+		func(ctx context.Context, s *services.Service, in adminInput) (interface{}, error) {
+			return s.AdminSuspendUser(ctx, in.username, !in.unsuspend, in.dryRun)
+		}},
+	"delete-user": {"-username USERNAME", true,
+		func(ctx context.Context, s *services.Service, in adminInput) (interface{}, error) {
+			return s.AdminDeleteUser(ctx, in.username, in.dryRun)
+		}},
+	"issue-token": {"-username USERNAME", true,
+		func(ctx context.Context, s *services.Service, in adminInput) (interface{}, error) {
+			return s.AdminIssueToken(ctx, in.username, in.dryRun)
+		}},
+	"recompute-counts": {"", false,
+		func(ctx context.Context, s *services.Service, in adminInput) (interface{}, error) {
+			return s.AdminRecomputeCounts(ctx, in.dryRun)
+		}},
+	"set-admin": {"-username USERNAME [-revoke]", true,
+		func(ctx context.Context, s *services.Service, in adminInput) (interface{}, error) {
+			return s.AdminSetAdmin(ctx, in.username, !in.revoke, in.dryRun)
+		}},
+	"rebuild-timeline": {"-username USERNAME", true,
+		func(ctx context.Context, s *services.Service, in adminInput) (interface{}, error) {
+			return s.AdminRebuildTimeline(ctx, in.username, in.dryRun)
+		}},
+	"purge-avatars": {"", false,
+		func(ctx context.Context, s *services.Service, in adminInput) (interface{}, error) {
+			return s.AdminPurgeOrphanAvatars(ctx, in.dryRun)
+		}},
+}
+
+// runAdminCommand parses flags of admin subcommand name, runs it and prints its result as JSON
+func runAdminCommand(ctx context.Context, s *services.Service, name string, args []string) error {
+	cmd := adminCommands[name]
+
+	var in adminInput
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.BoolVar(&in.dryRun, "dry-run", false, "report what would change without changing anything")
+	if cmd.username {
+		fs.StringVar(&in.username, "username", "", "username of the user")
+	}
+	if name == "create-user" {
+		fs.StringVar(&in.email, "email", "", "email of the new user")
+	}
+	if name == "suspend-user" {
+		fs.BoolVar(&in.unsuspend, "unsuspend", false, "lift the suspension instead")
+	}
+	if name == "set-admin" {
+		fs.BoolVar(&in.revoke, "revoke", false, "revoke admin instead")
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if cmd.username && in.username == "" {
+		return fmt.Errorf("missing -username, usage: %s [-dry-run] %s", name, cmd.usage)
+	}
+
+	out, err := cmd.run(ctx, s, in)
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
+
+// adminUsage lists admin subcommands with their flags
+func adminUsage() string {
+	names := make([]string, 0, len(adminCommands))
+	for name := range adminCommands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	usage := ""
+	for _, name := range names {
+		usage += fmt.Sprintf("\n  %s [-dry-run] %s", name, adminCommands[name].usage)
+	}
+
+	return usage
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestRunAdminCommandFlags(t *testing.T) {
+	tt := []struct {
+		name string
+		args []string
+		err  string
+	}{
+		{name: "delete-user", args: nil, err: "missing -username"},
+		{name: "suspend-user", args: []string{"-dry-run"}, err: "missing -username"},
+		{name: "issue-token", args: []string{"-username", "alice", "-revoke"}, err: "flag provided but not defined"},
+		{name: "recompute-counts", args: []string{"-username", "alice"}, err: "flag provided but not defined"},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			// service is never reached when flags are wrong
+			err := runAdminCommand(context.Background(), nil, tc.name, tc.args)
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("want error containing %q, got %v", tc.err, err)
+			}
+		})
+	}
+}
+
+func TestAdminUsage(t *testing.T) {
+	usage := adminUsage()
+	for name, cmd := range adminCommands {
+		if !strings.Contains(usage, name+" [-dry-run] "+cmd.usage) {
+			t.Errorf("want usage of %s listed, got %s", name, usage)
+		}
+	}
+}
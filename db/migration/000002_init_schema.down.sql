@@ -0,0 +1,3 @@
+alter table users drop column if exists avatar_url;
+alter table follows drop constraint if exists follows_follower_id_fkey;
+alter table follows drop constraint if exists follows_followee_id_fkey;
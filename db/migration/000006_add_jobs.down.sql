@@ -0,0 +1,3 @@
+drop index if exists running_jobs;
+drop index if exists pending_jobs;
+drop table if exists jobs;
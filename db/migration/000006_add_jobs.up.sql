@@ -0,0 +1,17 @@
+create table if not exists jobs
+(
+    id           serial      not null primary key,
+    kind         varchar     not null,
+    payload      jsonb       not null default '{}',
+    status       varchar     not null default 'pending'
+        check ( status in ('pending', 'running', 'done', 'dead') ),
+    attempts     int         not null default 0,
+    max_attempts int         not null default 5,
+    last_error   varchar,
+    run_at       timestamptz not null default now(),
+    created_at   timestamptz not null default now(),
+    updated_at   timestamptz not null default now()
+);
+
+create index if not exists pending_jobs on jobs (run_at) where status = 'pending';
+create index if not exists running_jobs on jobs (updated_at) where status = 'running';
@@ -0,0 +1,3 @@
+drop index if exists unread_notifications;
+drop index if exists sorted_notifications;
+drop table if exists notifications;
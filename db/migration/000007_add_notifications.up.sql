@@ -0,0 +1,16 @@
+create table if not exists notifications
+(
+    id        serial      not null primary key,
+    user_id   int         not null references users (id),
+    -- actors in order they acted, the most recent one last
+    actor_ids int[]       not null,
+    kind      varchar     not null,
+    post_id   int references posts (id),
+    read_at   timestamptz,
+    issued_at timestamptz not null default now()
+);
+
+create index if not exists sorted_notifications on notifications (user_id, issued_at desc, id desc);
+-- single unread notification per kind and post, new actors are coalesced into it
+create unique index if not exists unread_notifications on notifications (user_id, kind, coalesce(post_id, 0))
+    where read_at is null;
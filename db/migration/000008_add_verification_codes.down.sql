@@ -0,0 +1,2 @@
+drop index if exists sorted_verification_codes;
+drop table if exists verification_codes;
@@ -0,0 +1,10 @@
+create table if not exists verification_codes
+(
+    -- sha256 of the code, plain code is only ever sent by mail
+    code_hash    varchar     not null primary key,
+    user_id      int         not null references users (id),
+    redirect_uri varchar,
+    created_at   timestamptz not null default now()
+);
+
+create index if not exists sorted_verification_codes on verification_codes (created_at);
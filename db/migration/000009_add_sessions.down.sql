@@ -0,0 +1,3 @@
+drop index if exists previous_refresh_tokens;
+drop index if exists user_sessions;
+drop table if exists sessions;
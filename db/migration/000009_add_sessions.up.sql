@@ -0,0 +1,16 @@
+create table if not exists sessions
+(
+    id                          varchar     not null primary key,
+    user_id                     int         not null references users (id),
+    refresh_token_hash          varchar     not null unique,
+    -- kept to detect reuse of rotated refresh token
+    previous_refresh_token_hash varchar,
+    user_agent                  varchar     not null default '',
+    ip                          varchar     not null default '',
+    created_at                  timestamptz not null default now(),
+    last_seen_at                timestamptz not null default now(),
+    expires_at                  timestamptz not null
+);
+
+create index if not exists user_sessions on sessions (user_id, last_seen_at desc);
+create index if not exists previous_refresh_tokens on sessions (previous_refresh_token_hash);
@@ -0,0 +1,22 @@
+alter table notifications
+    drop constraint notifications_post_id_fkey,
+    add constraint notifications_post_id_fkey foreign key (post_id) references posts (id);
+alter table comment_likes
+    drop constraint comment_likes_comment_id_fkey,
+    add constraint comment_likes_comment_id_fkey foreign key (comment_id) references comments (id);
+alter table comment_likes
+    drop constraint comment_likes_post_id_fkey,
+    add constraint comment_likes_post_id_fkey foreign key (post_id) references posts (id);
+alter table comments
+    drop constraint comments_post_id_fkey,
+    add constraint comments_post_id_fkey foreign key (post_id) references posts (id);
+alter table post_likes
+    drop constraint post_likes_post_id_fkey,
+    add constraint post_likes_post_id_fkey foreign key (post_id) references posts (id);
+alter table timeline
+    drop constraint timeline_post_id_fkey,
+    add constraint timeline_post_id_fkey foreign key (post_id) references posts (id);
+
+drop index if exists sorted_post_revisions;
+drop table if exists post_revisions;
+alter table posts drop column edited_at;
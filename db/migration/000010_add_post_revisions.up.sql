@@ -0,0 +1,34 @@
+alter table posts add edited_at timestamptz;
+
+create table if not exists post_revisions
+(
+    id         serial      not null primary key,
+    post_id    int         not null references posts (id) on delete cascade,
+    content    varchar     not null,
+    spoiler_of varchar,
+    nsfw       bool        not null,
+    -- when this version was replaced by an edit
+    created_at timestamptz not null default now()
+);
+
+create index if not exists sorted_post_revisions on post_revisions (post_id, created_at desc);
+
+-- deleting a post removes everything that hangs off it
+alter table timeline
+    drop constraint timeline_post_id_fkey,
+    add constraint timeline_post_id_fkey foreign key (post_id) references posts (id) on delete cascade;
+alter table post_likes
+    drop constraint post_likes_post_id_fkey,
+    add constraint post_likes_post_id_fkey foreign key (post_id) references posts (id) on delete cascade;
+alter table comments
+    drop constraint comments_post_id_fkey,
+    add constraint comments_post_id_fkey foreign key (post_id) references posts (id) on delete cascade;
+alter table comment_likes
+    drop constraint comment_likes_post_id_fkey,
+    add constraint comment_likes_post_id_fkey foreign key (post_id) references posts (id) on delete cascade;
+alter table comment_likes
+    drop constraint comment_likes_comment_id_fkey,
+    add constraint comment_likes_comment_id_fkey foreign key (comment_id) references comments (id) on delete cascade;
+alter table notifications
+    drop constraint notifications_post_id_fkey,
+    add constraint notifications_post_id_fkey foreign key (post_id) references posts (id) on delete cascade;
@@ -0,0 +1,3 @@
+drop index if exists sorted_post_comments;
+drop index if exists comment_likes_unique;
+alter table posts drop column comments_count;
@@ -0,0 +1,19 @@
+alter table posts add comments_count int not null
+    default 0 check ( comments_count >= 0 );
+
+update posts
+set comments_count = (select count(*) from comments where comments.post_id = posts.id);
+
+-- single like per user and comment
+delete
+from comment_likes a
+    using comment_likes b
+where a.id > b.id
+  and a.user_id = b.user_id
+  and a.comment_id = b.comment_id;
+
+update comments
+set likes_count = (select count(*) from comment_likes where comment_likes.comment_id = comments.id);
+
+create unique index if not exists comment_likes_unique on comment_likes (user_id, comment_id);
+create index if not exists sorted_post_comments on comments (post_id, id desc);
@@ -0,0 +1,4 @@
+drop index if exists sorted_comment_replies;
+alter table comments drop column replies_count;
+alter table comments drop column depth;
+alter table comments drop column parent_id;
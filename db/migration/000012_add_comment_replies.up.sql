@@ -0,0 +1,6 @@
+alter table comments add parent_id int references comments (id) on delete cascade;
+alter table comments add depth int not null default 0 check ( depth >= 0 );
+alter table comments add replies_count int not null
+    default 0 check ( replies_count >= 0 );
+
+create index if not exists sorted_comment_replies on comments (parent_id, id);
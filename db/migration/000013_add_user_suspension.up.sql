@@ -0,0 +1,2 @@
+-- suspended users can not log in, their sessions are revoked when suspended
+alter table users add suspended_at timestamptz;
@@ -0,0 +1,2 @@
+-- admins can use admin endpoints, granted with set-admin subcommand
+alter table users add admin boolean not null default false;
@@ -0,0 +1,2 @@
+drop index if exists posts_search;
+alter table posts drop column if exists search_vector;
@@ -0,0 +1,5 @@
+-- simple config keeps words as they are, posts are not all in one language
+alter table posts add search_vector tsvector
+    generated always as ( to_tsvector('simple', content) ) stored;
+
+create index if not exists posts_search on posts using gin (search_vector);
@@ -0,0 +1,3 @@
+drop table if exists trending_hashtags;
+drop table if exists post_hashtags;
+drop table if exists hashtags;
@@ -0,0 +1,44 @@
+create table if not exists hashtags
+(
+    id  serial  not null primary key,
+    -- lower cased, without the leading #
+    tag varchar not null unique
+);
+
+create table if not exists post_hashtags
+(
+    post_id    int         not null references posts (id) on delete cascade,
+    hashtag_id int         not null references hashtags (id),
+    -- created_at of the post, so windows of trending hashtags need no join
+    created_at timestamptz not null,
+    primary key (post_id, hashtag_id)
+);
+
+create index if not exists sorted_hashtag_posts on post_hashtags (hashtag_id, post_id desc);
+create index if not exists recent_post_hashtags on post_hashtags (created_at);
+
+-- ranking of each window as last computed by the trending worker
+create table if not exists trending_hashtags
+(
+    period      varchar     not null,
+    rank        int         not null,
+    hashtag_id  int         not null references hashtags (id),
+    posts_count int         not null,
+    score       float8      not null,
+    computed_at timestamptz not null,
+    primary key (period, rank)
+);
+
+-- same rule as extraction of new posts, a letter first and at most 50 characters
+insert into hashtags (tag)
+select distinct lower(m[2])
+from posts
+         cross join lateral regexp_matches(content, '(^|[^[:alnum:]_#&/])#([[:alpha:]][[:alnum:]_]{0,49})', 'g') as m
+on conflict do nothing;
+
+insert into post_hashtags (post_id, hashtag_id, created_at)
+select distinct posts.id, hashtags.id, posts.created_at
+from posts
+         cross join lateral regexp_matches(content, '(^|[^[:alnum:]_#&/])#([[:alpha:]][[:alnum:]_]{0,49})', 'g') as m
+         inner join hashtags on hashtags.tag = lower(m[2])
+on conflict do nothing;
@@ -0,0 +1,26 @@
+-- one row per @username in content, offsets are in unicode code points, end excluded,
+-- posts and comments created before mentions existed keep plain text
+create table if not exists post_mentions
+(
+    post_id      int         not null references posts (id) on delete cascade,
+    user_id      int         not null references users (id) on delete cascade,
+    start_offset int         not null,
+    end_offset   int         not null,
+    -- when user was first mentioned in the post, kept across edits
+    created_at   timestamptz not null default now(),
+    primary key (post_id, start_offset)
+);
+
+create index if not exists sorted_user_post_mentions on post_mentions (user_id, created_at desc);
+
+create table if not exists comment_mentions
+(
+    comment_id   int         not null references comments (id) on delete cascade,
+    user_id      int         not null references users (id) on delete cascade,
+    start_offset int         not null,
+    end_offset   int         not null,
+    created_at   timestamptz not null default now(),
+    primary key (comment_id, start_offset)
+);
+
+create index if not exists sorted_user_comment_mentions on comment_mentions (user_id, created_at desc);
@@ -0,0 +1,5 @@
+alter table timeline drop column if exists reposted_by;
+drop table if exists reposts;
+alter table posts
+    drop column if exists quote_of,
+    drop column if exists reposts_count;
@@ -0,0 +1,19 @@
+alter table posts
+    add reposts_count int not null default 0 check ( reposts_count >= 0 ),
+    -- post quoted by this one, quotes stay when the quoted post is deleted
+    add quote_of      int references posts (id) on delete set null;
+
+create table if not exists reposts
+(
+    user_id    int         not null references users (id),
+    post_id    int         not null references posts (id) on delete cascade,
+    created_at timestamptz not null default now(),
+    primary key (user_id, post_id)
+);
+
+create index if not exists post_reposts on reposts (post_id);
+
+-- user whose repost brought the post to the timeline, null when it came from its author,
+-- timeline_unique keeps a post from showing up again however many users repost it
+alter table timeline
+    add reposted_by int references users (id) on delete cascade;
@@ -0,0 +1,18 @@
+-- images uploaded to be attached to posts, file and thumbnail are names of stored files
+create table if not exists media
+(
+    id         serial      not null primary key,
+    user_id    int         not null references users (id),
+    -- null until the upload is attached to a post
+    post_id    int references posts (id) on delete cascade,
+    position   int,
+    file       varchar     not null,
+    thumbnail  varchar     not null,
+    width      int         not null,
+    height     int         not null,
+    blurhash   varchar     not null,
+    alt_text   varchar     not null default '',
+    created_at timestamptz not null default now()
+);
+
+create index if not exists sorted_post_media on media (post_id, position);
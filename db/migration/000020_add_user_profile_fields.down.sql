@@ -0,0 +1,7 @@
+alter table users
+    drop column if exists display_name,
+    drop column if exists bio,
+    drop column if exists location,
+    drop column if exists website,
+    drop column if exists pronouns,
+    drop column if exists cover_url;
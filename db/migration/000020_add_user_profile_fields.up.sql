@@ -0,0 +1,8 @@
+-- profile details users edit themselves, empty when not set, cover_url is cover image file like avatar_url
+alter table users
+    add display_name varchar not null default '',
+    add bio          varchar not null default '',
+    add location     varchar not null default '',
+    add website      varchar not null default '',
+    add pronouns     varchar not null default '',
+    add cover_url    varchar;
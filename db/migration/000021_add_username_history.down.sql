@@ -0,0 +1,5 @@
+drop table if exists email_changes;
+drop table if exists username_history;
+
+alter table users
+    drop column if exists username_changed_at;
@@ -0,0 +1,25 @@
+alter table users
+    add username_changed_at timestamptz;
+
+-- previous usernames, they keep resolving to the account and nobody else can take them
+-- for a grace period after the change, a username is only ever held by one account
+create table if not exists username_history
+(
+    username   varchar     not null primary key,
+    user_id    int         not null references users (id) on delete cascade,
+    changed_at timestamptz not null default now()
+);
+
+create index if not exists user_username_history on username_history (user_id);
+
+-- email changes waiting for the new address to be verified
+create table if not exists email_changes
+(
+    -- sha256 of the code, plain code is only ever sent by mail to the new address
+    code_hash  varchar     not null primary key,
+    user_id    int         not null references users (id) on delete cascade,
+    email      varchar     not null,
+    created_at timestamptz not null default now()
+);
+
+create index if not exists sorted_email_changes on email_changes (created_at);
@@ -0,0 +1,4 @@
+drop table if exists exports;
+
+alter table users
+    drop column if exists deletion_scheduled_at;
@@ -0,0 +1,18 @@
+-- set while deletion asked for by the user is pending, logging back in before it clears it
+alter table users
+    add deletion_scheduled_at timestamptz;
+
+create index if not exists due_user_deletions on users (deletion_scheduled_at)
+    where deletion_scheduled_at is not null;
+
+-- data exports asked for by users, file is the stored archive and stays null until it is built
+create table if not exists exports
+(
+    id           serial      not null primary key,
+    user_id      int         not null references users (id),
+    file         varchar,
+    created_at   timestamptz not null default now(),
+    completed_at timestamptz
+);
+
+create index if not exists sorted_user_exports on exports (user_id, created_at desc);
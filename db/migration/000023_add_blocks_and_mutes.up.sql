@@ -0,0 +1,19 @@
+-- a block hides both users from each other, follows between them are removed when it is made
+create table if not exists blocks
+(
+    blocker_id int         not null references users (id) on delete cascade,
+    blocked_id int         not null references users (id) on delete cascade,
+    created_at timestamptz not null default now(),
+    primary key (blocker_id, blocked_id)
+);
+
+create index if not exists blocked_users on blocks (blocked_id);
+
+-- a mute only hides posts of the muted user from timeline and notifications of the muter
+create table if not exists mutes
+(
+    muter_id   int         not null references users (id) on delete cascade,
+    muted_id   int         not null references users (id) on delete cascade,
+    created_at timestamptz not null default now(),
+    primary key (muter_id, muted_id)
+);
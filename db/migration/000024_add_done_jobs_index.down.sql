@@ -0,0 +1 @@
+drop index if exists done_jobs;
@@ -0,0 +1,2 @@
+-- done jobs are purged once they are older than the retention period
+create index if not exists done_jobs on jobs (updated_at) where status = 'done';
@@ -0,0 +1,9 @@
+// Package migration embeds schema migrations so the binary can apply them by itself
+package migration
+
+import "embed"
+
+// FS holds numbered migrations, each as NNNNNN_name.up.sql and NNNNNN_name.down.sql pair
+//
+//go:embed *.sql
+var FS embed.FS
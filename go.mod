@@ -3,15 +3,18 @@ module social
 go 1.17
 
 require (
-	github.com/disintegration/imaging v1.6.2 // indirect
+	github.com/disintegration/imaging v1.6.2
+	github.com/hako/branca v0.0.0-20200807062402-6052ac720505
+	github.com/jackc/pgx v3.6.2+incompatible
+	github.com/lib/pq v1.10.4
+	github.com/matoous/go-nanoid v1.5.0
+	github.com/matryer/way v0.0.0-20180416093233-9632d0c407b0
+	github.com/sanity-io/litter v1.5.4
+)
+
+require (
 	github.com/eknkc/basex v1.0.1 // indirect
-	github.com/hako/branca v0.0.0-20200807062402-6052ac720505 // indirect
-	github.com/jackc/pgx v3.6.2+incompatible // indirect
-	github.com/lib/pq v1.10.4 // indirect
-	github.com/matoous/go-nanoid v1.5.0 // indirect
-	github.com/matryer/way v0.0.0-20180416093233-9632d0c407b0 // indirect
 	github.com/pkg/errors v0.9.1 // indirect
-	github.com/sanity-io/litter v1.5.4 // indirect
 	golang.org/x/crypto v0.0.0-20220321153916-2c7772ba3064 // indirect
 	golang.org/x/image v0.0.0-20191009234506-e7c1f5e7dbb8 // indirect
 	golang.org/x/sys v0.0.0-20220327210214-530d0810a4d0 // indirect
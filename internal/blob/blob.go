@@ -0,0 +1,50 @@
+package blob
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"time"
+)
+
+// ErrNotFound blob with the key does not exist
+var ErrNotFound = errors.New("blob not found")
+
+// Store keeps files like avatars and media uploads outside of the app, by slash separated
+// keys like avatars/abc.png, so they are shared by every instance of it
+type Store interface {
+	Put(ctx context.Context, key string, r io.Reader, contentType string) error
+	// Get opens blob for reading, the caller closes it
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes blob, removing blob that does not exist is not an error
+	Delete(ctx context.Context, key string) error
+	// List blobs whose keys start with prefix
+	List(ctx context.Context, prefix string) ([]Info, error)
+	// URL where blob is publicly served
+	URL(key string) string
+	// SignedURL URL granting access to blob until ttl passes, for blobs that are not served publicly
+	SignedURL(key string, ttl time.Duration) (string, error)
+}
+
+// Info describes stored blob
+type Info struct {
+	Key     string
+	Size    int64
+	ModTime time.Time
+}
+
+// validKey tells whether key is relative path that stays inside of the store
+func validKey(key string) bool {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") {
+		return false
+	}
+
+	for _, segment := range strings.Split(key, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return false
+		}
+	}
+
+	return true
+}
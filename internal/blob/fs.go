@@ -0,0 +1,256 @@
+package blob
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FSStore keeps blobs as files under a directory served at baseURL, signed URLs carry
+// their expiry and a signature of it made with secret, which Verify checks
+type FSStore struct {
+	// Private key prefixes ServeHTTP only serves through URLs made by SignedURL
+	Private []string
+
+	dir     string
+	baseURL string
+	secret  []byte
+}
+
+// NewFSStore creates store of files under dir that are served at baseURL
+func NewFSStore(dir, baseURL string, secret []byte) *FSStore {
+	return &FSStore{
+		dir:     dir,
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		secret:  secret,
+	}
+}
+
+func (s *FSStore) Put(ctx context.Context, key string, r io.Reader, contentType string) error {
+	name, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err = os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return fmt.Errorf("could not create blob directory, %v", err)
+	}
+
+	// written next to its final name first so readers never see a partial file
+	f, err := os.CreateTemp(filepath.Dir(name), ".tmp-")
+	if err != nil {
+		return fmt.Errorf("could not create blob file, %v", err)
+	}
+
+	defer os.Remove(f.Name())
+
+	if _, err = io.Copy(f, r); err != nil {
+		f.Close()
+		return fmt.Errorf("could not write blob file, %v", err)
+	}
+
+	if err = f.Close(); err != nil {
+		return fmt.Errorf("could not close blob file, %v", err)
+	}
+
+	if err = os.Chmod(f.Name(), 0644); err != nil {
+		return fmt.Errorf("could not chmod blob file, %v", err)
+	}
+
+	if err = os.Rename(f.Name(), name); err != nil {
+		return fmt.Errorf("could not rename blob file, %v", err)
+	}
+
+	return nil
+}
+
+func (s *FSStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	name, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("could not open blob file, %v", err)
+	}
+
+	return f, nil
+}
+
+func (s *FSStore) Delete(ctx context.Context, key string) error {
+	name, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err = os.Remove(name); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("could not remove blob file, %v", err)
+	}
+
+	return nil
+}
+
+func (s *FSStore) List(ctx context.Context, prefix string) ([]Info, error) {
+	// only the directory prefix ends in is walked
+	root := filepath.Join(s.dir, filepath.FromSlash(path.Dir("/"+prefix+"_")))
+	var list []Info
+	err := filepath.WalkDir(root, func(name string, entry fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) && name == root {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			return nil
+		}
+
+		rel, err := filepath.Rel(s.dir, name)
+		if err != nil {
+			return err
+		}
+
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+
+		list = append(list, Info{Key: key, Size: info.Size(), ModTime: info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not list blob files, %v", err)
+	}
+
+	return list, nil
+}
+
+func (s *FSStore) URL(key string) string {
+	return s.baseURL + "/" + (&url.URL{Path: key}).EscapedPath()
+}
+
+func (s *FSStore) SignedURL(key string, ttl time.Duration) (string, error) {
+	if !validKey(key) {
+		return "", fmt.Errorf("invalid blob key %q", key)
+	}
+
+	expires := strconv.FormatInt(time.Now().Add(ttl).Unix(), 10)
+	return s.URL(key) + "?" + url.Values{
+		"expires":   {expires},
+		"signature": {s.sign(key, expires)},
+	}.Encode(), nil
+}
+
+// Verify tells whether expires and signature from URL made by SignedURL for key are valid and not expired yet
+func (s *FSStore) Verify(key, expires, signature string) bool {
+	at, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > at {
+		return false
+	}
+
+	return hmac.Equal([]byte(signature), []byte(s.sign(key, expires)))
+}
+
+func (s *FSStore) sign(key, expires string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(key + "\n" + expires))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (s *FSStore) path(key string) (string, error) {
+	if !validKey(key) {
+		return "", fmt.Errorf("invalid blob key %q", key)
+	}
+
+	return filepath.Join(s.dir, filepath.FromSlash(key)), nil
+}
+
+// Path URL path blobs are served under, for mounting ServeHTTP
+func (s *FSStore) Path() string {
+	u, err := url.Parse(s.baseURL)
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimSuffix(u.Path, "/")
+}
+
+// ServeHTTP serves blob at request path under Path, blob keys are never reused so responses are cached for good,
+// except for Private ones which need a valid signature
+func (s *FSStore) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	key := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, s.Path()), "/")
+	// files being written have names starting with .
+	if !validKey(key) || strings.HasPrefix(path.Base(key), ".") {
+		http.NotFound(w, r)
+		return
+	}
+
+	private := s.private(key)
+	if q := r.URL.Query(); private && !s.Verify(key, q.Get("expires"), q.Get("signature")) {
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+
+	f, err := os.Open(filepath.Join(s.dir, filepath.FromSlash(key)))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil || info.IsDir() {
+		http.NotFound(w, r)
+		return
+	}
+
+	if private {
+		w.Header().Set("Cache-Control", "private, no-store")
+	} else {
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	}
+
+	http.ServeContent(w, r, info.Name(), info.ModTime(), f)
+}
+
+func (s *FSStore) private(key string) bool {
+	for _, prefix := range s.Private {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,182 @@
+package blob
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFSStore(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	s := NewFSStore(dir, "http://localhost/img/", []byte("secret"))
+
+	for _, key := range []string{"avatars/a.png", "avatars/b.png", "avatarsx/c.png", "media/d.jpg"} {
+		if err := s.Put(ctx, key, strings.NewReader("data of "+key), "image/png"); err != nil {
+			t.Fatalf("could not put %s: %v", key, err)
+		}
+	}
+
+	r, err := s.Get(ctx, "avatars/a.png")
+	if err != nil {
+		t.Fatalf("could not get blob: %v", err)
+	}
+
+	b, err := io.ReadAll(r)
+	r.Close()
+	if err != nil || string(b) != "data of avatars/a.png" {
+		t.Errorf("want blob data back, got %q, %v", b, err)
+	}
+
+	// a file being written does not show up
+	if err = os.WriteFile(filepath.Join(dir, "avatars", ".tmp-1"), nil, 0644); err != nil {
+		t.Fatalf("could not write temp file: %v", err)
+	}
+
+	list, err := s.List(ctx, "avatars/")
+	if err != nil {
+		t.Fatalf("could not list blobs: %v", err)
+	}
+
+	var keys []string
+	for _, info := range list {
+		keys = append(keys, info.Key)
+		if info.Size != int64(len("data of "+info.Key)) || info.ModTime.IsZero() {
+			t.Errorf("want size and time of %s, got %+v", info.Key, info)
+		}
+	}
+
+	sort.Strings(keys)
+	if strings.Join(keys, ",") != "avatars/a.png,avatars/b.png" {
+		t.Errorf("want only blobs under avatars/, got %v", keys)
+	}
+
+	if list, err = s.List(ctx, "avatars"); err != nil || len(list) != 3 {
+		t.Errorf("want prefix matched within directory too, got %+v, %v", list, err)
+	}
+
+	if list, err = s.List(ctx, "exports/"); err != nil || len(list) != 0 {
+		t.Errorf("want nothing under missing directory, got %+v, %v", list, err)
+	}
+
+	if err = s.Delete(ctx, "avatars/a.png"); err != nil {
+		t.Fatalf("could not delete blob: %v", err)
+	}
+
+	if err = s.Delete(ctx, "avatars/a.png"); err != nil {
+		t.Errorf("want deleting missing blob to succeed, got %v", err)
+	}
+
+	if _, err = s.Get(ctx, "avatars/a.png"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("want ErrNotFound, got %v", err)
+	}
+
+	for _, key := range []string{"", "/etc/passwd", "../secret", "a/../../b", "a//b", `a\b`} {
+		if err = s.Put(ctx, key, strings.NewReader(""), ""); err == nil {
+			t.Errorf("want invalid key %q rejected", key)
+		}
+	}
+
+	if got := s.URL("media/a b.jpg"); got != "http://localhost/img/media/a%20b.jpg" {
+		t.Errorf("want escaped url, got %s", got)
+	}
+}
+
+func TestFSStoreSignedURL(t *testing.T) {
+	s := NewFSStore(t.TempDir(), "http://localhost/img", []byte("secret"))
+
+	signed, err := s.SignedURL("exports/a.zip", time.Minute)
+	if err != nil {
+		t.Fatalf("could not sign url: %v", err)
+	}
+
+	u, err := url.Parse(signed)
+	if err != nil || u.Path != "/img/exports/a.zip" {
+		t.Fatalf("want url of the blob, got %s, %v", signed, err)
+	}
+
+	expires, signature := u.Query().Get("expires"), u.Query().Get("signature")
+	if !s.Verify("exports/a.zip", expires, signature) {
+		t.Fatal("want signed url verified")
+	}
+
+	past := strconv.FormatInt(time.Now().Add(-time.Second).Unix(), 10)
+	tt := []struct {
+		name, key, expires, signature string
+	}{
+		{name: "other key", key: "exports/b.zip", expires: expires, signature: signature},
+		{name: "extended expiry", key: "exports/a.zip", expires: expires + "0", signature: signature},
+		{name: "tampered signature", key: "exports/a.zip", expires: expires, signature: strings.Repeat("0", len(signature))},
+		{name: "no signature", key: "exports/a.zip", expires: expires},
+		{name: "bad expiry", key: "exports/a.zip", expires: "soon", signature: signature},
+		{name: "expired", key: "exports/a.zip", expires: past, signature: s.sign("exports/a.zip", past)},
+	}
+	for _, tc := range tt {
+		if s.Verify(tc.key, tc.expires, tc.signature) {
+			t.Errorf("%s: want signature rejected", tc.name)
+		}
+	}
+
+	other := NewFSStore(t.TempDir(), "http://localhost/img", []byte("other secret"))
+	if other.Verify("exports/a.zip", expires, signature) {
+		t.Error("want signature made with other secret rejected")
+	}
+
+	if _, err = s.SignedURL("../a.zip", time.Minute); err == nil {
+		t.Error("want invalid key rejected")
+	}
+}
+
+func TestFSStoreServeHTTP(t *testing.T) {
+	ctx := context.Background()
+	s := NewFSStore(t.TempDir(), "http://localhost/img", []byte("secret"))
+	s.Private = []string{"exports/"}
+
+	for _, key := range []string{"avatars/a.png", "exports/a.zip"} {
+		if err := s.Put(ctx, key, strings.NewReader("data"), ""); err != nil {
+			t.Fatalf("could not put %s: %v", key, err)
+		}
+	}
+
+	signed, err := s.SignedURL("exports/a.zip", time.Minute)
+	if err != nil {
+		t.Fatalf("could not sign url: %v", err)
+	}
+
+	tt := []struct {
+		method, target string
+		status         int
+		cacheControl   string
+	}{
+		{method: http.MethodGet, target: "/img/avatars/a.png", status: http.StatusOK, cacheControl: "public, max-age=31536000, immutable"},
+		{method: http.MethodHead, target: "/img/avatars/a.png", status: http.StatusOK},
+		{method: http.MethodPost, target: "/img/avatars/a.png", status: http.StatusMethodNotAllowed},
+		{method: http.MethodGet, target: "/img/avatars/b.png", status: http.StatusNotFound},
+		{method: http.MethodGet, target: "/img/avatars", status: http.StatusNotFound},
+		{method: http.MethodGet, target: "/img/avatars/.tmp-1", status: http.StatusNotFound},
+		{method: http.MethodGet, target: "/img/exports/a.zip", status: http.StatusForbidden},
+		{method: http.MethodGet, target: "/img/exports/a.zip?expires=1&signature=x", status: http.StatusForbidden},
+		{method: http.MethodGet, target: strings.TrimPrefix(signed, "http://localhost"), status: http.StatusOK, cacheControl: "private, no-store"},
+	}
+	for _, tc := range tt {
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, httptest.NewRequest(tc.method, tc.target, nil))
+		if rec.Code != tc.status {
+			t.Errorf("%s %s: want %d, got %d", tc.method, tc.target, tc.status, rec.Code)
+		}
+
+		if tc.cacheControl != "" && rec.Header().Get("Cache-Control") != tc.cacheControl {
+			t.Errorf("%s %s: want Cache-Control %q, got %q", tc.method, tc.target, tc.cacheControl, rec.Header().Get("Cache-Control"))
+		}
+	}
+}
@@ -0,0 +1,369 @@
+package blob
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	amzDateFormat   = "20060102T150405Z"
+	unsignedPayload = "UNSIGNED-PAYLOAD"
+	// maxSignedURLTTL longest expiry signature version 4 allows
+	maxSignedURLTTL = time.Hour * 24 * 7
+)
+
+// S3Config where S3 compatible store is and how to access it
+type S3Config struct {
+	// Endpoint like https://s3.eu-west-1.amazonaws.com or http://localhost:9000 for MinIO
+	Endpoint  string
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	// PathStyle addresses bucket as the first path segment instead of subdomain of Endpoint, MinIO needs it
+	PathStyle bool
+	// PublicURL blobs are publicly served at, like CDN in front of the bucket, defaults to the bucket URL
+	PublicURL string
+}
+
+// S3Store keeps blobs as objects of S3 compatible bucket, requests are signed with signature version 4
+type S3Store struct {
+	bucketURL *url.URL
+	publicURL string
+	region    string
+	accessKey string
+	secretKey string
+	client    *http.Client
+}
+
+// NewS3Store creates store of objects in the bucket of cfg
+func NewS3Store(cfg S3Config) (*S3Store, error) {
+	endpoint, err := url.Parse(cfg.Endpoint)
+	if err != nil || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid s3 endpoint %q", cfg.Endpoint)
+	}
+
+	if cfg.Bucket == "" {
+		return nil, fmt.Errorf("s3 bucket is required")
+	}
+
+	bucketURL := &url.URL{Scheme: endpoint.Scheme, Host: endpoint.Host, Path: strings.TrimSuffix(endpoint.Path, "/")}
+	if cfg.PathStyle {
+		bucketURL.Path += "/" + cfg.Bucket
+	} else {
+		bucketURL.Host = cfg.Bucket + "." + endpoint.Host
+	}
+
+	s := &S3Store{
+		bucketURL: bucketURL,
+		publicURL: strings.TrimSuffix(cfg.PublicURL, "/"),
+		region:    cfg.Region,
+		accessKey: cfg.AccessKey,
+		secretKey: cfg.SecretKey,
+		client:    &http.Client{Timeout: time.Minute},
+	}
+	if s.publicURL == "" {
+		s.publicURL = bucketURL.String()
+	}
+
+	if s.region == "" {
+		s.region = "us-east-1"
+	}
+
+	return s, nil
+}
+
+func (s *S3Store) Put(ctx context.Context, key string, r io.Reader, contentType string) error {
+	if !validKey(key) {
+		return fmt.Errorf("invalid blob key %q", key)
+	}
+
+	// payload is hashed for the signature, blobs are images small enough to hold in memory
+	body, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("could not read blob, %v", err)
+	}
+
+	header := http.Header{}
+	if contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+
+	res, err := s.do(ctx, http.MethodPut, key, nil, header, body)
+	if err != nil {
+		return fmt.Errorf("could not put blob, %v", err)
+	}
+
+	res.Body.Close()
+	return nil
+}
+
+func (s *S3Store) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	if !validKey(key) {
+		return nil, fmt.Errorf("invalid blob key %q", key)
+	}
+
+	res, err := s.do(ctx, http.MethodGet, key, nil, nil, nil)
+	if err == ErrNotFound {
+		return nil, err
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("could not get blob, %v", err)
+	}
+
+	return res.Body, nil
+}
+
+func (s *S3Store) Delete(ctx context.Context, key string) error {
+	if !validKey(key) {
+		return fmt.Errorf("invalid blob key %q", key)
+	}
+
+	res, err := s.do(ctx, http.MethodDelete, key, nil, nil, nil)
+	if err == ErrNotFound {
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("could not delete blob, %v", err)
+	}
+
+	res.Body.Close()
+	return nil
+}
+
+func (s *S3Store) List(ctx context.Context, prefix string) ([]Info, error) {
+	var (
+		list  []Info
+		token string
+	)
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+
+		res, err := s.do(ctx, http.MethodGet, "", query, nil, nil)
+		if err != nil {
+			return nil, fmt.Errorf("could not list blobs, %v", err)
+		}
+
+		var page struct {
+			Contents []struct {
+				Key          string
+				Size         int64
+				LastModified time.Time
+			}
+			IsTruncated           bool
+			NextContinuationToken string
+		}
+		err = xml.NewDecoder(res.Body).Decode(&page)
+		res.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("could not decode blob list, %v", err)
+		}
+
+		for _, c := range page.Contents {
+			list = append(list, Info{Key: c.Key, Size: c.Size, ModTime: c.LastModified})
+		}
+
+		if !page.IsTruncated || page.NextContinuationToken == "" {
+			return list, nil
+		}
+
+		token = page.NextContinuationToken
+	}
+}
+
+func (s *S3Store) URL(key string) string {
+	return s.publicURL + "/" + uriEncode(key, false)
+}
+
+// SignedURL presigned GET of the object, ttl is capped at the 7 days signature version 4 allows
+func (s *S3Store) SignedURL(key string, ttl time.Duration) (string, error) {
+	if !validKey(key) {
+		return "", fmt.Errorf("invalid blob key %q", key)
+	}
+
+	if ttl > maxSignedURLTTL {
+		ttl = maxSignedURLTTL
+	}
+
+	now := time.Now().UTC()
+	u := s.objectURL(key)
+	query := url.Values{
+		"X-Amz-Algorithm":     {"AWS4-HMAC-SHA256"},
+		"X-Amz-Credential":    {s.accessKey + "/" + s.scope(now)},
+		"X-Amz-Date":          {now.Format(amzDateFormat)},
+		"X-Amz-Expires":       {strconv.Itoa(int(ttl.Seconds()))},
+		"X-Amz-SignedHeaders": {"host"},
+	}
+	header := http.Header{"Host": {u.Host}}
+	signature := s.signature(now, http.MethodGet, u, query, header, []string{"host"}, unsignedPayload)
+	query.Set("X-Amz-Signature", signature)
+
+	return u.String() + "?" + canonicalQuery(query), nil
+}
+
+// do sends signed request for the object with key, or for the bucket when key is empty,
+// responses other than 2xx are turned into errors, 404 into ErrNotFound
+func (s *S3Store) do(ctx context.Context, method, key string, query url.Values, header http.Header, body []byte) (*http.Response, error) {
+	u := s.bucketURL
+	if key != "" {
+		u = s.objectURL(key)
+	}
+
+	rawURL := u.String()
+	if len(query) != 0 {
+		rawURL += "?" + canonicalQuery(query)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, rawURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	for k, v := range header {
+		req.Header[k] = v
+	}
+
+	now := time.Now().UTC()
+	payloadHash := sha256.Sum256(body)
+	req.Header.Set("X-Amz-Date", now.Format(amzDateFormat))
+	req.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(payloadHash[:]))
+	req.Header.Set("Host", u.Host)
+
+	var signedHeaders []string
+	for k := range req.Header {
+		signedHeaders = append(signedHeaders, strings.ToLower(k))
+	}
+
+	sort.Strings(signedHeaders)
+	signature := s.signature(now, method, u, query, req.Header, signedHeaders, hex.EncodeToString(payloadHash[:]))
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+s.accessKey+"/"+s.scope(now)+
+		", SignedHeaders="+strings.Join(signedHeaders, ";")+", Signature="+signature)
+	// Go sends Host from req.Host, it is only in the header map to be signed
+	req.Header.Del("Host")
+	req.Host = u.Host
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		return res, nil
+	}
+
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusNotFound {
+		return nil, ErrNotFound
+	}
+
+	msg, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+	return nil, fmt.Errorf("s3 responded %s: %s", res.Status, bytes.TrimSpace(msg))
+}
+
+func (s *S3Store) objectURL(key string) *url.URL {
+	u := *s.bucketURL
+	u.Path += "/" + key
+	u.RawPath = s.bucketURL.EscapedPath() + "/" + uriEncode(key, false)
+	return &u
+}
+
+func (s *S3Store) scope(t time.Time) string {
+	return t.Format("20060102") + "/" + s.region + "/s3/aws4_request"
+}
+
+// signature signs request as signature version 4 describes, headers are signed by their lower case names
+func (s *S3Store) signature(
+	t time.Time,
+	method string,
+	u *url.URL,
+	query url.Values,
+	header http.Header,
+	signedHeaders []string,
+	payloadHash string,
+) string {
+	var canonicalHeaders strings.Builder
+	for _, name := range signedHeaders {
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(header.Get(name)) + "\n")
+	}
+
+	canonicalURI := u.EscapedPath()
+	if canonicalURI == "" {
+		canonicalURI = "/"
+	}
+
+	canonicalRequest := strings.Join([]string{
+		method,
+		canonicalURI,
+		canonicalQuery(query),
+		canonicalHeaders.String(),
+		strings.Join(signedHeaders, ";"),
+		payloadHash,
+	}, "\n")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + t.Format(amzDateFormat) + "\n" + s.scope(t) + "\n" +
+		hex.EncodeToString(requestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+s.secretKey), t.Format("20060102"))
+	for _, part := range []string{s.region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// canonicalQuery query sorted by name with names and values encoded as signature version 4 expects
+func canonicalQuery(query url.Values) string {
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	var pairs []string
+	for _, name := range names {
+		for _, v := range query[name] {
+			pairs = append(pairs, uriEncode(name, true)+"="+uriEncode(v, true))
+		}
+	}
+
+	return strings.Join(pairs, "&")
+}
+
+// uriEncode percent encodes everything but unreserved characters, and / unless encodeSlash is set
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' ||
+			c == '-' || c == '_' || c == '.' || c == '~' || c == '/' && !encodeSlash {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+
+	return b.String()
+}
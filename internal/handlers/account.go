@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+type changeUsernameInput struct {
+	Username string
+}
+
+type changeEmailInput struct {
+	Email string
+}
+
+func (h *Handler) changeUsername(w http.ResponseWriter, r *http.Request) {
+	var input changeUsernameInput
+	defer r.Body.Close()
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		respondBadRequest(w, err)
+		return
+	}
+
+	user, err := h.ChangeUsername(r.Context(), input.Username)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respond(w, user, http.StatusOK)
+}
+
+func (h *Handler) changeEmail(w http.ResponseWriter, r *http.Request) {
+	var input changeEmailInput
+	defer r.Body.Close()
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		respondBadRequest(w, err)
+		return
+	}
+
+	if err := h.RequestEmailChange(r.Context(), input.Email); err != nil {
+		respondError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (h *Handler) verifyEmail(w http.ResponseWriter, r *http.Request) {
+	if err := h.VerifyEmailChange(r.Context(), r.URL.Query().Get("code")); err != nil {
+		respondError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) deleteAccount(w http.ResponseWriter, r *http.Request) {
+	out, err := h.DeleteAccount(r.Context())
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respond(w, out, http.StatusAccepted)
+}
+
+func (h *Handler) requestExport(w http.ResponseWriter, r *http.Request) {
+	export, err := h.RequestExport(r.Context())
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respond(w, export, http.StatusAccepted)
+}
+
+func (h *Handler) latestExport(w http.ResponseWriter, r *http.Request) {
+	export, err := h.LatestExport(r.Context())
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respond(w, export, http.StatusOK)
+}
@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"expvar"
+	"net/http"
+)
+
+func (h *Handler) checkCounts(w http.ResponseWriter, r *http.Request) {
+	result, err := h.CheckCounts(r.Context())
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respond(w, result, http.StatusOK)
+}
+
+func (h *Handler) reconcileCounts(w http.ResponseWriter, r *http.Request) {
+	result, err := h.ReconcileCounts(r.Context())
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respond(w, result, http.StatusOK)
+}
+
+// metrics serves expvar variables, counts reconciliation totals among them
+func (h *Handler) metrics(w http.ResponseWriter, r *http.Request) {
+	if err := h.CheckAdmin(r.Context()); err != nil {
+		respondError(w, err)
+		return
+	}
+
+	expvar.Handler().ServeHTTP(w, r)
+}
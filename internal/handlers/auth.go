@@ -3,20 +3,33 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"github.com/matryer/way"
 	"net/http"
+	"net/url"
 	"social/internal/services"
+	"strconv"
 	"strings"
+	"time"
 )
 
 type loginInput struct {
 	Email string
 }
 
+type refreshTokenInput struct {
+	RefreshToken string
+}
+
+type sendMagicLinkInput struct {
+	Email       string
+	RedirectURI string
+}
+
 func (h *Handler) login(w http.ResponseWriter, r *http.Request) {
 	var in loginInput
 	defer r.Body.Close()
 	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		respondBadRequest(w, err)
 		return
 	}
 
@@ -29,6 +42,45 @@ func (h *Handler) login(w http.ResponseWriter, r *http.Request) {
 	respond(w, out, http.StatusOK)
 }
 
+func (h *Handler) sendMagicLink(w http.ResponseWriter, r *http.Request) {
+	var in sendMagicLinkInput
+	defer r.Body.Close()
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		respondBadRequest(w, err)
+		return
+	}
+
+	if err := h.SendMagicLink(r.Context(), in.Email, in.RedirectURI); err != nil {
+		respondError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) authRedirect(w http.ResponseWriter, r *http.Request) {
+	out, redirectURI, err := h.VerifyMagicLink(r.Context(), r.URL.Query().Get("code"))
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	if redirectURI == "" {
+		respond(w, out, http.StatusOK)
+		return
+	}
+
+	// token goes in the fragment so it never reaches server logs of the redirect target
+	f := url.Values{
+		"token":         {out.Token},
+		"expires_at":    {out.ExpiresAt.Format(time.RFC3339Nano)},
+		"refresh_token": {out.RefreshToken},
+		"user.id":       {strconv.FormatInt(out.AuthUser.Id, 10)},
+		"username":      {out.AuthUser.Username},
+	}
+	http.Redirect(w, r, redirectURI+"#"+f.Encode(), http.StatusFound)
+}
+
 func (h *Handler) authUser(w http.ResponseWriter, r *http.Request) {
 	user, err := h.AuthUser(r.Context())
 	if err != nil {
@@ -41,19 +93,100 @@ func (h *Handler) authUser(w http.ResponseWriter, r *http.Request) {
 
 func (h *Handler) withAuth(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		token := r.Header.Get("Authorization")
-		if !strings.HasPrefix(token, "Bearer") {
-			next.ServeHTTP(w, r)
+		ctx := r.Context()
+		ctx = context.WithValue(ctx, services.KeyUserAgent, r.UserAgent())
+		ctx = context.WithValue(ctx, services.KeyRemoteIP, remoteIP(r))
+
+		var (
+			userId    int64
+			sessionId string
+			err       error
+		)
+		if token := r.Header.Get("Authorization"); strings.HasPrefix(token, "Bearer ") {
+			userId, sessionId, err = h.Authorized(ctx, token[7:])
+		} else if token = r.URL.Query().Get("stream_token"); token != "" && acceptsEventStream(r) {
+			// EventSource cannot send Authorization header, streams take short-lived token in the url
+			userId, sessionId, err = h.AuthorizedStream(ctx, token)
+		} else {
+			next.ServeHTTP(w, r.WithContext(ctx))
 			return
 		}
-		result := token[7:]
-		userId, err := h.Authorized(result)
+
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusUnauthorized)
+			respondError(w, err)
 			return
 		}
-		ctx := r.Context()
+
 		ctx = context.WithValue(ctx, services.KeyAuthUserId, userId)
+		ctx = context.WithValue(ctx, services.KeyAuthSessionId, sessionId)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
+
+func (h *Handler) refreshToken(w http.ResponseWriter, r *http.Request) {
+	var in refreshTokenInput
+	defer r.Body.Close()
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		respondBadRequest(w, err)
+		return
+	}
+
+	out, err := h.RefreshToken(r.Context(), in.RefreshToken)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respond(w, out, http.StatusOK)
+}
+
+func (h *Handler) logout(w http.ResponseWriter, r *http.Request) {
+	err := h.Logout(r.Context())
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) streamToken(w http.ResponseWriter, r *http.Request) {
+	out, err := h.StreamToken(r.Context())
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respond(w, out, http.StatusOK)
+}
+
+func (h *Handler) sessions(w http.ResponseWriter, r *http.Request) {
+	result, err := h.Sessions(r.Context())
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respond(w, result, http.StatusOK)
+}
+
+func (h *Handler) revokeSession(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	err := h.RevokeSession(ctx, way.Param(ctx, "sessionId"))
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) revokeSessions(w http.ResponseWriter, r *http.Request) {
+	err := h.RevokeSessions(r.Context())
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"github.com/matryer/way"
+	"net/http"
+	"strconv"
+)
+
+func (h *Handler) toggleBlock(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	out, err := h.ToggleBlock(ctx, way.Param(ctx, "username"))
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respond(w, out, http.StatusOK)
+}
+
+func (h *Handler) toggleMute(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	out, err := h.ToggleMute(ctx, way.Param(ctx, "username"))
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respond(w, out, http.StatusOK)
+}
+
+func (h *Handler) blocks(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	first, _ := strconv.Atoi(q.Get("first"))
+
+	users, err := h.Blocks(r.Context(), first, q.Get("after"))
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respond(w, users, http.StatusOK)
+}
+
+func (h *Handler) mutes(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	first, _ := strconv.Atoi(q.Get("first"))
+
+	users, err := h.Mutes(r.Context(), first, q.Get("after"))
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respond(w, users, http.StatusOK)
+}
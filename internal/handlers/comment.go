@@ -8,21 +8,26 @@ import (
 )
 
 type CreateComment struct {
-	Content string `json:"content"`
+	Content  string `json:"content"`
+	ParentId *int64 `json:"parentId"`
 }
 
 func (h *Handler) createComment(w http.ResponseWriter, r *http.Request) {
 	var input CreateComment
 	defer r.Body.Close()
 	ctx := r.Context()
-	_ = json.NewDecoder(r.Body).Decode(&input)
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		respondBadRequest(w, err)
+		return
+	}
+
 	id, err := strconv.ParseInt(way.Param(ctx, "id"), 10, 64)
 	if err != nil {
-		respondError(w, err)
+		respondError(w, invalidParam("id"))
 		return
 	}
 
-	result, err := h.CreateComment(ctx, input.Content, id)
+	result, err := h.CreateComment(ctx, input.Content, id, input.ParentId)
 	if err != nil {
 		respondError(w, err)
 		return
@@ -31,3 +36,62 @@ func (h *Handler) createComment(w http.ResponseWriter, r *http.Request) {
 	respond(w, result, http.StatusCreated)
 
 }
+
+func (h *Handler) getComments(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	postId, err := strconv.ParseInt(way.Param(ctx, "postId"), 10, 64)
+	if err != nil {
+		respondError(w, invalidParam("postId"))
+		return
+	}
+
+	q := r.URL.Query()
+	last, _ := strconv.Atoi(q.Get("last"))
+	after, _ := strconv.ParseInt(q.Get("after"), 10, 64)
+
+	result, err := h.GetComments(ctx, postId, last, after, q.Get("order"))
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respond(w, result, http.StatusOK)
+}
+
+func (h *Handler) toggleCommentLike(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	commentId, err := strconv.ParseInt(way.Param(ctx, "id"), 10, 64)
+	if err != nil {
+		respondError(w, invalidParam("id"))
+		return
+	}
+
+	result, err := h.ToggleCommentLike(ctx, commentId)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respond(w, result, http.StatusOK)
+}
+
+func (h *Handler) getCommentReplies(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	commentId, err := strconv.ParseInt(way.Param(ctx, "id"), 10, 64)
+	if err != nil {
+		respondError(w, invalidParam("id"))
+		return
+	}
+
+	q := r.URL.Query()
+	last, _ := strconv.Atoi(q.Get("last"))
+	after, _ := strconv.ParseInt(q.Get("after"), 10, 64)
+
+	result, err := h.GetCommentReplies(ctx, commentId, last, after)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respond(w, result, http.StatusOK)
+}
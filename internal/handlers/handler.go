@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"github.com/matryer/way"
+	"io/fs"
 	"net/http"
 	"social/internal/services"
 )
@@ -10,8 +11,14 @@ type Handler struct {
 	*services.Service
 }
 
-// New creates new HTTP handler
-func New(s *services.Service) http.Handler {
+// servedBlobs blob store whose blobs the app serves itself, under Path
+type servedBlobs interface {
+	http.Handler
+	Path() string
+}
+
+// New creates new HTTP handler, static assets of the SPA are served from static unless it is nil
+func New(s *services.Service, static fs.FS) http.Handler {
 	h := &Handler{s}
 
 	api := way.NewRouter()
@@ -21,29 +28,93 @@ func New(s *services.Service) http.Handler {
 	api.HandleFunc("GET", "/users/follows", h.getFollows)
 	api.HandleFunc("GET", "/users", h.getUserProfiles)
 	api.HandleFunc("POST", "/users/:username/toggle_follow", h.toggleFollow)
+	api.HandleFunc("POST", "/users/:username/toggle_block", h.toggleBlock)
+	api.HandleFunc("POST", "/users/:username/toggle_mute", h.toggleMute)
 	api.HandleFunc("POST", "/users", h.createUser)
 
 	// Auth routes
 	api.HandleFunc("GET", "/auth_user", h.authUser)
 	api.HandleFunc("POST", "/login", h.login)
+	api.HandleFunc("POST", "/send_magic_link", h.sendMagicLink)
+	api.HandleFunc("GET", "/auth_redirect", h.authRedirect)
+	api.HandleFunc("POST", "/refresh_token", h.refreshToken)
+	api.HandleFunc("POST", "/logout", h.logout)
+	api.HandleFunc("POST", "/auth_user/stream_token", h.streamToken)
+	api.HandleFunc("GET", "/auth_user/sessions", h.sessions)
+	api.HandleFunc("DELETE", "/auth_user/sessions", h.revokeSessions)
+	api.HandleFunc("DELETE", "/auth_user/sessions/:sessionId", h.revokeSession)
+	api.HandleFunc("GET", "/verify_email", h.verifyEmail)
+	api.HandleFunc("DELETE", "/auth_user", h.deleteAccount)
+	api.HandleFunc("POST", "/auth_user/export", h.requestExport)
+	api.HandleFunc("GET", "/auth_user/export", h.latestExport)
+	api.HandleFunc("GET", "/auth_user/blocks", h.blocks)
+	api.HandleFunc("GET", "/auth_user/mutes", h.mutes)
 
 	// Posts routes
 	api.HandleFunc("POST", "/posts", h.createPost)
 	api.HandleFunc("GET", "/posts", h.getPosts)
+	api.HandleFunc("GET", "/posts/me", h.getMyPosts)
 	api.HandleFunc("GET", "/posts/:postId", h.getPostById)
+	api.HandleFunc("PATCH", "/posts/:postId", h.updatePost)
+	api.HandleFunc("DELETE", "/posts/:postId", h.deletePost)
+	api.HandleFunc("GET", "/posts/:postId/revisions", h.getPostRevisions)
 	api.HandleFunc("GET", "/posts/users/:id", h.getPostsForUser)
-	api.HandleFunc("GET", "/posts/me", h.getMyPosts)
 	api.HandleFunc("Post", "/posts/:postId/like", h.togglePostLike)
+	api.HandleFunc("POST", "/posts/:postId/repost", h.togglePostRepost)
+
+	// Media routes
+	api.HandleFunc("POST", "/media", h.uploadMedia)
+
+	// Search routes
+	api.HandleFunc("GET", "/search/posts", h.searchPosts)
+
+	// Hashtag routes
+	api.HandleFunc("GET", "/tags/trending", h.trendingHashtags)
+	api.HandleFunc("GET", "/tags/:tag/posts", h.hashtagPosts)
+
+	// Timeline routes
+	api.HandleFunc("GET", "/timeline", h.timeline)
+
+	// Notification routes
+	api.HandleFunc("GET", "/notifications", h.notifications)
+	api.HandleFunc("GET", "/notifications/unread_count", h.unreadNotificationsCount)
+	api.HandleFunc("POST", "/notifications/:notificationId/mark_as_read", h.markNotificationAsRead)
+	api.HandleFunc("POST", "/mark_notifications_as_read", h.markNotificationsAsRead)
+
+	// Mention routes
+	api.HandleFunc("GET", "/mentions", h.mentions)
 
 	// Comment routes
 
 	api.HandleFunc("POST", "/comment/:id", h.createComment)
+	api.HandleFunc("GET", "/posts/:postId/comments", h.getComments)
+	api.HandleFunc("POST", "/comments/:id/toggle_like", h.toggleCommentLike)
+	api.HandleFunc("GET", "/comments/:id/replies", h.getCommentReplies)
 
 	// Patch Methods
+	api.HandleFunc("PATCH", "/auth_user", h.updateProfile)
 	api.HandleFunc("PATCH", "/auth_user/avatar", h.updateAvatar)
+	api.HandleFunc("PATCH", "/auth_user/cover", h.updateCover)
+	api.HandleFunc("PATCH", "/auth_user/username", h.changeUsername)
+	api.HandleFunc("PATCH", "/auth_user/email", h.changeEmail)
+
+	// Admin routes
+	api.HandleFunc("GET", "/admin/counts", h.checkCounts)
+	api.HandleFunc("POST", "/admin/counts/reconcile", h.reconcileCounts)
+	api.HandleFunc("GET", "/admin/metrics", h.metrics)
 
 	r := way.NewRouter()
 	r.Handle("*", "/api...", http.StripPrefix("/api", h.withAuth(api)))
+	// static files under the path of blobs are never served, private blobs among them least of all
+	var blobsPath string
+	if blobs, ok := s.Blobs.(servedBlobs); ok && blobs.Path() != "" {
+		blobsPath = blobs.Path()
+		r.Handle("*", blobsPath+"/...", blobs)
+	}
+
+	if static != nil {
+		r.NotFound = newStaticHandler(static, blobsPath)
+	}
 
 	return r
 }
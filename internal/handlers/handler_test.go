@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"context"
+	"github.com/hako/branca"
+	"net/http"
+	"net/http/httptest"
+	"social/internal/blob"
+	"social/internal/mailing"
+	"social/internal/services"
+	"social/internal/store"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestBlobRoutes(t *testing.T) {
+	blobs := blob.NewFSStore(t.TempDir(), "http://localhost/img", []byte("secret"))
+	blobs.Private = []string{services.ExportsPrefix}
+	s := services.New(store.NewMemory(), branca.NewBranca("YEk9b2KT7Hv6bYuthSzckXKkqkYZawhq"), "http://localhost",
+		&mailing.LogMailer{From: "noreply@localhost", Dir: t.TempDir()}, blobs)
+
+	ctx := context.Background()
+	for _, key := range []string{services.ExportsPrefix + "a.zip", "avatars/a.png"} {
+		if err := blobs.Put(ctx, key, strings.NewReader("data"), ""); err != nil {
+			t.Fatalf("could not put %s: %v", key, err)
+		}
+	}
+
+	signed, err := blobs.SignedURL(services.ExportsPrefix+"a.zip", time.Minute)
+	if err != nil {
+		t.Fatalf("could not sign url: %v", err)
+	}
+
+	// blobs left among static files by an older setup must not leak through the static handler
+	static := fstest.MapFS{
+		"index.html": {Data: []byte("<html>")},
+		"img/" + services.ExportsPrefix + "b.zip": {Data: []byte("stale export")},
+		"img/avatars/b.png":                       {Data: []byte("stale avatar")},
+	}
+	h := New(s, static)
+
+	tt := []struct {
+		target string
+		status int
+	}{
+		{target: "/img/" + services.ExportsPrefix + "a.zip", status: http.StatusForbidden},
+		{target: "/img/" + services.ExportsPrefix + "a.zip?expires=9999999999&signature=forged", status: http.StatusForbidden},
+		{target: "/img/" + services.ExportsPrefix + "b.zip", status: http.StatusForbidden},
+		{target: "/img/avatars/b.png", status: http.StatusNotFound},
+		{target: strings.TrimPrefix(signed, "http://localhost"), status: http.StatusOK},
+		{target: "/img/avatars/a.png", status: http.StatusOK},
+		{target: "/", status: http.StatusOK},
+	}
+	for _, tc := range tt {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tc.target, nil))
+		if rec.Code != tc.status {
+			t.Errorf("GET %s: want %d, got %d", tc.target, tc.status, rec.Code)
+		}
+
+		if strings.Contains(rec.Body.String(), "stale") {
+			t.Errorf("GET %s: want static copy of blob never served", tc.target)
+		}
+	}
+}
+
+func TestStaticHandlerHidden(t *testing.T) {
+	h := newStaticHandler(fstest.MapFS{
+		"index.html":        {Data: []byte("<html>")},
+		"app.js":            {Data: []byte("app")},
+		"img/exports/a.zip": {Data: []byte("export")},
+		"imgs/logo.png":     {Data: []byte("logo")},
+		".env":              {Data: []byte("secret")},
+		"assets/.hidden.js": {Data: []byte("hidden")},
+	}, "/img/")
+
+	tt := []struct {
+		target string
+		status int
+	}{
+		{target: "/app.js", status: http.StatusOK},
+		{target: "/imgs/logo.png", status: http.StatusOK},
+		{target: "/img/exports/a.zip", status: http.StatusNotFound},
+		{target: "/img/../img/exports/a.zip", status: http.StatusNotFound},
+		{target: "/.env", status: http.StatusNotFound},
+		{target: "/assets/.hidden.js", status: http.StatusNotFound},
+	}
+	for _, tc := range tt {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tc.target, nil))
+		if rec.Code != tc.status {
+			t.Errorf("GET %s: want %d, got %d", tc.target, tc.status, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package handlers
+
+import (
+	"github.com/matryer/way"
+	"net/http"
+	"strconv"
+)
+
+func (h *Handler) hashtagPosts(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	q := r.URL.Query()
+	last, _ := strconv.Atoi(q.Get("last"))
+	before, _ := strconv.ParseInt(q.Get("before"), 10, 64)
+
+	result, err := h.HashtagPosts(ctx, way.Param(ctx, "tag"), last, before)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respond(w, result, http.StatusOK)
+}
+
+func (h *Handler) trendingHashtags(w http.ResponseWriter, r *http.Request) {
+	result, err := h.TrendingHashtags(r.Context(), r.URL.Query().Get("window"))
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respond(w, result, http.StatusOK)
+}
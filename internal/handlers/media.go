@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"net/http"
+	"social/internal/services"
+)
+
+// maxMediaFormBytes the image plus room for the rest of the multipart form
+const maxMediaFormBytes = services.MaxMediaBytes + 1<<20
+
+func (h *Handler) uploadMedia(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxMediaFormBytes)
+	if err := r.ParseMultipartForm(maxMediaFormBytes); err != nil {
+		respondBadRequest(w, err)
+		return
+	}
+
+	defer r.MultipartForm.RemoveAll()
+
+	f, _, err := r.FormFile("file")
+	if err != nil {
+		respondBadRequest(w, err)
+		return
+	}
+
+	defer f.Close()
+
+	result, err := h.UploadMedia(r.Context(), f, r.FormValue("alt"))
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respond(w, result, http.StatusCreated)
+}
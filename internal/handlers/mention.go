@@ -0,0 +1,19 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+)
+
+func (h *Handler) mentions(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	last, _ := strconv.Atoi(q.Get("last"))
+
+	result, err := h.Mentions(r.Context(), last, q.Get("before"))
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respond(w, result, http.StatusOK)
+}
@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"fmt"
+	"github.com/matryer/way"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type unreadNotificationsOutput struct {
+	Count int `json:"count"`
+}
+
+func (h *Handler) notifications(w http.ResponseWriter, r *http.Request) {
+	if acceptsEventStream(r) {
+		h.subscribeToNotifications(w, r)
+		return
+	}
+
+	ctx := r.Context()
+	q := r.URL.Query()
+	last, _ := strconv.Atoi(q.Get("last"))
+	before, _ := strconv.ParseInt(q.Get("before"), 10, 64)
+
+	result, err := h.Notifications(ctx, last, before)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respond(w, result, http.StatusOK)
+}
+
+func (h *Handler) unreadNotificationsCount(w http.ResponseWriter, r *http.Request) {
+	count, err := h.UnreadNotificationsCount(r.Context())
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respond(w, unreadNotificationsOutput{Count: count}, http.StatusOK)
+}
+
+func (h *Handler) markNotificationAsRead(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	notificationId, err := strconv.ParseInt(way.Param(ctx, "notificationId"), 10, 64)
+	if err != nil {
+		respondError(w, invalidParam("notificationId"))
+		return
+	}
+
+	err = h.MarkNotificationAsRead(ctx, notificationId)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) markNotificationsAsRead(w http.ResponseWriter, r *http.Request) {
+	err := h.MarkNotificationsAsRead(r.Context())
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) subscribeToNotifications(w http.ResponseWriter, r *http.Request) {
+	f, ok := w.(http.Flusher)
+	if !ok {
+		respondError(w, fmt.Errorf("streaming unsupported"))
+		return
+	}
+
+	ctx := r.Context()
+	nn, err := h.SubscribeToNotifications(ctx)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	startEventStream(w)
+	f.Flush()
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case n, ok := <-nn:
+			if !ok {
+				return
+			}
+
+			if err = writeEvent(w, n.Id, n); err != nil {
+				log.Printf("could not write notification event: %v", err)
+				return
+			}
+			f.Flush()
+		case <-heartbeat.C:
+			if _, err = fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+			f.Flush()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -11,16 +11,24 @@ type createPostInput struct {
 	Content   string
 	SpoilerOf *string
 	NSFW      bool
+	QuoteOf   *int64
+	Media     []int64
+}
+
+type updatePostInput struct {
+	Content   string
+	SpoilerOf *string
+	NSFW      bool
 }
 
 func (h *Handler) createPost(w http.ResponseWriter, r *http.Request) {
 	var input createPostInput
 	defer r.Body.Close()
 	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
-		respondError(w, err)
+		respondBadRequest(w, err)
 		return
 	}
-	result, err := h.CreatePost(r.Context(), input.Content, input.SpoilerOf, input.NSFW)
+	result, err := h.CreatePost(r.Context(), input.Content, input.SpoilerOf, input.NSFW, input.QuoteOf, input.Media)
 	if err != nil {
 		respondError(w, err)
 		return
@@ -32,6 +40,10 @@ func (h *Handler) createPost(w http.ResponseWriter, r *http.Request) {
 func (h *Handler) togglePostLike(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	postId, err := strconv.ParseInt(way.Param(ctx, "postId"), 10, 64)
+	if err != nil {
+		respondError(w, invalidParam("postId"))
+		return
+	}
 
 	result, err := h.TogglePostLike(ctx, postId)
 	if err != nil {
@@ -43,9 +55,30 @@ func (h *Handler) togglePostLike(w http.ResponseWriter, r *http.Request) {
 
 }
 
+func (h *Handler) togglePostRepost(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	postId, err := strconv.ParseInt(way.Param(ctx, "postId"), 10, 64)
+	if err != nil {
+		respondError(w, invalidParam("postId"))
+		return
+	}
+
+	result, err := h.TogglePostRepost(ctx, postId)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respond(w, result, http.StatusOK)
+}
+
 func (h *Handler) getPostsForUser(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	userId, err := strconv.ParseInt(way.Param(ctx, "id"), 10, 64)
+	if err != nil {
+		respondError(w, invalidParam("id"))
+		return
+	}
 
 	result, err := h.GetPostsByUserId(ctx, userId)
 	if err != nil {
@@ -60,6 +93,10 @@ func (h *Handler) getPostsForUser(w http.ResponseWriter, r *http.Request) {
 func (h *Handler) getPostById(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	postId, err := strconv.ParseInt(way.Param(ctx, "postId"), 10, 64)
+	if err != nil {
+		respondError(w, invalidParam("postId"))
+		return
+	}
 
 	result, err := h.GetPostById(ctx, postId)
 	if err != nil {
@@ -94,3 +131,60 @@ func (h *Handler) getMyPosts(w http.ResponseWriter, r *http.Request) {
 	respond(w, result, http.StatusOK)
 
 }
+
+func (h *Handler) updatePost(w http.ResponseWriter, r *http.Request) {
+	var input updatePostInput
+	defer r.Body.Close()
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		respondBadRequest(w, err)
+		return
+	}
+
+	ctx := r.Context()
+	postId, err := strconv.ParseInt(way.Param(ctx, "postId"), 10, 64)
+	if err != nil {
+		respondError(w, invalidParam("postId"))
+		return
+	}
+
+	result, err := h.UpdatePost(ctx, postId, input.Content, input.SpoilerOf, input.NSFW)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respond(w, result, http.StatusOK)
+}
+
+func (h *Handler) deletePost(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	postId, err := strconv.ParseInt(way.Param(ctx, "postId"), 10, 64)
+	if err != nil {
+		respondError(w, invalidParam("postId"))
+		return
+	}
+
+	if err = h.DeletePost(ctx, postId); err != nil {
+		respondError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) getPostRevisions(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	postId, err := strconv.ParseInt(way.Param(ctx, "postId"), 10, 64)
+	if err != nil {
+		respondError(w, invalidParam("postId"))
+		return
+	}
+
+	result, err := h.GetPostRevisions(ctx, postId)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respond(w, result, http.StatusOK)
+}
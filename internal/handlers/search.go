@@ -0,0 +1,29 @@
+package handlers
+
+import (
+	"net/http"
+	"social/internal/services"
+	"strconv"
+)
+
+func (h *Handler) searchPosts(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	first, _ := strconv.Atoi(q.Get("first"))
+
+	result, err := h.SearchPosts(r.Context(), services.SearchPostsInput{
+		Query:       q.Get("q"),
+		Author:      q.Get("author"),
+		From:        q.Get("from"),
+		To:          q.Get("to"),
+		Spoiler:     q.Get("spoiler"),
+		ExcludeNSFW: q.Get("exclude_nsfw") == "true",
+		First:       first,
+		After:       q.Get("after"),
+	})
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respond(w, result, http.StatusOK)
+}
@@ -0,0 +1,231 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// staticTypes content types of assets mime.TypeByExtension may not know about
+var staticTypes = map[string]string{
+	".ico":         "image/x-icon",
+	".map":         "application/json",
+	".webmanifest": "application/manifest+json",
+	".woff":        "font/woff",
+	".woff2":       "font/woff2",
+}
+
+// staticEncodings precompressed variants, by suffix of their files, in order of preference
+var staticEncodings = []struct {
+	suffix, encoding string
+}{
+	{".br", "br"},
+	{".gz", "gzip"},
+}
+
+// staticHandler serves files of fsys. Html is revalidated on every request while other assets are
+// expected to have content hashes in their names and are cached for a year, both carry ETag and
+// Last-Modified when fsys has mod times. Precompressed .br and .gz variants are served to clients
+// accepting them, and paths without extension matching no file get index.html for the SPA to route.
+// Files under hidden directories are never served, blobs left there would be cached publicly
+type staticHandler struct {
+	fsys   fs.FS
+	hidden []string
+
+	mu    sync.Mutex
+	etags map[string]staticETag
+}
+
+// staticETag ETag of file as of its mod time and size
+type staticETag struct {
+	modTime time.Time
+	size    int64
+	etag    string
+}
+
+func newStaticHandler(fsys fs.FS, hidden ...string) *staticHandler {
+	h := &staticHandler{fsys: fsys, etags: map[string]staticETag{}}
+	for _, dir := range hidden {
+		if dir = strings.Trim(path.Clean("/"+dir), "/"); dir != "" {
+			h.hidden = append(h.hidden, dir)
+		}
+	}
+
+	return h
+}
+
+func (h *staticHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+	if name == "" {
+		name = "index.html"
+	}
+
+	f, info, err := h.open(name)
+	if err != nil && path.Ext(name) == "" {
+		name = "index.html"
+		f, info, err = h.open(name)
+	}
+
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	defer f.Close()
+
+	contentType := staticTypes[path.Ext(name)]
+	if contentType == "" {
+		contentType = mime.TypeByExtension(path.Ext(name))
+	}
+
+	w.Header().Add("Vary", "Accept-Encoding")
+	served := name
+	for _, e := range staticEncodings {
+		if !acceptsEncoding(r, e.encoding) {
+			continue
+		}
+
+		cf, cinfo, err := h.open(name + e.suffix)
+		if err != nil {
+			continue
+		}
+
+		defer cf.Close()
+		f, info, served = cf, cinfo, name+e.suffix
+		w.Header().Set("Content-Encoding", e.encoding)
+		// sniffing compressed bytes would get it wrong
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		break
+	}
+
+	if contentType != "" {
+		w.Header().Set("Content-Type", contentType)
+	}
+
+	if path.Ext(name) == ".html" {
+		w.Header().Set("Cache-Control", "no-cache")
+	} else {
+		w.Header().Set("Cache-Control", "public, max-age=31536000")
+	}
+
+	content, ok := f.(io.ReadSeeker)
+	if !ok {
+		b, err := io.ReadAll(f)
+		if err != nil {
+			respondError(w, err)
+			return
+		}
+
+		content = bytes.NewReader(b)
+	}
+
+	etag, err := h.etag(served, info, content)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	w.Header().Set("ETag", etag)
+	http.ServeContent(w, r, name, info.ModTime(), content)
+}
+
+// open opens regular file that is not hidden
+func (h *staticHandler) open(name string) (fs.File, fs.FileInfo, error) {
+	for _, segment := range strings.Split(name, "/") {
+		if strings.HasPrefix(segment, ".") {
+			return nil, nil, fs.ErrNotExist
+		}
+	}
+
+	for _, dir := range h.hidden {
+		if strings.HasPrefix(name, dir+"/") {
+			return nil, nil, fs.ErrNotExist
+		}
+	}
+
+	f, err := h.fsys.Open(name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+
+	if !info.Mode().IsRegular() {
+		f.Close()
+		return nil, nil, fs.ErrNotExist
+	}
+
+	return f, info, nil
+}
+
+// etag hash of content of file with name, remembered until the file changes
+func (h *staticHandler) etag(name string, info fs.FileInfo, content io.ReadSeeker) (string, error) {
+	h.mu.Lock()
+	cached, ok := h.etags[name]
+	h.mu.Unlock()
+	if ok && cached.modTime.Equal(info.ModTime()) && cached.size == info.Size() {
+		return cached.etag, nil
+	}
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, content); err != nil {
+		return "", err
+	}
+
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+
+	etag := strconv.Quote(hex.EncodeToString(hash.Sum(nil)[:16]))
+	h.mu.Lock()
+	h.etags[name] = staticETag{modTime: info.ModTime(), size: info.Size(), etag: etag}
+	h.mu.Unlock()
+
+	return etag, nil
+}
+
+// acceptsEncoding tells whether Accept-Encoding of r lists encoding without q=0
+func acceptsEncoding(r *http.Request, encoding string) bool {
+	for _, header := range r.Header.Values("Accept-Encoding") {
+		for _, part := range strings.Split(header, ",") {
+			fields := strings.Split(part, ";")
+			if strings.TrimSpace(fields[0]) != encoding {
+				continue
+			}
+
+			accepted := true
+			for _, param := range fields[1:] {
+				param = strings.ReplaceAll(param, " ", "")
+				if strings.HasPrefix(param, "q=") {
+					q, err := strconv.ParseFloat(strings.TrimPrefix(param, "q="), 64)
+					accepted = err == nil && q > 0
+				}
+			}
+
+			return accepted
+		}
+	}
+
+	return false
+}
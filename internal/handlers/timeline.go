@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// heartbeatInterval keeps idle event streams from being closed by proxies
+const heartbeatInterval = time.Second * 30
+
+func (h *Handler) timeline(w http.ResponseWriter, r *http.Request) {
+	if acceptsEventStream(r) {
+		h.subscribeToTimeline(w, r)
+		return
+	}
+
+	ctx := r.Context()
+	q := r.URL.Query()
+	last, _ := strconv.Atoi(q.Get("last"))
+	before, _ := strconv.ParseInt(q.Get("before"), 10, 64)
+
+	result, err := h.Timeline(ctx, last, before)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respond(w, result, http.StatusOK)
+}
+
+func (h *Handler) subscribeToTimeline(w http.ResponseWriter, r *http.Request) {
+	f, ok := w.(http.Flusher)
+	if !ok {
+		respondError(w, fmt.Errorf("streaming unsupported"))
+		return
+	}
+
+	ctx := r.Context()
+	lastEventId, _ := strconv.ParseInt(r.Header.Get("Last-Event-ID"), 10, 64)
+
+	tt, err := h.SubscribeToTimeline(ctx, lastEventId)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	startEventStream(w)
+	f.Flush()
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case item, ok := <-tt:
+			if !ok {
+				return
+			}
+
+			if err = writeEvent(w, item.Id, item); err != nil {
+				log.Printf("could not write timeline event: %v", err)
+				return
+			}
+			f.Flush()
+		case <-heartbeat.C:
+			if _, err = fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+			f.Flush()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
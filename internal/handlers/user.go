@@ -12,18 +12,27 @@ type createUserInput struct {
 	Email, Username string
 }
 
+// updateProfileInput fields left out of the body stay as they are
+type updateProfileInput struct {
+	DisplayName *string
+	Bio         *string
+	Location    *string
+	Website     *string
+	Pronouns    *string
+}
+
 func (h *Handler) createUser(w http.ResponseWriter, r *http.Request) {
 	var input createUserInput
 	defer r.Body.Close()
 	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		respondBadRequest(w, err)
 		return
 	}
 
 	err := h.CreateUser(r.Context(), input.Email, input.Username)
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		respondError(w, err)
 		return
 	}
 
@@ -41,7 +50,6 @@ func (h *Handler) toggleFollow(w http.ResponseWriter, r *http.Request) {
 		respondError(w, err)
 		return
 	}
-	w.WriteHeader(http.StatusOK)
 	respond(w, out, http.StatusOK)
 }
 
@@ -125,3 +133,39 @@ func (h *Handler) updateAvatar(w http.ResponseWriter, r *http.Request) {
 	}
 	respond(w, avatarUrl, http.StatusOK)
 }
+
+func (h *Handler) updateProfile(w http.ResponseWriter, r *http.Request) {
+	var input updateProfileInput
+	defer r.Body.Close()
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		respondBadRequest(w, err)
+		return
+	}
+
+	profile, err := h.UpdateProfile(r.Context(), services.UpdateProfileInput{
+		DisplayName: input.DisplayName,
+		Bio:         input.Bio,
+		Location:    input.Location,
+		Website:     input.Website,
+		Pronouns:    input.Pronouns,
+	})
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respond(w, profile, http.StatusOK)
+}
+
+func (h *Handler) updateCover(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, services.MaxCoverBytes)
+	defer r.Body.Close()
+
+	coverUrl, err := h.UpdateCover(r.Context(), r.Body)
+	if err != nil {
+		respondError(w, err)
+		return
+	}
+
+	respond(w, coverUrl, http.StatusOK)
+}
@@ -2,11 +2,22 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"net"
 	"net/http"
+	"social/internal/services"
+	"strings"
 )
 
+type errorOutput struct {
+	Code    string            `json:"code"`
+	Message string            `json:"message"`
+	Fields  map[string]string `json:"fields,omitempty"`
+}
+
 func respond(w http.ResponseWriter, v interface{}, statusCode int) {
 	b, err := json.Marshal(v)
 	if err != nil {
@@ -15,11 +26,76 @@ func respond(w http.ResponseWriter, v interface{}, statusCode int) {
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
+	w.WriteHeader(statusCode)
 	w.Write(b)
 }
 
+// respondError maps service errors to status codes, internal errors are logged and never exposed
 func respondError(w http.ResponseWriter, err error) {
-	log.Println(err)
-	http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	out := errorOutput{Message: err.Error()}
+	var statusCode int
+	switch {
+	case errors.Is(err, services.ErrUnauthenticated):
+		statusCode, out.Code = http.StatusUnauthorized, "unauthenticated"
+	case errors.Is(err, services.ErrNotFound):
+		statusCode, out.Code = http.StatusNotFound, "not_found"
+	case errors.Is(err, services.ErrInvalidInput):
+		statusCode, out.Code = http.StatusUnprocessableEntity, "invalid_input"
+		var invalidInput *services.InvalidInputError
+		if errors.As(err, &invalidInput) {
+			out.Fields = invalidInput.Fields
+		}
+	case errors.Is(err, services.ErrForbidden):
+		statusCode, out.Code = http.StatusForbidden, "forbidden"
+	case errors.Is(err, services.ErrConflict):
+		statusCode, out.Code = http.StatusConflict, "conflict"
+	default:
+		log.Println(err)
+		statusCode, out.Code = http.StatusInternalServerError, "internal"
+		out.Message = http.StatusText(http.StatusInternalServerError)
+	}
+
+	respond(w, out, statusCode)
+}
+
+// respondBadRequest responds to request that could not be read at all, e.g. malformed json body
+func respondBadRequest(w http.ResponseWriter, err error) {
+	respond(w, errorOutput{Code: "bad_request", Message: err.Error()}, http.StatusBadRequest)
+}
+
+// invalidParam reports path parameter that is not a valid id
+func invalidParam(name string) error {
+	return &services.InvalidInputError{Fields: map[string]string{name: "must be a number"}}
+}
+
+// acceptsEventStream tells whether client asks for server-sent events, as EventSource does
+func acceptsEventStream(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+}
+
+func startEventStream(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+}
+
+func writeEvent(w io.Writer, id int64, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("could not marshal event: %v", err)
+	}
+
+	_, err = fmt.Fprintf(w, "id: %d\ndata: %s\n\n", id, b)
+	return err
+}
+
+// remoteIP client address without port, proxy headers are not trusted
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
 }
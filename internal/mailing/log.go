@@ -0,0 +1,37 @@
+package mailing
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"strconv"
+	"time"
+)
+
+// LogMailer logs messages instead of sending them, when Dir is set each message
+// is also written to it as .eml file so it can be inspected locally or in tests,
+// it is meant for development only as logged messages carry working login links
+type LogMailer struct {
+	From string
+	Dir  string
+}
+
+func (m *LogMailer) Send(to, subject, html, text string) error {
+	log.Printf("mail to %s, subject %q:\n%s", to, subject, text)
+	if m.Dir == "" {
+		return nil
+	}
+
+	msg, err := buildMessage(m.From, to, subject, html, text)
+	if err != nil {
+		return err
+	}
+
+	name := strconv.FormatInt(time.Now().UnixNano(), 10) + ".eml"
+	if err = os.WriteFile(path.Join(m.Dir, name), msg, 0644); err != nil {
+		return fmt.Errorf("could not write mail file: %v", err)
+	}
+
+	return nil
+}
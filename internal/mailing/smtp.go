@@ -0,0 +1,41 @@
+package mailing
+
+import (
+	"fmt"
+	"net"
+	"net/smtp"
+	"strconv"
+)
+
+// SMTPMailer sends messages through SMTP server
+type SMTPMailer struct {
+	from string
+	addr string
+	auth smtp.Auth
+}
+
+// NewSMTPMailer creates mailer for the server at host:port, auth is skipped when username is empty
+func NewSMTPMailer(from, host string, port int, username, password string) *SMTPMailer {
+	m := &SMTPMailer{
+		from: from,
+		addr: net.JoinHostPort(host, strconv.Itoa(port)),
+	}
+	if username != "" {
+		m.auth = smtp.PlainAuth("", username, password, host)
+	}
+
+	return m
+}
+
+func (m *SMTPMailer) Send(to, subject, html, text string) error {
+	msg, err := buildMessage(m.from, to, subject, html, text)
+	if err != nil {
+		return err
+	}
+
+	if err = smtp.SendMail(m.addr, m.auth, m.from, []string{to}, msg); err != nil {
+		return fmt.Errorf("could not send mail: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,417 @@
+// Package migrate applies numbered sql migrations and keeps track of the applied version
+// in schema_migrations table, the same table golang-migrate uses, databases whose schema
+// was set up by hand with psql before that get their version recorded on the first run
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// lockKey key of the advisory lock held while migrating, so instances starting at once take turns
+const lockKey = 7418529630
+
+var rxMigrationFile = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+// ErrDirty returned when previous migration failed, version of the failed migration is recorded as dirty,
+// the schema has to be checked by hand and Force'd to the version it is actually at
+var ErrDirty = errors.New("database is dirty, fix it and force the version")
+
+// Migration single schema change
+type Migration struct {
+	Version uint
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status version of the database and every known migration
+type Status struct {
+	Version    uint
+	Dirty      bool
+	Migrations []MigrationStatus
+}
+
+// MigrationStatus tells whether migration is applied
+type MigrationStatus struct {
+	Version uint   `json:"version"`
+	Name    string `json:"name"`
+	Applied bool   `json:"applied"`
+}
+
+// Migrator runs migrations against db
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+}
+
+// New reads migrations from fsys, every version needs both up and down file
+func New(db *sql.DB, fsys fs.FS) (*Migrator, error) {
+	files, err := fs.Glob(fsys, "*.sql")
+	if err != nil {
+		return nil, fmt.Errorf("could not list migrations, %v", err)
+	}
+
+	byVersion := map[uint]*Migration{}
+	// files seen per version, down file may be empty
+	seen := map[uint]map[string]bool{}
+	for _, file := range files {
+		match := rxMigrationFile.FindStringSubmatch(path.Base(file))
+		if match == nil {
+			return nil, fmt.Errorf("bad migration file name %q", file)
+		}
+
+		version, err := strconv.ParseUint(match[1], 10, 64)
+		if err != nil || version == 0 {
+			return nil, fmt.Errorf("bad migration version in %q", file)
+		}
+
+		b, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, fmt.Errorf("could not read migration %q, %v", file, err)
+		}
+
+		m, ok := byVersion[uint(version)]
+		if !ok {
+			m = &Migration{Version: uint(version), Name: match[2]}
+			byVersion[m.Version] = m
+			seen[m.Version] = map[string]bool{}
+		}
+
+		if m.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has two names, %q and %q", m.Version, m.Name, match[2])
+		}
+
+		seen[m.Version][match[3]] = true
+		if match[3] == "up" {
+			m.Up = string(b)
+		} else {
+			m.Down = string(b)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if !seen[m.Version]["up"] || !seen[m.Version]["down"] {
+			return nil, fmt.Errorf("migration %d %s needs both up and down file", m.Version, m.Name)
+		}
+
+		migrations = append(migrations, *m)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return &Migrator{db: db, migrations: migrations}, nil
+}
+
+// Latest version of the newest migration
+func (m *Migrator) Latest() uint {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// Up applies every pending migration
+func (m *Migrator) Up(ctx context.Context) error {
+	return m.Goto(ctx, m.Latest())
+}
+
+// Down reverts given number of the most recently applied migrations
+func (m *Migrator) Down(ctx context.Context, steps int) error {
+	return m.withLock(ctx, func(conn *sql.Conn) error {
+		current, err := m.current(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		target := current
+		for i := len(m.migrations) - 1; i >= 0 && steps > 0; i-- {
+			if m.migrations[i].Version <= target {
+				target = m.previous(m.migrations[i].Version)
+				steps--
+			}
+		}
+
+		return m.migrate(ctx, conn, current, target)
+	})
+}
+
+// Goto migrates up or down to version, 0 reverts every migration
+func (m *Migrator) Goto(ctx context.Context, version uint) error {
+	if version != 0 && m.index(version) < 0 {
+		return fmt.Errorf("no migration with version %d", version)
+	}
+
+	return m.withLock(ctx, func(conn *sql.Conn) error {
+		current, err := m.current(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		return m.migrate(ctx, conn, current, version)
+	})
+}
+
+// Force sets version without running any migration and clears dirty flag,
+// use it to adopt database migrated by hand or to recover from failed migration
+func (m *Migrator) Force(ctx context.Context, version uint) error {
+	if version != 0 && m.index(version) < 0 {
+		return fmt.Errorf("no migration with version %d", version)
+	}
+
+	return m.withLock(ctx, func(conn *sql.Conn) error {
+		return setVersion(ctx, conn, version, false)
+	})
+}
+
+// Status reports version of the database and which migrations are applied
+func (m *Migrator) Status(ctx context.Context) (Status, error) {
+	var status Status
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		var err error
+		status.Version, status.Dirty, err = version(ctx, conn)
+		return err
+	})
+	if err != nil {
+		return status, err
+	}
+
+	for _, migration := range m.migrations {
+		status.Migrations = append(status.Migrations, MigrationStatus{
+			Version: migration.Version,
+			Name:    migration.Name,
+			Applied: migration.Version <= status.Version,
+		})
+	}
+
+	return status, nil
+}
+
+// withLock runs fn on a connection holding the migrations advisory lock
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("could not get connection, %v", err)
+	}
+
+	defer conn.Close()
+
+	if _, err = conn.ExecContext(ctx, "select pg_advisory_lock($1)", lockKey); err != nil {
+		return fmt.Errorf("could not acquire migrations lock, %v", err)
+	}
+
+	defer func() {
+		// background ctx so lock is released even when ctx is done
+		if _, err := conn.ExecContext(context.Background(), "select pg_advisory_unlock($1)", lockKey); err != nil {
+			log.Printf("could not release migrations lock, %v", err)
+		}
+	}()
+
+	query := "create table if not exists schema_migrations (version bigint not null primary key, dirty boolean not null)"
+	if _, err = conn.ExecContext(ctx, query); err != nil {
+		return fmt.Errorf("could not create schema_migrations table, %v", err)
+	}
+
+	if err = m.baseline(ctx, conn); err != nil {
+		return err
+	}
+
+	return fn(conn)
+}
+
+// legacyProbes tell the last of the migrations applied by hand with psql before versions were tracked,
+// newest first, each query selects whether the schema has what the migration added
+var legacyProbes = []struct {
+	version uint
+	query   string
+}{
+	{5, "select to_regclass('public.comments') is not null"},
+	{4, "select to_regclass('public.post_likes') is not null"},
+	{3, "select to_regclass('public.posts') is not null"},
+	{2, `select exists (select 1 from information_schema.columns
+		where table_schema = 'public' and table_name = 'users' and column_name = 'avatar_url')`},
+	{1, "select to_regclass('public.users') is not null"},
+}
+
+// baseline records version of database whose schema was set up by hand, so its migrations are not applied again
+func (m *Migrator) baseline(ctx context.Context, conn *sql.Conn) error {
+	var tracked bool
+	if err := conn.QueryRowContext(ctx, "select exists (select 1 from schema_migrations)").Scan(&tracked); err != nil {
+		return fmt.Errorf("could not read schema version, %v", err)
+	}
+
+	if tracked {
+		return nil
+	}
+
+	for _, probe := range legacyProbes {
+		var applied bool
+		if err := conn.QueryRowContext(ctx, probe.query).Scan(&applied); err != nil {
+			return fmt.Errorf("could not inspect existing schema, %v", err)
+		}
+
+		if !applied {
+			continue
+		}
+
+		if m.index(probe.version) < 0 {
+			return fmt.Errorf("existing schema is at version %d which has no migration", probe.version)
+		}
+
+		log.Printf("existing schema set up without migrations, recording it at version %d", probe.version)
+		return setVersion(ctx, conn, probe.version, false)
+	}
+
+	return nil
+}
+
+// current returns applied version, failing when database is dirty
+func (m *Migrator) current(ctx context.Context, conn *sql.Conn) (uint, error) {
+	current, dirty, err := version(ctx, conn)
+	if err != nil {
+		return 0, err
+	}
+
+	if dirty {
+		return 0, ErrDirty
+	}
+
+	if current != 0 && m.index(current) < 0 {
+		return 0, fmt.Errorf("database is at version %d which has no migration", current)
+	}
+
+	return current, nil
+}
+
+// migrate runs migrations between current and target, each in its own transaction along with version update
+func (m *Migrator) migrate(ctx context.Context, conn *sql.Conn, current, target uint) error {
+	for _, migration := range m.migrations {
+		if migration.Version <= current || migration.Version > target {
+			continue
+		}
+
+		if err := m.run(ctx, conn, migration.Up, migration.Version); err != nil {
+			return m.fail(ctx, conn, migration, fmt.Errorf("could not apply migration %d %s, %v", migration.Version, migration.Name, err))
+		}
+
+		log.Printf("applied migration %d %s", migration.Version, migration.Name)
+	}
+
+	for i := len(m.migrations) - 1; i >= 0; i-- {
+		migration := m.migrations[i]
+		if migration.Version > current || migration.Version <= target {
+			continue
+		}
+
+		if err := m.run(ctx, conn, migration.Down, m.previous(migration.Version)); err != nil {
+			return m.fail(ctx, conn, migration, fmt.Errorf("could not revert migration %d %s, %v", migration.Version, migration.Name, err))
+		}
+
+		log.Printf("reverted migration %d %s", migration.Version, migration.Name)
+	}
+
+	return nil
+}
+
+func (m *Migrator) run(ctx context.Context, conn *sql.Conn, query string, version uint) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("could not begin tx, %v", err)
+	}
+
+	defer tx.Rollback()
+
+	if strings.TrimSpace(query) != "" {
+		if _, err = tx.ExecContext(ctx, query); err != nil {
+			return err
+		}
+	}
+
+	if err = setVersion(ctx, tx, version, false); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// fail marks database dirty at version of migration that failed with err, so later runs stop
+// until someone checks the schema and forces the version
+func (m *Migrator) fail(ctx context.Context, conn *sql.Conn, migration Migration, err error) error {
+	// background ctx so failure is recorded even when it was caused by ctx being done
+	if dirtyErr := setVersion(context.Background(), conn, migration.Version, true); dirtyErr != nil {
+		log.Printf("could not mark database dirty at version %d, %v", migration.Version, dirtyErr)
+	}
+
+	return err
+}
+
+// previous version of migration before version, 0 for the first one
+func (m *Migrator) previous(version uint) uint {
+	if i := m.index(version); i > 0 {
+		return m.migrations[i-1].Version
+	}
+
+	return 0
+}
+
+func (m *Migrator) index(version uint) int {
+	for i, migration := range m.migrations {
+		if migration.Version == version {
+			return i
+		}
+	}
+
+	return -1
+}
+
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+func version(ctx context.Context, conn *sql.Conn) (uint, bool, error) {
+	var (
+		v     uint
+		dirty bool
+	)
+	err := conn.QueryRowContext(ctx, "select version, dirty from schema_migrations limit 1").Scan(&v, &dirty)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	}
+
+	if err != nil {
+		return 0, false, fmt.Errorf("could not read schema version, %v", err)
+	}
+
+	return v, dirty, nil
+}
+
+// setVersion keeps single row in schema_migrations, none at clean version 0
+func setVersion(ctx context.Context, ex execer, version uint, dirty bool) error {
+	if _, err := ex.ExecContext(ctx, "delete from schema_migrations"); err != nil {
+		return fmt.Errorf("could not clear schema version, %v", err)
+	}
+
+	if version == 0 && !dirty {
+		return nil
+	}
+
+	query := "insert into schema_migrations (version, dirty) values ($1, $2)"
+	if _, err := ex.ExecContext(ctx, query, version, dirty); err != nil {
+		return fmt.Errorf("could not set schema version, %v", err)
+	}
+
+	return nil
+}
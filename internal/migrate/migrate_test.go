@@ -0,0 +1,164 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	_ "github.com/lib/pq"
+	"os"
+	"social/db/migration"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestNew(t *testing.T) {
+	file := func(sql string) *fstest.MapFile { return &fstest.MapFile{Data: []byte(sql)} }
+
+	m, err := New(nil, fstest.MapFS{
+		"000002_add_posts.up.sql":   file("create table posts ();"),
+		"000002_add_posts.down.sql": file("drop table posts;"),
+		"000001_add_users.up.sql":   file("create table users ();"),
+		"000001_add_users.down.sql": file(""),
+	})
+	if err != nil {
+		t.Fatalf("could not read migrations: %v", err)
+	}
+
+	if len(m.migrations) != 2 || m.migrations[0].Name != "add_users" || m.migrations[1].Down != "drop table posts;" {
+		t.Errorf("want migrations in version order with their files, got %+v", m.migrations)
+	}
+
+	if m.Latest() != 2 || m.previous(2) != 1 || m.previous(1) != 0 {
+		t.Errorf("want latest 2 with 1 before it, got latest %d", m.Latest())
+	}
+
+	tt := []struct {
+		name  string
+		files fstest.MapFS
+		err   string
+	}{
+		{name: "bad name", files: fstest.MapFS{"add_users.up.sql": file("")}, err: "bad migration file name"},
+		{name: "version 0", files: fstest.MapFS{"000000_add_users.up.sql": file("")}, err: "bad migration version"},
+		{name: "missing down", files: fstest.MapFS{"000001_add_users.up.sql": file("")}, err: "needs both up and down"},
+		{name: "two names", files: fstest.MapFS{
+			"000001_add_users.up.sql":      file(""),
+			"000001_create_users.down.sql": file(""),
+		}, err: "has two names"},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := New(nil, tc.files); err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("want error containing %q, got %v", tc.err, err)
+			}
+		})
+	}
+}
+
+func TestEmbeddedMigrations(t *testing.T) {
+	m, err := New(nil, migration.FS)
+	if err != nil {
+		t.Fatalf("could not read embedded migrations: %v", err)
+	}
+
+	for i, migration := range m.migrations {
+		if migration.Version != uint(i+1) {
+			t.Errorf("want versions without gaps, got %d at %d", migration.Version, i)
+		}
+
+		if strings.TrimSpace(migration.Up) == "" {
+			t.Errorf("want migration %d %s to change something", migration.Version, migration.Name)
+		}
+	}
+
+	for _, probe := range legacyProbes {
+		if m.index(probe.version) < 0 {
+			t.Errorf("want legacy probe version %d to have migration", probe.version)
+		}
+	}
+}
+
+// TestMigrator runs against a scratch database given in TEST_DATABASE_URL, its tables are dropped
+func TestMigrator(t *testing.T) {
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+
+	db, err := sql.Open("postgres", url)
+	if err != nil {
+		t.Fatalf("could not open db: %v", err)
+	}
+
+	defer db.Close()
+
+	ctx := context.Background()
+	reset := func() {
+		for _, query := range []string{
+			"drop table if exists schema_migrations",
+			"drop table if exists migrate_test_a",
+			"drop table if exists migrate_test_b",
+		} {
+			if _, err := db.ExecContext(ctx, query); err != nil {
+				t.Fatalf("could not reset db: %v", err)
+			}
+		}
+	}
+	reset()
+	defer reset()
+
+	file := func(sql string) *fstest.MapFile { return &fstest.MapFile{Data: []byte(sql)} }
+	m, err := New(db, fstest.MapFS{
+		"000001_add_a.up.sql":    file("create table migrate_test_a (id int)"),
+		"000001_add_a.down.sql":  file("drop table migrate_test_a"),
+		"000002_add_b.up.sql":    file("create table migrate_test_b (id int)"),
+		"000002_add_b.down.sql":  file("drop table migrate_test_b"),
+		"000003_broken.up.sql":   file("alter table migrate_test_missing add column x int"),
+		"000003_broken.down.sql": file(""),
+	})
+	if err != nil {
+		t.Fatalf("could not read migrations: %v", err)
+	}
+
+	if err = m.Goto(ctx, 2); err != nil {
+		t.Fatalf("could not migrate up: %v", err)
+	}
+
+	status, err := m.Status(ctx)
+	if err != nil || status.Version != 2 || status.Dirty || !status.Migrations[1].Applied || status.Migrations[2].Applied {
+		t.Fatalf("want version 2 applied, got %+v, %v", status, err)
+	}
+
+	if err = m.Down(ctx, 1); err != nil {
+		t.Fatalf("could not migrate down: %v", err)
+	}
+
+	var exists bool
+	if err = db.QueryRowContext(ctx, "select to_regclass('public.migrate_test_b') is not null").Scan(&exists); err != nil || exists {
+		t.Errorf("want migrate_test_b dropped by down, got %v, %v", exists, err)
+	}
+
+	if err = m.Up(ctx); err == nil {
+		t.Fatal("want broken migration to fail")
+	}
+
+	if status, err = m.Status(ctx); err != nil || status.Version != 3 || !status.Dirty {
+		t.Errorf("want database dirty at the failed version, got %+v, %v", status, err)
+	}
+
+	if err = m.Up(ctx); !errors.Is(err, ErrDirty) {
+		t.Errorf("want ErrDirty until the version is forced, got %v", err)
+	}
+
+	if err = m.Force(ctx, 2); err != nil {
+		t.Fatalf("could not force version: %v", err)
+	}
+
+	if err = m.Goto(ctx, 0); err != nil {
+		t.Fatalf("could not revert every migration: %v", err)
+	}
+
+	if status, err = m.Status(ctx); err != nil || status.Version != 0 || status.Dirty {
+		t.Errorf("want clean version 0, got %+v, %v", status, err)
+	}
+}
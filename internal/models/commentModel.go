@@ -3,13 +3,20 @@ package models
 import "time"
 
 type Comment struct {
-	Id         int64     `json:"id"`
-	UserId     int64     `json:"userId"`
-	PostId     int64     `json:"postId"`
-	Content    string    `json:"content"`
-	LikesCount int       `json:"likes_count"`
-	CreatedAt  time.Time `json:"createdAt"`
-	User       *User     `json:"user"`
-	Mine       bool      `json:"mine"`
-	Liked      bool      `json:"liked"`
+	Id           int64     `json:"id"`
+	UserId       int64     `json:"userId"`
+	PostId       int64     `json:"postId"`
+	ParentId     *int64    `json:"parentId"`
+	Depth        int       `json:"depth"`
+	Content      string    `json:"content"`
+	LikesCount   int       `json:"likes_count"`
+	RepliesCount int       `json:"repliesCount"`
+	CreatedAt    time.Time `json:"createdAt"`
+	User         *User     `json:"user"`
+	Mine         bool      `json:"mine"`
+	Liked        bool      `json:"liked"`
+	Mentions     []Mention `json:"mentions,omitempty"`
+	// Replies first replies of the comment, RepliesCursor is set when there are more to load after it
+	Replies       []Comment `json:"replies,omitempty"`
+	RepliesCursor *int64    `json:"repliesCursor,omitempty"`
 }
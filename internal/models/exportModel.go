@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// UserExport archive of everything a user created, File is the name of the stored archive,
+// empty until it is built, and Url where it can be downloaded from for a while
+type UserExport struct {
+	Id          int64      `json:"id"`
+	UserId      int64      `json:"-"`
+	File        string     `json:"-"`
+	Url         *string    `json:"url"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	CompletedAt *time.Time `json:"completedAt"`
+}
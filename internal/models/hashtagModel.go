@@ -0,0 +1,8 @@
+package models
+
+// TrendingHashtag hashtag ranked by how fast its use grows, PostsCount counts posts tagged within the window
+type TrendingHashtag struct {
+	Tag        string  `json:"tag"`
+	PostsCount int     `json:"postsCount"`
+	Score      float64 `json:"score"`
+}
@@ -0,0 +1,8 @@
+package models
+
+// Link url in content, Start and End are offsets of it in unicode code points, End excluded
+type Link struct {
+	Start int    `json:"start"`
+	End   int    `json:"end"`
+	Url   string `json:"url"`
+}
@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// Media image attached to post, File and Thumbnail are names of the stored files
+// and Url and ThumbnailUrl where they are served from
+type Media struct {
+	Id           int64     `json:"id"`
+	UserId       int64     `json:"-"`
+	PostId       *int64    `json:"-"`
+	File         string    `json:"-"`
+	Thumbnail    string    `json:"-"`
+	Url          string    `json:"url"`
+	ThumbnailUrl string    `json:"thumbnailUrl"`
+	Width        int       `json:"width"`
+	Height       int       `json:"height"`
+	Blurhash     string    `json:"blurhash"`
+	AltText      string    `json:"altText"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
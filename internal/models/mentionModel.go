@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// Mention @username in content, Start and End are offsets of it in unicode code points, End excluded,
+// User is the mentioned user as they are now, so the link still works once they change username
+type Mention struct {
+	Start int  `json:"start"`
+	End   int  `json:"end"`
+	User  User `json:"user"`
+}
+
+// MentionItem entry of mentions feed, either Post or Comment is set, Cursor is passed back
+// to fetch entries older than this one
+type MentionItem struct {
+	Post      *Post     `json:"post,omitempty"`
+	Comment   *Comment  `json:"comment,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	Cursor    string    `json:"cursor"`
+}
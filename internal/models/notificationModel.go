@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// Notification model, actors of the same kind on the same post are coalesced into one notification
+type Notification struct {
+	Id          int64     `json:"id"`
+	UserId      int64     `json:"userId"`
+	Actors      []string  `json:"actors"`
+	ActorsCount int       `json:"actorsCount"`
+	Kind        string    `json:"kind"`
+	PostId      *int64    `json:"postId,omitempty"`
+	Read        bool      `json:"read"`
+	IssuedAt    time.Time `json:"issuedAt"`
+}
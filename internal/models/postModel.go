@@ -2,13 +2,24 @@ package models
 
 import "time"
 
+// Post model, QuoteOf is the post QuoteOfId points to, quoted posts come without their own QuoteOf
 type Post struct {
-	Id        int64     `json:"id"`
-	UserId    int64     `json:"userId"`
-	Content   string    `json:"content"`
-	SpoilerOf *string   `json:"spoilerOf"`
-	CreateAt  time.Time `json:"createAt"`
-	NSFW      bool      `json:"nsfw"`
-	User      User      `json:"user,omitempty"`
-	Mine      bool      `json:"mine"`
+	Id            int64      `json:"id"`
+	UserId        int64      `json:"userId"`
+	Content       string     `json:"content"`
+	SpoilerOf     *string    `json:"spoilerOf"`
+	CreateAt      time.Time  `json:"createAt"`
+	EditedAt      *time.Time `json:"editedAt"`
+	NSFW          bool       `json:"nsfw"`
+	LikesCount    int        `json:"likesCount"`
+	CommentsCount int        `json:"commentsCount"`
+	RepostsCount  int        `json:"repostsCount"`
+	QuoteOfId     *int64     `json:"quoteOfId"`
+	QuoteOf       *Post      `json:"quoteOf,omitempty"`
+	User          User       `json:"user,omitempty"`
+	Mine          bool       `json:"mine"`
+	Liked         bool       `json:"liked"`
+	Reposted      bool       `json:"reposted"`
+	Mentions      []Mention  `json:"mentions,omitempty"`
+	Media         []Media    `json:"media,omitempty"`
 }
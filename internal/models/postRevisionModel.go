@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// PostRevision previous version of an edited post
+type PostRevision struct {
+	Id        int64     `json:"id"`
+	PostId    int64     `json:"postId"`
+	Content   string    `json:"content"`
+	SpoilerOf *string   `json:"spoilerOf"`
+	NSFW      bool      `json:"nsfw"`
+	CreatedAt time.Time `json:"createdAt"`
+}
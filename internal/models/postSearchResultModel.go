@@ -0,0 +1,9 @@
+package models
+
+// PostSearchResult post found by search, Snippet has matched words wrapped in <mark> and the rest
+// of it HTML escaped, Cursor is passed back to fetch results after this one
+type PostSearchResult struct {
+	Post
+	Snippet string `json:"snippet"`
+	Cursor  string `json:"cursor"`
+}
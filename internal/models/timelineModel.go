@@ -5,4 +5,6 @@ type TimelineItem struct {
 	UserId int64 `json:"userId"`
 	PostId int64 `json:"postId"`
 	Post   Post  `json:"post"`
+	// RepostedBy user whose repost brought the post to the timeline, nil when it came from its author
+	RepostedBy *User `json:"repostedBy,omitempty"`
 }
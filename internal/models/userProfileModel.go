@@ -1,12 +1,20 @@
 package models
 
-// UserProfile model
+// UserProfile model, BioMentions and BioLinks are entities of Bio with offsets like Mention has
 type UserProfile struct {
 	User
-	Email          string `json:"email,omitempty"`
-	FollowersCount int    `json:"followersCount"`
-	FolloweesCount int    `json:"followeesCount"`
-	Me             bool   `json:"me"`
-	Following      bool   `json:"following"`
-	Followed       bool   `json:"followed"`
+	Email          string    `json:"email,omitempty"`
+	DisplayName    string    `json:"displayName"`
+	Bio            string    `json:"bio"`
+	BioMentions    []Mention `json:"bioMentions,omitempty"`
+	BioLinks       []Link    `json:"bioLinks,omitempty"`
+	Location       string    `json:"location"`
+	Website        string    `json:"website"`
+	Pronouns       string    `json:"pronouns"`
+	CoverUrl       *string   `json:"coverUrl"`
+	FollowersCount int       `json:"followersCount"`
+	FolloweesCount int       `json:"followeesCount"`
+	Me             bool      `json:"me"`
+	Following      bool      `json:"following"`
+	Followed       bool      `json:"followed"`
 }
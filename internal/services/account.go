@@ -0,0 +1,335 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net/url"
+	. "social/internal/models"
+	"social/internal/store"
+	"strings"
+	"time"
+)
+
+const (
+	// UsernameChangeCooldown how long user waits between username changes
+	UsernameChangeCooldown = time.Hour * 24 * 30
+	// UsernameRedirectGracePeriod how long previous username keeps resolving to the account, nobody else
+	// can take it meanwhile
+	UsernameRedirectGracePeriod = time.Hour * 24 * 90
+	// EmailChangeLifeSpan how long link verifying new email address stays valid
+	EmailChangeLifeSpan = time.Hour * 24
+	// AccountDeletionGracePeriod how long deleted account waits before it is gone for good,
+	// logging back in meanwhile cancels the deletion
+	AccountDeletionGracePeriod = time.Hour * 24 * 30
+	// accountDeletionBatchSize accounts RunAccountDeletions lists at a time
+	accountDeletionBatchSize = 100
+)
+
+// DeleteAccountOutput output dto
+type DeleteAccountOutput struct {
+	DeleteAt time.Time `json:"deleteAt"`
+}
+
+// reservedUsernames can't be taken as they clash with routes of the app or impersonate staff, compared lower cased
+var reservedUsernames = map[string]bool{
+	"admin": true, "administrator": true, "api": true, "assets": true, "auth": true, "help": true,
+	"img": true, "login": true, "logout": true, "me": true, "mentions": true, "mod": true,
+	"moderator": true, "notifications": true, "posts": true, "root": true, "search": true,
+	"settings": true, "signup": true, "static": true, "staff": true, "support": true, "system": true,
+	"tags": true, "timeline": true, "users": true, "www": true,
+}
+
+var emailChangeTemplate = template.Must(template.New("email_change").Parse(`<!DOCTYPE html>
+<html>
+<body>
+	<p>Hi {{ .Username }},</p>
+	<p><a href="{{ .Link }}" target="_blank">Click here to use this address</a> for your account. The link expires in {{ .LifeSpan }} and can be used only once.</p>
+	<p>If you did not ask for it, you can safely ignore this email.</p>
+</body>
+</html>`))
+
+// ChangeUsername renames the authenticated user, at most once per UsernameChangeCooldown,
+// the previous username keeps resolving to them for UsernameRedirectGracePeriod
+func (s *Service) ChangeUsername(ctx context.Context, username string) (User, error) {
+	var user User
+	userId, ok := ctx.Value(KeyAuthUserId).(int64)
+	if !ok {
+		return user, ErrUnauthenticated
+	}
+
+	username = strings.TrimSpace(username)
+	if !rxUsername.MatchString(username) {
+		return user, invalidInput("username", "must start with a letter and have at most 18 letters, digits, _ or -")
+	}
+
+	err := s.Store.Tx(ctx, func(tx store.Store) error {
+		var err error
+		if user, err = tx.UserById(ctx, userId); errors.Is(err, store.ErrNotFound) {
+			return ErrUserNotFound
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if user.Username == username {
+			return invalidInput("username", "must be different from the current one")
+		}
+
+		changedAt, err := tx.LastUsernameChange(ctx, userId)
+		if err != nil {
+			return err
+		}
+
+		if !changedAt.IsZero() && time.Since(changedAt) < UsernameChangeCooldown {
+			return ErrUsernameChangeCooldown
+		}
+
+		if err = checkUsernameAvailable(ctx, tx, username, userId); err != nil {
+			return err
+		}
+
+		if _, err = tx.UpdateUsername(ctx, userId, username); errors.Is(err, store.ErrUsernameTaken) {
+			return ErrUsernameTaken
+		}
+
+		user.Username = username
+		return err
+	})
+
+	return user, err
+}
+
+// RequestEmailChange mails link verifying new email address of the authenticated user,
+// the address is changed once the link is opened, asking again replaces the pending change
+func (s *Service) RequestEmailChange(ctx context.Context, email string) error {
+	userId, ok := ctx.Value(KeyAuthUserId).(int64)
+	if !ok {
+		return ErrUnauthenticated
+	}
+
+	email = strings.TrimSpace(email)
+	if !rxEmail.MatchString(email) {
+		return invalidInput("email", "bad email address")
+	}
+
+	user, err := s.GetUserById(ctx, userId)
+	if err != nil {
+		return err
+	}
+
+	other, err := s.Store.UserByEmail(ctx, email)
+	if err == nil && other.Id == userId {
+		return invalidInput("email", "must be different from the current one")
+	}
+
+	if err == nil {
+		return ErrEmailTaken
+	}
+
+	if !errors.Is(err, store.ErrNotFound) {
+		return err
+	}
+
+	code, err := randomString(32)
+	if err != nil {
+		return fmt.Errorf("could not generate email change code, %v", err)
+	}
+
+	if err = s.Store.DeleteEmailChangesBefore(ctx, time.Now().Add(-EmailChangeLifeSpan)); err != nil {
+		return err
+	}
+
+	if err = s.Store.CreateEmailChange(ctx, hashToken(code), userId, email); err != nil {
+		return err
+	}
+
+	link := s.Origin + "/api/verify_email?" + url.Values{"code": {code}}.Encode()
+
+	var html bytes.Buffer
+	if err = emailChangeTemplate.Execute(&html, map[string]interface{}{
+		"Username": user.Username,
+		"Link":     link,
+		"LifeSpan": EmailChangeLifeSpan,
+	}); err != nil {
+		return fmt.Errorf("could not render email change mail, %v", err)
+	}
+
+	text := fmt.Sprintf("Hi %s,\n\nopen %s to use this address for your account. The link expires in %s and can be used only once.\n",
+		user.Username, link, EmailChangeLifeSpan)
+	if err = s.Mailer.Send(email, "Verify your new email address", html.String(), text); err != nil {
+		return fmt.Errorf("could not send email change link, %v", err)
+	}
+
+	return nil
+}
+
+// VerifyEmailChange swaps email address of the user for the one code was sent to
+func (s *Service) VerifyEmailChange(ctx context.Context, code string) error {
+	code = strings.TrimSpace(code)
+	if code == "" {
+		return ErrInvalidVerificationCode
+	}
+
+	change, err := s.Store.TakeEmailChange(ctx, hashToken(code))
+	if errors.Is(err, store.ErrNotFound) {
+		return ErrInvalidVerificationCode
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if change.CreatedAt.Add(EmailChangeLifeSpan).Before(time.Now()) {
+		return ErrExpiredVerificationCode
+	}
+
+	err = s.Store.UpdateEmail(ctx, change.UserId, change.Email)
+	if errors.Is(err, store.ErrEmailTaken) {
+		return ErrEmailTaken
+	}
+
+	if errors.Is(err, store.ErrNotFound) {
+		return ErrUserNotFound
+	}
+
+	return err
+}
+
+// DeleteAccount schedules the authenticated user to be deleted with everything they created once
+// AccountDeletionGracePeriod passes and logs them out of every session
+func (s *Service) DeleteAccount(ctx context.Context) (DeleteAccountOutput, error) {
+	out := DeleteAccountOutput{DeleteAt: time.Now().Add(AccountDeletionGracePeriod)}
+	userId, ok := ctx.Value(KeyAuthUserId).(int64)
+	if !ok {
+		return out, ErrUnauthenticated
+	}
+
+	err := s.Store.Tx(ctx, func(tx store.Store) error {
+		err := tx.ScheduleUserDeletion(ctx, userId, out.DeleteAt)
+		if errors.Is(err, store.ErrNotFound) {
+			return ErrUserNotFound
+		}
+
+		if err != nil {
+			return err
+		}
+
+		return tx.DeleteSessions(ctx, userId)
+	})
+
+	return out, err
+}
+
+// RunAccountDeletions deletes accounts whose deletion grace period is over right away
+// and then every interval until ctx is done
+func (s *Service) RunAccountDeletions(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.deleteDueAccounts(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("could not delete accounts due for deletion, %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Service) deleteDueAccounts(ctx context.Context) error {
+	for {
+		userIds, err := s.Store.UsersDueForDeletion(ctx, time.Now(), accountDeletionBatchSize)
+		if err != nil {
+			return err
+		}
+
+		for _, userId := range userIds {
+			if err = s.deleteDueAccount(ctx, userId); err != nil {
+				return err
+			}
+		}
+
+		if len(userIds) < accountDeletionBatchSize {
+			return nil
+		}
+	}
+}
+
+func (s *Service) deleteDueAccount(ctx context.Context, userId int64) error {
+	var deleted store.DeletedUser
+	err := s.Store.Tx(ctx, func(tx store.Store) error {
+		// logging back in may have cancelled the deletion since the user was listed
+		deleteAt, err := tx.LockUserDeletion(ctx, userId)
+		if errors.Is(err, store.ErrNotFound) {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if deleteAt.IsZero() || deleteAt.After(time.Now()) {
+			return nil
+		}
+
+		deleted, err = tx.DeleteUser(ctx, userId)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("could not delete user %d, %v", userId, err)
+	}
+
+	s.removeDeletedUserFiles(ctx, deleted)
+	return nil
+}
+
+// checkUsernameAvailable fails when username is reserved or still held by someone else
+// who changed it within UsernameRedirectGracePeriod, taken usernames are left to the store
+func checkUsernameAvailable(ctx context.Context, st store.Store, username string, userId int64) error {
+	if reservedUsernames[strings.ToLower(username)] {
+		return invalidInput("username", "is reserved")
+	}
+
+	previousOwner, err := userByMovedUsername(ctx, st, username)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if previousOwner.Id != userId {
+		return ErrUsernameTaken
+	}
+
+	return nil
+}
+
+// movedUsername current username of the user who changed username away from the given one
+// within UsernameRedirectGracePeriod, empty when nobody did
+func movedUsername(ctx context.Context, st store.Store, username string) (string, error) {
+	user, err := userByMovedUsername(ctx, st, username)
+	if errors.Is(err, store.ErrNotFound) {
+		return "", nil
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	return user.Username, nil
+}
+
+// userByMovedUsername user who changed username away from the given one within UsernameRedirectGracePeriod
+func userByMovedUsername(ctx context.Context, st store.Store, username string) (User, error) {
+	return st.UserByPreviousUsername(ctx, username, time.Now().Add(-UsernameRedirectGracePeriod))
+}
@@ -0,0 +1,117 @@
+package services
+
+import (
+	"errors"
+	"social/internal/store"
+	"testing"
+	"time"
+)
+
+func TestChangeUsername(t *testing.T) {
+	s := newTestService(t)
+	alice := newTestUser(t, s, "alice")
+	bob := newTestUser(t, s, "bob")
+
+	for _, username := range []string{"admin", "Settings"} {
+		_, err := s.ChangeUsername(alice, username)
+		assertInvalidField(t, err, "username")
+	}
+
+	if _, err := createUser(bob, s.Store, "staff@example.org", "Staff"); err == nil {
+		t.Error("want reserved username rejected on sign up")
+	}
+
+	user, err := s.ChangeUsername(alice, "alicia")
+	if err != nil {
+		t.Fatalf("could not change username: %v", err)
+	}
+
+	if user.Username != "alicia" {
+		t.Errorf("want username alicia, got %s", user.Username)
+	}
+
+	if _, err = s.ChangeUsername(alice, "alison"); !errors.Is(err, ErrUsernameChangeCooldown) {
+		t.Errorf("changing again within cooldown: want ErrUsernameChangeCooldown, got %v", err)
+	}
+
+	if _, err = s.ChangeUsername(bob, "alice"); !errors.Is(err, ErrUsernameTaken) {
+		t.Errorf("taking username within redirect grace period: want ErrUsernameTaken, got %v", err)
+	}
+
+	profile, err := s.GetUserProfile(bob, "alice")
+	if err != nil {
+		t.Fatalf("could not get profile by previous username: %v", err)
+	}
+
+	if profile.Username != "alicia" {
+		t.Errorf("want previous username to resolve to alicia, got %s", profile.Username)
+	}
+}
+
+func TestDeleteAccount(t *testing.T) {
+	s := newTestService(t)
+	s.DevLogin = true
+	alice := newTestUser(t, s, "alice")
+	userId := authUserId(alice)
+
+	deleteAt := func() time.Time {
+		t.Helper()
+
+		var at time.Time
+		err := s.Store.Tx(alice, func(tx store.Store) error {
+			var err error
+			at, err = tx.LockUserDeletion(alice, userId)
+			return err
+		})
+		if err != nil {
+			t.Fatalf("could not get deletion time: %v", err)
+		}
+
+		return at
+	}
+
+	out, err := s.DeleteAccount(alice)
+	if err != nil {
+		t.Fatalf("could not delete account: %v", err)
+	}
+
+	if until := time.Until(out.DeleteAt); until < AccountDeletionGracePeriod-time.Minute || until > AccountDeletionGracePeriod {
+		t.Errorf("want deletion after grace period, got %v", out.DeleteAt)
+	}
+
+	if err = s.deleteDueAccounts(alice); err != nil {
+		t.Fatalf("could not delete due accounts: %v", err)
+	}
+
+	if _, err = s.GetUserById(alice, userId); err != nil {
+		t.Fatalf("want user kept within grace period, got %v", err)
+	}
+
+	if _, err = s.AdminIssueToken(alice, "alice", false); err != nil {
+		t.Fatalf("could not issue admin token: %v", err)
+	}
+
+	if deleteAt().IsZero() {
+		t.Error("want admin token to leave pending deletion alone")
+	}
+
+	if _, err = s.Login(alice, "alice@example.org"); err != nil {
+		t.Fatalf("could not login: %v", err)
+	}
+
+	if !deleteAt().IsZero() {
+		t.Error("want login to cancel pending deletion")
+	}
+
+	if err = s.Store.ScheduleUserDeletion(alice, userId, time.Now().Add(-time.Second)); err != nil {
+		t.Fatalf("could not schedule deletion: %v", err)
+	}
+
+	if err = s.deleteDueAccounts(alice); err != nil {
+		t.Fatalf("could not delete due accounts: %v", err)
+	}
+
+	if _, err = s.GetUserById(alice, userId); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("want user deleted once grace period is over, got %v", err)
+	}
+}
@@ -0,0 +1,323 @@
+package services
+
+import (
+	"context"
+	"errors"
+	. "social/internal/models"
+	"social/internal/store"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Admin methods back the admin subcommands, they skip authorization and with dryRun
+// do everything in a transaction that is rolled back, so they report what would change
+
+const (
+	// adminTimelineSize how many posts a rebuilt timeline gets
+	adminTimelineSize = 1000
+	// orphanAvatarMinAge avatars newer than this may still be on their way to the user row
+	orphanAvatarMinAge = time.Hour
+)
+
+// errDryRun rolls back transaction of dry run
+var errDryRun = errors.New("dry run")
+
+// AdminUserOutput output dto
+type AdminUserOutput struct {
+	DryRun bool `json:"dryRun"`
+	User   User `json:"user"`
+}
+
+// AdminSuspendOutput output dto
+type AdminSuspendOutput struct {
+	DryRun    bool `json:"dryRun"`
+	User      User `json:"user"`
+	Suspended bool `json:"suspended"`
+}
+
+// AdminDeleteOutput output dto
+type AdminDeleteOutput struct {
+	DryRun  bool              `json:"dryRun"`
+	User    User              `json:"user"`
+	Deleted store.DeletedUser `json:"deleted"`
+}
+
+// AdminTokenOutput output dto, token is only issued when it is not a dry run
+type AdminTokenOutput struct {
+	DryRun       bool       `json:"dryRun"`
+	User         User       `json:"user"`
+	Token        string     `json:"token,omitempty"`
+	ExpiresAt    *time.Time `json:"expiresAt,omitempty"`
+	RefreshToken string     `json:"refreshToken,omitempty"`
+}
+
+// AdminRecountOutput output dto
+type AdminRecountOutput struct {
+	DryRun bool `json:"dryRun"`
+	CountsReport
+}
+
+// AdminRoleOutput output dto
+type AdminRoleOutput struct {
+	DryRun bool `json:"dryRun"`
+	User   User `json:"user"`
+	Admin  bool `json:"admin"`
+}
+
+// AdminTimelineOutput output dto
+type AdminTimelineOutput struct {
+	DryRun bool `json:"dryRun"`
+	User   User `json:"user"`
+	Items  int  `json:"items"`
+}
+
+// AdminAvatarsOutput output dto
+type AdminAvatarsOutput struct {
+	DryRun bool     `json:"dryRun"`
+	Files  []string `json:"files"`
+}
+
+// AdminCreateUser creates user like sign up does
+func (s *Service) AdminCreateUser(ctx context.Context, email, username string, dryRun bool) (AdminUserOutput, error) {
+	out := AdminUserOutput{DryRun: dryRun}
+	err := s.adminTx(ctx, dryRun, func(tx store.Store) error {
+		userId, err := createUser(ctx, tx, email, username)
+		if err != nil {
+			return err
+		}
+
+		out.User, err = tx.UserById(ctx, userId)
+		return err
+	})
+
+	return out, err
+}
+
+// AdminSuspendUser suspends user and logs them out of every session, or lifts the suspension
+func (s *Service) AdminSuspendUser(ctx context.Context, username string, suspend, dryRun bool) (AdminSuspendOutput, error) {
+	out := AdminSuspendOutput{DryRun: dryRun, Suspended: suspend}
+	err := s.adminTx(ctx, dryRun, func(tx store.Store) error {
+		var err error
+		if out.User, err = adminUser(ctx, tx, username); err != nil {
+			return err
+		}
+
+		if err = tx.SuspendUser(ctx, out.User.Id, suspend); err != nil {
+			return err
+		}
+
+		if !suspend {
+			return nil
+		}
+
+		return tx.DeleteSessions(ctx, out.User.Id)
+	})
+
+	return out, err
+}
+
+// AdminDeleteUser deletes user with everything they created
+func (s *Service) AdminDeleteUser(ctx context.Context, username string, dryRun bool) (AdminDeleteOutput, error) {
+	out := AdminDeleteOutput{DryRun: dryRun}
+	err := s.adminTx(ctx, dryRun, func(tx store.Store) error {
+		var err error
+		if out.User, err = adminUser(ctx, tx, username); err != nil {
+			return err
+		}
+
+		out.Deleted, err = tx.DeleteUser(ctx, out.User.Id)
+		return err
+	})
+	if err != nil {
+		return out, err
+	}
+
+	if !dryRun {
+		s.removeDeletedUserFiles(ctx, out.Deleted)
+	}
+
+	return out, nil
+}
+
+// AdminIssueToken starts new session for user as if they logged in
+func (s *Service) AdminIssueToken(ctx context.Context, username string, dryRun bool) (AdminTokenOutput, error) {
+	out := AdminTokenOutput{DryRun: dryRun}
+	user, err := adminUser(ctx, s.Store, username)
+	if err != nil {
+		return out, err
+	}
+
+	out.User = user
+	if dryRun {
+		suspended, err := s.Store.UserSuspended(ctx, user.Id)
+		if err != nil {
+			return out, err
+		}
+
+		if suspended {
+			return out, ErrUserSuspended
+		}
+
+		return out, nil
+	}
+
+	// support tokens leave pending deletion of the user alone
+	login, err := s.issueToken(ctx, user, false)
+	if err != nil {
+		return out, err
+	}
+
+	out.Token = login.Token
+	out.ExpiresAt = &login.ExpiresAt
+	out.RefreshToken = login.RefreshToken
+
+	return out, nil
+}
+
+// AdminRecomputeCounts fixes denormalized counts, with dryRun it only reports wrong ones
+func (s *Service) AdminRecomputeCounts(ctx context.Context, dryRun bool) (AdminRecountOutput, error) {
+	report, err := s.reconcileCounts(ctx, !dryRun)
+	return AdminRecountOutput{DryRun: dryRun, CountsReport: report}, err
+}
+
+// AdminSetAdmin grants user access to admin endpoints or revokes it
+func (s *Service) AdminSetAdmin(ctx context.Context, username string, admin, dryRun bool) (AdminRoleOutput, error) {
+	out := AdminRoleOutput{DryRun: dryRun, Admin: admin}
+	err := s.adminTx(ctx, dryRun, func(tx store.Store) error {
+		var err error
+		if out.User, err = adminUser(ctx, tx, username); err != nil {
+			return err
+		}
+
+		return tx.SetAdmin(ctx, out.User.Id, admin)
+	})
+
+	return out, err
+}
+
+// AdminRebuildTimeline replaces timeline of user with newest posts of the user and users they follow
+func (s *Service) AdminRebuildTimeline(ctx context.Context, username string, dryRun bool) (AdminTimelineOutput, error) {
+	out := AdminTimelineOutput{DryRun: dryRun}
+	err := s.adminTx(ctx, dryRun, func(tx store.Store) error {
+		var err error
+		if out.User, err = adminUser(ctx, tx, username); err != nil {
+			return err
+		}
+
+		out.Items, err = tx.RebuildTimeline(ctx, out.User.Id, adminTimelineSize)
+		return err
+	})
+
+	return out, err
+}
+
+// AdminPurgeOrphanAvatars removes avatar files no user has
+func (s *Service) AdminPurgeOrphanAvatars(ctx context.Context, dryRun bool) (AdminAvatarsOutput, error) {
+	out := AdminAvatarsOutput{DryRun: dryRun, Files: []string{}}
+	avatars, err := s.Store.Avatars(ctx)
+	if err != nil {
+		return out, err
+	}
+
+	used := make(map[string]bool, len(avatars))
+	for _, avatar := range avatars {
+		used[avatar] = true
+	}
+
+	blobs, err := s.Blobs.List(ctx, avatarsPrefix)
+	if err != nil {
+		return out, err
+	}
+
+	for _, b := range blobs {
+		name := strings.TrimPrefix(b.Key, avatarsPrefix)
+		if strings.Contains(name, "/") || strings.HasPrefix(name, ".") || used[name] {
+			continue
+		}
+
+		if time.Since(b.ModTime) < orphanAvatarMinAge {
+			continue
+		}
+
+		if !dryRun {
+			if err = s.Blobs.Delete(ctx, b.Key); err != nil {
+				return out, err
+			}
+		}
+
+		out.Files = append(out.Files, name)
+	}
+
+	sort.Strings(out.Files)
+	return out, nil
+}
+
+// CheckAdmin fails unless authenticated user is admin
+func (s *Service) CheckAdmin(ctx context.Context) error {
+	uid, ok := ctx.Value(KeyAuthUserId).(int64)
+	if !ok {
+		return ErrUnauthenticated
+	}
+
+	admin, err := s.Store.IsAdmin(ctx, uid)
+	if errors.Is(err, store.ErrNotFound) {
+		return ErrUnauthenticated
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if !admin {
+		return ErrNotAdmin
+	}
+
+	return nil
+}
+
+// adminTx runs fn in transaction that is rolled back when dryRun is set
+func (s *Service) adminTx(ctx context.Context, dryRun bool, fn func(tx store.Store) error) error {
+	err := s.Store.Tx(ctx, func(tx store.Store) error {
+		if err := fn(tx); err != nil {
+			return err
+		}
+
+		if dryRun {
+			return errDryRun
+		}
+
+		return nil
+	})
+	if errors.Is(err, errDryRun) {
+		return nil
+	}
+
+	return err
+}
+
+func adminUser(ctx context.Context, st store.Store, username string) (User, error) {
+	user, err := st.UserByUsername(ctx, strings.TrimSpace(username))
+	if errors.Is(err, store.ErrNotFound) {
+		return user, ErrUserNotFound
+	}
+
+	return user, err
+}
+
+// removeDeletedUserFiles removes blobs of deleted user, one left behind is only logged
+// and avatars are picked up by AdminPurgeOrphanAvatars later
+func (s *Service) removeDeletedUserFiles(ctx context.Context, deleted store.DeletedUser) {
+	if deleted.Avatar != "" {
+		s.deleteBlob(ctx, avatarsPrefix+deleted.Avatar)
+	}
+
+	if deleted.Cover != "" {
+		s.deleteBlob(ctx, coversPrefix+deleted.Cover)
+	}
+
+	s.removeMediaFiles(ctx, deleted.Media)
+	for _, file := range deleted.Exports {
+		s.deleteBlob(ctx, ExportsPrefix+file)
+	}
+}
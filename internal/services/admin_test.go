@@ -0,0 +1,248 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"social/internal/blob"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAdminCreateUser(t *testing.T) {
+	s := newTestService(t)
+	ctx := context.Background()
+
+	out, err := s.AdminCreateUser(ctx, "alice@example.org", "alice", true)
+	if err != nil || !out.DryRun || out.User.Username != "alice" {
+		t.Fatalf("want alice reported by dry run, got %+v, %v", out, err)
+	}
+
+	if _, err = s.Store.UserByUsername(ctx, "alice"); err == nil {
+		t.Fatal("want dry run to create nobody")
+	}
+
+	if out, err = s.AdminCreateUser(ctx, "alice@example.org", "alice", false); err != nil || out.User.Id == 0 {
+		t.Fatalf("want alice created, got %+v, %v", out, err)
+	}
+
+	if _, err = s.AdminCreateUser(ctx, "alice@example.org", "alice2", false); !errors.Is(err, ErrEmailTaken) {
+		t.Errorf("want ErrEmailTaken, got %v", err)
+	}
+
+	_, err = s.AdminCreateUser(ctx, "bob@example.org", "bob!", false)
+	assertInvalidField(t, err, "username")
+}
+
+func TestAdminSuspendUser(t *testing.T) {
+	s := newTestService(t)
+	ctx := newTestUser(t, s, "alice")
+
+	login, err := s.AdminIssueToken(ctx, "alice", false)
+	if err != nil || login.Token == "" {
+		t.Fatalf("could not issue token: %+v, %v", login, err)
+	}
+
+	if _, err = s.AdminSuspendUser(ctx, "alice", true, true); err != nil {
+		t.Fatalf("could not suspend alice in dry run: %v", err)
+	}
+
+	if _, _, err = s.Authorized(ctx, login.Token); err != nil {
+		t.Errorf("want dry run to keep sessions, got %v", err)
+	}
+
+	out, err := s.AdminSuspendUser(ctx, " alice ", true, false)
+	if err != nil || !out.Suspended || out.User.Username != "alice" {
+		t.Fatalf("want alice suspended, got %+v, %v", out, err)
+	}
+
+	if _, _, err = s.Authorized(ctx, login.Token); err == nil {
+		t.Error("want suspension to end sessions of alice")
+	}
+
+	if _, err = s.AdminIssueToken(ctx, "alice", true); !errors.Is(err, ErrUserSuspended) {
+		t.Errorf("want ErrUserSuspended from dry run, got %v", err)
+	}
+
+	if _, err = s.AdminIssueToken(ctx, "alice", false); !errors.Is(err, ErrUserSuspended) {
+		t.Errorf("want ErrUserSuspended, got %v", err)
+	}
+
+	if _, err = s.AdminSuspendUser(ctx, "alice", false, false); err != nil {
+		t.Fatalf("could not unsuspend alice: %v", err)
+	}
+
+	if _, err = s.AdminIssueToken(ctx, "alice", false); err != nil {
+		t.Errorf("want token issued once suspension is lifted, got %v", err)
+	}
+
+	if _, err = s.AdminSuspendUser(ctx, "nobody", true, false); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("want ErrUserNotFound, got %v", err)
+	}
+}
+
+func TestAdminIssueToken(t *testing.T) {
+	s := newTestService(t)
+	ctx := newTestUser(t, s, "alice")
+
+	out, err := s.AdminIssueToken(ctx, "alice", true)
+	if err != nil || out.Token != "" || out.ExpiresAt != nil {
+		t.Fatalf("want no token from dry run, got %+v, %v", out, err)
+	}
+
+	if out, err = s.AdminIssueToken(ctx, "alice", false); err != nil {
+		t.Fatalf("could not issue token: %v", err)
+	}
+
+	uid, _, err := s.Authorized(ctx, out.Token)
+	if err != nil || uid != authUserId(ctx) {
+		t.Errorf("want token of alice, got %d, %v", uid, err)
+	}
+}
+
+func TestAdminSetAdmin(t *testing.T) {
+	s := newTestService(t)
+	ctx := newTestUser(t, s, "alice")
+
+	if err := s.CheckAdmin(ctx); !errors.Is(err, ErrNotAdmin) {
+		t.Fatalf("want ErrNotAdmin, got %v", err)
+	}
+
+	if _, err := s.AdminSetAdmin(ctx, "alice", true, true); err != nil {
+		t.Fatalf("could not make alice admin in dry run: %v", err)
+	}
+
+	if err := s.CheckAdmin(ctx); !errors.Is(err, ErrNotAdmin) {
+		t.Errorf("want dry run to grant nothing, got %v", err)
+	}
+
+	if _, err := s.AdminSetAdmin(ctx, "alice", true, false); err != nil {
+		t.Fatalf("could not make alice admin: %v", err)
+	}
+
+	if err := s.CheckAdmin(ctx); err != nil {
+		t.Errorf("want alice admin, got %v", err)
+	}
+
+	if _, err := s.AdminSetAdmin(ctx, "alice", false, false); err != nil {
+		t.Fatalf("could not revoke admin of alice: %v", err)
+	}
+
+	if err := s.CheckAdmin(ctx); !errors.Is(err, ErrNotAdmin) {
+		t.Errorf("want admin revoked, got %v", err)
+	}
+}
+
+func TestAdminDeleteUser(t *testing.T) {
+	s := newTestService(t)
+	ctx := newTestUser(t, s, "alice")
+
+	for i := 0; i < 2; i++ {
+		if _, err := s.CreatePost(ctx, "post", nil, false, nil, nil); err != nil {
+			t.Fatalf("could not create post: %v", err)
+		}
+	}
+
+	out, err := s.AdminDeleteUser(ctx, "alice", true)
+	if err != nil || out.Deleted.Posts != 2 {
+		t.Fatalf("want 2 posts reported by dry run, got %+v, %v", out, err)
+	}
+
+	if _, err = s.Store.UserByUsername(ctx, "alice"); err != nil {
+		t.Fatalf("want dry run to keep alice, got %v", err)
+	}
+
+	if out, err = s.AdminDeleteUser(ctx, "alice", false); err != nil || out.Deleted.Posts != 2 {
+		t.Fatalf("want alice deleted with 2 posts, got %+v, %v", out, err)
+	}
+
+	if _, err = s.AdminDeleteUser(ctx, "alice", false); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("want ErrUserNotFound once deleted, got %v", err)
+	}
+}
+
+func TestAdminRebuildTimeline(t *testing.T) {
+	s := newTestService(t)
+	alice := newTestUser(t, s, "alice")
+	bob := newTestUser(t, s, "bob")
+
+	if _, err := s.CreatePost(alice, "before follow", nil, false, nil, nil); err != nil {
+		t.Fatalf("could not create post: %v", err)
+	}
+
+	if _, err := s.ToggleFollow(bob, "alice"); err != nil {
+		t.Fatalf("could not follow: %v", err)
+	}
+
+	if _, err := s.CreatePost(bob, "own post", nil, false, nil, nil); err != nil {
+		t.Fatalf("could not create post: %v", err)
+	}
+
+	out, err := s.AdminRebuildTimeline(bob, "bob", true)
+	if err != nil || out.Items != 2 {
+		t.Fatalf("want 2 items reported by dry run, got %+v, %v", out, err)
+	}
+
+	timeline, err := s.Timeline(bob, 0, 0)
+	if err != nil || len(timeline) != 1 {
+		t.Fatalf("want dry run to keep timeline, got %d items, %v", len(timeline), err)
+	}
+
+	if _, err = s.AdminRebuildTimeline(bob, "bob", false); err != nil {
+		t.Fatalf("could not rebuild timeline: %v", err)
+	}
+
+	if timeline, err = s.Timeline(bob, 0, 0); err != nil || len(timeline) != 2 {
+		t.Errorf("want post of followed alice in rebuilt timeline, got %d items, %v", len(timeline), err)
+	}
+}
+
+func TestAdminPurgeOrphanAvatars(t *testing.T) {
+	s := newTestService(t)
+	ctx := newTestUser(t, s, "alice")
+
+	dir := t.TempDir()
+	s.Blobs = blob.NewFSStore(dir, "http://localhost/img", []byte("secret"))
+
+	if _, err := s.Store.UpdateAvatar(ctx, authUserId(ctx), "used.jpg"); err != nil {
+		t.Fatalf("could not set avatar: %v", err)
+	}
+
+	old := time.Now().Add(-orphanAvatarMinAge - time.Minute)
+	for _, name := range []string{"used.jpg", "orphan.jpg", "fresh.jpg"} {
+		key := avatarsPrefix + name
+		if err := s.Blobs.Put(ctx, key, strings.NewReader("avatar"), "image/jpeg"); err != nil {
+			t.Fatalf("could not put %s: %v", key, err)
+		}
+
+		if name == "fresh.jpg" {
+			continue
+		}
+
+		if err := os.Chtimes(filepath.Join(dir, filepath.FromSlash(key)), old, old); err != nil {
+			t.Fatalf("could not age %s: %v", key, err)
+		}
+	}
+
+	out, err := s.AdminPurgeOrphanAvatars(ctx, true)
+	if err != nil || len(out.Files) != 1 || out.Files[0] != "orphan.jpg" {
+		t.Fatalf("want only orphan.jpg reported, got %+v, %v", out, err)
+	}
+
+	if _, err = s.AdminPurgeOrphanAvatars(ctx, false); err != nil {
+		t.Fatalf("could not purge avatars: %v", err)
+	}
+
+	for name, kept := range map[string]bool{"used.jpg": true, "orphan.jpg": false, "fresh.jpg": true} {
+		r, err := s.Blobs.Get(ctx, avatarsPrefix+name)
+		if err == nil {
+			r.Close()
+		}
+
+		if (err == nil) != kept {
+			t.Errorf("want %s kept %v, got %v", name, kept, err)
+		}
+	}
+}
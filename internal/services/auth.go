@@ -2,83 +2,227 @@ package services
 
 import (
 	"context"
-	"database/sql"
 	"errors"
 	"fmt"
+	"log"
 	. "social/internal/models"
+	"social/internal/store"
 	"strconv"
+	"strings"
 	"time"
 )
 
 const (
-	// TokenLifeSpan token expiration time
+	// TokenLifeSpan refresh token and session expiration time
 	TokenLifeSpan = time.Hour * 24 * 14
+	// AccessTokenLifeSpan access token expiration time
+	AccessTokenLifeSpan = time.Minute * 15
+	// StreamTokenLifeSpan how long stream token can be used to open an event stream
+	StreamTokenLifeSpan = time.Minute
 	// KeyAuthUserId userId in http context
 	KeyAuthUserId = "auth_user_id"
+	// KeyAuthSessionId sessionId in http context
+	KeyAuthSessionId = "auth_session_id"
+	// KeyUserAgent client user agent in http context, saved with new sessions
+	KeyUserAgent = "user_agent"
+	// KeyRemoteIP client ip in http context, saved with new sessions
+	KeyRemoteIP = "remote_ip"
 )
 
+// streamTokenPrefix tells stream tokens apart from access tokens so neither passes for the other
+const streamTokenPrefix = "stream:"
+
+// StreamTokenOutput output dto
+type StreamTokenOutput struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
 type LoginOutput struct {
-	Token     string
-	ExpiresAt time.Time
-	AuthUser  User
+	Token        string
+	ExpiresAt    time.Time
+	RefreshToken string
+	AuthUser     User
 }
 
 func (s *Service) Login(ctx context.Context, email string) (LoginOutput, error) {
 	var out LoginOutput
+	if !s.DevLogin {
+		return out, ErrDevLoginDisabled
+	}
 
-	query := fmt.Sprintf("Select id,username from public.users where email = '%s'", email)
-	err := s.Db.QueryRowContext(ctx, query).Scan(&out.AuthUser.Id, &out.AuthUser.Username)
+	user, err := s.Store.UserByEmail(ctx, strings.TrimSpace(email))
+	if errors.Is(err, store.ErrNotFound) {
+		return out, ErrUserNotFound
+	}
 
-	if err == sql.ErrNoRows {
-		return out, errors.New("record not found")
+	if err != nil {
+		return out, err
 	}
 
+	return s.issueToken(ctx, user, true)
+}
+
+func (s *Service) AuthUser(ctx context.Context) (User, error) {
+	userId, ok := ctx.Value(KeyAuthUserId).(int64)
+	if !ok {
+		return User{}, ErrUnauthenticated
+	}
+
+	return s.GetUserById(ctx, userId)
+}
+
+// Authorized validates access token and returns ids of its user and session
+func (s *Service) Authorized(ctx context.Context, token string) (int64, string, error) {
+	str, err := s.Codec.DecodeToString(token)
 	if err != nil {
-		return out, fmt.Errorf("cannot find user")
+		return 0, "", ErrInvalidToken
 	}
 
-	out.Token, err = s.Codec.EncodeToString(strconv.FormatInt(out.AuthUser.Id, 10))
+	parts := strings.SplitN(str, ":", 2)
+	if len(parts) != 2 {
+		return 0, "", ErrInvalidToken
+	}
+
+	userId, err := strconv.ParseInt(parts[0], 10, 64)
 	if err != nil {
-		return out, fmt.Errorf("cannot generate token")
+		return 0, "", ErrInvalidToken
 	}
-	out.ExpiresAt = time.Now().Add(TokenLifeSpan)
 
-	return out, nil
+	sessionId := parts[1]
+	if err = s.touchSession(ctx, userId, sessionId); err != nil {
+		return 0, "", err
+	}
+
+	return userId, sessionId, nil
 }
 
-func (s *Service) AuthUser(ctx context.Context) (User, error) {
-	var user User
+// StreamToken issues short-lived token opening event streams for the current session of the authenticated
+// user, browsers cannot send Authorization header with EventSource so it goes in the url instead
+func (s *Service) StreamToken(ctx context.Context) (StreamTokenOutput, error) {
+	var out StreamTokenOutput
 	userId, ok := ctx.Value(KeyAuthUserId).(int64)
 	if !ok {
-		return user, fmt.Errorf("no user in session")
+		return out, ErrUnauthenticated
+	}
+
+	sessionId, ok := ctx.Value(KeyAuthSessionId).(string)
+	if !ok {
+		return out, ErrUnauthenticated
+	}
+
+	out.ExpiresAt = time.Now().Add(StreamTokenLifeSpan)
+	token, err := s.Codec.EncodeToString(fmt.Sprintf("%s%d:%s:%d", streamTokenPrefix, userId, sessionId, out.ExpiresAt.Unix()))
+	if err != nil {
+		return out, fmt.Errorf("cannot generate stream token")
 	}
 
-	query := fmt.Sprintf("Select username from users where id = %d", userId)
-	err := s.Db.QueryRowContext(ctx, query).Scan(&user.Username)
+	out.Token = token
+	return out, nil
+}
+
+// AuthorizedStream validates stream token and returns ids of its user and session
+func (s *Service) AuthorizedStream(ctx context.Context, token string) (int64, string, error) {
+	str, err := s.Codec.DecodeToString(token)
+	if err != nil || !strings.HasPrefix(str, streamTokenPrefix) {
+		return 0, "", ErrInvalidToken
+	}
 
-	if err == sql.ErrNoRows {
-		return user, fmt.Errorf("record not found")
+	parts := strings.Split(strings.TrimPrefix(str, streamTokenPrefix), ":")
+	if len(parts) != 3 {
+		return 0, "", ErrInvalidToken
 	}
 
+	userId, err := strconv.ParseInt(parts[0], 10, 64)
 	if err != nil {
-		return user, fmt.Errorf("cannot find user")
+		return 0, "", ErrInvalidToken
 	}
 
-	user.Id = userId
-	return user, nil
+	expiresAt, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil || time.Now().Unix() > expiresAt {
+		return 0, "", ErrInvalidToken
+	}
 
+	sessionId := parts[1]
+	if err = s.touchSession(ctx, userId, sessionId); err != nil {
+		return 0, "", err
+	}
+
+	return userId, sessionId, nil
 }
 
-func (s *Service) Authorized(token string) (int64, error) {
-	str, err := s.Codec.DecodeToString(token)
+// issueToken starts new session for user unless they are suspended, pending deletion of the user
+// is cancelled when cancelDeletion is set, that is when the user logs in themselves
+func (s *Service) issueToken(ctx context.Context, user User, cancelDeletion bool) (LoginOutput, error) {
+	var out LoginOutput
+
+	suspended, err := s.Store.UserSuspended(ctx, user.Id)
+	if errors.Is(err, store.ErrNotFound) {
+		return out, ErrUserNotFound
+	}
+
+	if err != nil {
+		return out, err
+	}
+
+	if suspended {
+		return out, ErrUserSuspended
+	}
+
+	if cancelDeletion {
+		// logging in is how user takes back deletion of their account
+		cancelled, err := s.Store.CancelUserDeletion(ctx, user.Id)
+		if err != nil {
+			return out, err
+		}
+
+		if cancelled {
+			log.Printf("deletion of user %d cancelled by login", user.Id)
+		}
+	}
+
+	sessionId, err := randomString(16)
 	if err != nil {
-		return 0, fmt.Errorf("could not decode token: %v", err)
+		return out, err
 	}
 
-	id, err := strconv.ParseInt(str, 10, 64)
+	refreshToken, err := randomString(32)
 	if err != nil {
-		return 0, fmt.Errorf("could not parse auth user id from token: %v", err)
+		return out, err
 	}
 
-	return id, err
+	userAgent, _ := ctx.Value(KeyUserAgent).(string)
+	ip, _ := ctx.Value(KeyRemoteIP).(string)
+
+	if err = s.Store.DeleteExpiredSessions(ctx, user.Id); err != nil {
+		return out, err
+	}
+
+	session := Session{Id: sessionId, UserAgent: userAgent, IP: ip, ExpiresAt: time.Now().Add(TokenLifeSpan)}
+	if err = s.Store.CreateSession(ctx, user.Id, session, hashToken(refreshToken)); err != nil {
+		return out, err
+	}
+
+	out, err = s.accessToken(user, sessionId)
+	if err != nil {
+		return out, err
+	}
+
+	out.RefreshToken = refreshToken
+	return out, nil
+}
+
+func (s *Service) accessToken(user User, sessionId string) (LoginOutput, error) {
+	var (
+		out LoginOutput
+		err error
+	)
+	out.Token, err = s.Codec.EncodeToString(strconv.FormatInt(user.Id, 10) + ":" + sessionId)
+	if err != nil {
+		return out, fmt.Errorf("cannot generate token")
+	}
+	out.ExpiresAt = time.Now().Add(AccessTokenLifeSpan)
+	out.AuthUser = user
+
+	return out, nil
 }
@@ -0,0 +1,183 @@
+package services
+
+import (
+	"context"
+	"errors"
+	. "social/internal/models"
+	"social/internal/store"
+	"strings"
+)
+
+// ToggleBlockOutput output dto
+type ToggleBlockOutput struct {
+	Blocked bool `json:"blocked"`
+}
+
+// ToggleMuteOutput output dto
+type ToggleMuteOutput struct {
+	Muted bool `json:"muted"`
+}
+
+// ToggleBlock blocks or unblocks user with username, blocking removes follows between the two of them
+// both ways and likes and reposts of the blocked user on posts of the authenticated user,
+// then hides them from each other until unblocked
+func (s *Service) ToggleBlock(ctx context.Context, username string) (ToggleBlockOutput, error) {
+	var out ToggleBlockOutput
+	userId, ok := ctx.Value(KeyAuthUserId).(int64)
+	if !ok {
+		return out, ErrUnauthenticated
+	}
+
+	err := s.Store.Tx(ctx, func(tx store.Store) error {
+		other, err := toggledUser(ctx, tx, userId, username)
+		if err != nil {
+			return err
+		}
+
+		if out.Blocked, err = tx.IsBlocking(ctx, userId, other.Id); err != nil {
+			return err
+		}
+
+		if out.Blocked {
+			return tx.Unblock(ctx, userId, other.Id)
+		}
+
+		err = tx.Block(ctx, userId, other.Id)
+		if errors.Is(err, store.ErrNotFound) {
+			return ErrUserNotFound
+		}
+
+		return err
+	})
+	if err != nil {
+		return out, err
+	}
+
+	out.Blocked = !out.Blocked
+
+	return out, nil
+}
+
+// ToggleMute mutes or unmutes user with username, posts and notifications of muted users
+// are left out of timeline and notifications of the authenticated user
+func (s *Service) ToggleMute(ctx context.Context, username string) (ToggleMuteOutput, error) {
+	var out ToggleMuteOutput
+	userId, ok := ctx.Value(KeyAuthUserId).(int64)
+	if !ok {
+		return out, ErrUnauthenticated
+	}
+
+	err := s.Store.Tx(ctx, func(tx store.Store) error {
+		other, err := toggledUser(ctx, tx, userId, username)
+		if err != nil {
+			return err
+		}
+
+		if out.Muted, err = tx.IsMuting(ctx, userId, other.Id); err != nil {
+			return err
+		}
+
+		if out.Muted {
+			return tx.Unmute(ctx, userId, other.Id)
+		}
+
+		err = tx.Mute(ctx, userId, other.Id)
+		if errors.Is(err, store.ErrNotFound) {
+			return ErrUserNotFound
+		}
+
+		return err
+	})
+	if err != nil {
+		return out, err
+	}
+
+	out.Muted = !out.Muted
+
+	return out, nil
+}
+
+// Blocks lists users the authenticated user blocked, ordered by username
+func (s *Service) Blocks(ctx context.Context, first int, after string) ([]User, error) {
+	userId, ok := ctx.Value(KeyAuthUserId).(int64)
+	if !ok {
+		return nil, ErrUnauthenticated
+	}
+
+	return s.Store.Blocks(ctx, userId, normalizePageSize(first), strings.TrimSpace(after))
+}
+
+// Mutes lists users the authenticated user muted, ordered by username
+func (s *Service) Mutes(ctx context.Context, first int, after string) ([]User, error) {
+	userId, ok := ctx.Value(KeyAuthUserId).(int64)
+	if !ok {
+		return nil, ErrUnauthenticated
+	}
+
+	return s.Store.Mutes(ctx, userId, normalizePageSize(first), strings.TrimSpace(after))
+}
+
+// toggledUser user with username, or who had it until recently, that is not the user with userId
+func toggledUser(ctx context.Context, tx store.Store, userId int64, username string) (User, error) {
+	username = strings.TrimSpace(username)
+	if !rxUsername.MatchString(username) {
+		return User{}, invalidInput("username", "invalid username")
+	}
+
+	user, err := tx.UserByUsername(ctx, username)
+	if errors.Is(err, store.ErrNotFound) {
+		user, err = userByMovedUsername(ctx, tx, username)
+	}
+
+	if errors.Is(err, store.ErrNotFound) {
+		return user, ErrUserNotFound
+	}
+
+	if err != nil {
+		return user, err
+	}
+
+	if user.Id == userId {
+		return user, ErrBlockSelf
+	}
+
+	return user, nil
+}
+
+// checkBlocked returns ErrBlocked when either of the users blocked the other
+func checkBlocked(ctx context.Context, st store.Store, userId, otherId int64) error {
+	if userId == otherId {
+		return nil
+	}
+
+	blocked, err := st.Blocked(ctx, userId, otherId)
+	if err != nil {
+		return err
+	}
+
+	if blocked {
+		return ErrBlocked
+	}
+
+	return nil
+}
+
+// visiblePost post as seen by user with uid, posts of users they blocked or were blocked by do not exist for them
+func (s *Service) visiblePost(ctx context.Context, uid, postId int64) (Post, error) {
+	post, err := s.Store.Post(ctx, postId)
+	if errors.Is(err, store.ErrNotFound) {
+		return post, ErrPostNotFound
+	}
+
+	if err != nil {
+		return post, err
+	}
+
+	if uid != 0 {
+		if err = checkBlocked(ctx, s.Store, uid, post.UserId); errors.Is(err, ErrBlocked) {
+			return post, ErrPostNotFound
+		}
+	}
+
+	return post, err
+}
@@ -0,0 +1,162 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestToggleBlock(t *testing.T) {
+	s := newTestService(t)
+	alice := newTestUser(t, s, "alice")
+	bob := newTestUser(t, s, "bob")
+
+	if _, err := s.ToggleBlock(alice, "alice"); !errors.Is(err, ErrBlockSelf) {
+		t.Fatalf("blocking yourself: want ErrBlockSelf, got %v", err)
+	}
+
+	if _, err := s.ToggleFollow(bob, "alice"); err != nil {
+		t.Fatalf("could not follow: %v", err)
+	}
+
+	item, err := s.CreatePost(alice, "hello", nil, false, nil, nil)
+	if err != nil {
+		t.Fatalf("could not create post: %v", err)
+	}
+
+	postId := item.Post.Id
+	if _, err = s.TogglePostLike(bob, postId); err != nil {
+		t.Fatalf("could not like post: %v", err)
+	}
+
+	if _, err = s.TogglePostRepost(bob, postId); err != nil {
+		t.Fatalf("could not repost post: %v", err)
+	}
+
+	out, err := s.ToggleBlock(alice, "bob")
+	if err != nil {
+		t.Fatalf("could not block: %v", err)
+	}
+
+	if !out.Blocked {
+		t.Fatal("want blocked")
+	}
+
+	post, err := s.GetPostById(alice, postId)
+	if err != nil {
+		t.Fatalf("could not get post: %v", err)
+	}
+
+	if post.LikesCount != 0 || post.RepostsCount != 0 {
+		t.Errorf("want likes and reposts of blocked user removed, got %d likes and %d reposts",
+			post.LikesCount, post.RepostsCount)
+	}
+
+	profile, err := s.GetUserProfile(alice, "alice")
+	if err != nil {
+		t.Fatalf("could not get profile: %v", err)
+	}
+
+	if profile.FollowersCount != 0 {
+		t.Errorf("want follow of blocked user removed, got %d followers", profile.FollowersCount)
+	}
+
+	if _, err = s.GetPostById(bob, postId); !errors.Is(err, ErrPostNotFound) {
+		t.Errorf("blocked user getting post: want ErrPostNotFound, got %v", err)
+	}
+
+	if _, err = s.ToggleFollow(bob, "alice"); !errors.Is(err, ErrBlocked) {
+		t.Errorf("blocked user following: want ErrBlocked, got %v", err)
+	}
+
+	if _, err = s.TogglePostLike(bob, postId); !errors.Is(err, ErrBlocked) {
+		t.Errorf("blocked user liking: want ErrBlocked, got %v", err)
+	}
+
+	comment, err := s.CreateComment(alice, "first", postId, nil)
+	if err != nil {
+		t.Fatalf("could not comment: %v", err)
+	}
+
+	if _, err = s.GetCommentReplies(bob, comment.Id, 0, 0); !errors.Is(err, ErrPostNotFound) {
+		t.Errorf("blocked user getting replies: want ErrPostNotFound, got %v", err)
+	}
+
+	if out, err = s.ToggleBlock(alice, "bob"); err != nil || out.Blocked {
+		t.Fatalf("could not unblock: %v", err)
+	}
+
+	if _, err = s.GetPostById(bob, postId); err != nil {
+		t.Errorf("could not get post after unblock: %v", err)
+	}
+}
+
+func TestToggleMute(t *testing.T) {
+	s := newTestService(t)
+	alice := newTestUser(t, s, "alice")
+	bob := newTestUser(t, s, "bob")
+	carol := newTestUser(t, s, "carol")
+
+	if _, err := s.ToggleMute(alice, "alice"); !errors.Is(err, ErrBlockSelf) {
+		t.Fatalf("muting yourself: want ErrBlockSelf, got %v", err)
+	}
+
+	item, err := s.CreatePost(alice, "hello", nil, false, nil, nil)
+	if err != nil {
+		t.Fatalf("could not create post: %v", err)
+	}
+
+	for _, ctx := range []context.Context{bob, carol} {
+		if _, err = s.TogglePostLike(ctx, item.Post.Id); err != nil {
+			t.Fatalf("could not like post: %v", err)
+		}
+	}
+
+	out, err := s.ToggleMute(alice, "bob")
+	if err != nil {
+		t.Fatalf("could not mute: %v", err)
+	}
+
+	if !out.Muted {
+		t.Fatal("want muted")
+	}
+
+	notifications, err := s.Notifications(alice, 0, 0)
+	if err != nil {
+		t.Fatalf("could not get notifications: %v", err)
+	}
+
+	if len(notifications) != 1 || notifications[0].ActorsCount != 1 || notifications[0].Actors[0] != "carol" {
+		t.Fatalf("want like notification of carol alone, got %+v", notifications)
+	}
+
+	if _, err = s.TogglePostLike(carol, item.Post.Id); err != nil {
+		t.Fatalf("could not unlike post: %v", err)
+	}
+
+	count, err := s.UnreadNotificationsCount(alice)
+	if err != nil {
+		t.Fatalf("could not count unread notifications: %v", err)
+	}
+
+	if count != 0 {
+		t.Errorf("want notification with muted actors alone left out of unread count, got %d", count)
+	}
+
+	mutes, err := s.Mutes(alice, 0, "")
+	if err != nil {
+		t.Fatalf("could not list mutes: %v", err)
+	}
+
+	if len(mutes) != 1 || mutes[0].Id != authUserId(bob) {
+		t.Errorf("want bob muted, got %+v", mutes)
+	}
+
+	if out, err = s.ToggleMute(alice, "bob"); err != nil || out.Muted {
+		t.Fatalf("could not unmute: %v", err)
+	}
+
+	if count, err = s.UnreadNotificationsCount(alice); err != nil || count != 1 {
+		t.Errorf("want like of bob back after unmute, got %d, %v", count, err)
+	}
+}
@@ -0,0 +1,77 @@
+package services
+
+import (
+	"log"
+	"sync"
+)
+
+// subscriptionBuffer how many messages can wait for slow subscriber before it gets closed
+const subscriptionBuffer = 16
+
+// broker in-process pub/sub delivering messages to subscribers of a user, subscribers that fall
+// behind by more than subscriptionBuffer messages are closed so their clients reconnect and catch up
+// from the store instead of silently missing messages.
+//
+// Messages only reach subscribers of the same process, with several instances behind a load balancer
+// a timeline item fanned out by a job worker of another instance is not streamed live, the client
+// gets it from the store once it reconnects with Last-Event-ID, notifications are fetched again
+// on reconnect. Live delivery across instances needs pub/sub shared by them, like Postgres
+// LISTEN/NOTIFY, in place of this broker.
+type broker struct {
+	name string
+	mu   sync.Mutex
+	subs map[int64]map[chan interface{}]struct{}
+}
+
+func newBroker(name string) *broker {
+	return &broker{
+		name: name,
+		subs: make(map[int64]map[chan interface{}]struct{}),
+	}
+}
+
+// subscribe registers new subscription for user, returned func must be called to release it,
+// the channel is closed once it is released or the subscriber falls behind
+func (b *broker) subscribe(userId int64) (<-chan interface{}, func()) {
+	c := make(chan interface{}, subscriptionBuffer)
+
+	b.mu.Lock()
+	if _, ok := b.subs[userId]; !ok {
+		b.subs[userId] = make(map[chan interface{}]struct{})
+	}
+	b.subs[userId][c] = struct{}{}
+	b.mu.Unlock()
+
+	return c, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		b.remove(userId, c)
+	}
+}
+
+// publish sends message to every subscription of user without blocking
+func (b *broker) publish(userId int64, v interface{}) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for c := range b.subs[userId] {
+		select {
+		case c <- v:
+		default:
+			log.Printf("%s subscriber of user %d is too slow, closing it", b.name, userId)
+			b.remove(userId, c)
+		}
+	}
+}
+
+// remove closes subscription of user unless it is already closed, b.mu must be held
+func (b *broker) remove(userId int64, c chan interface{}) {
+	if _, ok := b.subs[userId][c]; !ok {
+		return
+	}
+
+	delete(b.subs[userId], c)
+	if len(b.subs[userId]) == 0 {
+		delete(b.subs, userId)
+	}
+	close(c)
+}
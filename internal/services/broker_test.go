@@ -0,0 +1,42 @@
+package services
+
+import "testing"
+
+func TestBroker(t *testing.T) {
+	b := newBroker("test")
+	sub, unsubscribe := b.subscribe(1)
+	other, unsubscribeOther := b.subscribe(2)
+	defer unsubscribeOther()
+
+	b.publish(1, "hello")
+	if v := <-sub; v != "hello" {
+		t.Errorf("want hello, got %v", v)
+	}
+
+	select {
+	case v := <-other:
+		t.Errorf("want messages of other users left out, got %v", v)
+	default:
+	}
+
+	for i := 0; i <= subscriptionBuffer; i++ {
+		b.publish(1, i)
+	}
+
+	var received int
+	for range sub {
+		received++
+	}
+
+	if received != subscriptionBuffer {
+		t.Errorf("want buffered messages delivered before slow subscriber is closed, got %d", received)
+	}
+
+	// releasing subscription closed by publish must not close it again
+	unsubscribe()
+
+	b.publish(1, "after")
+	if len(b.subs) != 1 {
+		t.Errorf("want closed subscription forgotten, got %d users subscribed", len(b.subs))
+	}
+}
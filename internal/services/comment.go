@@ -2,44 +2,278 @@ package services
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	. "social/internal/models"
+	"social/internal/store"
+	"strings"
 )
 
-func (s *Service) CreateComment(ctx context.Context, content string, postId int64) (Comment, error) {
+const (
+	CommentsNewestFirst = "newest"
+	CommentsOldestFirst = "oldest"
+
+	// maxCommentDepth how deep replies can be nested, top level comments have depth 0
+	maxCommentDepth = 8
+	// previewRepliesCount how many replies are returned along with each comment
+	previewRepliesCount = 3
+)
+
+// CreateComment adds comment to post, or reply to comment when parentId is given
+func (s *Service) CreateComment(ctx context.Context, content string, postId int64, parentId *int64) (Comment, error) {
 	var result Comment
 	userId, ok := ctx.Value(KeyAuthUserId).(int64)
 	if !ok {
-		return result, fmt.Errorf("unauthorized")
+		return result, ErrUnauthenticated
 	}
 
-	query := `insert into comments(user_id,post_id,content) values(@userId,@postId,@content) returning id`
-	query, args, err := queryBuilder(query, map[string]interface{}{
-		"userId":  userId,
-		"postId":  postId,
-		"content": content,
+	content = strings.TrimSpace(content)
+	if content == "" || len([]rune(content)) > 480 {
+		return result, invalidInput("content", "must be between 1 and 480 characters")
+	}
+
+	var (
+		notificationId, replyNotificationId int64
+		mentionNotificationIds              []int64
+	)
+	err := s.Store.Tx(ctx, func(tx store.Store) error {
+		comment := Comment{UserId: userId, PostId: postId, ParentId: parentId, Content: content}
+
+		var parent Comment
+		if parentId != nil {
+			var err error
+			parent, err = tx.IncrementRepliesCount(ctx, *parentId)
+			if errors.Is(err, store.ErrNotFound) {
+				return ErrCommentNotFound
+			}
+
+			if err != nil {
+				return err
+			}
+
+			if parent.PostId != postId {
+				return invalidInput("parentId", "must be comment of the same post")
+			}
+
+			if err = checkBlocked(ctx, tx, userId, parent.UserId); err != nil {
+				return err
+			}
+
+			comment.Depth = parent.Depth + 1
+			if comment.Depth > maxCommentDepth {
+				return invalidInput("parentId", "replies are nested too deep")
+			}
+		}
+
+		var err error
+		result, err = tx.CreateComment(ctx, comment)
+		if errors.Is(err, store.ErrNotFound) {
+			return ErrPostNotFound
+		}
+
+		if err != nil {
+			return err
+		}
+
+		authorId, err := tx.IncrementCommentsCount(ctx, postId)
+		if err != nil {
+			return err
+		}
+
+		if err = checkBlocked(ctx, tx, userId, authorId); err != nil {
+			return err
+		}
+
+		if notificationId, err = s.notify(ctx, tx, authorId, userId, NotificationComment, &postId); err != nil {
+			return err
+		}
+
+		if parentId != nil && parent.UserId != authorId {
+			if replyNotificationId, err = s.notify(ctx, tx, parent.UserId, userId, NotificationReply, &postId); err != nil {
+				return err
+			}
+		}
+
+		if result.Mentions, err = resolveMentions(ctx, tx, userId, content); err != nil {
+			return err
+		}
+
+		if len(result.Mentions) == 0 {
+			return nil
+		}
+
+		if err = tx.AddCommentMentions(ctx, result.Id, result.Mentions); err != nil {
+			return err
+		}
+
+		mentionNotificationIds, err = s.notifyMentions(ctx, tx, mentionedUserIds(result.Mentions), userId, postId)
+		return err
 	})
+	if err != nil {
+		return result, err
+	}
 
-	if err = s.Db.QueryRowContext(ctx, query, args...).Scan(&result.Id); err != nil {
-		return result, fmt.Errorf("cannot insert comment")
+	s.publishNotification(notificationId)
+	s.publishNotification(replyNotificationId)
+	for _, id := range mentionNotificationIds {
+		s.publishNotification(id)
 	}
+
 	user, err := s.GetUserById(ctx, userId)
 	if err != nil {
 		return result, fmt.Errorf("cannot find user, %v", err)
 	}
 
 	result.Liked = false
-	result.PostId = postId
-	result.Content = content
-	result.UserId = userId
-	result.User = &User{
-		Id:        userId,
-		Username:  user.Username,
-		AvatarUrl: user.AvatarUrl,
-	}
+	result.User = &user
 	result.LikesCount = 0
 	result.Mine = true
 
 	return result, nil
 
 }
+
+// GetComments fetch top level comments of a post with their first replies, order is either
+// CommentsNewestFirst or CommentsOldestFirst and after is id of the last comment from the previous page
+func (s *Service) GetComments(ctx context.Context, postId int64, last int, after int64, order string) ([]Comment, error) {
+	if order == "" {
+		order = CommentsNewestFirst
+	}
+
+	if order != CommentsNewestFirst && order != CommentsOldestFirst {
+		return nil, invalidInput("order", "must be newest or oldest")
+	}
+
+	uid, _ := ctx.Value(KeyAuthUserId).(int64)
+	if _, err := s.visiblePost(ctx, uid, postId); err != nil {
+		return nil, err
+	}
+
+	comments, err := s.Store.Comments(ctx, uid, postId, normalizePageSize(last), after, order == CommentsOldestFirst)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = s.previewReplies(ctx, comments, uid); err != nil {
+		return nil, err
+	}
+
+	if err = s.withCommentMentions(ctx, comments); err != nil {
+		return nil, err
+	}
+
+	return comments, nil
+}
+
+// GetCommentReplies fetch direct replies of a comment, oldest first, after is id of the last reply
+// from the previous page, or RepliesCursor of the comment to continue after its first replies
+func (s *Service) GetCommentReplies(ctx context.Context, commentId int64, last int, after int64) ([]Comment, error) {
+	postId, err := s.Store.CommentPostId(ctx, commentId)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, ErrCommentNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	uid, _ := ctx.Value(KeyAuthUserId).(int64)
+	if _, err = s.visiblePost(ctx, uid, postId); err != nil {
+		return nil, err
+	}
+
+	replies, err := s.Store.CommentReplies(ctx, uid, commentId, normalizePageSize(last), after)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = s.previewReplies(ctx, replies, uid); err != nil {
+		return nil, err
+	}
+
+	if err = s.withCommentMentions(ctx, replies); err != nil {
+		return nil, err
+	}
+
+	return replies, nil
+}
+
+// ToggleCommentLike likes or unlikes comment
+func (s *Service) ToggleCommentLike(ctx context.Context, commentId int64) (ToggleLikeOutput, error) {
+	var result ToggleLikeOutput
+
+	userId, ok := ctx.Value(KeyAuthUserId).(int64)
+	if !ok {
+		return result, ErrUnauthenticated
+	}
+
+	err := s.Store.Tx(ctx, func(tx store.Store) error {
+		var err error
+		if result.Liked, err = tx.IsCommentLiked(ctx, userId, commentId); err != nil {
+			return err
+		}
+
+		var authorId int64
+		if result.Liked {
+			result.LikesCount, authorId, err = tx.UnlikeComment(ctx, userId, commentId)
+		} else {
+			result.LikesCount, authorId, err = tx.LikeComment(ctx, userId, commentId)
+		}
+
+		if errors.Is(err, store.ErrNotFound) {
+			return ErrCommentNotFound
+		}
+
+		if err != nil || result.Liked {
+			return err
+		}
+
+		return checkBlocked(ctx, tx, userId, authorId)
+	})
+	if err != nil {
+		return result, err
+	}
+
+	result.Liked = !result.Liked
+
+	return result, nil
+}
+
+// previewReplies fills first replies of each comment and marks comments of user with uid as mine
+func (s *Service) previewReplies(ctx context.Context, comments []Comment, uid int64) error {
+	var parentIds []int64
+	for i, c := range comments {
+		comments[i].Mine = uid != 0 && c.UserId == uid
+		if c.RepliesCount > 0 {
+			parentIds = append(parentIds, c.Id)
+		}
+	}
+
+	if len(parentIds) == 0 {
+		return nil
+	}
+
+	// one more than shown tells whether there are more replies to load
+	replies, err := s.Store.PreviewReplies(ctx, uid, parentIds, previewRepliesCount+1)
+	if err != nil {
+		return err
+	}
+
+	byParent := make(map[int64][]Comment, len(parentIds))
+	for _, r := range replies {
+		r.Mine = uid != 0 && r.UserId == uid
+		byParent[*r.ParentId] = append(byParent[*r.ParentId], r)
+	}
+
+	for i := range comments {
+		rr := byParent[comments[i].Id]
+		if len(rr) > previewRepliesCount {
+			rr = rr[:previewRepliesCount]
+			cursor := rr[len(rr)-1].Id
+			comments[i].RepliesCursor = &cursor
+		}
+		comments[i].Replies = rr
+	}
+
+	return nil
+}
@@ -0,0 +1,215 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestCreateCommentValidation(t *testing.T) {
+	s := newTestService(t)
+	ctx := newTestUser(t, s, "alice")
+
+	item, err := s.CreatePost(ctx, "hello", nil, false, nil, nil)
+	if err != nil {
+		t.Fatalf("could not create post: %v", err)
+	}
+
+	for _, content := range []string{"  ", strings.Repeat("a", 481)} {
+		_, err = s.CreateComment(ctx, content, item.Post.Id, nil)
+		assertInvalidField(t, err, "content")
+	}
+
+	comment, err := s.CreateComment(ctx, strings.Repeat("ñ", 480), item.Post.Id, nil)
+	if err != nil {
+		t.Fatalf("could not create comment at the limit: %v", err)
+	}
+
+	if comment.Content != strings.Repeat("ñ", 480) {
+		t.Errorf("want content kept, got %q", comment.Content)
+	}
+}
+
+func TestGetComments(t *testing.T) {
+	s := newTestService(t)
+	alice := newTestUser(t, s, "alice")
+	bob := newTestUser(t, s, "bob")
+
+	item, err := s.CreatePost(alice, "hello", nil, false, nil, nil)
+	if err != nil {
+		t.Fatalf("could not create post: %v", err)
+	}
+
+	postId := item.Post.Id
+	var ids []int64
+	for _, content := range []string{"first", "second", "third"} {
+		c, err := s.CreateComment(bob, content, postId, nil)
+		if err != nil {
+			t.Fatalf("could not comment: %v", err)
+		}
+
+		ids = append(ids, c.Id)
+	}
+
+	if _, err = s.CreateComment(bob, "hi", postId+1, nil); !errors.Is(err, ErrPostNotFound) {
+		t.Errorf("commenting missing post: want ErrPostNotFound, got %v", err)
+	}
+
+	post, err := s.GetPostById(alice, postId)
+	if err != nil {
+		t.Fatalf("could not get post: %v", err)
+	}
+
+	if post.CommentsCount != 3 {
+		t.Errorf("want 3 comments counted, got %d", post.CommentsCount)
+	}
+
+	if _, err = s.GetComments(alice, postId, 0, 0, "top"); err == nil {
+		t.Error("want unknown order rejected")
+	}
+
+	newest, err := s.GetComments(alice, postId, 2, 0, "")
+	if err != nil {
+		t.Fatalf("could not get comments: %v", err)
+	}
+
+	if len(newest) != 2 || newest[0].Id != ids[2] || newest[1].Id != ids[1] {
+		t.Fatalf("want two newest comments first, got %+v", newest)
+	}
+
+	rest, err := s.GetComments(alice, postId, 2, newest[1].Id, CommentsNewestFirst)
+	if err != nil || len(rest) != 1 || rest[0].Id != ids[0] {
+		t.Errorf("want oldest comment on the next page, got %+v, %v", rest, err)
+	}
+
+	oldest, err := s.GetComments(alice, postId, 0, ids[0], CommentsOldestFirst)
+	if err != nil || len(oldest) != 2 || oldest[0].Id != ids[1] || oldest[1].Id != ids[2] {
+		t.Errorf("want comments after the first one, oldest first, got %+v, %v", oldest, err)
+	}
+
+	if newest[0].Mine {
+		t.Error("want comments of someone else not mine")
+	}
+}
+
+func TestToggleCommentLike(t *testing.T) {
+	s := newTestService(t)
+	alice := newTestUser(t, s, "alice")
+	bob := newTestUser(t, s, "bob")
+
+	item, err := s.CreatePost(alice, "hello", nil, false, nil, nil)
+	if err != nil {
+		t.Fatalf("could not create post: %v", err)
+	}
+
+	comment, err := s.CreateComment(alice, "first", item.Post.Id, nil)
+	if err != nil {
+		t.Fatalf("could not comment: %v", err)
+	}
+
+	for _, ctx := range []context.Context{alice, bob} {
+		if out, err := s.ToggleCommentLike(ctx, comment.Id); err != nil || !out.Liked {
+			t.Fatalf("could not like comment: %+v, %v", out, err)
+		}
+	}
+
+	comments, err := s.GetComments(bob, item.Post.Id, 0, 0, "")
+	if err != nil || len(comments) != 1 {
+		t.Fatalf("could not get comments: %+v, %v", comments, err)
+	}
+
+	if comments[0].LikesCount != 2 || !comments[0].Liked {
+		t.Errorf("want 2 likes, liked by viewer, got %+v", comments[0])
+	}
+
+	out, err := s.ToggleCommentLike(bob, comment.Id)
+	if err != nil || out.Liked || out.LikesCount != 1 {
+		t.Errorf("want unliked with 1 like left, got %+v, %v", out, err)
+	}
+
+	if _, err = s.ToggleCommentLike(bob, comment.Id+1); !errors.Is(err, ErrCommentNotFound) {
+		t.Errorf("liking missing comment: want ErrCommentNotFound, got %v", err)
+	}
+}
+
+func TestCommentReplies(t *testing.T) {
+	s := newTestService(t)
+	alice := newTestUser(t, s, "alice")
+	bob := newTestUser(t, s, "bob")
+
+	item, err := s.CreatePost(alice, "hello", nil, false, nil, nil)
+	if err != nil {
+		t.Fatalf("could not create post: %v", err)
+	}
+
+	postId := item.Post.Id
+	parent, err := s.CreateComment(alice, "top", postId, nil)
+	if err != nil {
+		t.Fatalf("could not comment: %v", err)
+	}
+
+	var replyIds []int64
+	for i := 0; i < previewRepliesCount+2; i++ {
+		reply, err := s.CreateComment(bob, "reply", postId, &parent.Id)
+		if err != nil {
+			t.Fatalf("could not reply: %v", err)
+		}
+
+		if reply.Depth != 1 || reply.ParentId == nil || *reply.ParentId != parent.Id {
+			t.Fatalf("want direct reply at depth 1, got %+v", reply)
+		}
+
+		replyIds = append(replyIds, reply.Id)
+	}
+
+	comments, err := s.GetComments(alice, postId, 0, 0, "")
+	if err != nil || len(comments) != 1 {
+		t.Fatalf("want replies left out of top level comments, got %+v, %v", comments, err)
+	}
+
+	top := comments[0]
+	if top.RepliesCount != len(replyIds) || len(top.Replies) != previewRepliesCount || top.RepliesCursor == nil {
+		t.Fatalf("want %d replies previewed with cursor to the rest, got %+v", previewRepliesCount, top)
+	}
+
+	rest, err := s.GetCommentReplies(alice, parent.Id, 0, *top.RepliesCursor)
+	if err != nil {
+		t.Fatalf("could not get replies: %v", err)
+	}
+
+	if len(rest) != 2 || rest[0].Id != replyIds[previewRepliesCount] || rest[1].Id != replyIds[previewRepliesCount+1] {
+		t.Errorf("want remaining replies after cursor, oldest first, got %+v", rest)
+	}
+
+	if _, err = s.GetCommentReplies(alice, replyIds[len(replyIds)-1]+100, 0, 0); !errors.Is(err, ErrCommentNotFound) {
+		t.Errorf("replies of missing comment: want ErrCommentNotFound, got %v", err)
+	}
+
+	other, err := s.CreatePost(alice, "other", nil, false, nil, nil)
+	if err != nil {
+		t.Fatalf("could not create post: %v", err)
+	}
+
+	_, err = s.CreateComment(bob, "reply", other.Post.Id, &parent.Id)
+	assertInvalidField(t, err, "parentId")
+
+	deepest := parent
+	for depth := 1; depth <= maxCommentDepth; depth++ {
+		if deepest, err = s.CreateComment(bob, "deeper", postId, &deepest.Id); err != nil {
+			t.Fatalf("could not reply at depth %d: %v", depth, err)
+		}
+	}
+
+	_, err = s.CreateComment(alice, "too deep", postId, &deepest.Id)
+	assertInvalidField(t, err, "parentId")
+
+	replies, err := s.GetCommentReplies(alice, *deepest.ParentId, 0, 0)
+	if err != nil || len(replies) != 1 || replies[0].Id != deepest.Id {
+		t.Fatalf("could not get deepest reply: %+v, %v", replies, err)
+	}
+
+	if replies[0].RepliesCount != 0 {
+		t.Errorf("want replies count of parent rolled back with rejected reply, got %d", replies[0].RepliesCount)
+	}
+}
@@ -0,0 +1,124 @@
+package services
+
+import (
+	"context"
+	"expvar"
+	"log"
+	"social/internal/store"
+	"time"
+)
+
+const (
+	// countsBatchSize rows reconciled per transaction, so locks are held only briefly
+	countsBatchSize = 500
+	// countsSamples mismatches listed in report of each counter
+	countsSamples = 20
+)
+
+// countsMetrics totals of counts reconciliation, published with expvar
+var countsMetrics = expvar.NewMap("counts")
+
+// CounterReport how many rows of counter were checked and how many of them were wrong
+type CounterReport struct {
+	Counter    string `json:"counter"`
+	Checked    int    `json:"checked"`
+	Mismatched int    `json:"mismatched"`
+	// Samples first few mismatches, with counts as they were before the fix
+	Samples []store.CountMismatch `json:"samples"`
+}
+
+// CountsReport result of reconciling every counter, Fixed tells whether mismatches were repaired
+type CountsReport struct {
+	Fixed     bool            `json:"fixed"`
+	StartedAt time.Time       `json:"startedAt"`
+	Counters  []CounterReport `json:"counters"`
+}
+
+// CheckCounts reports denormalized counts that differ from rows they count without fixing them
+func (s *Service) CheckCounts(ctx context.Context) (CountsReport, error) {
+	if err := s.CheckAdmin(ctx); err != nil {
+		return CountsReport{}, err
+	}
+
+	return s.reconcileCounts(ctx, false)
+}
+
+// ReconcileCounts fixes denormalized counts right away instead of waiting for the scheduled run
+func (s *Service) ReconcileCounts(ctx context.Context) (CountsReport, error) {
+	if err := s.CheckAdmin(ctx); err != nil {
+		return CountsReport{}, err
+	}
+
+	return s.reconcileCounts(ctx, true)
+}
+
+// RunCountsReconciler fixes denormalized counts every interval until ctx is done
+func (s *Service) RunCountsReconciler(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if _, err := s.reconcileCounts(ctx, true); err != nil && ctx.Err() == nil {
+			log.Printf("could not reconcile counts, %v", err)
+		}
+	}
+}
+
+// reconcileCounts walks every counter in batches, each batch in its own transaction
+func (s *Service) reconcileCounts(ctx context.Context, fix bool) (CountsReport, error) {
+	report := CountsReport{Fixed: fix, StartedAt: time.Now()}
+	for _, counter := range store.Counters {
+		r := CounterReport{Counter: counter, Samples: []store.CountMismatch{}}
+		var afterId int64
+		for {
+			var batch store.CountBatch
+			err := s.Store.Tx(ctx, func(tx store.Store) error {
+				var err error
+				batch, err = tx.ReconcileCounts(ctx, counter, afterId, countsBatchSize, fix)
+				return err
+			})
+			if err != nil {
+				return report, err
+			}
+
+			if batch.Checked == 0 {
+				break
+			}
+
+			r.Checked += batch.Checked
+			r.Mismatched += len(batch.Mismatches)
+			for _, m := range batch.Mismatches {
+				if len(r.Samples) < countsSamples {
+					r.Samples = append(r.Samples, m)
+				}
+			}
+
+			afterId = batch.LastId
+		}
+
+		if fix {
+			countsMetrics.Add(counter+".fixed", int64(r.Mismatched))
+			if r.Mismatched != 0 {
+				log.Printf("fixed %s of %d out of %d rows", counter, r.Mismatched, r.Checked)
+			}
+		}
+
+		report.Counters = append(report.Counters, r)
+	}
+
+	if fix {
+		countsMetrics.Add("runs", 1)
+		last := new(expvar.Int)
+		last.Set(report.StartedAt.Unix())
+		countsMetrics.Set("last_run", last)
+		log.Printf("reconciled counts in %s", time.Since(report.StartedAt).Round(time.Millisecond))
+	}
+
+	return report, nil
+}
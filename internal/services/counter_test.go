@@ -0,0 +1,49 @@
+package services
+
+import (
+	"errors"
+	"social/internal/store"
+	"testing"
+)
+
+func TestCheckCounts(t *testing.T) {
+	s := newTestService(t)
+	ctx := newTestUser(t, s, "alice")
+	bob := newTestUser(t, s, "bob")
+
+	if _, err := s.ToggleFollow(bob, "alice"); err != nil {
+		t.Fatalf("could not follow: %v", err)
+	}
+
+	if _, err := s.CheckCounts(ctx); !errors.Is(err, ErrNotAdmin) {
+		t.Fatalf("want ErrNotAdmin, got %v", err)
+	}
+
+	if _, err := s.ReconcileCounts(ctx); !errors.Is(err, ErrNotAdmin) {
+		t.Fatalf("want ErrNotAdmin, got %v", err)
+	}
+
+	if err := s.Store.SetAdmin(ctx, authUserId(ctx), true); err != nil {
+		t.Fatalf("could not make alice admin: %v", err)
+	}
+
+	report, err := s.CheckCounts(ctx)
+	if err != nil || report.Fixed || len(report.Counters) != len(store.Counters) {
+		t.Fatalf("want report of every counter, got %+v, %v", report, err)
+	}
+
+	for i, r := range report.Counters {
+		if r.Counter != store.Counters[i] || r.Mismatched != 0 || r.Samples == nil {
+			t.Errorf("want %s in sync, got %+v", store.Counters[i], r)
+		}
+	}
+
+	// users are the rows of followers_count
+	if report.Counters[0].Checked != 2 {
+		t.Errorf("want 2 users checked, got %d", report.Counters[0].Checked)
+	}
+
+	if report, err = s.ReconcileCounts(ctx); err != nil || !report.Fixed {
+		t.Errorf("want fixing report, got %+v, %v", report, err)
+	}
+}
@@ -0,0 +1,81 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Kinds of errors returned by Service methods, handlers map them to status codes,
+// every other error is internal
+var (
+	// ErrUnauthenticated returned when there is no authenticated user in context
+	ErrUnauthenticated = errors.New("unauthenticated")
+	// ErrNotFound returned when requested record does not exist
+	ErrNotFound = errors.New("not found")
+	// ErrInvalidInput returned when input does not pass validation, see InvalidInputError for details
+	ErrInvalidInput = errors.New("invalid input")
+	// ErrForbidden returned when authenticated user is not allowed to do the action
+	ErrForbidden = errors.New("forbidden")
+	// ErrConflict returned when action conflicts with existing data
+	ErrConflict = errors.New("conflict")
+)
+
+var (
+	ErrUserNotFound         = fmt.Errorf("user %w", ErrNotFound)
+	ErrPostNotFound         = fmt.Errorf("post %w", ErrNotFound)
+	ErrCommentNotFound      = fmt.Errorf("comment %w", ErrNotFound)
+	ErrNotificationNotFound = fmt.Errorf("notification %w", ErrNotFound)
+	ErrExportNotFound       = fmt.Errorf("export %w", ErrNotFound)
+
+	ErrEmailTaken    = fmt.Errorf("email taken: %w", ErrConflict)
+	ErrUsernameTaken = fmt.Errorf("username taken: %w", ErrConflict)
+
+	// ErrNotPostAuthor returned when user tries to change post of someone else
+	ErrNotPostAuthor = fmt.Errorf("only author can change the post: %w", ErrForbidden)
+	// ErrFollowSelf returned when user tries to follow themselves
+	ErrFollowSelf = fmt.Errorf("cannot follow yourself: %w", ErrForbidden)
+	// ErrBlockSelf returned when user tries to block or mute themselves
+	ErrBlockSelf = fmt.Errorf("cannot block or mute yourself: %w", ErrForbidden)
+	// ErrBlocked returned when user interacts with someone they blocked or were blocked by
+	ErrBlocked = fmt.Errorf("blocked: %w", ErrForbidden)
+	// ErrNotAdmin returned when user who is not admin tries admin action
+	ErrNotAdmin = fmt.Errorf("admin only: %w", ErrForbidden)
+	// ErrUsernameChangeCooldown returned when user changes username again within UsernameChangeCooldown
+	ErrUsernameChangeCooldown = fmt.Errorf("username changed too recently: %w", ErrForbidden)
+	// ErrUserSuspended returned when suspended user tries to log in
+	ErrUserSuspended = fmt.Errorf("user suspended: %w", ErrForbidden)
+	// ErrDevLoginDisabled returned by Login unless DevLogin is enabled
+	ErrDevLoginDisabled = fmt.Errorf("dev login disabled: %w", ErrForbidden)
+	// ErrInvalidToken returned for malformed, expired or revoked access or refresh token
+	ErrInvalidToken = fmt.Errorf("invalid token: %w", ErrUnauthenticated)
+	// ErrInvalidVerificationCode returned for unknown or already used magic link code
+	ErrInvalidVerificationCode = fmt.Errorf("invalid verification code: %w", ErrInvalidInput)
+	// ErrExpiredVerificationCode returned for magic link code older than VerificationCodeLifeSpan
+	ErrExpiredVerificationCode = fmt.Errorf("verification code expired: %w", ErrInvalidInput)
+)
+
+// InvalidInputError lists invalid fields of the input with reason for each of them
+type InvalidInputError struct {
+	Fields map[string]string
+}
+
+func (e *InvalidInputError) Error() string {
+	fields := make([]string, 0, len(e.Fields))
+	for field, reason := range e.Fields {
+		fields = append(fields, field+": "+reason)
+	}
+	sort.Strings(fields)
+
+	return "invalid input: " + strings.Join(fields, ", ")
+}
+
+// Is makes errors.Is(err, ErrInvalidInput) report true
+func (e *InvalidInputError) Is(target error) bool {
+	return target == ErrInvalidInput
+}
+
+func invalidInput(field, reason string) error {
+	return &InvalidInputError{Fields: map[string]string{field: reason}}
+}
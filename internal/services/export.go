@@ -0,0 +1,289 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	gonanoid "github.com/matoous/go-nanoid"
+	"html/template"
+	"io"
+	"log"
+	"os"
+	"social/internal/blob"
+	. "social/internal/models"
+	"social/internal/store"
+	"time"
+)
+
+const (
+	jobExportUser = "export_user"
+	// ExportsPrefix key prefix of export archives, blob store must not serve them publicly
+	ExportsPrefix = "exports/"
+	// ExportCooldown how long user waits before asking for another export, asking sooner returns the previous one
+	ExportCooldown = time.Hour * 24
+	// ExportLinkLifeSpan how long download link of an export works
+	ExportLinkLifeSpan = time.Hour * 24
+)
+
+type exportUserPayload struct {
+	ExportId int64 `json:"exportId"`
+}
+
+var exportReadyTemplate = template.Must(template.New("export_ready").Parse(`<!DOCTYPE html>
+<html>
+<body>
+	<p>Hi {{ .Username }},</p>
+	<p>The archive of your data you asked for is ready, <a href="{{ .Link }}" target="_blank">click here to download it</a>. The link expires in {{ .LifeSpan }}, you can get a new one from your account settings.</p>
+</body>
+</html>`))
+
+// RequestExport queues building an archive of everything the authenticated user created,
+// while their previous export is younger than ExportCooldown that one is returned instead
+func (s *Service) RequestExport(ctx context.Context) (UserExport, error) {
+	var export UserExport
+	userId, ok := ctx.Value(KeyAuthUserId).(int64)
+	if !ok {
+		return export, ErrUnauthenticated
+	}
+
+	err := s.Store.Tx(ctx, func(tx store.Store) error {
+		var err error
+		export, err = tx.LatestExport(ctx, userId)
+		if err == nil && time.Since(export.CreatedAt) < ExportCooldown {
+			return nil
+		}
+
+		if err != nil && !errors.Is(err, store.ErrNotFound) {
+			return err
+		}
+
+		export, err = tx.CreateExport(ctx, userId)
+		if errors.Is(err, store.ErrNotFound) {
+			return ErrUserNotFound
+		}
+
+		if err != nil {
+			return err
+		}
+
+		return s.enqueueJob(ctx, tx, jobExportUser, exportUserPayload{ExportId: export.Id})
+	})
+	if err != nil {
+		return export, err
+	}
+
+	return s.withExportUrl(export)
+}
+
+// LatestExport most recently requested export of the authenticated user, Url is set once it is built
+func (s *Service) LatestExport(ctx context.Context) (UserExport, error) {
+	userId, ok := ctx.Value(KeyAuthUserId).(int64)
+	if !ok {
+		return UserExport{}, ErrUnauthenticated
+	}
+
+	export, err := s.Store.LatestExport(ctx, userId)
+	if errors.Is(err, store.ErrNotFound) {
+		return export, ErrExportNotFound
+	}
+
+	if err != nil {
+		return export, err
+	}
+
+	return s.withExportUrl(export)
+}
+
+// withExportUrl sets download link of built export
+func (s *Service) withExportUrl(export UserExport) (UserExport, error) {
+	if export.File == "" {
+		return export, nil
+	}
+
+	url, err := s.Blobs.SignedURL(ExportsPrefix+export.File, ExportLinkLifeSpan)
+	if err != nil {
+		return export, err
+	}
+
+	export.Url = &url
+	return export, nil
+}
+
+func (s *Service) exportUserJob(ctx context.Context, payload []byte) error {
+	var in exportUserPayload
+	if err := json.Unmarshal(payload, &in); err != nil {
+		return fmt.Errorf("could not unmarshal export payload, %v", err)
+	}
+
+	export, err := s.Store.Export(ctx, in.ExportId)
+	if errors.Is(err, store.ErrNotFound) {
+		// user deleted in the meantime
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("could not fetch export, %v", err)
+	}
+
+	if export.File != "" {
+		return nil
+	}
+
+	archive, err := s.Store.UserArchive(ctx, export.UserId)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("could not collect user archive, %v", err)
+	}
+
+	// media may not fit in memory, so the archive is written to disk before it is stored
+	f, err := os.CreateTemp("", "export-*.zip")
+	if err != nil {
+		return fmt.Errorf("could not create export file, %v", err)
+	}
+
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	if err = s.writeArchive(ctx, f, archive); err != nil {
+		return err
+	}
+
+	if _, err = f.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("could not rewind export file, %v", err)
+	}
+
+	name, err := gonanoid.Nanoid()
+	if err != nil {
+		return fmt.Errorf("could not generate export name, %v", err)
+	}
+
+	name += ".zip"
+	if err = s.Blobs.Put(ctx, ExportsPrefix+name, f, "application/zip"); err != nil {
+		return err
+	}
+
+	if err = s.Store.CompleteExport(ctx, export.Id, name); err != nil {
+		s.deleteBlob(ctx, ExportsPrefix+name)
+		if errors.Is(err, store.ErrNotFound) {
+			return nil
+		}
+
+		return err
+	}
+
+	export.File = name
+	if err = s.mailExportReady(archive.Profile, export); err != nil {
+		// the export is there anyway, user finds it in their settings
+		log.Printf("could not mail export %d is ready, %v", export.Id, err)
+	}
+
+	return nil
+}
+
+// writeArchive writes archive.json along with avatar, cover and media files of the user into w as zip,
+// urls in archive.json point to the files within the zip
+func (s *Service) writeArchive(ctx context.Context, w io.Writer, archive store.UserArchive) error {
+	zw := zip.NewWriter(w)
+
+	var files []string
+	if archive.Profile.AvatarUrl != nil {
+		avatar := "avatar/" + *archive.Profile.AvatarUrl
+		files = append(files, avatarsPrefix+*archive.Profile.AvatarUrl, avatar)
+		archive.Profile.AvatarUrl = &avatar
+	}
+
+	if archive.Profile.CoverUrl != nil {
+		cover := "cover/" + *archive.Profile.CoverUrl
+		files = append(files, coversPrefix+*archive.Profile.CoverUrl, cover)
+		archive.Profile.CoverUrl = &cover
+	}
+
+	postIndex := make(map[int64]int, len(archive.Posts))
+	for i, p := range archive.Posts {
+		postIndex[p.Id] = i
+	}
+
+	for _, m := range archive.Media {
+		files = append(files, mediaPrefix+m.File, "media/"+m.File, mediaPrefix+m.Thumbnail, "media/"+m.Thumbnail)
+		if m.PostId == nil {
+			continue
+		}
+
+		if i, ok := postIndex[*m.PostId]; ok {
+			m.Url, m.ThumbnailUrl = "media/"+m.File, "media/"+m.Thumbnail
+			archive.Posts[i].Media = append(archive.Posts[i].Media, m)
+		}
+	}
+
+	b, err := json.MarshalIndent(archive, "", "\t")
+	if err != nil {
+		return fmt.Errorf("could not marshal user archive, %v", err)
+	}
+
+	if err = writeZipFile(zw, "archive.json", bytes.NewReader(b)); err != nil {
+		return err
+	}
+
+	for i := 0; i < len(files); i += 2 {
+		rc, err := s.Blobs.Get(ctx, files[i])
+		if errors.Is(err, blob.ErrNotFound) {
+			log.Printf("blob %s of user %d is missing from their export", files[i], archive.Profile.Id)
+			continue
+		}
+
+		if err != nil {
+			return err
+		}
+
+		err = writeZipFile(zw, files[i+1], rc)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	if err = zw.Close(); err != nil {
+		return fmt.Errorf("could not finish export zip, %v", err)
+	}
+
+	return nil
+}
+
+func writeZipFile(zw *zip.Writer, name string, r io.Reader) error {
+	w, err := zw.Create(name)
+	if err != nil {
+		return fmt.Errorf("could not add %s to export zip, %v", name, err)
+	}
+
+	if _, err = io.Copy(w, r); err != nil {
+		return fmt.Errorf("could not write %s to export zip, %v", name, err)
+	}
+
+	return nil
+}
+
+func (s *Service) mailExportReady(profile UserProfile, export UserExport) error {
+	export, err := s.withExportUrl(export)
+	if err != nil {
+		return err
+	}
+
+	var html bytes.Buffer
+	if err = exportReadyTemplate.Execute(&html, map[string]interface{}{
+		"Username": profile.Username,
+		"Link":     *export.Url,
+		"LifeSpan": ExportLinkLifeSpan,
+	}); err != nil {
+		return fmt.Errorf("could not render export ready mail, %v", err)
+	}
+
+	text := fmt.Sprintf("Hi %s,\n\nthe archive of your data you asked for is ready, download it from %s. The link expires in %s.\n",
+		profile.Username, *export.Url, ExportLinkLifeSpan)
+	return s.Mailer.Send(profile.Email, "Your data export is ready", html.String(), text)
+}
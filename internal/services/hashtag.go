@@ -0,0 +1,155 @@
+package services
+
+import (
+	"context"
+	"log"
+	"regexp"
+	. "social/internal/models"
+	"social/internal/store"
+	"strings"
+	"time"
+)
+
+const (
+	// maxPostHashtags hashtags kept per post, the rest of them stay plain text
+	maxPostHashtags = 20
+	// trendingHashtagsSize how many hashtags each trending window lists
+	trendingHashtagsSize = 10
+)
+
+var (
+	// rxHashtag # not glued to a word, url fragment or html entity, followed by a letter
+	// and at most 49 more letters, digits or _, the migration backfilling hashtags uses the same rule
+	rxHashtag = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_#&/])#(\p{L}[\p{L}\p{N}_]{0,49})`)
+	rxTag     = regexp.MustCompile(`^\p{L}[\p{L}\p{N}_]{0,49}$`)
+)
+
+// trendingWindows trending hashtags are ranked over, by period name
+var trendingWindows = []struct {
+	period string
+	window time.Duration
+}{
+	{"1h", time.Hour},
+	{"24h", time.Hour * 24},
+	{"7d", time.Hour * 24 * 7},
+}
+
+// TrendingHashtagsOutput output dto, ComputedAt is nil until the ranking is first computed
+type TrendingHashtagsOutput struct {
+	Window     string            `json:"window"`
+	ComputedAt *time.Time        `json:"computedAt"`
+	Tags       []TrendingHashtag `json:"tags"`
+}
+
+// HashtagPosts lists newest posts tagged with tag, which may start with #
+func (s *Service) HashtagPosts(ctx context.Context, tag string, last int, before int64) ([]Post, error) {
+	uid, _ := ctx.Value(KeyAuthUserId).(int64)
+
+	tag = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(tag), "#"))
+	if !rxTag.MatchString(tag) {
+		return nil, invalidInput("tag", "must start with a letter and have at most 50 letters, digits or _")
+	}
+
+	posts, err := s.Store.HashtagPosts(ctx, uid, tag, normalizePageSize(last), before)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range posts {
+		posts[i].Mine = posts[i].UserId == uid
+	}
+
+	if err = s.withPostDetails(ctx, uid, posts); err != nil {
+		return nil, err
+	}
+
+	return posts, nil
+}
+
+// TrendingHashtags hashtags whose use grows the fastest within window, one of 1h, 24h or 7d,
+// as last ranked by RunTrendingHashtags
+func (s *Service) TrendingHashtags(ctx context.Context, window string) (TrendingHashtagsOutput, error) {
+	out := TrendingHashtagsOutput{Window: window}
+	if out.Window == "" {
+		out.Window = "24h"
+	}
+
+	known := false
+	for _, w := range trendingWindows {
+		known = known || w.period == out.Window
+	}
+
+	if !known {
+		return out, invalidInput("window", "must be one of 1h, 24h or 7d")
+	}
+
+	tags, computedAt, err := s.Store.TrendingHashtags(ctx, out.Window)
+	if err != nil {
+		return out, err
+	}
+
+	out.Tags = tags
+	if !computedAt.IsZero() {
+		out.ComputedAt = &computedAt
+	}
+
+	return out, nil
+}
+
+// RunTrendingHashtags ranks trending hashtags of every window right away and then every interval until ctx is done
+func (s *Service) RunTrendingHashtags(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.refreshTrendingHashtags(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("could not refresh trending hashtags, %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// refreshTrendingHashtags ranks every window unless another instance is doing it at the same time,
+// both would replace the same rows otherwise
+func (s *Service) refreshTrendingHashtags(ctx context.Context) error {
+	now := time.Now()
+	return s.Store.Tx(ctx, func(tx store.Store) error {
+		locked, err := tx.LockTrendingHashtags(ctx)
+		if err != nil || !locked {
+			return err
+		}
+
+		for _, w := range trendingWindows {
+			if err := tx.RefreshTrendingHashtags(ctx, w.period, w.window, now, trendingHashtagsSize); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// extractHashtags lower cased hashtags of content, each one once, in order they first appear
+func extractHashtags(content string) []string {
+	var tags []string
+	seen := map[string]bool{}
+	for _, match := range rxHashtag.FindAllStringSubmatch(content, -1) {
+		tag := strings.ToLower(match[1])
+		if seen[tag] {
+			continue
+		}
+
+		seen[tag] = true
+		tags = append(tags, tag)
+		if len(tags) == maxPostHashtags {
+			break
+		}
+	}
+
+	return tags
+}
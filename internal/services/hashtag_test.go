@@ -0,0 +1,79 @@
+package services
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestExtractHashtags(t *testing.T) {
+	many := ""
+	for i := 0; i < maxPostHashtags+5; i++ {
+		many += " #t" + strconv.Itoa(i)
+	}
+
+	tt := []struct {
+		content string
+		want    []string
+	}{
+		{content: "no tags", want: nil},
+		{content: "#Go and #go and #GO", want: []string{"go"}},
+		{content: "(#one),#two.#three", want: []string{"one", "two", "three"}},
+		{content: "#1st #_x # #", want: nil},
+		{content: "word#glued ##double &#39; http://example.org/#frag", want: nil},
+		{content: "#café_2 #東京", want: []string{"café_2", "東京"}},
+		{content: "#" + strings.Repeat("a", 60), want: []string{strings.Repeat("a", 50)}},
+		{content: many, want: func() []string {
+			var tags []string
+			for i := 0; i < maxPostHashtags; i++ {
+				tags = append(tags, "t"+strconv.Itoa(i))
+			}
+			return tags
+		}()},
+	}
+	for _, tc := range tt {
+		if got := extractHashtags(tc.content); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("extractHashtags(%q): want %v, got %v", tc.content, tc.want, got)
+		}
+	}
+}
+
+func TestTrendingHashtags(t *testing.T) {
+	s := newTestService(t)
+	ctx := newTestUser(t, s, "alice")
+
+	if _, err := s.TrendingHashtags(ctx, "2d"); err == nil {
+		t.Fatal("want unknown window rejected")
+	}
+
+	out, err := s.TrendingHashtags(ctx, "")
+	if err != nil || out.Window != "24h" || out.ComputedAt != nil || len(out.Tags) != 0 {
+		t.Fatalf("want empty 24h ranking before first refresh, got %+v, %v", out, err)
+	}
+
+	for _, content := range []string{"#go", "#go #rust", "#Go"} {
+		if _, err = s.CreatePost(ctx, content, nil, false, nil, nil); err != nil {
+			t.Fatalf("could not create post: %v", err)
+		}
+	}
+
+	if err = s.refreshTrendingHashtags(ctx); err != nil {
+		t.Fatalf("could not refresh trending hashtags: %v", err)
+	}
+
+	for _, w := range trendingWindows {
+		out, err = s.TrendingHashtags(ctx, w.period)
+		if err != nil || out.ComputedAt == nil || len(out.Tags) != 2 || out.Tags[0].Tag != "go" || out.Tags[0].PostsCount != 3 {
+			t.Errorf("want go trending over %s, got %+v, %v", w.period, out, err)
+		}
+	}
+
+	posts, err := s.HashtagPosts(ctx, "#GO", 0, 0)
+	if err != nil || len(posts) != 3 {
+		t.Errorf("want 3 posts tagged go, got %d, %v", len(posts), err)
+	}
+
+	_, err = s.HashtagPosts(ctx, "#1st", 0, 0)
+	assertInvalidField(t, err, "tag")
+}
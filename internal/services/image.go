@@ -0,0 +1,81 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	gonanoid "github.com/matoous/go-nanoid"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"log"
+)
+
+// maxImageSide longest side of image that gets decoded, a small file may claim huge dimensions
+// and decoding allocates memory for every pixel of them
+const maxImageSide = 8192
+
+// decodeImage decodes png or jpeg image from r, field names the input errors are reported for,
+// dimensions from the header are checked before any pixel is decoded
+func decodeImage(r io.Reader, field string) (image.Image, string, error) {
+	var header bytes.Buffer
+	config, format, err := image.DecodeConfig(io.TeeReader(r, &header))
+	if err != nil {
+		return nil, "", invalidInput(field, "could not decode image")
+	}
+
+	if format != "png" && format != "jpeg" {
+		return nil, "", invalidInput(field, "only png and jpeg images are supported")
+	}
+
+	if config.Width > maxImageSide || config.Height > maxImageSide {
+		return nil, "", invalidInput(field, fmt.Sprintf("must be at most %dx%d pixels", maxImageSide, maxImageSide))
+	}
+
+	img, _, err := image.Decode(io.MultiReader(&header, r))
+	if err != nil {
+		return nil, "", invalidInput(field, "could not decode image")
+	}
+
+	return img, format, nil
+}
+
+// putImage encodes img as format, png or jpeg, into a new blob with random name under prefix and returns the name
+func (s *Service) putImage(ctx context.Context, prefix string, img image.Image, format string) (string, error) {
+	name, err := gonanoid.Nanoid()
+	if err != nil {
+		return "", fmt.Errorf("unable to generate guid for image, %v", err)
+	}
+
+	var (
+		buf         bytes.Buffer
+		contentType string
+	)
+	if format == "png" {
+		name += ".png"
+		contentType = "image/png"
+		err = png.Encode(&buf, img)
+	} else {
+		name += ".jpg"
+		contentType = "image/jpeg"
+		err = jpeg.Encode(&buf, img, nil)
+	}
+
+	if err != nil {
+		return "", fmt.Errorf("could not encode image: %v", err)
+	}
+
+	if err = s.Blobs.Put(ctx, prefix+name, &buf, contentType); err != nil {
+		return "", err
+	}
+
+	return name, nil
+}
+
+// deleteBlob removes blob with key, failure is only logged as the blob is no longer referenced anyway
+func (s *Service) deleteBlob(ctx context.Context, key string) {
+	if err := s.Blobs.Delete(ctx, key); err != nil {
+		log.Printf("could not delete blob %s, %v", key, err)
+	}
+}
@@ -0,0 +1,180 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"social/internal/store"
+	"sync"
+	"time"
+)
+
+const (
+	jobPollInterval = time.Second
+	jobTimeout      = time.Minute
+	// jobLease how long a running job may go without finishing before another worker reclaims it
+	jobLease       = time.Minute * 5
+	jobMaxBackoff  = time.Hour
+	jobMaxAttempts = 5
+	// jobRetention how long done jobs are kept before they are purged
+	jobRetention     = time.Hour * 24 * 7
+	jobPurgeInterval = time.Hour
+)
+
+// JobHandler processes payload of single queued job
+type JobHandler func(ctx context.Context, payload []byte) error
+
+// enqueueJob adds job to the queue, using tx makes delivery depend on tx commit
+func (s *Service) enqueueJob(ctx context.Context, tx store.Store, kind string, payload interface{}) error {
+	if _, ok := s.jobHandlers[kind]; !ok {
+		return fmt.Errorf("no handler registered for job %q", kind)
+	}
+
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("could not marshal job payload, %v", err)
+	}
+
+	return tx.EnqueueJob(ctx, kind, b, jobMaxAttempts)
+}
+
+// RunJobs process queued jobs with given number of workers until ctx is done, meanwhile it purges done jobs
+// older than jobRetention and uploads never attached to a post, jobs in progress are cancelled with ctx
+// and put back to the queue
+func (s *Service) RunJobs(ctx context.Context, workers int) {
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.jobWorker(ctx)
+		}()
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		s.purgeJobs(ctx)
+	}()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		s.cleanUpMedia(ctx)
+	}()
+
+	wg.Wait()
+}
+
+func (s *Service) jobWorker(ctx context.Context) {
+	for {
+		if ctx.Err() != nil {
+			return
+		}
+
+		ran, err := s.runNextJob(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("could not run job, %v", err)
+		}
+
+		if ran {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(jobPollInterval):
+		}
+	}
+}
+
+// runNextJob claims and runs single job, it reports whether there was a job to run
+func (s *Service) runNextJob(ctx context.Context) (bool, error) {
+	job, err := s.Store.ClaimJob(ctx, jobLease)
+	if errors.Is(err, store.ErrNotFound) {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	err = s.handleJob(ctx, job.Kind, job.Payload)
+
+	// outcome is recorded even once ctx is done, so the job does not wait for its lease to run again
+	done := context.Background()
+	if err == nil {
+		return true, s.Store.CompleteJob(done, job.Id)
+	}
+
+	if ctx.Err() != nil {
+		log.Printf("job %d (%s) interrupted by shutdown, queued again", job.Id, job.Kind)
+		return true, s.Store.RetryJob(done, job.Id, err.Error(), time.Now())
+	}
+
+	if job.Attempts >= job.MaxAttempts {
+		log.Printf("job %d (%s) is dead after %d attempts, %v", job.Id, job.Kind, job.Attempts, err)
+		return true, s.Store.KillJob(done, job.Id, err.Error())
+	}
+
+	backoff := jobBackoff(job.Attempts)
+	log.Printf("job %d (%s) failed on attempt %d, retrying in %s, %v", job.Id, job.Kind, job.Attempts, backoff, err)
+	return true, s.Store.RetryJob(done, job.Id, err.Error(), time.Now().Add(backoff))
+}
+
+// purgeJobs deletes done jobs older than jobRetention every jobPurgeInterval until ctx is done
+func (s *Service) purgeJobs(ctx context.Context) {
+	ticker := time.NewTicker(jobPurgeInterval)
+	defer ticker.Stop()
+
+	for {
+		n, err := s.Store.PurgeDoneJobs(ctx, time.Now().Add(-jobRetention))
+		if err != nil && ctx.Err() == nil {
+			log.Printf("could not purge done jobs, %v", err)
+		}
+
+		if n != 0 {
+			log.Printf("purged %d done jobs", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Service) handleJob(ctx context.Context, kind string, payload []byte) (err error) {
+	handler, ok := s.jobHandlers[kind]
+	if !ok {
+		return fmt.Errorf("no handler registered for job %q", kind)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, jobTimeout)
+	defer cancel()
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("job panicked: %v", r)
+		}
+	}()
+
+	return handler(ctx, payload)
+}
+
+func jobBackoff(attempts int) time.Duration {
+	if attempts > 12 {
+		return jobMaxBackoff
+	}
+
+	backoff := time.Second * time.Duration(1<<uint(attempts))
+	if backoff > jobMaxBackoff {
+		return jobMaxBackoff
+	}
+
+	return backoff
+}
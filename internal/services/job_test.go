@@ -0,0 +1,151 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"social/internal/store"
+	"testing"
+	"time"
+)
+
+func TestJobBackoff(t *testing.T) {
+	tt := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{attempts: 1, want: time.Second * 2},
+		{attempts: 4, want: time.Second * 16},
+		{attempts: 12, want: jobMaxBackoff},
+		{attempts: 64, want: jobMaxBackoff},
+	}
+	for _, tc := range tt {
+		if got := jobBackoff(tc.attempts); got != tc.want {
+			t.Errorf("jobBackoff(%d) = %s, want %s", tc.attempts, got, tc.want)
+		}
+	}
+}
+
+func TestRunNextJob(t *testing.T) {
+	s := newTestService(t)
+	ctx := context.Background()
+
+	var calls int
+	var fail error
+	s.jobHandlers["test"] = func(ctx context.Context, payload []byte) error {
+		calls++
+		if string(payload) == "panic" {
+			panic("boom")
+		}
+
+		return fail
+	}
+
+	if ran, err := s.runNextJob(ctx); ran || err != nil {
+		t.Fatalf("want nothing to run on empty queue, got %v, %v", ran, err)
+	}
+
+	if err := s.Store.EnqueueJob(ctx, "test", []byte(`{}`), 2); err != nil {
+		t.Fatalf("could not enqueue job: %v", err)
+	}
+
+	if ran, err := s.runNextJob(ctx); !ran || err != nil {
+		t.Fatalf("could not run job: %v", err)
+	}
+
+	if ran, _ := s.runNextJob(ctx); ran || calls != 1 {
+		t.Errorf("want completed job run once, got %d calls", calls)
+	}
+
+	fail = errors.New("failed")
+	if err := s.Store.EnqueueJob(ctx, "test", []byte("panic"), 2); err != nil {
+		t.Fatalf("could not enqueue job: %v", err)
+	}
+
+	if ran, err := s.runNextJob(ctx); !ran || err != nil {
+		t.Fatalf("want panicking job recovered, got %v, %v", ran, err)
+	}
+
+	if ran, _ := s.runNextJob(ctx); ran {
+		t.Error("want failed job to back off before its next attempt")
+	}
+}
+
+// jobOutcomes store recording how failed jobs were settled
+type jobOutcomes struct {
+	store.Store
+	retried, killed []int64
+}
+
+func (o *jobOutcomes) RetryJob(ctx context.Context, jobId int64, lastError string, runAt time.Time) error {
+	o.retried = append(o.retried, jobId)
+	return o.Store.RetryJob(ctx, jobId, lastError, runAt)
+}
+
+func (o *jobOutcomes) KillJob(ctx context.Context, jobId int64, lastError string) error {
+	o.killed = append(o.killed, jobId)
+	return o.Store.KillJob(ctx, jobId, lastError)
+}
+
+func TestRunNextJobMaxAttempts(t *testing.T) {
+	s := newTestService(t)
+	outcomes := &jobOutcomes{Store: s.Store}
+	s.Store = outcomes
+	ctx := context.Background()
+
+	s.jobHandlers["test"] = func(ctx context.Context, payload []byte) error {
+		return errors.New("failed")
+	}
+
+	if err := s.Store.EnqueueJob(ctx, "test", nil, 2); err != nil {
+		t.Fatalf("could not enqueue job: %v", err)
+	}
+
+	if _, err := s.runNextJob(ctx); err != nil {
+		t.Fatalf("could not run job: %v", err)
+	}
+
+	if len(outcomes.retried) != 1 || len(outcomes.killed) != 0 {
+		t.Fatalf("want job retried after first attempt, got %+v", outcomes)
+	}
+
+	// due right away instead of waiting for the backoff
+	if err := outcomes.Store.RetryJob(ctx, outcomes.retried[0], "failed", time.Now()); err != nil {
+		t.Fatalf("could not reschedule job: %v", err)
+	}
+
+	if _, err := s.runNextJob(ctx); err != nil {
+		t.Fatalf("could not run job: %v", err)
+	}
+
+	if len(outcomes.retried) != 1 || len(outcomes.killed) != 1 {
+		t.Errorf("want job dead after max attempts, got %+v", outcomes)
+	}
+}
+
+func TestRunNextJobShutdown(t *testing.T) {
+	s := newTestService(t)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	s.jobHandlers["test"] = func(ctx context.Context, payload []byte) error {
+		cancel()
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	if err := s.Store.EnqueueJob(ctx, "test", nil, 5); err != nil {
+		t.Fatalf("could not enqueue job: %v", err)
+	}
+
+	if ran, err := s.runNextJob(ctx); !ran || err != nil {
+		t.Fatalf("could not run job: %v", err)
+	}
+
+	job, err := s.Store.ClaimJob(context.Background(), time.Hour)
+	if err != nil {
+		t.Fatalf("want job interrupted by shutdown queued again right away, got %v", err)
+	}
+
+	if job.Attempts != 2 {
+		t.Errorf("want second attempt, got %+v", job)
+	}
+}
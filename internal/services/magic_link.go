@@ -0,0 +1,150 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/url"
+	"social/internal/store"
+	"strings"
+	"time"
+)
+
+// VerificationCodeLifeSpan how long magic link stays valid
+const VerificationCodeLifeSpan = time.Minute * 15
+
+const jobSendMagicLink = "send_magic_link"
+
+type sendMagicLinkPayload struct {
+	Email       string `json:"email"`
+	RedirectURI string `json:"redirectURI"`
+}
+
+var magicLinkTemplate = template.Must(template.New("magic_link").Parse(`<!DOCTYPE html>
+<html>
+<body>
+	<p>Hi {{ .Username }},</p>
+	<p><a href="{{ .Link }}" target="_blank">Click here to log in</a>. The link expires in {{ .LifeSpan }} and can be used only once.</p>
+	<p>If you did not ask for it, you can safely ignore this email.</p>
+</body>
+</html>`))
+
+// SendMagicLink queues mail with single use login link to the user with given email, nothing is sent
+// when there is no such user, once used it redirects to redirectURI which has to be on the app origin
+func (s *Service) SendMagicLink(ctx context.Context, email, redirectURI string) error {
+	email = strings.TrimSpace(email)
+	if !rxEmail.MatchString(email) {
+		return invalidInput("email", "bad email address")
+	}
+
+	redirectURI = strings.TrimSpace(redirectURI)
+	if redirectURI != "" {
+		if err := s.validateRedirectURI(redirectURI); err != nil {
+			return err
+		}
+	}
+
+	// the user is looked up by the job, so registered and unknown emails take the same time
+	// and mail failures never reach the response, either would tell them apart
+	return s.enqueueJob(ctx, s.Store, jobSendMagicLink, sendMagicLinkPayload{Email: email, RedirectURI: redirectURI})
+}
+
+func (s *Service) sendMagicLinkJob(ctx context.Context, payload []byte) error {
+	var in sendMagicLinkPayload
+	if err := json.Unmarshal(payload, &in); err != nil {
+		return fmt.Errorf("could not unmarshal magic link payload, %v", err)
+	}
+
+	user, err := s.Store.UserByEmail(ctx, in.Email)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	code, err := randomString(32)
+	if err != nil {
+		return fmt.Errorf("could not generate verification code, %v", err)
+	}
+
+	if err = s.Store.DeleteVerificationCodesBefore(ctx, time.Now().Add(-VerificationCodeLifeSpan)); err != nil {
+		return err
+	}
+
+	if err = s.Store.CreateVerificationCode(ctx, hashToken(code), user.Id, in.RedirectURI); err != nil {
+		return err
+	}
+
+	link := s.Origin + "/api/auth_redirect?" + url.Values{"code": {code}}.Encode()
+
+	var html bytes.Buffer
+	if err = magicLinkTemplate.Execute(&html, map[string]interface{}{
+		"Username": user.Username,
+		"Link":     link,
+		"LifeSpan": VerificationCodeLifeSpan,
+	}); err != nil {
+		return fmt.Errorf("could not render magic link mail, %v", err)
+	}
+
+	text := fmt.Sprintf("Hi %s,\n\nopen %s to log in. The link expires in %s and can be used only once.\n",
+		user.Username, link, VerificationCodeLifeSpan)
+	if err = s.Mailer.Send(in.Email, "Your login link", html.String(), text); err != nil {
+		return fmt.Errorf("could not send magic link, %v", err)
+	}
+
+	return nil
+}
+
+// VerifyMagicLink exchanges magic link code for auth token, it also returns
+// redirect uri given when the link was sent, empty if there was none
+func (s *Service) VerifyMagicLink(ctx context.Context, code string) (LoginOutput, string, error) {
+	var out LoginOutput
+	code = strings.TrimSpace(code)
+	if code == "" {
+		return out, "", ErrInvalidVerificationCode
+	}
+
+	// taking the code deletes it right away, which makes it single use even under concurrent requests
+	verificationCode, err := s.Store.TakeVerificationCode(ctx, hashToken(code))
+	if errors.Is(err, store.ErrNotFound) {
+		return out, "", ErrInvalidVerificationCode
+	}
+
+	if err != nil {
+		return out, "", err
+	}
+
+	if verificationCode.CreatedAt.Add(VerificationCodeLifeSpan).Before(time.Now()) {
+		return out, "", ErrExpiredVerificationCode
+	}
+
+	out, err = s.issueToken(ctx, verificationCode.User, true)
+	if err != nil {
+		return out, "", err
+	}
+
+	return out, verificationCode.RedirectURI, nil
+}
+
+func (s *Service) validateRedirectURI(redirectURI string) error {
+	uri, err := url.Parse(redirectURI)
+	if err != nil || !uri.IsAbs() {
+		return invalidInput("redirectURI", "must be absolute url")
+	}
+
+	origin, err := url.Parse(s.Origin)
+	if err != nil {
+		return fmt.Errorf("could not parse origin, %v", err)
+	}
+
+	if uri.Scheme != origin.Scheme || uri.Host != origin.Host {
+		return invalidInput("redirectURI", "must be on app origin")
+	}
+
+	return nil
+}
@@ -0,0 +1,117 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"regexp"
+	"social/internal/store"
+	"testing"
+	"time"
+)
+
+// sentMails mailer keeping plain text of every mail by recipient
+type sentMails map[string][]string
+
+func (m sentMails) Send(to, subject, html, text string) error {
+	m[to] = append(m[to], text)
+	return nil
+}
+
+var rxMagicLink = regexp.MustCompile(`http\S+auth_redirect\S+`)
+
+// magicLinkCode code of the last magic link mailed to email
+func magicLinkCode(t *testing.T, mails sentMails, email string) string {
+	t.Helper()
+
+	if len(mails[email]) == 0 {
+		t.Fatalf("want magic link mailed to %s", email)
+	}
+
+	link, err := url.Parse(rxMagicLink.FindString(mails[email][len(mails[email])-1]))
+	if err != nil {
+		t.Fatalf("could not parse magic link: %v", err)
+	}
+
+	return link.Query().Get("code")
+}
+
+func TestSendMagicLink(t *testing.T) {
+	s := newTestService(t)
+	mails := sentMails{}
+	s.Mailer = mails
+	ctx := context.Background()
+	newTestUser(t, s, "alice")
+
+	assertInvalidField(t, s.SendMagicLink(ctx, "alice", ""), "email")
+	for _, uri := range []string{"/home", "http://example.org/home", "https://localhost/home"} {
+		assertInvalidField(t, s.SendMagicLink(ctx, "alice@example.org", uri), "redirectURI")
+	}
+
+	for _, email := range []string{"alice@example.org", "nobody@example.org"} {
+		if err := s.SendMagicLink(ctx, email, "http://localhost/home"); err != nil {
+			t.Fatalf("could not send magic link to %s: %v", email, err)
+		}
+
+		// both are queued alike, the user is looked up by the job
+		if ran, err := s.runNextJob(ctx); !ran || err != nil {
+			t.Fatalf("want magic link job queued for %s, got %v, %v", email, ran, err)
+		}
+	}
+
+	if len(mails["nobody@example.org"]) != 0 {
+		t.Errorf("want nothing sent to unknown email, got %v", mails["nobody@example.org"])
+	}
+
+	code := magicLinkCode(t, mails, "alice@example.org")
+	out, redirectURI, err := s.VerifyMagicLink(ctx, code)
+	if err != nil {
+		t.Fatalf("could not verify magic link: %v", err)
+	}
+
+	if out.AuthUser.Username != "alice" || out.Token == "" || redirectURI != "http://localhost/home" {
+		t.Errorf("want alice logged in and redirected home, got %+v, %q", out, redirectURI)
+	}
+
+	if _, _, err = s.VerifyMagicLink(ctx, code); !errors.Is(err, ErrInvalidVerificationCode) {
+		t.Errorf("reusing code: want ErrInvalidVerificationCode, got %v", err)
+	}
+
+	for _, code := range []string{"", "unknown"} {
+		if _, _, err = s.VerifyMagicLink(ctx, code); !errors.Is(err, ErrInvalidVerificationCode) {
+			t.Errorf("verifying %q: want ErrInvalidVerificationCode, got %v", code, err)
+		}
+	}
+}
+
+// staleCodes store returning verification codes as if they were created VerificationCodeLifeSpan ago
+type staleCodes struct {
+	store.Store
+}
+
+func (s staleCodes) TakeVerificationCode(ctx context.Context, codeHash string) (store.VerificationCode, error) {
+	code, err := s.Store.TakeVerificationCode(ctx, codeHash)
+	code.CreatedAt = code.CreatedAt.Add(-VerificationCodeLifeSpan - time.Second)
+	return code, err
+}
+
+func TestVerifyMagicLinkExpired(t *testing.T) {
+	s := newTestService(t)
+	mails := sentMails{}
+	s.Mailer = mails
+	ctx := context.Background()
+	newTestUser(t, s, "alice")
+
+	if err := s.SendMagicLink(ctx, "alice@example.org", ""); err != nil {
+		t.Fatalf("could not send magic link: %v", err)
+	}
+
+	if _, err := s.runNextJob(ctx); err != nil {
+		t.Fatalf("could not run magic link job: %v", err)
+	}
+
+	s.Store = staleCodes{s.Store}
+	if _, _, err := s.VerifyMagicLink(ctx, magicLinkCode(t, mails, "alice@example.org")); !errors.Is(err, ErrExpiredVerificationCode) {
+		t.Errorf("want ErrExpiredVerificationCode, got %v", err)
+	}
+}
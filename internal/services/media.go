@@ -0,0 +1,201 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"github.com/disintegration/imaging"
+	"io"
+	"log"
+	. "social/internal/models"
+	"social/internal/store"
+	"strings"
+	"time"
+)
+
+const (
+	MaxMediaBytes = 10 << 20
+	// maxPostMedia attachments per post
+	maxPostMedia = 4
+	// maxMediaSide longest side of stored media, larger images are scaled down keeping their aspect ratio
+	maxMediaSide = 2048
+	// mediaThumbnailSide longest side of thumbnails
+	mediaThumbnailSide = 400
+	maxAltTextLength   = 1000
+	// mediaPrefix key prefix of media blobs
+	mediaPrefix = "media/"
+	// unattachedMediaMaxAge uploads not attached to a post by then are deleted, the post was never sent
+	unattachedMediaMaxAge = time.Hour * 24
+	mediaCleanupInterval  = time.Hour
+	mediaCleanupBatchSize = 100
+)
+
+// UploadMedia stores image to be attached to a post of the authenticated user, along with its thumbnail,
+// alt text describes the image to those who can't see it
+func (s *Service) UploadMedia(ctx context.Context, r io.Reader, altText string) (Media, error) {
+	var media Media
+	userId, ok := ctx.Value(KeyAuthUserId).(int64)
+	if !ok {
+		return media, ErrUnauthenticated
+	}
+
+	altText = strings.TrimSpace(altText)
+	if len([]rune(altText)) > maxAltTextLength {
+		return media, invalidInput("alt", "must be at most 1000 characters")
+	}
+
+	img, format, err := decodeImage(io.LimitReader(r, MaxMediaBytes), "file")
+	if err != nil {
+		return media, err
+	}
+
+	bounds := img.Bounds()
+	if bounds.Dx() > maxMediaSide || bounds.Dy() > maxMediaSide {
+		img = imaging.Fit(img, maxMediaSide, maxMediaSide, imaging.CatmullRom)
+	}
+
+	media = Media{
+		UserId:   userId,
+		Width:    img.Bounds().Dx(),
+		Height:   img.Bounds().Dy(),
+		Blurhash: blurhash(img),
+		AltText:  altText,
+	}
+
+	if media.File, err = s.putImage(ctx, mediaPrefix, img, format); err != nil {
+		return media, err
+	}
+
+	thumbnail := imaging.Fit(img, mediaThumbnailSide, mediaThumbnailSide, imaging.CatmullRom)
+	if media.Thumbnail, err = s.putImage(ctx, mediaPrefix, thumbnail, format); err != nil {
+		s.removeMediaFiles(ctx, []string{media.File})
+		return media, err
+	}
+
+	created, err := s.Store.CreateMedia(ctx, media)
+	if err != nil {
+		s.removeMediaFiles(ctx, mediaFiles([]Media{media}))
+		return media, err
+	}
+
+	return s.withMediaUrls(created), nil
+}
+
+// attachPostMedia attaches media the user uploaded to their post in tx
+func (s *Service) attachPostMedia(ctx context.Context, tx store.Store, userId, postId int64, mediaIds []int64) error {
+	err := tx.AttachMedia(ctx, userId, postId, mediaIds)
+	if errors.Is(err, store.ErrNotFound) {
+		return invalidInput("media", "must be your own uploads not attached to a post yet")
+	}
+
+	return err
+}
+
+// withPostMedia fills media attached to each post
+func (s *Service) withPostMedia(ctx context.Context, posts []Post) error {
+	if len(posts) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, 0, len(posts))
+	for _, p := range posts {
+		ids = append(ids, p.Id)
+	}
+
+	media, err := s.Store.PostMedia(ctx, ids)
+	if err != nil {
+		return err
+	}
+
+	for i := range posts {
+		posts[i].Media = nil
+		for _, m := range media[posts[i].Id] {
+			posts[i].Media = append(posts[i].Media, s.withMediaUrls(m))
+		}
+	}
+
+	return nil
+}
+
+func (s *Service) withMediaUrls(m Media) Media {
+	m.Url = s.Blobs.URL(mediaPrefix + m.File)
+	m.ThumbnailUrl = s.Blobs.URL(mediaPrefix + m.Thumbnail)
+	return m
+}
+
+// validatePostMedia checks ids of media to attach to a post
+func validatePostMedia(mediaIds []int64) error {
+	if len(mediaIds) > maxPostMedia {
+		return invalidInput("media", "must have at most 4 attachments")
+	}
+
+	seen := map[int64]bool{}
+	for _, id := range mediaIds {
+		if seen[id] {
+			return invalidInput("media", "must not repeat attachments")
+		}
+
+		seen[id] = true
+	}
+
+	return nil
+}
+
+// mediaFiles names of files of media
+func mediaFiles(media []Media) []string {
+	var files []string
+	for _, m := range media {
+		files = append(files, m.File, m.Thumbnail)
+	}
+
+	return files
+}
+
+// removeMediaFiles removes blobs of media files
+func (s *Service) removeMediaFiles(ctx context.Context, files []string) {
+	for _, file := range files {
+		s.deleteBlob(ctx, mediaPrefix+file)
+	}
+}
+
+// cleanUpMedia deletes uploads older than unattachedMediaMaxAge that never got attached to a post
+// every mediaCleanupInterval until ctx is done
+func (s *Service) cleanUpMedia(ctx context.Context) {
+	ticker := time.NewTicker(mediaCleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		n, err := s.deleteUnattachedMedia(ctx, time.Now().Add(-unattachedMediaMaxAge))
+		if err != nil && ctx.Err() == nil {
+			log.Printf("could not delete unattached media, %v", err)
+		}
+
+		if n != 0 {
+			log.Printf("deleted %d unattached media", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// deleteUnattachedMedia deletes uploads created before before that are not attached to a post along with
+// their files and returns how many were deleted
+func (s *Service) deleteUnattachedMedia(ctx context.Context, before time.Time) (int, error) {
+	deleted := 0
+	for {
+		files, err := s.Store.DeleteUnattachedMedia(ctx, before, mediaCleanupBatchSize)
+		if err != nil {
+			return deleted, err
+		}
+
+		s.removeMediaFiles(ctx, files)
+		// file and thumbnail of each
+		deleted += len(files) / 2
+		if len(files) < mediaCleanupBatchSize*2 {
+			return deleted, nil
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"strings"
+	"testing"
+	"time"
+)
+
+// encodeTestImage image of given size encoded with encode
+func encodeTestImage(t *testing.T, width, height int, encode func(*bytes.Buffer, image.Image) error) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := encode(&buf, image.NewGray(image.Rect(0, 0, width, height))); err != nil {
+		t.Fatalf("could not encode image: %v", err)
+	}
+
+	return buf.Bytes()
+}
+
+func encodePNG(buf *bytes.Buffer, img image.Image) error { return png.Encode(buf, img) }
+
+func TestDecodeImage(t *testing.T) {
+	for format, b := range map[string][]byte{
+		"png":  encodeTestImage(t, 30, 20, encodePNG),
+		"jpeg": encodeTestImage(t, 30, 20, func(buf *bytes.Buffer, img image.Image) error { return jpeg.Encode(buf, img, nil) }),
+	} {
+		img, got, err := decodeImage(bytes.NewReader(b), "file")
+		if err != nil || got != format || img.Bounds().Dx() != 30 || img.Bounds().Dy() != 20 {
+			t.Errorf("want 30x20 %s, got %s, %v", format, got, err)
+		}
+	}
+
+	gifImage := encodeTestImage(t, 1, 1, func(buf *bytes.Buffer, img image.Image) error { return gif.Encode(buf, img, nil) })
+	tt := []struct {
+		name   string
+		b      []byte
+		reason string
+	}{
+		{name: "garbage", b: []byte("not an image"), reason: "could not decode"},
+		{name: "gif", b: gifImage, reason: "only png and jpeg"},
+		// header only, so it fails unless it is rejected before the pixels are decoded
+		{name: "too wide", b: encodeTestImage(t, maxImageSide+1, 1, encodePNG)[:64], reason: "pixels"},
+		{name: "too tall", b: encodeTestImage(t, 1, maxImageSide+1, encodePNG)[:64], reason: "pixels"},
+		{name: "truncated", b: encodeTestImage(t, 30, 20, encodePNG)[:64], reason: "could not decode"},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			_, _, err := decodeImage(bytes.NewReader(tc.b), "file")
+
+			var invalid *InvalidInputError
+			if !errors.As(err, &invalid) || !strings.Contains(invalid.Fields["file"], tc.reason) {
+				t.Errorf("want invalid file saying %q, got %v", tc.reason, err)
+			}
+		})
+	}
+}
+
+func TestDeleteUnattachedMedia(t *testing.T) {
+	s := newTestService(t)
+	ctx := newTestUser(t, s, "alice")
+
+	upload := func() int64 {
+		t.Helper()
+
+		media, err := s.UploadMedia(ctx, bytes.NewReader(encodeTestImage(t, 10, 10, encodePNG)), "")
+		if err != nil {
+			t.Fatalf("could not upload media: %v", err)
+		}
+
+		return media.Id
+	}
+
+	attached, unattached := upload(), upload()
+	post, err := s.CreatePost(ctx, "with media", nil, false, nil, []int64{attached})
+	if err != nil {
+		t.Fatalf("could not create post: %v", err)
+	}
+
+	blobs, err := s.Blobs.List(ctx, mediaPrefix)
+	if err != nil || len(blobs) != 4 {
+		t.Fatalf("want file and thumbnail of both uploads, got %d, %v", len(blobs), err)
+	}
+
+	if n, err := s.deleteUnattachedMedia(ctx, time.Now().Add(-time.Minute)); err != nil || n != 0 {
+		t.Fatalf("want recent uploads kept, got %d, %v", n, err)
+	}
+
+	if n, err := s.deleteUnattachedMedia(ctx, time.Now().Add(time.Minute)); err != nil || n != 1 {
+		t.Fatalf("want 1 upload deleted, got %d, %v", n, err)
+	}
+
+	if blobs, err = s.Blobs.List(ctx, mediaPrefix); err != nil || len(blobs) != 2 {
+		t.Errorf("want files of the attached upload left, got %d, %v", len(blobs), err)
+	}
+
+	got, err := s.GetPostById(ctx, post.Post.Id)
+	if err != nil || len(got.Media) != 1 || got.Media[0].Id != attached {
+		t.Errorf("want media of post kept, got %+v, %v", got.Media, err)
+	}
+
+	_, err = s.CreatePost(ctx, "too late", nil, false, nil, []int64{unattached})
+	assertInvalidField(t, err, "media")
+}
@@ -0,0 +1,309 @@
+package services
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"regexp"
+	. "social/internal/models"
+	"social/internal/store"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// maxMentions users mentioned per post or comment, mentions of more users stay plain text
+const maxMentions = 10
+
+// rxMention @ not glued to a word, email, url path or another mention, the name is only
+// a mention when it is a valid username of existing user
+var rxMention = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_@./-])@([a-zA-Z0-9_-]+)`)
+
+// Mentions fetch posts and comments mentioning the authenticated user, most recently mentioned first,
+// before is Cursor of the last item from the previous page
+func (s *Service) Mentions(ctx context.Context, last int, before string) ([]MentionItem, error) {
+	uid, ok := ctx.Value(KeyAuthUserId).(int64)
+	if !ok {
+		return nil, ErrUnauthenticated
+	}
+
+	var cursor store.MentionCursor
+	if before != "" {
+		var err error
+		if cursor, err = decodeMentionCursor(before); err != nil {
+			return nil, invalidInput("before", "invalid cursor")
+		}
+	}
+
+	items, err := s.Store.Mentions(ctx, uid, normalizePageSize(last), cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		posts    []Post
+		comments []Comment
+	)
+	for _, item := range items {
+		if item.Post != nil {
+			posts = append(posts, *item.Post)
+		} else {
+			comments = append(comments, *item.Comment)
+		}
+	}
+
+	if err = s.withPostDetails(ctx, uid, posts); err != nil {
+		return nil, err
+	}
+
+	if err = s.withCommentMentions(ctx, comments); err != nil {
+		return nil, err
+	}
+
+	for i := range items {
+		cursor = store.MentionCursor{CreatedAt: items[i].CreatedAt}
+		if items[i].Post != nil {
+			*items[i].Post, posts = posts[0], posts[1:]
+			items[i].Post.Mine = items[i].Post.UserId == uid
+			cursor.PostId = items[i].Post.Id
+		} else {
+			*items[i].Comment, comments = comments[0], comments[1:]
+			items[i].Comment.Mine = items[i].Comment.UserId == uid
+			cursor.PostId = items[i].Comment.PostId
+			cursor.CommentId = items[i].Comment.Id
+		}
+
+		items[i].Cursor = encodeMentionCursor(cursor)
+	}
+
+	return items, nil
+}
+
+// mentionCandidate @username found in content, start and end are offsets of it in runes
+type mentionCandidate struct {
+	username   string
+	start, end int
+}
+
+// resolveMentions mentions of existing users in content written by author,
+// users author blocked or was blocked by are not mentioned
+func resolveMentions(ctx context.Context, st store.Store, authorId int64, content string) ([]Mention, error) {
+	candidates := findMentions(content)
+	users, err := mentionedUsers(ctx, st, candidates)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(users) != 0 {
+		blockedIds, err := st.BlockedUserIds(ctx, authorId)
+		if err != nil {
+			return nil, err
+		}
+
+		for username, u := range users {
+			for _, blockedId := range blockedIds {
+				if u.Id == blockedId {
+					delete(users, username)
+					break
+				}
+			}
+		}
+	}
+
+	return mentionsOf(candidates, users), nil
+}
+
+// findMentions @usernames in content, in order they appear
+func findMentions(content string) []mentionCandidate {
+	var candidates []mentionCandidate
+	// runes counts runes of content up to offset, matches come in order so it only moves forward
+	runes, offset := 0, 0
+	for _, match := range rxMention.FindAllStringSubmatchIndex(content, -1) {
+		username := content[match[2]:match[3]]
+		if !rxUsername.MatchString(username) {
+			continue
+		}
+
+		// @ right before the username
+		at := match[2] - 1
+		runes += utf8.RuneCountInString(content[offset:at])
+		offset = at
+		candidates = append(candidates, mentionCandidate{
+			username: username,
+			start:    runes,
+			end:      runes + 1 + utf8.RuneCountInString(username),
+		})
+	}
+
+	return candidates
+}
+
+// mentionedUsers existing users among candidates, by username
+func mentionedUsers(ctx context.Context, st store.Store, candidates []mentionCandidate) (map[string]User, error) {
+	var usernames []string
+	seen := map[string]bool{}
+	for _, c := range candidates {
+		if !seen[c.username] {
+			seen[c.username] = true
+			usernames = append(usernames, c.username)
+		}
+	}
+
+	if len(usernames) == 0 {
+		return nil, nil
+	}
+
+	users, err := st.UsersByUsernames(ctx, usernames)
+	if err != nil {
+		return nil, err
+	}
+
+	byUsername := make(map[string]User, len(users))
+	for _, u := range users {
+		byUsername[u.Username] = u
+	}
+
+	return byUsername, nil
+}
+
+// mentionsOf candidates naming one of users, at most maxMentions distinct users get mentioned
+func mentionsOf(candidates []mentionCandidate, users map[string]User) []Mention {
+	var mentions []Mention
+	mentioned := map[int64]bool{}
+	for _, c := range candidates {
+		user, ok := users[c.username]
+		if !ok {
+			continue
+		}
+
+		if !mentioned[user.Id] {
+			if len(mentioned) == maxMentions {
+				continue
+			}
+
+			mentioned[user.Id] = true
+		}
+
+		mentions = append(mentions, Mention{Start: c.start, End: c.end, User: user})
+	}
+
+	return mentions
+}
+
+// withPostMentions fills mentions of each post
+func (s *Service) withPostMentions(ctx context.Context, posts []Post) error {
+	if len(posts) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, 0, len(posts))
+	for _, p := range posts {
+		ids = append(ids, p.Id)
+	}
+
+	mentions, err := s.Store.PostMentions(ctx, ids)
+	if err != nil {
+		return err
+	}
+
+	for i := range posts {
+		posts[i].Mentions = mentions[posts[i].Id]
+	}
+
+	return nil
+}
+
+// withCommentMentions fills mentions of each comment and of its first replies
+func (s *Service) withCommentMentions(ctx context.Context, comments []Comment) error {
+	var ids []int64
+	for _, c := range comments {
+		ids = append(ids, c.Id)
+		for _, r := range c.Replies {
+			ids = append(ids, r.Id)
+		}
+	}
+
+	if len(ids) == 0 {
+		return nil
+	}
+
+	mentions, err := s.Store.CommentMentions(ctx, ids)
+	if err != nil {
+		return err
+	}
+
+	for i := range comments {
+		comments[i].Mentions = mentions[comments[i].Id]
+		for j := range comments[i].Replies {
+			comments[i].Replies[j].Mentions = mentions[comments[i].Replies[j].Id]
+		}
+	}
+
+	return nil
+}
+
+// notifyMentions notifies users with userIds that actor mentioned them on post and returns
+// ids of notifications to publish once tx is committed
+func (s *Service) notifyMentions(ctx context.Context, tx store.Store, userIds []int64, actorId, postId int64) ([]int64, error) {
+	var notificationIds []int64
+	for _, userId := range userIds {
+		notificationId, err := s.notify(ctx, tx, userId, actorId, NotificationMention, &postId)
+		if err != nil {
+			return nil, err
+		}
+
+		notificationIds = append(notificationIds, notificationId)
+	}
+
+	return notificationIds, nil
+}
+
+// mentionedUserIds ids of users mentioned, each one once
+func mentionedUserIds(mentions []Mention) []int64 {
+	var ids []int64
+	seen := map[int64]bool{}
+	for _, m := range mentions {
+		if !seen[m.User.Id] {
+			seen[m.User.Id] = true
+			ids = append(ids, m.User.Id)
+		}
+	}
+
+	return ids
+}
+
+func encodeMentionCursor(c store.MentionCursor) string {
+	s := strconv.FormatInt(c.CreatedAt.UnixNano(), 10) + ":" + strconv.FormatInt(c.PostId, 10) + ":" +
+		strconv.FormatInt(c.CommentId, 10)
+	return base64.RawURLEncoding.EncodeToString([]byte(s))
+}
+
+func decodeMentionCursor(cursor string) (store.MentionCursor, error) {
+	var c store.MentionCursor
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return c, err
+	}
+
+	parts := strings.Split(string(b), ":")
+	if len(parts) != 3 {
+		return c, fmt.Errorf("cursor must have 3 parts")
+	}
+
+	createdAt, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil || createdAt == 0 {
+		return c, fmt.Errorf("cursor must have time")
+	}
+
+	if c.PostId, err = strconv.ParseInt(parts[1], 10, 64); err != nil {
+		return c, err
+	}
+
+	if c.CommentId, err = strconv.ParseInt(parts[2], 10, 64); err != nil {
+		return c, err
+	}
+
+	c.CreatedAt = time.Unix(0, createdAt)
+	return c, nil
+}
@@ -0,0 +1,133 @@
+package services
+
+import (
+	"encoding/base64"
+	"fmt"
+	. "social/internal/models"
+	"social/internal/store"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFindMentions(t *testing.T) {
+	tt := []struct {
+		content string
+		want    []mentionCandidate
+	}{
+		{content: "@alice", want: []mentionCandidate{{"alice", 0, 6}}},
+		// offsets count runes, not bytes
+		{content: "héllo @alice 👋 @bob!", want: []mentionCandidate{{"alice", 6, 12}, {"bob", 15, 19}}},
+		{content: "(@alice),@bob", want: []mentionCandidate{{"alice", 1, 7}, {"bob", 9, 13}}},
+		{content: "mail@alice x.@alice a/@alice @@alice", want: nil},
+		{content: "@1alice @" + strings.Repeat("a", 19), want: nil},
+		{content: "日本 @a_b-c", want: []mentionCandidate{{"a_b-c", 3, 9}}},
+	}
+	for _, tc := range tt {
+		got := findMentions(tc.content)
+		if fmt.Sprint(got) != fmt.Sprint(tc.want) {
+			t.Errorf("findMentions(%q): want %v, got %v", tc.content, tc.want, got)
+		}
+
+		runes := []rune(tc.content)
+		for _, c := range got {
+			if mention := string(runes[c.start:c.end]); mention != "@"+c.username {
+				t.Errorf("want offsets of %q to cover @%s, got %q", tc.content, c.username, mention)
+			}
+		}
+	}
+}
+
+func TestMentionsOf(t *testing.T) {
+	users := map[string]User{}
+	var candidates []mentionCandidate
+	for i := 0; i < maxMentions+2; i++ {
+		username := fmt.Sprintf("user%d", i)
+		users[username] = User{Id: int64(i + 1), Username: username}
+		candidates = append(candidates, mentionCandidate{username: username, start: i * 10, end: i*10 + 6})
+	}
+
+	// repeating one already mentioned is no extra user, unknown ones are plain text
+	candidates = append(candidates,
+		mentionCandidate{username: "user0", start: 200, end: 206},
+		mentionCandidate{username: "nobody", start: 210, end: 217},
+	)
+
+	mentions := mentionsOf(candidates, users)
+	if len(mentions) != maxMentions+1 {
+		t.Fatalf("want %d mentions, got %d", maxMentions+1, len(mentions))
+	}
+
+	distinct := map[int64]bool{}
+	for _, m := range mentions {
+		distinct[m.User.Id] = true
+	}
+
+	if len(distinct) != maxMentions {
+		t.Errorf("want %d users mentioned, got %d", maxMentions, len(distinct))
+	}
+
+	if last := mentions[len(mentions)-1]; last.User.Username != "user0" || last.Start != 200 {
+		t.Errorf("want repeated mention of user0 kept, got %+v", last)
+	}
+}
+
+func TestMentionCursor(t *testing.T) {
+	c := store.MentionCursor{CreatedAt: time.Unix(1600000000, 42), PostId: 7, CommentId: 9}
+	got, err := decodeMentionCursor(encodeMentionCursor(c))
+	if err != nil || !got.CreatedAt.Equal(c.CreatedAt) || got.PostId != 7 || got.CommentId != 9 {
+		t.Errorf("want %+v back, got %+v, %v", c, got, err)
+	}
+
+	encode := func(s string) string { return base64.RawURLEncoding.EncodeToString([]byte(s)) }
+	for _, cursor := range []string{"not base64!", encode("1:2"), encode("0:1:0"), encode("1:x:0"), encode("1:1:x")} {
+		if _, err = decodeMentionCursor(cursor); err == nil {
+			t.Errorf("want error for cursor %q", cursor)
+		}
+	}
+}
+
+func TestMentions(t *testing.T) {
+	s := newTestService(t)
+	alice := newTestUser(t, s, "alice")
+	bob := newTestUser(t, s, "bob")
+	carol := newTestUser(t, s, "carol")
+
+	post, err := s.CreatePost(bob, "hi @alice and @carol and @nobody", nil, false, nil, nil)
+	if err != nil {
+		t.Fatalf("could not create post: %v", err)
+	}
+
+	if len(post.Post.Mentions) != 2 || post.Post.Mentions[0].User.Username != "alice" || post.Post.Mentions[0].Start != 3 {
+		t.Fatalf("want alice and carol mentioned, got %+v", post.Post.Mentions)
+	}
+
+	comment, err := s.CreateComment(bob, "@alice look", post.Post.Id, nil)
+	if err != nil || len(comment.Mentions) != 1 {
+		t.Fatalf("want alice mentioned in comment, got %+v, %v", comment, err)
+	}
+
+	if _, err = s.ToggleBlock(carol, "bob"); err != nil {
+		t.Fatalf("could not block: %v", err)
+	}
+
+	if post, err = s.CreatePost(bob, "@carol again", nil, false, nil, nil); err != nil || len(post.Post.Mentions) != 0 {
+		t.Errorf("want no mention of carol who blocked bob, got %+v, %v", post.Post.Mentions, err)
+	}
+
+	items, err := s.Mentions(alice, 1, "")
+	if err != nil || len(items) != 1 || items[0].Comment == nil {
+		t.Fatalf("want the comment first, got %+v, %v", items, err)
+	}
+
+	if items, err = s.Mentions(alice, 1, items[0].Cursor); err != nil || len(items) != 1 || items[0].Post == nil {
+		t.Fatalf("want the post next, got %+v, %v", items, err)
+	}
+
+	if items, err = s.Mentions(alice, 1, items[0].Cursor); err != nil || len(items) != 0 {
+		t.Errorf("want nothing after the post, got %+v, %v", items, err)
+	}
+
+	_, err = s.Mentions(alice, 0, "bogus")
+	assertInvalidField(t, err, "before")
+}
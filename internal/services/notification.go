@@ -0,0 +1,140 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	. "social/internal/models"
+	"social/internal/store"
+)
+
+const (
+	NotificationFollow  = "follow"
+	NotificationLike    = "like"
+	NotificationComment = "comment"
+	NotificationReply   = "reply"
+	NotificationMention = "mention"
+	NotificationRepost  = "repost"
+	NotificationQuote   = "quote"
+)
+
+// Notifications fetch notifications of the authenticated user, most recent first
+func (s *Service) Notifications(ctx context.Context, last int, before int64) ([]Notification, error) {
+	uid, ok := ctx.Value(KeyAuthUserId).(int64)
+	if !ok {
+		return nil, ErrUnauthenticated
+	}
+
+	return s.Store.Notifications(ctx, uid, normalizePageSize(last), before)
+}
+
+// UnreadNotificationsCount count unread notifications of the authenticated user
+func (s *Service) UnreadNotificationsCount(ctx context.Context) (int, error) {
+	uid, ok := ctx.Value(KeyAuthUserId).(int64)
+	if !ok {
+		return 0, ErrUnauthenticated
+	}
+
+	return s.Store.UnreadNotificationsCount(ctx, uid)
+}
+
+// MarkNotificationAsRead mark single notification of the authenticated user as read
+func (s *Service) MarkNotificationAsRead(ctx context.Context, notificationId int64) error {
+	uid, ok := ctx.Value(KeyAuthUserId).(int64)
+	if !ok {
+		return ErrUnauthenticated
+	}
+
+	err := s.Store.MarkNotificationAsRead(ctx, uid, notificationId)
+	if errors.Is(err, store.ErrNotFound) {
+		return ErrNotificationNotFound
+	}
+
+	return err
+}
+
+// MarkNotificationsAsRead mark all notifications of the authenticated user as read
+func (s *Service) MarkNotificationsAsRead(ctx context.Context) error {
+	uid, ok := ctx.Value(KeyAuthUserId).(int64)
+	if !ok {
+		return ErrUnauthenticated
+	}
+
+	return s.Store.MarkNotificationsAsRead(ctx, uid)
+}
+
+// SubscribeToNotifications streams notifications of the authenticated user until ctx is done
+func (s *Service) SubscribeToNotifications(ctx context.Context) (<-chan Notification, error) {
+	uid, ok := ctx.Value(KeyAuthUserId).(int64)
+	if !ok {
+		return nil, ErrUnauthenticated
+	}
+
+	sub, unsubscribe := s.notificationBroker.subscribe(uid)
+
+	nn := make(chan Notification)
+	go func() {
+		defer close(nn)
+		defer unsubscribe()
+
+		for {
+			select {
+			case v, ok := <-sub:
+				if !ok {
+					return
+				}
+
+				select {
+				case nn <- v.(Notification):
+				case <-ctx.Done():
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return nn, nil
+}
+
+// notify adds actor to the unread notification of that kind or creates new one,
+// it returns id of the notification or 0 when nobody has to be notified, that is when user acted on
+// their own or muted, blocked or was blocked by actor
+func (s *Service) notify(ctx context.Context, tx store.Store, userId, actorId int64, kind string, postId *int64) (int64, error) {
+	if userId == actorId {
+		return 0, nil
+	}
+
+	blocked, err := tx.Blocked(ctx, userId, actorId)
+	if err != nil || blocked {
+		return 0, err
+	}
+
+	muted, err := tx.IsMuting(ctx, userId, actorId)
+	if err != nil || muted {
+		return 0, err
+	}
+
+	return tx.Notify(ctx, userId, actorId, kind, postId)
+}
+
+// publishNotification sends notification to its subscribed user, call it once notify tx is committed
+func (s *Service) publishNotification(notificationId int64) {
+	if notificationId == 0 {
+		return
+	}
+
+	n, err := s.Store.Notification(context.Background(), notificationId)
+	if errors.Is(err, store.ErrNotFound) {
+		// every actor of it is hidden from the user
+		return
+	}
+
+	if err != nil {
+		log.Printf("could not fetch notification %d to publish, %v", notificationId, err)
+		return
+	}
+
+	s.notificationBroker.publish(n.UserId, n)
+}
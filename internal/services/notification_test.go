@@ -0,0 +1,97 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestNotifications(t *testing.T) {
+	s := newTestService(t)
+	alice := newTestUser(t, s, "alice")
+	bob := newTestUser(t, s, "bob")
+	carol := newTestUser(t, s, "carol")
+
+	item, err := s.CreatePost(alice, "hello", nil, false, nil, nil)
+	if err != nil {
+		t.Fatalf("could not create post: %v", err)
+	}
+
+	postId := item.Post.Id
+	for _, ctx := range []context.Context{alice, bob, carol} {
+		if _, err = s.TogglePostLike(ctx, postId); err != nil {
+			t.Fatalf("could not like post: %v", err)
+		}
+	}
+
+	if _, err = s.ToggleFollow(bob, "alice"); err != nil {
+		t.Fatalf("could not follow: %v", err)
+	}
+
+	if _, err = s.CreateComment(bob, "nice", postId, nil); err != nil {
+		t.Fatalf("could not comment: %v", err)
+	}
+
+	notifications, err := s.Notifications(alice, 0, 0)
+	if err != nil {
+		t.Fatalf("could not get notifications: %v", err)
+	}
+
+	kinds := map[string][]string{}
+	for _, n := range notifications {
+		kinds[n.Kind] = n.Actors
+	}
+
+	if len(notifications) != 3 || len(kinds[NotificationLike]) != 2 || kinds[NotificationLike][0] != "carol" ||
+		len(kinds[NotificationFollow]) != 1 || len(kinds[NotificationComment]) != 1 {
+		t.Fatalf("want likes of bob and carol coalesced, latest first, and own like left out, got %+v", notifications)
+	}
+
+	if _, err = s.TogglePostLike(carol, postId); err != nil {
+		t.Fatalf("could not unlike post: %v", err)
+	}
+
+	if notifications, err = s.Notifications(alice, 0, 0); err != nil {
+		t.Fatalf("could not get notifications: %v", err)
+	}
+
+	for _, n := range notifications {
+		if n.Kind == NotificationLike && (n.ActorsCount != 1 || n.Actors[0] != "bob") {
+			t.Errorf("want unlike to retract carol, got %+v", n)
+		}
+	}
+
+	if err = s.MarkNotificationAsRead(bob, notifications[0].Id); !errors.Is(err, ErrNotificationNotFound) {
+		t.Errorf("marking notification of someone else: want ErrNotificationNotFound, got %v", err)
+	}
+
+	if err = s.MarkNotificationsAsRead(alice); err != nil {
+		t.Fatalf("could not mark notifications as read: %v", err)
+	}
+
+	if count, _ := s.UnreadNotificationsCount(alice); count != 0 {
+		t.Errorf("want no unread notifications, got %d", count)
+	}
+
+	ctx, cancel := context.WithCancel(alice)
+	defer cancel()
+
+	nn, err := s.SubscribeToNotifications(ctx)
+	if err != nil {
+		t.Fatalf("could not subscribe: %v", err)
+	}
+
+	if _, err = s.TogglePostLike(carol, postId); err != nil {
+		t.Fatalf("could not like post: %v", err)
+	}
+
+	select {
+	case n := <-nn:
+		if n.Kind != NotificationLike || n.ActorsCount != 1 || n.Read {
+			t.Errorf("want new unread like notification once the previous one was read, got %+v", n)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("want like notification streamed")
+	}
+}
@@ -2,102 +2,139 @@ package services
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"github.com/sanity-io/litter"
-	"log"
 	. "social/internal/models"
+	"social/internal/store"
 	"strings"
 )
 
+const jobFanoutPost = "fanout_post"
+
+type fanoutPostPayload struct {
+	PostId int64 `json:"postId"`
+}
+
 //ToggleLikeOutput response model
 type ToggleLikeOutput struct {
 	Liked      bool `json:"liked,omitempty"`
 	LikesCount int  `json:"likes_count,omitempty"`
 }
 
-//CreatePost adds new post to db and timeline
+//CreatePost adds new post to db and timeline, quoting post with id quoteOf when it is set
 func (s *Service) CreatePost(
 	ctx context.Context,
 	content string,
 	spoilerOf *string,
 	nsfw bool,
+	quoteOf *int64,
+	mediaIds []int64,
 ) (TimelineItem, error) {
 	var result TimelineItem
 	userId, ok := ctx.Value(KeyAuthUserId).(int64)
 	if !ok {
-		return result, fmt.Errorf("unauthorized")
+		return result, ErrUnauthenticated
+	}
+	content, err := validatePostInput(content, spoilerOf)
+	if err != nil {
+		return result, err
 	}
-	content = strings.TrimSpace(content)
 
-	if content == "" || len([]rune(content)) > 480 {
-		return result, fmt.Errorf("bad content")
+	if err = validatePostMedia(mediaIds); err != nil {
+		return result, err
 	}
 
-	if spoilerOf != nil {
-		*spoilerOf = strings.TrimSpace(*spoilerOf)
+	var notificationIds []int64
+	err = s.Store.Tx(ctx, func(tx store.Store) error {
+		var (
+			quoted Post
+			err    error
+		)
+		if quoteOf != nil {
+			quoted, err = tx.Post(ctx, *quoteOf)
+			if errors.Is(err, store.ErrNotFound) {
+				return ErrPostNotFound
+			}
+
+			if err != nil {
+				return err
+			}
+
+			if err = checkBlocked(ctx, tx, userId, quoted.UserId); err != nil {
+				return err
+			}
+		}
 
-		if *spoilerOf == "" || len([]rune(*spoilerOf)) > 64 {
-			return result, fmt.Errorf("invalid spoiler")
+		if result.Post, err = tx.CreatePost(ctx, userId, content, spoilerOf, nsfw, quoteOf); err != nil {
+			return err
 		}
-	}
 
-	tx, err := s.Db.BeginTx(ctx, nil)
+		if err = s.attachPostMedia(ctx, tx, userId, result.Post.Id, mediaIds); err != nil {
+			return err
+		}
 
-	if err != nil {
-		return result, fmt.Errorf("cannot beging tx, %v", err)
-	}
+		if quoteOf != nil {
+			notificationId, err := s.notify(ctx, tx, quoted.UserId, userId, NotificationQuote, quoteOf)
+			if err != nil {
+				return err
+			}
+
+			notificationIds = append(notificationIds, notificationId)
+		}
 
-	defer tx.Rollback()
+		if tags := extractHashtags(content); len(tags) != 0 {
+			if err = tx.SetPostHashtags(ctx, result.Post.Id, tags); err != nil {
+				return err
+			}
+		}
 
-	query := `INSERT INTO posts (user_id, content, spoiler_of, nsfw) VALUES(@user_id,@content,@spoilerOf,@nsfw) returning id, created_at`
+		if result.Post.Mentions, err = resolveMentions(ctx, tx, userId, content); err != nil {
+			return err
+		}
 
-	query, args, err := queryBuilder(query, map[string]interface{}{
-		"user_id":   userId,
-		"content":   content,
-		"spoilerOf": spoilerOf,
-		"nsfw":      nsfw,
-	})
+		if len(result.Post.Mentions) != 0 {
+			mentionedIds, err := tx.SetPostMentions(ctx, result.Post.Id, result.Post.Mentions)
+			if err != nil {
+				return err
+			}
 
-	if err = tx.QueryRowContext(ctx, query, args...).Scan(&result.Post.Id, &result.Post.CreateAt); err != nil {
-		return result, fmt.Errorf("cannot insert post to db, %v", err)
-	}
+			mentionNotificationIds, err := s.notifyMentions(ctx, tx, mentionedIds, userId, result.Post.Id)
+			if err != nil {
+				return err
+			}
 
-	query = "insert into timeline (user_id, post_id) values (@user_id, @post_id) returning id"
-	query, args, err = queryBuilder(query, map[string]interface{}{
-		"user_id": userId,
-		"post_id": result.Post.Id,
+			notificationIds = append(notificationIds, mentionNotificationIds...)
+		}
+
+		if result.Id, err = tx.AddTimelineItem(ctx, userId, result.Post.Id); err != nil {
+			return err
+		}
+
+		return s.enqueueJob(ctx, tx, jobFanoutPost, fanoutPostPayload{PostId: result.Post.Id})
 	})
+	if err != nil {
+		return result, err
+	}
 
-	if err = tx.QueryRowContext(ctx, query, args...).Scan(&result.Id); err != nil {
-		return result, fmt.Errorf("cannot insert timelineItem to db, %v", err)
+	for _, notificationId := range notificationIds {
+		s.publishNotification(notificationId)
 	}
 
-	tx.Commit()
 	result.UserId = userId
-	result.Post.Content = content
-	result.Post.SpoilerOf = spoilerOf
-	result.Post.NSFW = nsfw
-	result.Post.UserId = userId
 	result.Post.Mine = true
 	result.PostId = result.Post.Id
 
-	go func(p Post) {
-		user, err := s.GetUserById(context.Background(), userId)
-		if err != nil {
-			log.Printf("cannot find user for post, %v", err)
-		}
-		result.Post.User = user
-		result.Post.Mine = false
+	posts := []Post{result.Post}
+	if err = s.withPostMedia(ctx, posts); err != nil {
+		return result, err
+	}
 
-		postList, err := s.fanoutPost(result.Post)
-		if err != nil {
-			log.Printf("could not fanout posts, %v", err)
-			return
-		}
-		for _, result = range postList {
-			log.Println(litter.Sdump(result))
-		}
-	}(result.Post)
+	if err = s.withQuotedPosts(ctx, userId, posts); err != nil {
+		return result, err
+	}
+
+	result.Post = posts[0]
 
 	return result, nil
 }
@@ -108,221 +145,326 @@ func (s *Service) TogglePostLike(ctx context.Context, postId int64) (ToggleLikeO
 
 	userId, ok := ctx.Value(KeyAuthUserId).(int64)
 	if !ok {
-		return result, fmt.Errorf("unauthorized")
-	}
-
-	tx, err := s.Db.BeginTx(ctx, nil)
-
-	if err != nil {
-		return result, fmt.Errorf("cannot beging tx, %v", err)
+		return result, ErrUnauthenticated
 	}
 
-	defer tx.Rollback()
-
-	query := `select exists (
-				select 1 from post_likes where user_id = @userId and post_id = @postId
-				)`
-	query, args, err := queryBuilder(query, map[string]interface{}{
-		"userId": userId,
-		"postId": postId,
-	})
+	var notificationId int64
+	err := s.Store.Tx(ctx, func(tx store.Store) error {
+		var (
+			authorId int64
+			err      error
+		)
+		if result.Liked, err = tx.IsPostLiked(ctx, userId, postId); err != nil {
+			return err
+		}
 
-	if err = tx.QueryRow(query, args...).Scan(&result.Liked); err != nil {
-		return result, fmt.Errorf("could not select posts like existance, %v", err)
-	}
+		if result.Liked {
+			if result.LikesCount, authorId, err = tx.UnlikePost(ctx, userId, postId); err != nil {
+				return err
+			}
 
-	if result.Liked {
-		query = `delete from post_likes where user_id = $userId and post_id = @postId`
-		query, args, err := queryBuilder(query, map[string]interface{}{
-			"userId": userId,
-			"postId": postId,
-		})
-		if err != nil {
-			return result, fmt.Errorf("cannot generate query , %v", err)
-		}
-		if _, err := tx.ExecContext(ctx, query, args...); err != nil {
-			return result, fmt.Errorf("could not remove like from post, %v", err)
+			return tx.RetractNotification(ctx, authorId, userId, NotificationLike, &postId)
 		}
 
-		query = "update posts set likes_count = likes_count -1 where id = $1 returning likes_count"
-		if err = tx.QueryRowContext(ctx, query, postId).Scan(&result.LikesCount); err != nil {
-			return result, fmt.Errorf("could not update post count, %v", err)
+		result.LikesCount, authorId, err = tx.LikePost(ctx, userId, postId)
+		if errors.Is(err, store.ErrNotFound) {
+			return ErrPostNotFound
 		}
-	} else {
-		query = "insert into post_likes (user_id, post_id) values ($1,$2)"
-		_, err = tx.ExecContext(ctx, query, userId, postId)
+
 		if err != nil {
-			return result, fmt.Errorf("could not insert like for post, %v", err)
-		}
-		query = "update posts set likes_count = likes_count + 1 where id = $1 returning likes_count"
-		if err = tx.QueryRowContext(ctx, query, postId).Scan(&result.LikesCount); err != nil {
-			return result, fmt.Errorf("could not update post count, %v", err)
+			return err
 		}
 
-		if err = tx.Commit(); err != nil {
-			return result, fmt.Errorf("could not commit tx, %v", err)
+		if err = checkBlocked(ctx, tx, userId, authorId); err != nil {
+			return err
 		}
 
-		result.Liked = !result.Liked
+		notificationId, err = s.notify(ctx, tx, authorId, userId, NotificationLike, &postId)
+		return err
+	})
+	if err != nil {
+		return result, err
 	}
 
+	result.Liked = !result.Liked
+	s.publishNotification(notificationId)
+
 	return result, nil
 }
 
 func (s *Service) GetMyPosts(ctx context.Context) ([]Post, error) {
-	var postList []Post
 	userId, ok := ctx.Value(KeyAuthUserId).(int64)
 	if !ok {
-		return nil, fmt.Errorf("unauthorized")
+		return nil, ErrUnauthenticated
 	}
 
-	query := ` select p.id, content, nsfw, spoiler_of, user_id, created_at,u.username, u.avatar_url from posts p
- 	left join users u on u.id = p.user_id
- 	where user_id = @userId order by created_at desc limit 10 offset 2`
-	query, args, err := queryBuilder(query, map[string]interface{}{
-		"userId": userId,
-	})
-	if err != nil {
-		return nil, fmt.Errorf("could not generate query, %v", err)
-	}
+	return s.posts(ctx, userId, userId)
+}
 
-	rows, err := s.Db.QueryContext(ctx, query, args...)
+//GetPosts fetch all posts (implement pagination later)
+func (s *Service) GetPosts(ctx context.Context) ([]Post, error) {
+	userId, ok := ctx.Value(KeyAuthUserId).(int64)
+	if !ok {
+		return nil, ErrUnauthenticated
+	}
 
-	for rows.Next() {
-		var item Post
-		rows.Scan(&item.Id, &item.Content, &item.NSFW, &item.SpoilerOf, &item.UserId,
-			&item.CreateAt, &item.User.Username, &item.User.AvatarUrl)
+	return s.posts(ctx, userId, 0)
+}
 
-		if item.UserId == userId {
-			item.Mine = true
-		}
-		postList = append(postList, item)
+// GetPostsByUserId fetch posts for specific user
+func (s *Service) GetPostsByUserId(ctx context.Context, userId int64) ([]Post, error) {
+	uid, ok := ctx.Value(KeyAuthUserId).(int64)
+	if !ok {
+		return nil, ErrUnauthenticated
 	}
 
-	return postList, nil
+	return s.posts(ctx, uid, userId)
 }
 
-//GetPosts fetch all posts (implement pagination later)
-func (s *Service) GetPosts(ctx context.Context) ([]Post, error) {
-	var postList []Post
+// GetPostById fetch single post from db
+func (s *Service) GetPostById(ctx context.Context, postId int64) (Post, error) {
 	userId, ok := ctx.Value(KeyAuthUserId).(int64)
 	if !ok {
-		return nil, fmt.Errorf("unauthorized")
+		return Post{}, ErrUnauthenticated
 	}
 
-	query := ` select p.id, content, nsfw, spoiler_of, user_id, created_at,u.username, u.avatar_url from posts p
- 	left join users u on u.id = p.user_id order by created_at desc limit 10`
-	query, args, err := queryBuilder(query, map[string]interface{}{})
+	post, err := s.visiblePost(ctx, userId, postId)
 	if err != nil {
-		return nil, fmt.Errorf("could not generate query, %v", err)
+		return post, err
 	}
 
-	rows, err := s.Db.QueryContext(ctx, query, args...)
-
-	for rows.Next() {
-		var item Post
-		rows.Scan(&item.Id, &item.Content, &item.NSFW, &item.SpoilerOf, &item.UserId,
-			&item.CreateAt, &item.User.Username, &item.User.AvatarUrl)
-
-		if item.UserId == userId {
-			item.Mine = true
-		}
-		postList = append(postList, item)
+	post.Mine = post.UserId == userId
+	posts := []Post{post}
+	if err = s.withPostDetails(ctx, userId, posts); err != nil {
+		return post, err
 	}
 
-	return postList, nil
+	return posts[0], nil
 }
 
-// GetPostsByUserId fetch posts for specific user
-func (s *Service) GetPostsByUserId(ctx context.Context, userId int64) ([]Post, error) {
-	var postList []Post
-	_, ok := ctx.Value(KeyAuthUserId).(int64)
+// UpdatePost edits post of the authenticated user, previous version is kept in post revisions
+func (s *Service) UpdatePost(
+	ctx context.Context,
+	postId int64,
+	content string,
+	spoilerOf *string,
+	nsfw bool,
+) (Post, error) {
+	var post Post
+	userId, ok := ctx.Value(KeyAuthUserId).(int64)
 	if !ok {
-		return nil, fmt.Errorf("unauthorized")
+		return post, ErrUnauthenticated
 	}
 
-	query := ` select p.id, content, nsfw, spoiler_of, user_id, created_at,u.username, u.avatar_url from posts p
- 		left join users u on u.id = p.user_id 
- 		where p.user_id = @user_id
- 		order by created_at desc limit 10`
-	query, args, err := queryBuilder(query, map[string]interface{}{
-		"userId": userId,
-	})
+	content, err := validatePostInput(content, spoilerOf)
 	if err != nil {
-		return nil, fmt.Errorf("could not generate query, %v", err)
+		return post, err
 	}
 
-	rows, err := s.Db.QueryContext(ctx, query, args...)
+	var notificationIds []int64
+	err = s.Store.Tx(ctx, func(tx store.Store) error {
+		if err := s.lockOwnPost(ctx, tx, postId, userId); err != nil {
+			return err
+		}
+
+		if err := tx.AddPostRevision(ctx, postId); err != nil {
+			return err
+		}
 
-	for rows.Next() {
-		var item Post
-		rows.Scan(&item.Id, &item.Content, &item.NSFW, &item.SpoilerOf, &item.UserId,
-			&item.CreateAt, &item.User.Username, &item.User.AvatarUrl)
+		var err error
+		if post, err = tx.UpdatePost(ctx, postId, content, spoilerOf, nsfw); err != nil {
+			return err
+		}
+
+		if err = tx.SetPostHashtags(ctx, postId, extractHashtags(content)); err != nil {
+			return err
+		}
 
-		if item.UserId == userId {
-			item.Mine = true
+		if post.Mentions, err = resolveMentions(ctx, tx, userId, content); err != nil {
+			return err
 		}
-		postList = append(postList, item)
+
+		// users mentioned before the edit were already notified
+		mentionedIds, err := tx.SetPostMentions(ctx, postId, post.Mentions)
+		if err != nil {
+			return err
+		}
+
+		notificationIds, err = s.notifyMentions(ctx, tx, mentionedIds, userId, postId)
+		return err
+	})
+	if err != nil {
+		return post, err
 	}
 
-	return postList, nil
+	for _, notificationId := range notificationIds {
+		s.publishNotification(notificationId)
+	}
+
+	user, err := s.GetUserById(ctx, userId)
+	if err != nil {
+		return post, err
+	}
+
+	post.User = user
+	post.Mine = true
+
+	posts := []Post{post}
+	if err = s.withPostMedia(ctx, posts); err != nil {
+		return post, err
+	}
+
+	if err = s.withQuotedPosts(ctx, userId, posts); err != nil {
+		return post, err
+	}
+
+	return posts[0], nil
 }
 
-// GetPostById fetch single post from db
-func (s *Service) GetPostById(ctx context.Context, postId int64) (Post, error) {
-	var post Post
+// DeletePost removes post of the authenticated user along with its timeline items, likes and comments
+func (s *Service) DeletePost(ctx context.Context, postId int64) error {
 	userId, ok := ctx.Value(KeyAuthUserId).(int64)
 	if !ok {
-		return post, fmt.Errorf("unauthorized")
+		return ErrUnauthenticated
 	}
 
-	query := ` select p.id, content, nsfw, spoiler_of, user_id, created_at,u.username, u.avatar_url from posts p
- 	left join users u on u.id = p.user_id where p.id = @postId`
-	query, args, err := queryBuilder(query, map[string]interface{}{
-		"postId": postId,
+	var media []Media
+	err := s.Store.Tx(ctx, func(tx store.Store) error {
+		if err := s.lockOwnPost(ctx, tx, postId, userId); err != nil {
+			return err
+		}
+
+		postMedia, err := tx.PostMedia(ctx, []int64{postId})
+		if err != nil {
+			return err
+		}
+
+		media = postMedia[postId]
+		return tx.DeletePost(ctx, postId)
 	})
 	if err != nil {
-		return post, fmt.Errorf("could not generate query, %v", err)
+		return err
 	}
 
-	if err = s.Db.QueryRowContext(ctx, query, args...).Scan(&post.Id, &post.Content, &post.NSFW, &post.SpoilerOf, &post.UserId,
-		&post.CreateAt, &post.User.Username, &post.User.AvatarUrl); err != nil {
-		return post, fmt.Errorf("could not fetch post from db")
+	s.removeMediaFiles(ctx, mediaFiles(media))
+	return nil
+}
+
+// GetPostRevisions fetch previous versions of a post, most recent first
+func (s *Service) GetPostRevisions(ctx context.Context, postId int64) ([]PostRevision, error) {
+	userId, ok := ctx.Value(KeyAuthUserId).(int64)
+	if !ok {
+		return nil, ErrUnauthenticated
 	}
 
-	if post.UserId == userId {
-		post.Mine = true
+	if _, err := s.visiblePost(ctx, userId, postId); err != nil {
+		return nil, err
 	}
 
-	return post, nil
+	return s.Store.PostRevisions(ctx, postId)
 }
 
 // Private methods
-func (s *Service) fanoutPost(p Post) ([]TimelineItem, error) {
-	query := "insert into timeline (user_id,post_id) " +
-		"Select follower_id, $1 from follows where followee_id = $2 " +
-		"returning id, user_id"
-	rows, err := s.Db.Query(query, p.Id, p.UserId)
+func (s *Service) fanoutPostJob(ctx context.Context, payload []byte) error {
+	var in fanoutPostPayload
+	if err := json.Unmarshal(payload, &in); err != nil {
+		return fmt.Errorf("could not unmarshal fanout payload, %v", err)
+	}
+
+	p, err := s.Store.Post(ctx, in.PostId)
+	// post deleted before it got fanned out, along with its author maybe
+	if errors.Is(err, store.ErrNotFound) {
+		return nil
+	}
+
 	if err != nil {
-		return nil, fmt.Errorf("cannot insert timeline: %v", err)
+		return fmt.Errorf("could not fetch post for fanout, %v", err)
 	}
 
-	defer rows.Close()
+	itemList, err := s.Store.FanoutPost(ctx, p.Id, p.UserId)
+	if err != nil {
+		return err
+	}
 
-	var itemList []TimelineItem
-	for rows.Next() {
-		var item TimelineItem
-		if err = rows.Scan(&item.Id, &item.PostId); err != nil {
-			return nil, err
+	posts := []Post{p}
+	if err = s.withPostDetails(ctx, 0, posts); err != nil {
+		return err
+	}
+
+	for _, item := range itemList {
+		if item.Post, err = s.quoteVisibleTo(ctx, item.UserId, posts[0]); err != nil {
+			return err
 		}
-		item.PostId = p.Id
-		item.Post = p
-		itemList = append(itemList, item)
+
+		s.timelineBroker.publish(item.UserId, item)
+	}
+
+	return nil
+}
+
+// posts fetch newest posts of author, or of everyone when authorId is 0, as seen by user with uid
+func (s *Service) posts(ctx context.Context, uid, authorId int64) ([]Post, error) {
+	postList, err := s.Store.Posts(ctx, uid, authorId, 10)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range postList {
+		postList[i].Mine = postList[i].UserId == uid
+	}
+
+	if err = s.withPostDetails(ctx, uid, postList); err != nil {
+		return nil, err
+	}
+
+	return postList, nil
+}
+
+// withPostDetails fills mentions of posts and posts they quote as seen by viewer, 0 for anyone
+func (s *Service) withPostDetails(ctx context.Context, viewerId int64, posts []Post) error {
+	if err := s.withPostMentions(ctx, posts); err != nil {
+		return err
+	}
+
+	if err := s.withPostMedia(ctx, posts); err != nil {
+		return err
+	}
+
+	return s.withQuotedPosts(ctx, viewerId, posts)
+}
+
+// lockOwnPost locks post for the rest of tx, making sure it belongs to user
+func (s *Service) lockOwnPost(ctx context.Context, tx store.Store, postId, userId int64) error {
+	authorId, err := tx.LockPost(ctx, postId)
+	if errors.Is(err, store.ErrNotFound) {
+		return ErrPostNotFound
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if authorId != userId {
+		return ErrNotPostAuthor
+	}
+
+	return nil
+}
+
+func validatePostInput(content string, spoilerOf *string) (string, error) {
+	content = strings.TrimSpace(content)
+
+	if content == "" || len([]rune(content)) > 480 {
+		return content, invalidInput("content", "must be between 1 and 480 characters")
 	}
 
-	if err = rows.Err(); err != nil {
-		return nil, fmt.Errorf("cannot iterate list of posts, %v", err)
+	if spoilerOf != nil {
+		*spoilerOf = strings.TrimSpace(*spoilerOf)
+
+		if *spoilerOf == "" || len([]rune(*spoilerOf)) > 64 {
+			return content, invalidInput("spoilerOf", "must be between 1 and 64 characters")
+		}
 	}
 
-	return itemList, err
+	return content, nil
 }
@@ -0,0 +1,43 @@
+package services
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCreatePostValidation(t *testing.T) {
+	s := newTestService(t)
+	ctx := newTestUser(t, s, "alice")
+
+	spoiler := func(s string) *string { return &s }
+	tt := []struct {
+		name      string
+		content   string
+		spoilerOf *string
+		field     string
+	}{
+		{name: "empty content", content: "   ", field: "content"},
+		{name: "content too long", content: strings.Repeat("a", 481), field: "content"},
+		{name: "empty spoiler", content: "hello", spoilerOf: spoiler(" "), field: "spoilerOf"},
+		{name: "spoiler too long", content: "hello", spoilerOf: spoiler(strings.Repeat("a", 65)), field: "spoilerOf"},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := s.CreatePost(ctx, tc.content, tc.spoilerOf, false, nil, nil)
+			assertInvalidField(t, err, tc.field)
+		})
+	}
+
+	item, err := s.CreatePost(ctx, " "+strings.Repeat("ñ", 480)+" ", spoiler(" "+strings.Repeat("ñ", 64)+" "), false, nil, nil)
+	if err != nil {
+		t.Fatalf("could not create post at the limits: %v", err)
+	}
+
+	if item.Post.Content != strings.Repeat("ñ", 480) {
+		t.Errorf("want content trimmed, got %q", item.Post.Content)
+	}
+
+	if item.Post.SpoilerOf == nil || *item.Post.SpoilerOf != strings.Repeat("ñ", 64) {
+		t.Errorf("want spoiler trimmed, got %v", item.Post.SpoilerOf)
+	}
+}
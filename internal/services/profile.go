@@ -0,0 +1,207 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/disintegration/imaging"
+	"io"
+	"net/url"
+	"regexp"
+	. "social/internal/models"
+	"social/internal/store"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	MaxCoverBytes = 5 << 20
+	// coversPrefix key prefix of cover image blobs
+	coversPrefix = "covers/"
+
+	maxDisplayNameLength = 50
+	maxBioLength         = 160
+	maxLocationLength    = 30
+	maxWebsiteLength     = 100
+	maxPronounsLength    = 30
+)
+
+// rxLink http and https urls in bio, punctuation right after them is trimmed off by findLinks
+var rxLink = regexp.MustCompile(`https?://[^\s<>"]+`)
+
+// UpdateProfileInput profile fields to change, nil ones stay as they are and empty ones are cleared
+type UpdateProfileInput struct {
+	DisplayName *string
+	Bio         *string
+	Location    *string
+	Website     *string
+	Pronouns    *string
+}
+
+// UpdateProfile edits profile of the authenticated user and returns it as updated
+func (s *Service) UpdateProfile(ctx context.Context, in UpdateProfileInput) (UserProfile, error) {
+	var profile UserProfile
+	userId, ok := ctx.Value(KeyAuthUserId).(int64)
+	if !ok {
+		return profile, ErrUnauthenticated
+	}
+
+	update, err := validateProfileInput(in)
+	if err != nil {
+		return profile, err
+	}
+
+	user, err := s.GetUserById(ctx, userId)
+	if err != nil {
+		return profile, err
+	}
+
+	if err = s.Store.UpdateProfile(ctx, userId, update); errors.Is(err, store.ErrNotFound) {
+		return profile, ErrUserNotFound
+	}
+
+	if err != nil {
+		return profile, err
+	}
+
+	return s.GetUserProfile(ctx, user.Username)
+}
+
+// UpdateCover upload and update cover image shown at the top of profile
+func (s *Service) UpdateCover(ctx context.Context, r io.Reader) (string, error) {
+	userId, ok := ctx.Value(KeyAuthUserId).(int64)
+	if !ok {
+		return "", ErrUnauthenticated
+	}
+
+	img, format, err := decodeImage(io.LimitReader(r, MaxCoverBytes), "cover")
+	if err != nil {
+		return "", err
+	}
+
+	img = imaging.Fill(img, 1500, 500, imaging.Center, imaging.CatmullRom)
+	cover, err := s.putImage(ctx, coversPrefix, img, format)
+	if err != nil {
+		return "", err
+	}
+
+	oldCover, err := s.Store.UpdateCover(ctx, userId, cover)
+	if err != nil {
+		defer s.deleteBlob(ctx, coversPrefix+cover)
+		return "", err
+	}
+	if oldCover != "" {
+		defer s.deleteBlob(ctx, coversPrefix+oldCover)
+	}
+
+	return s.Blobs.URL(coversPrefix + cover), nil
+}
+
+// withBioEntities fills mentions and links of bio of each profile, mentions resolve to users
+// as they are now, so they follow username changes and drop users that are gone
+func (s *Service) withBioEntities(ctx context.Context, profiles []UserProfile) error {
+	candidates := make([][]mentionCandidate, len(profiles))
+	var all []mentionCandidate
+	for i, p := range profiles {
+		candidates[i] = findMentions(p.Bio)
+		all = append(all, candidates[i]...)
+	}
+
+	users, err := mentionedUsers(ctx, s.Store, all)
+	if err != nil {
+		return err
+	}
+
+	for i := range profiles {
+		profiles[i].BioMentions = mentionsOf(candidates[i], users)
+		profiles[i].BioLinks = findLinks(profiles[i].Bio)
+	}
+
+	return nil
+}
+
+// validateProfileInput trims and checks fields of in, websites without scheme get https://
+func validateProfileInput(in UpdateProfileInput) (store.ProfileUpdate, error) {
+	fields := []struct {
+		name      string
+		value     *string
+		maxLength int
+		multiline bool
+	}{
+		{"displayName", in.DisplayName, maxDisplayNameLength, false},
+		{"bio", in.Bio, maxBioLength, true},
+		{"location", in.Location, maxLocationLength, false},
+		{"website", in.Website, maxWebsiteLength, false},
+		{"pronouns", in.Pronouns, maxPronounsLength, false},
+	}
+	for _, f := range fields {
+		if f.value == nil {
+			continue
+		}
+
+		*f.value = strings.TrimSpace(*f.value)
+		if utf8.RuneCountInString(*f.value) > f.maxLength {
+			return store.ProfileUpdate{}, invalidInput(f.name, fmt.Sprintf("must be at most %d characters", f.maxLength))
+		}
+
+		for _, r := range *f.value {
+			if unicode.IsControl(r) && !(f.multiline && r == '\n') {
+				return store.ProfileUpdate{}, invalidInput(f.name, "must not have control characters")
+			}
+		}
+	}
+
+	if in.Website != nil && *in.Website != "" {
+		website, ok := normalizeWebsite(*in.Website)
+		if !ok {
+			return store.ProfileUpdate{}, invalidInput("website", "must be http or https url")
+		}
+
+		in.Website = &website
+	}
+
+	return store.ProfileUpdate{
+		DisplayName: in.DisplayName,
+		Bio:         in.Bio,
+		Location:    in.Location,
+		Website:     in.Website,
+		Pronouns:    in.Pronouns,
+	}, nil
+}
+
+// normalizeWebsite parses website as http or https url with host, https:// is assumed when scheme is left out
+func normalizeWebsite(website string) (string, bool) {
+	if !strings.Contains(website, "://") {
+		website = "https://" + website
+	}
+
+	u, err := url.Parse(website)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" || u.User != nil {
+		return "", false
+	}
+
+	if utf8.RuneCountInString(u.String()) > maxWebsiteLength {
+		return "", false
+	}
+
+	return u.String(), true
+}
+
+// findLinks http and https urls in content, in order they appear
+func findLinks(content string) []Link {
+	var links []Link
+	runes, offset := 0, 0
+	for _, match := range rxLink.FindAllStringIndex(content, -1) {
+		link := strings.TrimRight(content[match[0]:match[1]], ".,;:!?)]}'")
+		if _, err := url.Parse(link); err != nil {
+			continue
+		}
+
+		runes += utf8.RuneCountInString(content[offset:match[0]])
+		offset = match[0]
+		links = append(links, Link{Start: runes, End: runes + utf8.RuneCountInString(link), Url: link})
+	}
+
+	return links
+}
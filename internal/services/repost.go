@@ -0,0 +1,220 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	. "social/internal/models"
+	"social/internal/store"
+)
+
+const jobFanoutRepost = "fanout_repost"
+
+type fanoutRepostPayload struct {
+	PostId int64 `json:"postId"`
+	UserId int64 `json:"userId"`
+}
+
+// ToggleRepostOutput response model
+type ToggleRepostOutput struct {
+	Reposted     bool `json:"reposted"`
+	RepostsCount int  `json:"repostsCount"`
+}
+
+// TogglePostRepost reposts post to followers of the authenticated user or takes the repost back
+func (s *Service) TogglePostRepost(ctx context.Context, postId int64) (ToggleRepostOutput, error) {
+	var result ToggleRepostOutput
+
+	userId, ok := ctx.Value(KeyAuthUserId).(int64)
+	if !ok {
+		return result, ErrUnauthenticated
+	}
+
+	var notificationId int64
+	err := s.Store.Tx(ctx, func(tx store.Store) error {
+		var (
+			authorId int64
+			err      error
+		)
+		if result.Reposted, err = tx.IsPostReposted(ctx, userId, postId); err != nil {
+			return err
+		}
+
+		if result.Reposted {
+			if result.RepostsCount, authorId, err = tx.Unrepost(ctx, userId, postId); err != nil {
+				return err
+			}
+
+			return tx.RetractNotification(ctx, authorId, userId, NotificationRepost, &postId)
+		}
+
+		result.RepostsCount, authorId, err = tx.Repost(ctx, userId, postId)
+		if errors.Is(err, store.ErrNotFound) {
+			return ErrPostNotFound
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if err = checkBlocked(ctx, tx, userId, authorId); err != nil {
+			return err
+		}
+
+		if notificationId, err = s.notify(ctx, tx, authorId, userId, NotificationRepost, &postId); err != nil {
+			return err
+		}
+
+		return s.enqueueJob(ctx, tx, jobFanoutRepost, fanoutRepostPayload{PostId: postId, UserId: userId})
+	})
+	if err != nil {
+		return result, err
+	}
+
+	result.Reposted = !result.Reposted
+	s.publishNotification(notificationId)
+
+	return result, nil
+}
+
+func (s *Service) fanoutRepostJob(ctx context.Context, payload []byte) error {
+	var in fanoutRepostPayload
+	if err := json.Unmarshal(payload, &in); err != nil {
+		return fmt.Errorf("could not unmarshal repost fanout payload, %v", err)
+	}
+
+	// repost taken back before it got fanned out
+	reposted, err := s.Store.IsPostReposted(ctx, in.UserId, in.PostId)
+	if err != nil {
+		return fmt.Errorf("could not check repost for fanout, %v", err)
+	}
+
+	if !reposted {
+		return nil
+	}
+
+	p, err := s.Store.Post(ctx, in.PostId)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("could not fetch post for repost fanout, %v", err)
+	}
+
+	reposter, err := s.Store.UserById(ctx, in.UserId)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("could not fetch reposter for fanout, %v", err)
+	}
+
+	itemList, err := s.Store.FanoutRepost(ctx, p.Id, reposter.Id)
+	if err != nil {
+		return err
+	}
+
+	posts := []Post{p}
+	if err = s.withPostDetails(ctx, 0, posts); err != nil {
+		return err
+	}
+
+	for _, item := range itemList {
+		if item.Post, err = s.quoteVisibleTo(ctx, item.UserId, posts[0]); err != nil {
+			return err
+		}
+
+		item.Post.Mine = item.Post.UserId == item.UserId
+		item.RepostedBy = &reposter
+		s.timelineBroker.publish(item.UserId, item)
+	}
+
+	return nil
+}
+
+// withQuotedPosts fills posts quoted by posts, along with their mentions and media,
+// posts of users viewer blocked or was blocked by are left out, viewer 0 sees every one of them
+func (s *Service) withQuotedPosts(ctx context.Context, viewerId int64, posts []Post) error {
+	var ids []int64
+	for _, p := range posts {
+		if p.QuoteOfId != nil {
+			ids = append(ids, *p.QuoteOfId)
+		}
+	}
+
+	if len(ids) == 0 {
+		return nil
+	}
+
+	quoted, err := s.Store.PostsByIds(ctx, ids)
+	if err != nil {
+		return err
+	}
+
+	if viewerId != 0 {
+		blockedIds, err := s.Store.BlockedUserIds(ctx, viewerId)
+		if err != nil {
+			return err
+		}
+
+		for id, q := range quoted {
+			for _, blockedId := range blockedIds {
+				if q.UserId == blockedId {
+					delete(quoted, id)
+					break
+				}
+			}
+		}
+	}
+
+	quotedList := make([]Post, 0, len(quoted))
+	for _, q := range quoted {
+		quotedList = append(quotedList, q)
+	}
+
+	if err = s.withPostMentions(ctx, quotedList); err != nil {
+		return err
+	}
+
+	if err = s.withPostMedia(ctx, quotedList); err != nil {
+		return err
+	}
+
+	for _, q := range quotedList {
+		quoted[q.Id] = q
+	}
+
+	for i := range posts {
+		if posts[i].QuoteOfId == nil {
+			continue
+		}
+
+		if q, ok := quoted[*posts[i].QuoteOfId]; ok {
+			posts[i].QuoteOf = &q
+		}
+	}
+
+	return nil
+}
+
+// quoteVisibleTo post with its quoted post left out when viewer blocked or was blocked by its author,
+// fan-out fills details of post once for every follower and this tells them apart
+func (s *Service) quoteVisibleTo(ctx context.Context, viewerId int64, post Post) (Post, error) {
+	if post.QuoteOf == nil {
+		return post, nil
+	}
+
+	blocked, err := s.Store.Blocked(ctx, viewerId, post.QuoteOf.UserId)
+	if err != nil {
+		return post, err
+	}
+
+	if blocked {
+		post.QuoteOf = nil
+	}
+
+	return post, nil
+}
@@ -0,0 +1,135 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestTogglePostRepost(t *testing.T) {
+	s := newTestService(t)
+	alice := newTestUser(t, s, "alice")
+	bob := newTestUser(t, s, "bob")
+	carol := newTestUser(t, s, "carol")
+	dave := newTestUser(t, s, "dave")
+
+	for _, followee := range []string{"alice", "bob"} {
+		if _, err := s.ToggleFollow(carol, followee); err != nil {
+			t.Fatalf("could not follow %s: %v", followee, err)
+		}
+	}
+
+	post, err := s.CreatePost(dave, "worth sharing", nil, false, nil, nil)
+	if err != nil {
+		t.Fatalf("could not create post: %v", err)
+	}
+
+	postId := post.Post.Id
+	repost := func(ctx context.Context, want bool, count int) {
+		t.Helper()
+
+		out, err := s.TogglePostRepost(ctx, postId)
+		if err != nil || out.Reposted != want || out.RepostsCount != count {
+			t.Fatalf("want reposted %v with %d reposts, got %+v, %v", want, count, out, err)
+		}
+
+		runJobs(t, s)
+	}
+	timelineOf := func(ctx context.Context) []string {
+		t.Helper()
+
+		timeline, err := s.Timeline(ctx, 0, 0)
+		if err != nil {
+			t.Fatalf("could not get timeline: %v", err)
+		}
+
+		var reposters []string
+		for _, item := range timeline {
+			if item.RepostedBy == nil {
+				t.Fatalf("want only reposts in timeline, got %+v", item)
+			}
+
+			reposters = append(reposters, item.RepostedBy.Username)
+		}
+
+		return reposters
+	}
+
+	repost(alice, true, 1)
+	repost(bob, true, 2)
+
+	// the post comes once, from whoever reposted it first
+	if got := timelineOf(carol); len(got) != 1 || got[0] != "alice" {
+		t.Fatalf("want single item reposted by alice, got %v", got)
+	}
+
+	if got := timelineOf(bob); len(got) != 1 || got[0] != "bob" {
+		t.Errorf("want own repost in timeline of bob, got %v", got)
+	}
+
+	// bob still reposts it, so carol keeps it
+	repost(alice, false, 1)
+	if got := timelineOf(carol); len(got) != 1 || got[0] != "bob" {
+		t.Fatalf("want item credited to bob, got %v", got)
+	}
+
+	if got := timelineOf(alice); len(got) != 0 {
+		t.Errorf("want repost gone from timeline of alice, got %v", got)
+	}
+
+	repost(bob, false, 0)
+	if got := timelineOf(carol); len(got) != 0 {
+		t.Errorf("want item gone once nobody carol follows reposts it, got %v", got)
+	}
+}
+
+func TestFanoutQuoteOfBlocked(t *testing.T) {
+	s := newTestService(t)
+	alice := newTestUser(t, s, "alice")
+	bob := newTestUser(t, s, "bob")
+	carol := newTestUser(t, s, "carol")
+
+	for _, follower := range []context.Context{bob, carol} {
+		if _, err := s.ToggleFollow(follower, "alice"); err != nil {
+			t.Fatalf("could not follow: %v", err)
+		}
+	}
+
+	quoted, err := s.CreatePost(bob, "original", nil, false, nil, nil)
+	if err != nil {
+		t.Fatalf("could not create post: %v", err)
+	}
+
+	if _, err = s.ToggleBlock(carol, "bob"); err != nil {
+		t.Fatalf("could not block: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(carol)
+	defer cancel()
+
+	tt, err := s.SubscribeToTimeline(ctx, 0)
+	if err != nil {
+		t.Fatalf("could not subscribe: %v", err)
+	}
+
+	if _, err = s.CreatePost(alice, "quoting", nil, false, &quoted.Post.Id, nil); err != nil {
+		t.Fatalf("could not create post: %v", err)
+	}
+
+	runJobs(t, s)
+
+	// fan-out runs without anyone authenticated, quote is still hidden from carol only
+	select {
+	case item := <-tt:
+		if item.Post.QuoteOfId == nil || item.Post.QuoteOf != nil {
+			t.Errorf("want quote of blocked bob left out for carol, got %+v", item.Post)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("want post of alice streamed to carol")
+	}
+
+	timeline, err := s.Timeline(bob, 0, 0)
+	if err != nil || len(timeline) == 0 || timeline[0].Post.QuoteOf == nil {
+		t.Errorf("want quote shown to bob, got %+v, %v", timeline, err)
+	}
+}
@@ -0,0 +1,212 @@
+package services
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"html"
+	. "social/internal/models"
+	"social/internal/store"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const maxSearchTerms = 8
+
+// SearchPostsInput query and filters of post search, From and To are dates or RFC 3339 times,
+// a plain To date includes the whole day, Spoiler is "true", "false" or empty for either
+type SearchPostsInput struct {
+	Query       string
+	Author      string
+	From        string
+	To          string
+	Spoiler     string
+	ExcludeNSFW bool
+	First       int
+	After       string
+}
+
+// SearchPosts full text search of posts ranked by relevance and recency, words in double quotes
+// match as a phrase and word ending with * matches as prefix
+func (s *Service) SearchPosts(ctx context.Context, in SearchPostsInput) ([]PostSearchResult, error) {
+	uid, _ := ctx.Value(KeyAuthUserId).(int64)
+
+	search := store.PostSearch{
+		ViewerId:    uid,
+		Terms:       parseSearchQuery(in.Query),
+		ExcludeNSFW: in.ExcludeNSFW,
+		// wall clock only, as the cursor keeps it, so later pages score posts the same way
+		AsOf: time.Now().Round(0),
+	}
+	if len(search.Terms) == 0 {
+		return nil, invalidInput("q", "must have at least one word")
+	}
+
+	if len(search.Terms) > maxSearchTerms {
+		return nil, invalidInput("q", fmt.Sprintf("must have at most %d words or phrases", maxSearchTerms))
+	}
+
+	var err error
+	if search.From, err = parseSearchDate(in.From, false); err != nil {
+		return nil, invalidInput("from", "must be a date or RFC 3339 time")
+	}
+
+	if search.To, err = parseSearchDate(in.To, true); err != nil {
+		return nil, invalidInput("to", "must be a date or RFC 3339 time")
+	}
+
+	switch in.Spoiler {
+	case "":
+	case "true", "false":
+		spoiler := in.Spoiler == "true"
+		search.Spoiler = &spoiler
+	default:
+		return nil, invalidInput("spoiler", "must be true or false")
+	}
+
+	if in.Author != "" {
+		author, err := s.Store.UserByUsername(ctx, strings.TrimSpace(in.Author))
+		if errors.Is(err, store.ErrNotFound) {
+			return nil, ErrUserNotFound
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		search.AuthorId = author.Id
+	}
+
+	var (
+		afterScore float64
+		afterId    int64
+	)
+	if in.After != "" {
+		if search.AsOf, afterScore, afterId, err = decodeSearchCursor(in.After); err != nil {
+			return nil, invalidInput("after", "invalid cursor")
+		}
+	}
+
+	matches, err := s.Store.SearchPosts(ctx, search, normalizePageSize(in.First), afterScore, afterId)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]PostSearchResult, 0, len(matches))
+	posts := make([]Post, 0, len(matches))
+	for _, m := range matches {
+		m.Post.Mine = m.Post.UserId == uid
+		posts = append(posts, m.Post)
+		results = append(results, PostSearchResult{
+			Snippet: highlightSnippet(m.Snippet),
+			Cursor:  encodeSearchCursor(search.AsOf, m.Score, m.Post.Id),
+		})
+	}
+
+	if err = s.withPostDetails(ctx, uid, posts); err != nil {
+		return nil, err
+	}
+
+	for i := range results {
+		results[i].Post = posts[i]
+	}
+
+	return results, nil
+}
+
+// parseSearchQuery splits q into terms, words in double quotes make a single phrase term
+func parseSearchQuery(q string) []store.SearchTerm {
+	var terms []store.SearchTerm
+	for i, part := range strings.Split(q, `"`) {
+		// odd parts are the quoted ones
+		if i%2 == 1 {
+			terms = appendSearchTerm(terms, part)
+			continue
+		}
+
+		for _, field := range strings.Fields(part) {
+			terms = appendSearchTerm(terms, field)
+		}
+	}
+
+	return terms
+}
+
+// appendSearchTerm appends words of s as term, dropping everything but letters and digits
+func appendSearchTerm(terms []store.SearchTerm, s string) []store.SearchTerm {
+	words := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if len(words) == 0 {
+		return terms
+	}
+
+	prefix := strings.HasSuffix(strings.TrimSpace(s), "*")
+	return append(terms, store.SearchTerm{Words: words, Prefix: prefix})
+}
+
+func parseSearchDate(s string, end bool) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		return t, err
+	}
+
+	if end {
+		t = t.AddDate(0, 0, 1)
+	}
+
+	return t, nil
+}
+
+// highlightSnippet escapes snippet and turns match markers into mark tags
+func highlightSnippet(snippet string) string {
+	snippet = html.EscapeString(snippet)
+	snippet = strings.ReplaceAll(snippet, store.SnippetStart, "<mark>")
+	return strings.ReplaceAll(snippet, store.SnippetStop, "</mark>")
+}
+
+// encodeSearchCursor keeps moment the first page was ranked at, so scores of later pages compare
+func encodeSearchCursor(asOf time.Time, score float64, id int64) string {
+	s := strconv.FormatInt(asOf.UnixNano(), 10) + ":" + strconv.FormatFloat(score, 'g', -1, 64) + ":" + strconv.FormatInt(id, 10)
+	return base64.RawURLEncoding.EncodeToString([]byte(s))
+}
+
+func decodeSearchCursor(cursor string) (time.Time, float64, int64, error) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, 0, 0, err
+	}
+
+	parts := strings.Split(string(b), ":")
+	if len(parts) != 3 {
+		return time.Time{}, 0, 0, fmt.Errorf("cursor must have 3 parts")
+	}
+
+	asOf, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return time.Time{}, 0, 0, err
+	}
+
+	score, err := strconv.ParseFloat(parts[1], 64)
+	if err != nil {
+		return time.Time{}, 0, 0, err
+	}
+
+	id, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil || id == 0 {
+		return time.Time{}, 0, 0, fmt.Errorf("cursor must have post id")
+	}
+
+	return time.Unix(0, asOf), score, id, nil
+}
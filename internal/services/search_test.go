@@ -0,0 +1,160 @@
+package services
+
+import (
+	"encoding/base64"
+	"reflect"
+	"social/internal/store"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseSearchQuery(t *testing.T) {
+	tt := []struct {
+		q    string
+		want []store.SearchTerm
+	}{
+		{q: "", want: nil},
+		{q: "  ¿? ", want: nil},
+		{q: "Go  gopher", want: []store.SearchTerm{{Words: []string{"go"}}, {Words: []string{"gopher"}}}},
+		{q: "gop*", want: []store.SearchTerm{{Words: []string{"gop"}, Prefix: true}}},
+		{q: "don't", want: []store.SearchTerm{{Words: []string{"don", "t"}}}},
+		{q: `say "Hello, World" now`, want: []store.SearchTerm{
+			{Words: []string{"say"}},
+			{Words: []string{"hello", "world"}},
+			{Words: []string{"now"}},
+		}},
+		{q: `"hello wor*"`, want: []store.SearchTerm{{Words: []string{"hello", "wor"}, Prefix: true}}},
+		// unterminated quote runs to the end
+		{q: `a "b c`, want: []store.SearchTerm{{Words: []string{"a"}}, {Words: []string{"b", "c"}}}},
+		{q: "café 東京", want: []store.SearchTerm{{Words: []string{"café"}}, {Words: []string{"東京"}}}},
+	}
+	for _, tc := range tt {
+		if got := parseSearchQuery(tc.q); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("parseSearchQuery(%q): want %+v, got %+v", tc.q, tc.want, got)
+		}
+	}
+}
+
+func TestParseSearchDate(t *testing.T) {
+	day := time.Date(2021, 3, 4, 0, 0, 0, 0, time.UTC)
+	tt := []struct {
+		s    string
+		end  bool
+		want time.Time
+	}{
+		{s: "", want: time.Time{}},
+		{s: "2021-03-04", want: day},
+		{s: "2021-03-04", end: true, want: day.AddDate(0, 0, 1)},
+		{s: "2021-03-04T10:00:00Z", end: true, want: day.Add(10 * time.Hour)},
+	}
+	for _, tc := range tt {
+		if got, err := parseSearchDate(tc.s, tc.end); err != nil || !got.Equal(tc.want) {
+			t.Errorf("parseSearchDate(%q, %v): want %v, got %v, %v", tc.s, tc.end, tc.want, got, err)
+		}
+	}
+
+	if _, err := parseSearchDate("yesterday", false); err == nil {
+		t.Error("want error for date that is not one")
+	}
+}
+
+func TestHighlightSnippet(t *testing.T) {
+	snippet := "<b>" + store.SnippetStart + "go" + store.SnippetStop + "</b> & " + store.SnippetStart + "rust" + store.SnippetStop
+	want := "&lt;b&gt;<mark>go</mark>&lt;/b&gt; &amp; <mark>rust</mark>"
+	if got := highlightSnippet(snippet); got != want {
+		t.Errorf("want %q, got %q", want, got)
+	}
+}
+
+func TestSearchCursor(t *testing.T) {
+	asOf := time.Unix(1600000000, 123456789)
+	for _, score := range []float64{0, 0.1, 1.0 / 3, 1e-12} {
+		cursor := encodeSearchCursor(asOf, score, 42)
+		gotAsOf, gotScore, gotId, err := decodeSearchCursor(cursor)
+		if err != nil || !gotAsOf.Equal(asOf) || gotScore != score || gotId != 42 {
+			t.Errorf("want %v, %v, 42 back, got %v, %v, %d, %v", asOf, score, gotAsOf, gotScore, gotId, err)
+		}
+	}
+
+	encode := func(s string) string { return base64.RawURLEncoding.EncodeToString([]byte(s)) }
+	for _, cursor := range []string{
+		"not base64!",
+		encode("1:0.5"),
+		encode("x:0.5:1"),
+		encode("1:x:1"),
+		encode("1:0.5:x"),
+		encode("1:0.5:0"),
+		encode("1:0.5:1:2"),
+	} {
+		if _, _, _, err := decodeSearchCursor(cursor); err == nil {
+			t.Errorf("want error for cursor %q", cursor)
+		}
+	}
+}
+
+func TestSearchPosts(t *testing.T) {
+	s := newTestService(t)
+	ctx := newTestUser(t, s, "alice")
+
+	for _, content := range []string{"hello gophers", "Gophers say hello", "goodbye", "hello <world>"} {
+		if _, err := s.CreatePost(ctx, content, nil, false, nil, nil); err != nil {
+			t.Fatalf("could not create post: %v", err)
+		}
+	}
+
+	_, err := s.SearchPosts(ctx, SearchPostsInput{Query: `"" ?`})
+	assertInvalidField(t, err, "q")
+
+	_, err = s.SearchPosts(ctx, SearchPostsInput{Query: strings.Repeat("a ", maxSearchTerms+1)})
+	assertInvalidField(t, err, "q")
+
+	_, err = s.SearchPosts(ctx, SearchPostsInput{Query: "hello", From: "soon"})
+	assertInvalidField(t, err, "from")
+
+	_, err = s.SearchPosts(ctx, SearchPostsInput{Query: "hello", Spoiler: "maybe"})
+	assertInvalidField(t, err, "spoiler")
+
+	_, err = s.SearchPosts(ctx, SearchPostsInput{Query: "hello", After: "bogus"})
+	assertInvalidField(t, err, "after")
+
+	if _, err = s.SearchPosts(ctx, SearchPostsInput{Query: "hello", Author: "nobody"}); err != ErrUserNotFound {
+		t.Errorf("want ErrUserNotFound, got %v", err)
+	}
+
+	results, err := s.SearchPosts(ctx, SearchPostsInput{Query: "hello"})
+	if err != nil || len(results) != 3 {
+		t.Fatalf("want 3 posts with hello, got %d, %v", len(results), err)
+	}
+
+	for _, r := range results {
+		if !r.Post.Mine || !strings.Contains(r.Snippet, "<mark>hello</mark>") || strings.Contains(r.Snippet, "<world>") {
+			t.Errorf("want own post with escaped highlighted snippet, got %+v", r)
+		}
+	}
+
+	// cursor of each page picks up right after it, however the pages are cut
+	seen := map[int64]bool{}
+	after := ""
+	for page := 0; page < 3; page++ {
+		results, err = s.SearchPosts(ctx, SearchPostsInput{Query: "hello", First: 1, After: after})
+		if err != nil || len(results) != 1 || seen[results[0].Post.Id] {
+			t.Fatalf("want next single post on page %d, got %+v, %v", page, results, err)
+		}
+
+		seen[results[0].Post.Id] = true
+		after = results[0].Cursor
+	}
+
+	if results, err = s.SearchPosts(ctx, SearchPostsInput{Query: "hello", After: after}); err != nil || len(results) != 0 {
+		t.Errorf("want nothing after the last post, got %d, %v", len(results), err)
+	}
+
+	if results, err = s.SearchPosts(ctx, SearchPostsInput{Query: `"gophers say"`}); err != nil || len(results) != 1 {
+		t.Errorf("want single post with the phrase, got %d, %v", len(results), err)
+	}
+
+	if results, err = s.SearchPosts(ctx, SearchPostsInput{Query: "good*"}); err != nil || len(results) != 1 {
+		t.Errorf("want single post with the prefix, got %d, %v", len(results), err)
+	}
+}
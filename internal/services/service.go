@@ -1,21 +1,46 @@
 package services
 
 import (
-	"database/sql"
 	"github.com/hako/branca"
+	"social/internal/blob"
+	"social/internal/mailing"
+	"social/internal/store"
 )
 
 // Service contains core logic
 type Service struct {
-	Db     *sql.DB
+	Store  store.Store
 	Codec  *branca.Branca
 	Origin string
+	Mailer mailing.Mailer
+	// Blobs stores avatar and media files
+	Blobs blob.Store
+	// DevLogin allows Login by email alone, never enable it in production
+	DevLogin bool
+
+	jobHandlers        map[string]JobHandler
+	timelineBroker     *broker
+	notificationBroker *broker
 }
 
-func New(db *sql.DB, cdc *branca.Branca, origin string) *Service {
-	return &Service{
-		db,
-		cdc,
-		origin,
+func New(st store.Store, cdc *branca.Branca, origin string, mailer mailing.Mailer, blobs blob.Store) *Service {
+	s := &Service{
+		Store:  st,
+		Codec:  cdc,
+		Origin: origin,
+		Mailer: mailer,
+		Blobs:  blobs,
+
+		timelineBroker:     newBroker("timeline"),
+		notificationBroker: newBroker("notification"),
 	}
+
+	s.jobHandlers = map[string]JobHandler{
+		jobFanoutPost:    s.fanoutPostJob,
+		jobFanoutRepost:  s.fanoutRepostJob,
+		jobExportUser:    s.exportUserJob,
+		jobSendMagicLink: s.sendMagicLinkJob,
+	}
+
+	return s
 }
@@ -0,0 +1,72 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"github.com/hako/branca"
+	"social/internal/blob"
+	"social/internal/mailing"
+	"social/internal/store"
+	"testing"
+)
+
+// newTestService service backed by in memory store, it keeps no mails and blobs outside of the test
+func newTestService(t *testing.T) *Service {
+	t.Helper()
+
+	blobs := blob.NewFSStore(t.TempDir(), "http://localhost/img", []byte("secret"))
+	return New(store.NewMemory(), branca.NewBranca("YEk9b2KT7Hv6bYuthSzckXKkqkYZawhq"), "http://localhost",
+		&mailing.LogMailer{From: "noreply@localhost", Dir: t.TempDir()}, blobs)
+}
+
+// newTestUser creates user with username and returns context authenticated as them
+func newTestUser(t *testing.T, s *Service, username string) context.Context {
+	t.Helper()
+
+	ctx := context.Background()
+	if err := s.CreateUser(ctx, username+"@example.org", username); err != nil {
+		t.Fatalf("could not create user %s: %v", username, err)
+	}
+
+	user, err := s.Store.UserByEmail(ctx, username+"@example.org")
+	if err != nil {
+		t.Fatalf("could not get user %s: %v", username, err)
+	}
+
+	return context.WithValue(ctx, KeyAuthUserId, user.Id)
+}
+
+// authUserId id of the user ctx is authenticated as
+func authUserId(ctx context.Context) int64 {
+	return ctx.Value(KeyAuthUserId).(int64)
+}
+
+// assertInvalidField fails unless err is InvalidInputError about field
+func assertInvalidField(t *testing.T, err error, field string) {
+	t.Helper()
+
+	var invalid *InvalidInputError
+	if !errors.As(err, &invalid) {
+		t.Fatalf("want invalid %s, got %v", field, err)
+	}
+
+	if _, ok := invalid.Fields[field]; !ok {
+		t.Fatalf("want invalid %s, got %v", field, err)
+	}
+}
+
+// runJobs runs queued jobs that are due until none is left
+func runJobs(t *testing.T, s *Service) {
+	t.Helper()
+
+	for {
+		ran, err := s.runNextJob(context.Background())
+		if err != nil {
+			t.Fatalf("could not run job: %v", err)
+		}
+
+		if !ran {
+			return
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	. "social/internal/models"
+	"social/internal/store"
+	"strings"
+	"time"
+)
+
+// sessionTouchInterval how often last seen time of a session is updated
+const sessionTouchInterval = time.Minute
+
+// RefreshToken rotates refresh token and issues new access token for its session,
+// presenting already rotated refresh token revokes the session as the token was likely stolen
+func (s *Service) RefreshToken(ctx context.Context, refreshToken string) (LoginOutput, error) {
+	var out LoginOutput
+	refreshToken = strings.TrimSpace(refreshToken)
+	if refreshToken == "" {
+		return out, ErrInvalidToken
+	}
+
+	newRefreshToken, err := randomString(32)
+	if err != nil {
+		return out, err
+	}
+
+	hash := hashToken(refreshToken)
+	sessionId, user, err := s.Store.RotateRefreshToken(ctx, hash, hashToken(newRefreshToken))
+	if errors.Is(err, store.ErrNotFound) {
+		if sessionId, err = s.Store.RevokeRotatedRefreshToken(ctx, hash); err == nil {
+			log.Printf("reused refresh token, session %s revoked", sessionId)
+		} else if !errors.Is(err, store.ErrNotFound) {
+			return out, err
+		}
+
+		return out, ErrInvalidToken
+	}
+
+	if err != nil {
+		return out, err
+	}
+
+	out, err = s.accessToken(user, sessionId)
+	if err != nil {
+		return out, err
+	}
+
+	out.RefreshToken = newRefreshToken
+	return out, nil
+}
+
+// Logout revokes current session of the authenticated user
+func (s *Service) Logout(ctx context.Context) error {
+	sessionId, ok := ctx.Value(KeyAuthSessionId).(string)
+	if !ok {
+		return ErrUnauthenticated
+	}
+
+	return s.RevokeSession(ctx, sessionId)
+}
+
+// Sessions lists active sessions of the authenticated user, most recently seen first
+func (s *Service) Sessions(ctx context.Context) ([]Session, error) {
+	uid, ok := ctx.Value(KeyAuthUserId).(int64)
+	if !ok {
+		return nil, ErrUnauthenticated
+	}
+
+	currentId, _ := ctx.Value(KeyAuthSessionId).(string)
+
+	sessions, err := s.Store.Sessions(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range sessions {
+		sessions[i].Current = sessions[i].Id == currentId
+	}
+
+	return sessions, nil
+}
+
+// RevokeSession revokes single session of the authenticated user, its tokens stop working right away
+func (s *Service) RevokeSession(ctx context.Context, sessionId string) error {
+	uid, ok := ctx.Value(KeyAuthUserId).(int64)
+	if !ok {
+		return ErrUnauthenticated
+	}
+
+	return s.Store.DeleteSession(ctx, uid, sessionId)
+}
+
+// RevokeSessions revokes every session of the authenticated user, current one included
+func (s *Service) RevokeSessions(ctx context.Context) error {
+	uid, ok := ctx.Value(KeyAuthUserId).(int64)
+	if !ok {
+		return ErrUnauthenticated
+	}
+
+	return s.Store.DeleteSessions(ctx, uid)
+}
+
+// touchSession checks that session is still active and updates when it was last seen
+func (s *Service) touchSession(ctx context.Context, userId int64, sessionId string) error {
+	lastSeenAt, err := s.Store.SessionLastSeenAt(ctx, userId, sessionId)
+	if errors.Is(err, store.ErrNotFound) {
+		return ErrInvalidToken
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if time.Since(lastSeenAt) < sessionTouchInterval {
+		return nil
+	}
+
+	ip, _ := ctx.Value(KeyRemoteIP).(string)
+	return s.Store.TouchSession(ctx, sessionId, ip)
+}
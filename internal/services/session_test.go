@@ -0,0 +1,43 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestRefreshTokenReuse(t *testing.T) {
+	s := newTestService(t)
+	s.DevLogin = true
+	alice := newTestUser(t, s, "alice")
+
+	login, err := s.Login(alice, "alice@example.org")
+	if err != nil {
+		t.Fatalf("could not login: %v", err)
+	}
+
+	refreshed, err := s.RefreshToken(context.Background(), login.RefreshToken)
+	if err != nil {
+		t.Fatalf("could not refresh token: %v", err)
+	}
+
+	if refreshed.RefreshToken == login.RefreshToken {
+		t.Fatal("want refresh token rotated")
+	}
+
+	if _, _, err = s.Authorized(context.Background(), refreshed.Token); err != nil {
+		t.Fatalf("want refreshed access token authorized, got %v", err)
+	}
+
+	if _, err = s.RefreshToken(context.Background(), login.RefreshToken); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("reusing rotated refresh token: want ErrInvalidToken, got %v", err)
+	}
+
+	if _, _, err = s.Authorized(context.Background(), refreshed.Token); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("want session revoked after refresh token reuse, got %v", err)
+	}
+
+	if _, err = s.RefreshToken(context.Background(), refreshed.RefreshToken); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("want latest refresh token of revoked session rejected, got %v", err)
+	}
+}
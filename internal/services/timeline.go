@@ -0,0 +1,117 @@
+package services
+
+import (
+	"context"
+	"log"
+	. "social/internal/models"
+)
+
+// Timeline fetch home feed of the authenticated user
+func (s *Service) Timeline(ctx context.Context, last int, before int64) ([]TimelineItem, error) {
+	uid, ok := ctx.Value(KeyAuthUserId).(int64)
+	if !ok {
+		return nil, ErrUnauthenticated
+	}
+
+	return s.timeline(ctx, uid, normalizePageSize(last), before, 0)
+}
+
+// SubscribeToTimeline streams timeline items delivered to the authenticated user until ctx is done,
+// items newer than lastEventId that were missed while disconnected are sent first
+func (s *Service) SubscribeToTimeline(ctx context.Context, lastEventId int64) (<-chan TimelineItem, error) {
+	uid, ok := ctx.Value(KeyAuthUserId).(int64)
+	if !ok {
+		return nil, ErrUnauthenticated
+	}
+
+	// subscribe before catching up so nothing published in between gets lost
+	sub, unsubscribe := s.timelineBroker.subscribe(uid)
+
+	var missed []TimelineItem
+	if lastEventId > 0 {
+		var err error
+		missed, err = s.timeline(ctx, uid, maxPageSize, 0, lastEventId)
+		if err != nil {
+			unsubscribe()
+			return nil, err
+		}
+	}
+
+	tt := make(chan TimelineItem)
+	go func() {
+		defer close(tt)
+		defer unsubscribe()
+
+		// missed items are paged through so none are skipped however long the client was away
+		lastId := lastEventId
+		for page := missed; len(page) != 0; {
+			for _, item := range page {
+				select {
+				case tt <- item:
+					lastId = item.Id
+				case <-ctx.Done():
+					return
+				}
+			}
+
+			if len(page) < maxPageSize {
+				break
+			}
+
+			var err error
+			if page, err = s.timeline(ctx, uid, maxPageSize, 0, lastId); err != nil {
+				log.Printf("could not catch up timeline of user %d, %v", uid, err)
+				return
+			}
+		}
+
+		for {
+			select {
+			case v, ok := <-sub:
+				if !ok {
+					return
+				}
+
+				item := v.(TimelineItem)
+				if item.Id <= lastId {
+					continue
+				}
+
+				select {
+				case tt <- item:
+					lastId = item.Id
+				case <-ctx.Done():
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return tt, nil
+}
+
+// timeline fetch timeline page of user, newest first or, when after is set, oldest first starting after it
+func (s *Service) timeline(ctx context.Context, uid int64, last int, before, after int64) ([]TimelineItem, error) {
+	timeline, err := s.Store.Timeline(ctx, uid, last, before, after)
+	if err != nil {
+		return nil, err
+	}
+
+	posts := make([]Post, 0, len(timeline))
+	for i := range timeline {
+		timeline[i].Post.Mine = timeline[i].Post.UserId == uid
+		posts = append(posts, timeline[i].Post)
+	}
+
+	if err = s.withPostDetails(ctx, uid, posts); err != nil {
+		return nil, err
+	}
+
+	for i := range timeline {
+		timeline[i].Post = posts[i]
+	}
+
+	return timeline, nil
+}
@@ -0,0 +1,128 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	. "social/internal/models"
+	"testing"
+	"time"
+)
+
+func TestSubscribeToTimelineCatchUp(t *testing.T) {
+	s := newTestService(t)
+	alice := newTestUser(t, s, "alice")
+	bob := newTestUser(t, s, "bob")
+
+	var ids []int64
+	for i := 0; i < maxPageSize*2+5; i++ {
+		item, err := s.CreatePost(alice, fmt.Sprintf("post %d", i), nil, false, nil, nil)
+		if err != nil {
+			t.Fatalf("could not create post: %v", err)
+		}
+
+		id, err := s.Store.AddTimelineItem(bob, authUserId(bob), item.Post.Id)
+		if err != nil {
+			t.Fatalf("could not add timeline item: %v", err)
+		}
+
+		ids = append(ids, id)
+	}
+
+	ctx, cancel := context.WithCancel(bob)
+	defer cancel()
+
+	tt, err := s.SubscribeToTimeline(ctx, ids[1])
+	if err != nil {
+		t.Fatalf("could not subscribe: %v", err)
+	}
+
+	for _, want := range ids[2:] {
+		select {
+		case item := <-tt:
+			if item.Id != want {
+				t.Fatalf("want missed item %d, oldest first, got %d", want, item.Id)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("want missed item %d, got nothing", want)
+		}
+	}
+
+	// items already sent during catch up are not sent twice
+	s.timelineBroker.publish(authUserId(bob), TimelineItem{Id: ids[len(ids)-1]})
+
+	if _, err = s.Store.Follow(bob, authUserId(bob), authUserId(alice)); err != nil {
+		t.Fatalf("could not follow: %v", err)
+	}
+
+	item, err := s.CreatePost(alice, "live", nil, false, nil, nil)
+	if err != nil {
+		t.Fatalf("could not create post: %v", err)
+	}
+
+	live, err := s.Store.FanoutPost(bob, item.Post.Id, authUserId(alice))
+	if err != nil || len(live) != 1 {
+		t.Fatalf("could not fan out post: %+v, %v", live, err)
+	}
+
+	s.timelineBroker.publish(authUserId(bob), live[0])
+	select {
+	case got := <-tt:
+		if got.Id != live[0].Id {
+			t.Errorf("want live item %d, got %d", live[0].Id, got.Id)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("want live item, got nothing")
+	}
+}
+
+func TestStreamToken(t *testing.T) {
+	s := newTestService(t)
+	s.DevLogin = true
+	alice := newTestUser(t, s, "alice")
+
+	login, err := s.Login(alice, "alice@example.org")
+	if err != nil {
+		t.Fatalf("could not login: %v", err)
+	}
+
+	userId, sessionId, err := s.Authorized(alice, login.Token)
+	if err != nil {
+		t.Fatalf("could not authorize: %v", err)
+	}
+
+	if _, err = s.StreamToken(alice); !errors.Is(err, ErrUnauthenticated) {
+		t.Errorf("want stream token tied to a session, got %v", err)
+	}
+
+	ctx := context.WithValue(alice, KeyAuthSessionId, sessionId)
+	out, err := s.StreamToken(ctx)
+	if err != nil {
+		t.Fatalf("could not issue stream token: %v", err)
+	}
+
+	if until := time.Until(out.ExpiresAt); until <= 0 || until > StreamTokenLifeSpan {
+		t.Errorf("want stream token short-lived, expires at %v", out.ExpiresAt)
+	}
+
+	gotUserId, gotSessionId, err := s.AuthorizedStream(ctx, out.Token)
+	if err != nil || gotUserId != userId || gotSessionId != sessionId {
+		t.Fatalf("want stream token authorized for the session, got %d, %s, %v", gotUserId, gotSessionId, err)
+	}
+
+	if _, _, err = s.Authorized(ctx, out.Token); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("want stream token rejected as access token, got %v", err)
+	}
+
+	if _, _, err = s.AuthorizedStream(ctx, login.Token); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("want access token rejected as stream token, got %v", err)
+	}
+
+	if err = s.Logout(ctx); err != nil {
+		t.Fatalf("could not logout: %v", err)
+	}
+
+	if _, _, err = s.AuthorizedStream(ctx, out.Token); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("want stream token of revoked session rejected, got %v", err)
+	}
+}
@@ -2,31 +2,24 @@ package services
 
 import (
 	"context"
-	"database/sql"
 	"errors"
-	"fmt"
 	"github.com/disintegration/imaging"
-	gonanoid "github.com/matoous/go-nanoid"
-	"image"
-	"image/jpeg"
-	"image/png"
 	"io"
-	"log"
-	"os"
-	"path"
 	"regexp"
 	. "social/internal/models"
+	"social/internal/store"
 	"strings"
 )
 
 const (
 	MaxAvatarBytes = 5 << 20
+	// avatarsPrefix key prefix of avatar blobs
+	avatarsPrefix = "avatars/"
 )
 
 var (
 	rxEmail    = regexp.MustCompile("^[a-zA-Z0-9.!#$%&'*+/=?^_`{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$")
 	rxUsername = regexp.MustCompile("^[a-zA-Z][a-zA-Z0-9_-]{0,17}$")
-	avatarDir  = path.Join("web", "static", "img", "avatars")
 )
 
 // ToggleFollowOutput output dto
@@ -37,44 +30,47 @@ type ToggleFollowOutput struct {
 
 // CreateUser creates new user
 func (s *Service) CreateUser(ctx context.Context, email, username string) error {
+	_, err := createUser(ctx, s.Store, email, username)
+	return err
+}
+
+// createUser validates input and inserts the user with st, it returns id of the new user
+func createUser(ctx context.Context, st store.Store, email, username string) (int64, error) {
 	email = strings.TrimSpace(email)
 
 	if !rxEmail.MatchString(email) {
-		return errors.New("bad email address")
+		return 0, invalidInput("email", "bad email address")
 	}
 
 	username = strings.TrimSpace(username)
 	if !rxUsername.MatchString(username) {
-		return errors.New("bad username")
+		return 0, invalidInput("username", "must start with a letter and have at most 18 letters, digits, _ or -")
+	}
+
+	if err := checkUsernameAvailable(ctx, st, username, 0); err != nil {
+		return 0, err
 	}
 
-	query := "Insert into public.users(email,username) values($1,$2)"
-	_, err := s.Db.ExecContext(ctx, query, email, username)
+	userId, err := st.CreateUser(ctx, email, username)
+	if errors.Is(err, store.ErrEmailTaken) {
+		return 0, ErrEmailTaken
+	}
 
-	if err != nil {
-		return fmt.Errorf("could not insert user")
+	if errors.Is(err, store.ErrUsernameTaken) {
+		return 0, ErrUsernameTaken
 	}
 
-	return nil
+	return userId, err
 }
 
 // GetUserById fetch single user info
 func (s *Service) GetUserById(ctx context.Context, userId int64) (User, error) {
-	var user User
-	query := fmt.Sprintf("Select username, avatar_url from users where id = %d", userId)
-	err := s.Db.QueryRowContext(ctx, query).Scan(&user.Username, &user.AvatarUrl)
-
-	if err == sql.ErrNoRows {
-		return user, fmt.Errorf("record not found")
+	user, err := s.Store.UserById(ctx, userId)
+	if errors.Is(err, store.ErrNotFound) {
+		return user, ErrUserNotFound
 	}
 
-	if err != nil {
-		return user, fmt.Errorf("cannot find user")
-	}
-
-	user.Id = userId
-	return user, nil
-
+	return user, err
 }
 
 // ToggleFollow between wto users
@@ -82,316 +78,197 @@ func (s *Service) ToggleFollow(ctx context.Context, username string) (ToggleFoll
 	var out ToggleFollowOutput
 	followerId, ok := ctx.Value(KeyAuthUserId).(int64)
 	if !ok {
-		return out, fmt.Errorf("user not authenticated")
+		return out, ErrUnauthenticated
 	}
 
 	username = strings.TrimSpace(username)
 
 	if !rxUsername.MatchString(username) {
-		return out, fmt.Errorf("invalid username")
+		return out, invalidInput("username", "invalid username")
 	}
 
-	var followeeId int64
-	tx, err := s.Db.BeginTx(ctx, nil)
-	if err != nil {
-		return out, fmt.Errorf("could not begin tx: %v", err)
-	}
-	defer tx.Rollback()
-	query := fmt.Sprintf("Select id from users where username = $1")
-	if err = tx.QueryRowContext(ctx, query, username).Scan(&followeeId); err != nil {
-		return out, fmt.Errorf("could not find user")
-	}
+	var notificationId int64
+	err := s.Store.Tx(ctx, func(tx store.Store) error {
+		followee, err := tx.UserByUsername(ctx, username)
+		if errors.Is(err, store.ErrNotFound) {
+			followee, err = userByMovedUsername(ctx, tx, username)
+		}
 
-	if followeeId == followerId {
-		return out, fmt.Errorf("you cannot follow yourself")
-	}
+		if errors.Is(err, store.ErrNotFound) {
+			return ErrUserNotFound
+		}
 
-	query = "Select exists (select 1 from follows where follower_id = $1 and followee_id = $2)"
-	if err = tx.QueryRowContext(ctx, query, followerId, followeeId).Scan(&out.Following); err != nil {
-		return out, fmt.Errorf("could not query select existance of follow: %v", err)
-	}
+		if err != nil {
+			return err
+		}
 
-	if out.Following {
-		query = "Delete from follows where follower_id = $1 and followee_id == $2"
-		if _, err = tx.ExecContext(ctx, query, followerId, followeeId); err != nil {
-			return out, fmt.Errorf("could not delete follow: %v", err)
+		if followee.Id == followerId {
+			return ErrFollowSelf
 		}
-		query = "Update users set followees_count = followees_count - 1 where id = $1"
-		if _, err = tx.ExecContext(ctx, query, followerId); err != nil {
-			return out, fmt.Errorf("could not update follower followees count (-): %v", err)
+
+		if out.Following, err = tx.IsFollowing(ctx, followerId, followee.Id); err != nil {
+			return err
 		}
-		query = "update users set followers_count = followers_count - 1 where id = $1 returning followers_count"
-		if err = tx.QueryRowContext(ctx, query, followeeId).Scan(&out.FollowersCount); err != nil {
-			return out, fmt.Errorf("could not update followee followers count(-): %v", err)
+
+		if out.Following {
+			if out.FollowersCount, err = tx.Unfollow(ctx, followerId, followee.Id); err != nil {
+				return err
+			}
+
+			return tx.RetractNotification(ctx, followee.Id, followerId, NotificationFollow, nil)
 		}
-	} else {
-		query = "insert into follows (follower_id, followee_id) values($1,$2)"
-		if _, err = tx.ExecContext(ctx, query, followerId, followeeId); err != nil {
-			return out, fmt.Errorf("cannot add new row to follows: %v", err)
+
+		blocked, err := tx.Blocked(ctx, followerId, followee.Id)
+		if err != nil {
+			return err
 		}
-		query = "update users set followees_count = followees_count + 1 where id = $1"
-		if _, err = tx.ExecContext(ctx, query, followerId); err != nil {
-			return out, fmt.Errorf("error updataing number of followees (+) : %v", err)
+
+		if blocked {
+			return ErrBlocked
 		}
 
-		query = "update users set followers_count = followers_count + 1 where id = $1 returning followers_count"
-		if err = tx.QueryRowContext(ctx, query, followeeId).Scan(&out.FollowersCount); err != nil {
-			return out, fmt.Errorf("error updating number of followers(+): %v", err)
+		if out.FollowersCount, err = tx.Follow(ctx, followerId, followee.Id); err != nil {
+			return err
 		}
-	}
 
-	if err = tx.Commit(); err != nil {
-		return out, fmt.Errorf("error while commiting tx, %v", err)
+		notificationId, err = s.notify(ctx, tx, followee.Id, followerId, NotificationFollow, nil)
+		return err
+	})
+	if err != nil {
+		return out, err
 	}
 
 	out.Following = !out.Following
-
-	if out.Following {
-		// TODO: notify followee
-	}
+	s.publishNotification(notificationId)
 
 	return out, nil
 
 }
 
 func (s *Service) GetUsers(ctx context.Context, search string, first int, after string) ([]UserProfile, error) {
-	search = strings.TrimSpace(search)
-	after = strings.TrimSpace(after)
-	first = normalizePageSize(first)
-	uid, auth := ctx.Value(KeyAuthUserId).(int64)
-	query, args, err := queryBuilder(`SELECT id, email,avatar_url, username, followers_count, followees_count
-		{{ if .auth }}
-		, followers.follower_id IS NOT NULL AS following
-		, followees.followee_id IS NOT NULL AS followeed
-		{{ end }}
-		FROM users
-		{{ if .auth }}
-		LEFT JOIN follows AS followers
-			ON followers.follower_id = @uid AND followers.followee_id = users.id
-		LEFT JOIN follows AS followees
-			ON followees.follower_id = users.id AND followees.followee_id = @uid
-		{{ end }}
-		{{ if or .search .afterUsername }}WHERE{{ end }}
-		{{ if .search }}username ILIKE '%' || @search || '%'{{ end }}
-		{{ if and .search .after }}AND{{ end }}
-		{{ if .after }}username > @after{{ end }}
-		ORDER BY username ASC
-		LIMIT @first`, map[string]interface{}{
-		"auth":   auth,
-		"uid":    uid,
-		"search": search,
-		"first":  first,
-		"after":  after,
-	})
+	uid, _ := ctx.Value(KeyAuthUserId).(int64)
+	profiles, err := s.Store.Users(ctx, uid, strings.TrimSpace(search), normalizePageSize(first), strings.TrimSpace(after))
 	if err != nil {
-		return nil, fmt.Errorf("could not build users query , %v", err)
+		return nil, err
 	}
 
-	log.Printf("users query : %s\n args : %v\n ", query, args)
-
-	rows, err := s.Db.QueryContext(ctx, query, args...)
-	if err != nil {
-		return nil, fmt.Errorf("could not execute query : %v", err)
+	for i := range profiles {
+		profiles[i] = viewProfile(profiles[i], uid)
 	}
 
-	defer rows.Close()
-
-	userProfileList := make([]UserProfile, 0, first)
-
-	for rows.Next() {
-		var profile UserProfile
-		dest := []interface{}{&profile.Id, &profile.Email, &profile.AvatarUrl, &profile.Username, &profile.FolloweesCount, &profile.FollowersCount}
-		if auth {
-			dest = append(dest, &profile.Followed, &profile.Following)
-		}
-		if err = rows.Scan(dest...); err != nil {
-			return nil, fmt.Errorf("could not parse results, %v", err)
-		}
-
-		profile.Me = auth && uid == profile.Id
-		if !profile.Me {
-			profile.Id = 0
-			profile.Email = ""
-		}
-		userProfileList = append(userProfileList, profile)
+	if err = s.withBioEntities(ctx, profiles); err != nil {
+		return nil, err
 	}
 
-	return userProfileList, nil
+	return profiles, nil
 }
 
 // GetUserProfile fetch user profile from db
 func (s *Service) GetUserProfile(ctx context.Context, username string) (UserProfile, error) {
-	var userProfile UserProfile
-
 	username = strings.TrimSpace(username)
 
 	if !rxUsername.MatchString(username) {
-		return userProfile, fmt.Errorf("invalid username")
+		return UserProfile{}, invalidInput("username", "invalid username")
 	}
 
-	uid, auth := ctx.Value(KeyAuthUserId).(int64)
-	args := []interface{}{username}
-	dest := []interface{}{&userProfile.Id, &userProfile.Email, &userProfile.Username, &userProfile.FollowersCount, &userProfile.AvatarUrl, &userProfile.FolloweesCount}
+	uid, _ := ctx.Value(KeyAuthUserId).(int64)
+	profile, err := s.Store.UserProfile(ctx, uid, username)
+	if errors.Is(err, store.ErrNotFound) {
+		// previous username of someone who changed it resolves to their profile for a while
+		var moved string
+		if moved, err = movedUsername(ctx, s.Store, username); err != nil {
+			return profile, err
+		}
 
-	query := "select id, email, username,avatar_url, followers_count, followees_count"
-	if auth {
-		query += ", " + " followers.follower_id is not null as following," +
-			" followees.followee_id is not null as followeed"
-		dest = append(dest, &userProfile.Following, &userProfile.Followed)
-	}
-	query += " from users"
-	if auth {
-		query += " left join follows as followers on followers.follower_id = $2 and followers.followee_id = users.id " +
-			" left join follows as followees on followees.follower_id = users.id and followees.followee_id = $2"
-		args = append(args, uid)
+		if moved == "" {
+			return profile, ErrUserNotFound
+		}
 
+		profile, err = s.Store.UserProfile(ctx, uid, moved)
 	}
-	query += " where username = $1"
 
-	err := s.Db.QueryRowContext(ctx, query, args...).Scan(dest...)
+	if errors.Is(err, store.ErrNotFound) {
+		return profile, ErrUserNotFound
+	}
 
 	if err != nil {
-		return userProfile, fmt.Errorf("error while fetching user profile, %v", err)
+		return profile, err
 	}
 
-	userProfile.Username = username
-	userProfile.Me = auth && uid == userProfile.Id
-	if !userProfile.Me {
-		userProfile.Id = 0
-		userProfile.Email = ""
+	profiles := []UserProfile{viewProfile(profile, uid)}
+	if err = s.withBioEntities(ctx, profiles); err != nil {
+		return profile, err
 	}
 
-	return userProfile, nil
+	return profiles[0], nil
 }
 
 //GetFollowers fetch followers from db
 func (s *Service) GetFollowers(ctx context.Context, username string, first int, after string) ([]UserProfile, error) {
-	username = strings.TrimSpace(username)
-	after = strings.TrimSpace(after)
-	first = normalizePageSize(first)
-	uid, auth := ctx.Value(KeyAuthUserId).(int64)
-	query, args, err := queryBuilder(`SELECT users.id,users.avatarUrl, users.email, users.username, users.followers_count, users.followees_count
-		{{ if .auth }}
-		, followers.follower_id IS NOT NULL AS following
-		, followees.followee_id IS NOT NULL AS followeed
-		{{ end }}
-		from follows 
-		inner join users on follows.follower_id = users.id
-		{{ if .auth }}
-		LEFT JOIN follows AS followers
-			ON followers.follower_id = @uid AND followers.followee_id = users.id
-		LEFT JOIN follows AS followees
-			ON followees.follower_id = users.id AND followees.followee_id = @uid
-		{{ end }}
-		where follows.followee_id = (select id from users where username = @username)
-		{{ if .after }}username > @after{{ end }}
-		ORDER BY username ASC
-		LIMIT @first`, map[string]interface{}{
-		"auth":     auth,
-		"uid":      uid,
-		"username": username,
-		"first":    first,
-		"after":    after,
-	})
+	uid, _ := ctx.Value(KeyAuthUserId).(int64)
+	username, after = strings.TrimSpace(username), strings.TrimSpace(after)
+	profiles, err := s.Store.Followers(ctx, uid, username, normalizePageSize(first), after)
 	if err != nil {
-		return nil, fmt.Errorf("could not build users query , %v", err)
+		return nil, err
 	}
 
-	log.Printf("followers query : %s\n args : %v\n ", query, args)
+	if len(profiles) == 0 && after == "" {
+		// previous username of someone who changed it keeps working for a while
+		moved, err := movedUsername(ctx, s.Store, username)
+		if err != nil {
+			return nil, err
+		}
 
-	rows, err := s.Db.QueryContext(ctx, query, args...)
-	if err != nil {
-		return nil, fmt.Errorf("could not execute query : %v", err)
+		if moved != "" {
+			if profiles, err = s.Store.Followers(ctx, uid, moved, normalizePageSize(first), after); err != nil {
+				return nil, err
+			}
+		}
 	}
 
-	defer rows.Close()
-
-	userProfileList := make([]UserProfile, 0, first)
-
-	for rows.Next() {
-		var profile UserProfile
-		dest := []interface{}{&profile.Id, &profile.Email, &profile.Username, &profile.FolloweesCount, &profile.FollowersCount}
-		if auth {
-			dest = append(dest, &profile.Followed, &profile.Following)
-		}
-		if err = rows.Scan(dest...); err != nil {
-			return nil, fmt.Errorf("could not parse results, %v", err)
-		}
+	for i := range profiles {
+		profiles[i] = viewProfile(profiles[i], uid)
+	}
 
-		profile.Me = auth && uid == profile.Id
-		if !profile.Me {
-			profile.Id = 0
-			profile.Email = ""
-		}
-		userProfileList = append(userProfileList, profile)
+	if err = s.withBioEntities(ctx, profiles); err != nil {
+		return nil, err
 	}
 
-	return userProfileList, nil
+	return profiles, nil
 }
 
 // GetFollowees fetch followees from db
 func (s *Service) GetFollowees(ctx context.Context, username string, first int, after string) ([]UserProfile, error) {
-	username = strings.TrimSpace(username)
-	after = strings.TrimSpace(after)
-	first = normalizePageSize(first)
-	uid, auth := ctx.Value(KeyAuthUserId).(int64)
-	query, args, err := queryBuilder(`SELECT users.id, users.email,users.avatarUrl, users.username, users.followers_count, users.followees_count
-		{{ if .auth }}
-		, followers.follower_id IS NOT NULL AS following
-		, followees.followee_id IS NOT NULL AS followeed
-		{{ end }}
-		from follows 
-		inner join users on follows.followee_id = users.id
-		{{ if .auth }}
-		LEFT JOIN follows AS followers
-			ON followers.follower_id = @uid AND followers.followee_id = users.id
-		LEFT JOIN follows AS followees
-			ON followees.follower_id = users.id AND followees.followee_id = @uid
-		{{ end }}
-		where follows.follower_id = (select id from users where username = @username)
-		{{ if .after }}username > @after{{ end }}
-		ORDER BY username ASC
-		LIMIT @first`, map[string]interface{}{
-		"auth":     auth,
-		"uid":      uid,
-		"username": username,
-		"first":    first,
-		"after":    after,
-	})
+	uid, _ := ctx.Value(KeyAuthUserId).(int64)
+	username, after = strings.TrimSpace(username), strings.TrimSpace(after)
+	profiles, err := s.Store.Followees(ctx, uid, username, normalizePageSize(first), after)
 	if err != nil {
-		return nil, fmt.Errorf("could not build users query , %v", err)
+		return nil, err
 	}
 
-	log.Printf("followers query : %s\n args : %v\n ", query, args)
+	if len(profiles) == 0 && after == "" {
+		// previous username of someone who changed it keeps working for a while
+		moved, err := movedUsername(ctx, s.Store, username)
+		if err != nil {
+			return nil, err
+		}
 
-	rows, err := s.Db.QueryContext(ctx, query, args...)
-	if err != nil {
-		return nil, fmt.Errorf("could not execute query : %v", err)
+		if moved != "" {
+			if profiles, err = s.Store.Followees(ctx, uid, moved, normalizePageSize(first), after); err != nil {
+				return nil, err
+			}
+		}
 	}
 
-	defer rows.Close()
-
-	userProfileList := make([]UserProfile, 0, first)
-
-	for rows.Next() {
-		var profile UserProfile
-		dest := []interface{}{&profile.Id, &profile.Email, &profile.Username, &profile.FolloweesCount, &profile.FollowersCount}
-		if auth {
-			dest = append(dest, &profile.Followed, &profile.Following)
-		}
-		if err = rows.Scan(dest...); err != nil {
-			return nil, fmt.Errorf("could not parse results, %v", err)
-		}
+	for i := range profiles {
+		profiles[i] = viewProfile(profiles[i], uid)
+	}
 
-		profile.Me = auth && uid == profile.Id
-		if !profile.Me {
-			profile.Id = 0
-			profile.Email = ""
-		}
-		userProfileList = append(userProfileList, profile)
+	if err = s.withBioEntities(ctx, profiles); err != nil {
+		return nil, err
 	}
 
-	return userProfileList, nil
+	return profiles, nil
 }
 
 // UpdateAvatar upload anad update avatar image
@@ -399,71 +276,41 @@ func (s *Service) UpdateAvatar(ctx context.Context, r io.Reader) (string, error)
 	userId, ok := ctx.Value(KeyAuthUserId).(int64)
 
 	if !ok {
-		return "", fmt.Errorf("unauthorized")
+		return "", ErrUnauthenticated
 	}
 
 	r = io.LimitReader(r, MaxAvatarBytes)
-	img, format, err := image.Decode(r)
+	img, format, err := decodeImage(r, "avatar")
 	if err != nil {
-		return "", fmt.Errorf("unable to decode image, %v", err)
-	}
-
-	if format != "png" && format != "jpeg" {
-		return "", fmt.Errorf("unsupported image format")
+		return "", err
 	}
 
-	avatar, err := gonanoid.Nanoid()
+	img = imaging.Fill(img, 400, 400, imaging.Center, imaging.CatmullRom)
+	avatar, err := s.putImage(ctx, avatarsPrefix, img, format)
 	if err != nil {
-		return "", fmt.Errorf("unable to generate guid for avatar , %v", err)
-	}
-
-	if format == "png" {
-		avatar += ".png"
-	} else {
-		avatar += ".jpg"
+		return "", err
 	}
 
-	avatarPath := path.Join(avatarDir, avatar)
-
-	f, err := os.Create(avatarPath)
+	oldAvatar, err := s.Store.UpdateAvatar(ctx, userId, avatar)
 	if err != nil {
-		return "", fmt.Errorf("could not create avatar file, %v", err)
+		defer s.deleteBlob(ctx, avatarsPrefix+avatar)
+		return "", err
 	}
-
-	defer f.Close()
-
-	img = imaging.Fill(img, 400, 400, imaging.Center, imaging.CatmullRom)
-	if format == "png" {
-		err = png.Encode(f, img)
-	} else {
-		err = jpeg.Encode(f, img, nil)
+	if oldAvatar != "" {
+		defer s.deleteBlob(ctx, avatarsPrefix+oldAvatar)
 	}
 
-	if err != nil {
-		return "", fmt.Errorf("could not encode image: %v", err)
-	}
+	return s.Blobs.URL(avatarsPrefix + avatar), nil
 
-	query := `update users set avatar_url = @avatarUrl where id = @id returning (select avatar_url from users where id = @id) as old_avatar`
-	query, args, err := queryBuilder(query, map[string]interface{}{
-		"id":        userId,
-		"avatarUrl": avatar,
-	})
+}
 
-	if err != nil {
-		defer os.Remove(path.Join(avatarDir, avatar))
-		fmt.Errorf("error build query for updating avatar: %v", err)
-		return "", err
-	}
-	var oldAvatar sql.NullString
-	if err = s.Db.QueryRowContext(ctx, query, args...).Scan(&oldAvatar); err != nil {
-		defer os.Remove(avatarPath)
-		fmt.Errorf("error build query for updating avatar: %v", err)
-		return "", err
+// viewProfile hides id and email of everyone but the authenticated user with id uid
+func viewProfile(profile UserProfile, uid int64) UserProfile {
+	profile.Me = uid != 0 && uid == profile.Id
+	if !profile.Me {
+		profile.Id = 0
+		profile.Email = ""
 	}
-	if oldAvatar.Valid {
-		defer os.Remove(path.Join(avatarDir, oldAvatar.String))
-	}
-
-	return s.Origin + "/img/avatars/" + avatar, nil
 
+	return profile
 }
@@ -0,0 +1,33 @@
+package services
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestToggleFollow(t *testing.T) {
+	s := newTestService(t)
+	alice := newTestUser(t, s, "alice")
+	newTestUser(t, s, "bob")
+
+	if _, err := s.ToggleFollow(alice, "alice"); !errors.Is(err, ErrFollowSelf) {
+		t.Fatalf("following yourself: want ErrFollowSelf, got %v", err)
+	}
+
+	out, err := s.ToggleFollow(alice, "bob")
+	if err != nil {
+		t.Fatalf("could not follow: %v", err)
+	}
+
+	if !out.Following || out.FollowersCount != 1 {
+		t.Errorf("want following with 1 follower, got %+v", out)
+	}
+
+	if out, err = s.ToggleFollow(alice, "bob"); err != nil {
+		t.Fatalf("could not unfollow: %v", err)
+	}
+
+	if out.Following || out.FollowersCount != 0 {
+		t.Errorf("want not following with no followers, got %+v", out)
+	}
+}
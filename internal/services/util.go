@@ -1,12 +1,11 @@
 package services
 
 import (
-	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"fmt"
-	"github.com/jackc/pgx"
-	"log"
-	"strings"
-	"text/template"
 )
 
 const (
@@ -15,43 +14,6 @@ const (
 	maxPageSize     = 20
 )
 
-var queriesCache = make(map[string]*template.Template)
-
-func isUniqueViolation(err error) bool {
-	pgErr, ok := err.(pgx.PgError)
-	return ok && pgErr.Code == "..."
-}
-
-func queryBuilder(text string, data map[string]interface{}) (string, []interface{}, error) {
-	t, ok := queriesCache[text]
-	if !ok {
-		var err error
-		t, err = template.New("query").Parse(text)
-		if err != nil {
-			return "", nil, fmt.Errorf("could not parse query template")
-		}
-
-		queriesCache[text] = t
-	}
-
-	var wr bytes.Buffer
-	if err := t.Execute(&wr, data); err != nil {
-		return "", nil, fmt.Errorf("could not execute query")
-	}
-
-	query := wr.String()
-	args := []interface{}{}
-	for key, val := range data {
-		if !strings.Contains(query, "@"+key) {
-			continue
-		}
-		args = append(args, val)
-		query = strings.ReplaceAll(query, "@"+key, fmt.Sprintf("$%d", len(args)))
-	}
-	log.Println(query)
-	return query, args, nil
-}
-
 func normalizePageSize(i int) int {
 	if i == 0 {
 		return defaultPageSize
@@ -64,3 +26,19 @@ func normalizePageSize(i int) int {
 	}
 	return i
 }
+
+// randomString generates url safe random string from size random bytes
+func randomString(size int) (string, error) {
+	b := make([]byte, size)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("could not read random bytes, %v", err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashToken hashes secret before it is stored, only hashes of codes and refresh tokens are kept in db
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,321 @@
+package store
+
+import (
+	"context"
+	. "social/internal/models"
+	"sync"
+	"time"
+)
+
+var _ Store = (*Memory)(nil)
+
+// Memory store keeping everything in memory, safe for concurrent use, transactions run one at a time
+// and roll back by restoring snapshot of the data taken when they started
+type Memory struct {
+	mu *sync.RWMutex
+	// inTx is set on store passed to Tx callback, its methods run under the lock held by Tx
+	inTx bool
+	data *memoryData
+}
+
+type memoryData struct {
+	seq       map[string]int64
+	users     map[int64]UserProfile
+	suspended map[int64]time.Time
+	admins    map[int64]bool
+	follows   map[memoryPair]struct{}
+	// blocks and mutes blocker or muter first
+	blocks       map[memoryPair]time.Time
+	mutes        map[memoryPair]time.Time
+	posts        map[int64]Post
+	postLikes    map[memoryPair]struct{}
+	reposts      map[memoryPair]time.Time
+	revisions    []PostRevision
+	timeline     []TimelineItem
+	comments     map[int64]Comment
+	commentLikes map[memoryPair]struct{}
+	// hashtags tags of each post
+	hashtags map[int64][]string
+	trending map[string]memoryTrending
+	// postMentions and commentMentions mentions of each post and comment, ordered by start
+	postMentions      map[int64][]memoryMention
+	commentMentions   map[int64][]memoryMention
+	media             map[int64]memoryMedia
+	notifications     map[int64]memoryNotification
+	jobs              map[int64]memoryJob
+	sessions          map[string]memorySession
+	codes             map[string]memoryCode
+	usernameHistory   map[string]memoryUsernameChange
+	usernameChangedAt map[int64]time.Time
+	emailChanges      map[string]EmailChange
+	// deletionScheduledAt when users scheduled for deletion are to be deleted
+	deletionScheduledAt map[int64]time.Time
+	exports             map[int64]UserExport
+}
+
+// memoryPair key of follows, follower first, and of likes and reposts, user first
+type memoryPair struct {
+	a, b int64
+}
+
+type memoryNotification struct {
+	Notification
+	actorIds []int64
+}
+
+type memoryMention struct {
+	start, end int
+	userId     int64
+	createdAt  time.Time
+}
+
+// memoryMedia media with its position among media of the post it is attached to
+type memoryMedia struct {
+	Media
+	position int
+}
+
+type memoryTrending struct {
+	tags       []TrendingHashtag
+	computedAt time.Time
+}
+
+type memoryJob struct {
+	Job
+	status    string
+	lastError string
+	runAt     time.Time
+	updatedAt time.Time
+}
+
+type memorySession struct {
+	Session
+	userId                   int64
+	refreshTokenHash         string
+	previousRefreshTokenHash string
+}
+
+// memoryUsernameChange entry of username history, by previous username
+type memoryUsernameChange struct {
+	userId    int64
+	changedAt time.Time
+}
+
+type memoryCode struct {
+	userId      int64
+	redirectURI string
+	createdAt   time.Time
+}
+
+// NewMemory creates empty store
+func NewMemory() *Memory {
+	return &Memory{
+		mu: &sync.RWMutex{},
+		data: &memoryData{
+			seq:                 map[string]int64{},
+			users:               map[int64]UserProfile{},
+			suspended:           map[int64]time.Time{},
+			admins:              map[int64]bool{},
+			follows:             map[memoryPair]struct{}{},
+			blocks:              map[memoryPair]time.Time{},
+			mutes:               map[memoryPair]time.Time{},
+			posts:               map[int64]Post{},
+			postLikes:           map[memoryPair]struct{}{},
+			reposts:             map[memoryPair]time.Time{},
+			comments:            map[int64]Comment{},
+			commentLikes:        map[memoryPair]struct{}{},
+			hashtags:            map[int64][]string{},
+			trending:            map[string]memoryTrending{},
+			postMentions:        map[int64][]memoryMention{},
+			commentMentions:     map[int64][]memoryMention{},
+			media:               map[int64]memoryMedia{},
+			notifications:       map[int64]memoryNotification{},
+			jobs:                map[int64]memoryJob{},
+			sessions:            map[string]memorySession{},
+			codes:               map[string]memoryCode{},
+			usernameHistory:     map[string]memoryUsernameChange{},
+			usernameChangedAt:   map[int64]time.Time{},
+			emailChanges:        map[string]EmailChange{},
+			deletionScheduledAt: map[int64]time.Time{},
+			exports:             map[int64]UserExport{},
+		},
+	}
+}
+
+// Tx runs fn holding the lock, store passed to fn must not be used once it returns
+func (m *Memory) Tx(ctx context.Context, fn func(Store) error) error {
+	if m.inTx {
+		return fn(m)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	snapshot := m.data.clone()
+	if err := fn(&Memory{mu: m.mu, inTx: true, data: m.data}); err != nil {
+		*m.data = snapshot
+		return err
+	}
+
+	return nil
+}
+
+func (m *Memory) lock() func() {
+	if m.inTx {
+		return func() {}
+	}
+
+	m.mu.Lock()
+	return m.mu.Unlock
+}
+
+func (m *Memory) rlock() func() {
+	if m.inTx {
+		return func() {}
+	}
+
+	m.mu.RLock()
+	return m.mu.RUnlock
+}
+
+// nextId mimics serial column of the table
+func (d *memoryData) nextId(table string) int64 {
+	d.seq[table]++
+	return d.seq[table]
+}
+
+func (d *memoryData) clone() memoryData {
+	c := memoryData{
+		seq:                 make(map[string]int64, len(d.seq)),
+		users:               make(map[int64]UserProfile, len(d.users)),
+		suspended:           make(map[int64]time.Time, len(d.suspended)),
+		admins:              make(map[int64]bool, len(d.admins)),
+		follows:             make(map[memoryPair]struct{}, len(d.follows)),
+		blocks:              make(map[memoryPair]time.Time, len(d.blocks)),
+		mutes:               make(map[memoryPair]time.Time, len(d.mutes)),
+		posts:               make(map[int64]Post, len(d.posts)),
+		postLikes:           make(map[memoryPair]struct{}, len(d.postLikes)),
+		reposts:             make(map[memoryPair]time.Time, len(d.reposts)),
+		revisions:           append([]PostRevision(nil), d.revisions...),
+		timeline:            append([]TimelineItem(nil), d.timeline...),
+		comments:            make(map[int64]Comment, len(d.comments)),
+		commentLikes:        make(map[memoryPair]struct{}, len(d.commentLikes)),
+		hashtags:            make(map[int64][]string, len(d.hashtags)),
+		trending:            make(map[string]memoryTrending, len(d.trending)),
+		postMentions:        make(map[int64][]memoryMention, len(d.postMentions)),
+		commentMentions:     make(map[int64][]memoryMention, len(d.commentMentions)),
+		media:               make(map[int64]memoryMedia, len(d.media)),
+		notifications:       make(map[int64]memoryNotification, len(d.notifications)),
+		jobs:                make(map[int64]memoryJob, len(d.jobs)),
+		sessions:            make(map[string]memorySession, len(d.sessions)),
+		codes:               make(map[string]memoryCode, len(d.codes)),
+		usernameHistory:     make(map[string]memoryUsernameChange, len(d.usernameHistory)),
+		usernameChangedAt:   make(map[int64]time.Time, len(d.usernameChangedAt)),
+		emailChanges:        make(map[string]EmailChange, len(d.emailChanges)),
+		deletionScheduledAt: make(map[int64]time.Time, len(d.deletionScheduledAt)),
+		exports:             make(map[int64]UserExport, len(d.exports)),
+	}
+
+	// rows are stored by value and pointers in them are never written through,
+	// so copying the maps is enough, except for slices that get appended to,
+	// hashtags, trending and mentions slices are only ever replaced as a whole
+	for k, v := range d.seq {
+		c.seq[k] = v
+	}
+	for k, v := range d.users {
+		c.users[k] = v
+	}
+	for k, v := range d.suspended {
+		c.suspended[k] = v
+	}
+	for k, v := range d.admins {
+		c.admins[k] = v
+	}
+	for k, v := range d.follows {
+		c.follows[k] = v
+	}
+	for k, v := range d.blocks {
+		c.blocks[k] = v
+	}
+	for k, v := range d.mutes {
+		c.mutes[k] = v
+	}
+	for k, v := range d.posts {
+		c.posts[k] = v
+	}
+	for k, v := range d.postLikes {
+		c.postLikes[k] = v
+	}
+	for k, v := range d.reposts {
+		c.reposts[k] = v
+	}
+	for k, v := range d.comments {
+		c.comments[k] = v
+	}
+	for k, v := range d.commentLikes {
+		c.commentLikes[k] = v
+	}
+	for k, v := range d.hashtags {
+		c.hashtags[k] = v
+	}
+	for k, v := range d.trending {
+		c.trending[k] = v
+	}
+	for k, v := range d.postMentions {
+		c.postMentions[k] = v
+	}
+	for k, v := range d.commentMentions {
+		c.commentMentions[k] = v
+	}
+	for k, v := range d.media {
+		c.media[k] = v
+	}
+	for k, v := range d.notifications {
+		v.actorIds = append([]int64(nil), v.actorIds...)
+		c.notifications[k] = v
+	}
+	for k, v := range d.jobs {
+		c.jobs[k] = v
+	}
+	for k, v := range d.sessions {
+		c.sessions[k] = v
+	}
+	for k, v := range d.codes {
+		c.codes[k] = v
+	}
+	for k, v := range d.usernameHistory {
+		c.usernameHistory[k] = v
+	}
+	for k, v := range d.usernameChangedAt {
+		c.usernameChangedAt[k] = v
+	}
+	for k, v := range d.emailChanges {
+		c.emailChanges[k] = v
+	}
+	for k, v := range d.deletionScheduledAt {
+		c.deletionScheduledAt[k] = v
+	}
+	for k, v := range d.exports {
+		c.exports[k] = v
+	}
+
+	return c
+}
+
+func copyString(s *string) *string {
+	if s == nil {
+		return nil
+	}
+
+	c := *s
+	return &c
+}
+
+func copyInt64(i *int64) *int64 {
+	if i == nil {
+		return nil
+	}
+
+	c := *i
+	return &c
+}
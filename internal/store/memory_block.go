@@ -0,0 +1,214 @@
+package store
+
+import (
+	"context"
+	. "social/internal/models"
+	"sort"
+	"time"
+)
+
+func (m *Memory) IsBlocking(ctx context.Context, blockerId, blockedId int64) (bool, error) {
+	defer m.rlock()()
+
+	_, ok := m.data.blocks[memoryPair{blockerId, blockedId}]
+	return ok, nil
+}
+
+func (m *Memory) Blocked(ctx context.Context, userId, otherId int64) (bool, error) {
+	defer m.rlock()()
+
+	return m.data.hidden(userId, otherId), nil
+}
+
+func (m *Memory) BlockedUserIds(ctx context.Context, userId int64) ([]int64, error) {
+	defer m.rlock()()
+
+	seen := map[int64]bool{}
+	var ids []int64
+	for key := range m.data.blocks {
+		other := key.b
+		if key.b == userId {
+			other = key.a
+		} else if key.a != userId {
+			continue
+		}
+
+		if !seen[other] {
+			seen[other] = true
+			ids = append(ids, other)
+		}
+	}
+
+	return ids, nil
+}
+
+func (m *Memory) Block(ctx context.Context, blockerId, blockedId int64) error {
+	defer m.lock()()
+
+	if _, ok := m.data.users[blockerId]; !ok {
+		return ErrNotFound
+	}
+
+	if _, ok := m.data.users[blockedId]; !ok {
+		return ErrNotFound
+	}
+
+	key := memoryPair{blockerId, blockedId}
+	if _, ok := m.data.blocks[key]; !ok {
+		m.data.blocks[key] = time.Now()
+	}
+
+	for _, f := range []memoryPair{key, {blockedId, blockerId}} {
+		if _, ok := m.data.follows[f]; ok {
+			delete(m.data.follows, f)
+			m.data.updateFollowCounts(f.a, f.b, -1)
+		}
+	}
+
+	for key := range m.data.postLikes {
+		if post, ok := m.data.posts[key.b]; ok && key.a == blockedId && post.UserId == blockerId {
+			delete(m.data.postLikes, key)
+			post.LikesCount = nonNegative(post.LikesCount - 1)
+			m.data.posts[key.b] = post
+		}
+	}
+
+	for key := range m.data.reposts {
+		if post, ok := m.data.posts[key.b]; ok && key.a == blockedId && post.UserId == blockerId {
+			delete(m.data.reposts, key)
+			post.RepostsCount = nonNegative(post.RepostsCount - 1)
+			m.data.posts[key.b] = post
+		}
+	}
+
+	timeline := m.data.timeline[:0:0]
+	for _, item := range m.data.timeline {
+		if item.RepostedBy == nil || item.RepostedBy.Id != blockedId || m.data.posts[item.PostId].UserId != blockerId {
+			timeline = append(timeline, item)
+		}
+	}
+	m.data.timeline = timeline
+
+	for key := range m.data.commentLikes {
+		if c, ok := m.data.comments[key.b]; ok && key.a == blockedId && c.UserId == blockerId {
+			delete(m.data.commentLikes, key)
+			c.LikesCount = nonNegative(c.LikesCount - 1)
+			m.data.comments[key.b] = c
+		}
+	}
+
+	for id, n := range m.data.notifications {
+		var actorId int64
+		switch n.UserId {
+		case blockerId:
+			actorId = blockedId
+		case blockedId:
+			actorId = blockerId
+		default:
+			continue
+		}
+
+		if n.actorIds = removeId(n.actorIds, actorId); len(n.actorIds) == 0 {
+			delete(m.data.notifications, id)
+		} else {
+			m.data.notifications[id] = n
+		}
+	}
+
+	return nil
+}
+
+func (m *Memory) Unblock(ctx context.Context, blockerId, blockedId int64) error {
+	defer m.lock()()
+
+	delete(m.data.blocks, memoryPair{blockerId, blockedId})
+	return nil
+}
+
+func (m *Memory) Blocks(ctx context.Context, userId int64, first int, after string) ([]User, error) {
+	defer m.rlock()()
+
+	return m.data.relatedUsers(m.data.blocks, userId, first, after), nil
+}
+
+func (m *Memory) IsMuting(ctx context.Context, muterId, mutedId int64) (bool, error) {
+	defer m.rlock()()
+
+	return m.data.muted(muterId, mutedId), nil
+}
+
+func (m *Memory) Mute(ctx context.Context, muterId, mutedId int64) error {
+	defer m.lock()()
+
+	if _, ok := m.data.users[muterId]; !ok {
+		return ErrNotFound
+	}
+
+	if _, ok := m.data.users[mutedId]; !ok {
+		return ErrNotFound
+	}
+
+	key := memoryPair{muterId, mutedId}
+	if _, ok := m.data.mutes[key]; !ok {
+		m.data.mutes[key] = time.Now()
+	}
+
+	return nil
+}
+
+func (m *Memory) Unmute(ctx context.Context, muterId, mutedId int64) error {
+	defer m.lock()()
+
+	delete(m.data.mutes, memoryPair{muterId, mutedId})
+	return nil
+}
+
+func (m *Memory) Mutes(ctx context.Context, userId int64, first int, after string) ([]User, error) {
+	defer m.rlock()()
+
+	return m.data.relatedUsers(m.data.mutes, userId, first, after), nil
+}
+
+// hidden tells whether viewer blocked user or was blocked by them, anonymous viewers see everyone
+func (d *memoryData) hidden(viewerId, userId int64) bool {
+	if viewerId == 0 {
+		return false
+	}
+
+	_, blocking := d.blocks[memoryPair{viewerId, userId}]
+	_, blocked := d.blocks[memoryPair{userId, viewerId}]
+	return blocking || blocked
+}
+
+// muted tells whether viewer muted user
+func (d *memoryData) muted(viewerId, userId int64) bool {
+	_, ok := d.mutes[memoryPair{viewerId, userId}]
+	return ok
+}
+
+// relatedUsers lists users paired with user in pairs where user comes first, ordered by username
+func (d *memoryData) relatedUsers(pairs map[memoryPair]time.Time, userId int64, first int, after string) []User {
+	users := []User{}
+	for key := range pairs {
+		if key.a != userId {
+			continue
+		}
+
+		u := d.userOf(key.b)
+		if after != "" && u.Username <= after {
+			continue
+		}
+
+		users = append(users, u)
+	}
+
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].Username < users[j].Username
+	})
+
+	if len(users) > first {
+		users = users[:first]
+	}
+
+	return users
+}
@@ -0,0 +1,290 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	. "social/internal/models"
+	"sort"
+	"testing"
+)
+
+func TestMemoryBlock(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+	ids := newTestUsers(t, m, "alice", "bob", "carol", "erin")
+	alice, bob, carol, erin := ids[0], ids[1], ids[2], ids[3]
+
+	for _, f := range [][2]int64{{alice, bob}, {bob, alice}, {bob, erin}} {
+		if _, err := m.Follow(ctx, f[0], f[1]); err != nil {
+			t.Fatalf("could not follow: %v", err)
+		}
+	}
+
+	posts := map[int64]Post{}
+	for _, userId := range []int64{alice, bob, carol, erin} {
+		post, err := m.CreatePost(ctx, userId, "#go post", nil, false, nil)
+		if err != nil {
+			t.Fatalf("could not create post: %v", err)
+		}
+
+		if err = m.SetPostHashtags(ctx, post.Id, []string{"go"}); err != nil {
+			t.Fatalf("could not set hashtags: %v", err)
+		}
+
+		posts[userId] = post
+	}
+
+	if _, _, err := m.LikePost(ctx, bob, posts[alice].Id); err != nil {
+		t.Fatalf("could not like post: %v", err)
+	}
+
+	if _, _, err := m.LikePost(ctx, bob, posts[erin].Id); err != nil {
+		t.Fatalf("could not like post: %v", err)
+	}
+
+	// alice blocks bob, carol blocks alice, both hide the pair from each other
+	if err := m.Block(ctx, alice, bob); err != nil {
+		t.Fatalf("could not block: %v", err)
+	}
+
+	if err := m.Block(ctx, carol, alice); err != nil {
+		t.Fatalf("could not block: %v", err)
+	}
+
+	if following, _ := m.IsFollowing(ctx, alice, bob); following {
+		t.Error("want follows between alice and bob removed")
+	}
+
+	if following, _ := m.IsFollowing(ctx, bob, erin); !following {
+		t.Error("want follows with others kept")
+	}
+
+	profile, err := m.UserProfile(ctx, 0, "alice")
+	if err != nil || profile.FollowersCount != 0 || profile.FolloweesCount != 0 {
+		t.Errorf("want follow counts of alice at 0, got %+v, %v", profile, err)
+	}
+
+	if p := m.data.posts[posts[alice].Id]; p.LikesCount != 0 {
+		t.Errorf("want like of bob on post of alice removed, got %d", p.LikesCount)
+	}
+
+	if p := m.data.posts[posts[erin].Id]; p.LikesCount != 1 {
+		t.Errorf("want like of bob on post of erin kept, got %d", p.LikesCount)
+	}
+
+	for _, viewer := range []int64{alice, bob, carol} {
+		if blocked, _ := m.Blocked(ctx, viewer, alice); blocked != (viewer != alice) {
+			t.Errorf("want Blocked(%d, alice) %v, got %v", viewer, viewer != alice, blocked)
+		}
+	}
+
+	for _, username := range []string{"bob", "carol"} {
+		if _, err = m.UserProfile(ctx, alice, username); !errors.Is(err, ErrNotFound) {
+			t.Errorf("want %s not found by alice, got %v", username, err)
+		}
+
+		if _, err = m.UserProfile(ctx, 0, username); err != nil {
+			t.Errorf("want %s found by anonymous viewer, got %v", username, err)
+		}
+	}
+
+	users, err := m.Users(ctx, alice, "", 10, "")
+	if err != nil {
+		t.Fatalf("could not list users: %v", err)
+	}
+
+	if got := usernamesOf(users); got != "[alice erin]" {
+		t.Errorf("want users alice sees to leave out bob and carol, got %s", got)
+	}
+
+	if followers, _ := m.Followers(ctx, alice, "erin", 10, ""); len(followers) != 0 {
+		t.Errorf("want bob left out of followers of erin alice sees, got %s", usernamesOf(followers))
+	}
+
+	if followers, _ := m.Followers(ctx, erin, "erin", 10, ""); len(followers) != 1 {
+		t.Errorf("want bob in followers of erin erin sees, got %s", usernamesOf(followers))
+	}
+
+	all, err := m.Posts(ctx, alice, 0, 10)
+	if err != nil {
+		t.Fatalf("could not list posts: %v", err)
+	}
+
+	if got := authorsOf(all); fmt.Sprint(got) != fmt.Sprint([]int64{alice, erin}) {
+		t.Errorf("want posts alice sees from alice and erin, got authors %v", got)
+	}
+
+	tagged, err := m.HashtagPosts(ctx, bob, "go", 10, 0)
+	if err != nil {
+		t.Fatalf("could not list hashtag posts: %v", err)
+	}
+
+	if got := authorsOf(tagged); fmt.Sprint(got) != fmt.Sprint([]int64{bob, carol, erin}) {
+		t.Errorf("want tagged posts bob sees leave out alice, got authors %v", got)
+	}
+
+	if all, _ = m.Posts(ctx, 0, 0, 10); len(all) != 4 {
+		t.Errorf("want every post listed for anonymous viewer, got %d", len(all))
+	}
+
+	for _, userId := range []int64{alice, bob, erin} {
+		if _, err = m.CreateComment(ctx, Comment{UserId: userId, PostId: posts[erin].Id, Content: "comment"}); err != nil {
+			t.Fatalf("could not create comment: %v", err)
+		}
+	}
+
+	comments, err := m.Comments(ctx, alice, posts[erin].Id, 10, 0, true)
+	if err != nil {
+		t.Fatalf("could not list comments: %v", err)
+	}
+
+	if len(comments) != 2 || comments[0].UserId != alice || comments[1].UserId != erin {
+		t.Errorf("want comments of alice and erin alice sees, got %+v", comments)
+	}
+
+	if err = m.Unblock(ctx, alice, bob); err != nil {
+		t.Fatalf("could not unblock: %v", err)
+	}
+
+	if _, err = m.UserProfile(ctx, alice, "bob"); err != nil {
+		t.Errorf("want bob found after unblock, got %v", err)
+	}
+}
+
+func TestMemoryMute(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+	ids := newTestUsers(t, m, "alice", "dave", "erin")
+	alice, dave, erin := ids[0], ids[1], ids[2]
+
+	for _, followeeId := range []int64{dave, erin} {
+		if _, err := m.Follow(ctx, alice, followeeId); err != nil {
+			t.Fatalf("could not follow: %v", err)
+		}
+	}
+
+	// timeline item added before the mute is hidden when read
+	davePost, err := m.CreatePost(ctx, dave, "before", nil, false, nil)
+	if err != nil {
+		t.Fatalf("could not create post: %v", err)
+	}
+
+	if _, err = m.FanoutPost(ctx, davePost.Id, dave); err != nil {
+		t.Fatalf("could not fan out post: %v", err)
+	}
+
+	if err = m.Mute(ctx, alice, dave); err != nil {
+		t.Fatalf("could not mute: %v", err)
+	}
+
+	if muting, _ := m.IsMuting(ctx, alice, dave); !muting {
+		t.Fatal("want alice muting dave")
+	}
+
+	if muting, _ := m.IsMuting(ctx, dave, alice); muting {
+		t.Error("want mute one way")
+	}
+
+	if following, _ := m.IsFollowing(ctx, alice, dave); !following {
+		t.Error("want mute to keep follow")
+	}
+
+	afterPost, err := m.CreatePost(ctx, dave, "after", nil, false, nil)
+	if err != nil {
+		t.Fatalf("could not create post: %v", err)
+	}
+
+	if items, _ := m.FanoutPost(ctx, afterPost.Id, dave); len(items) != 0 {
+		t.Errorf("want post of muted user not fanned out to muter, got %+v", items)
+	}
+
+	// repost of muted author by followed user stays out too
+	if items, _ := m.FanoutRepost(ctx, afterPost.Id, erin); len(items) != 1 || items[0].UserId != erin {
+		t.Errorf("want repost of muted author only in timeline of reposter, got %+v", items)
+	}
+
+	erinPost, err := m.CreatePost(ctx, erin, "erin", nil, false, nil)
+	if err != nil {
+		t.Fatalf("could not create post: %v", err)
+	}
+
+	if _, err = m.FanoutPost(ctx, erinPost.Id, erin); err != nil {
+		t.Fatalf("could not fan out post: %v", err)
+	}
+
+	timeline, err := m.Timeline(ctx, alice, 10, 0, 0)
+	if err != nil {
+		t.Fatalf("could not get timeline: %v", err)
+	}
+
+	if len(timeline) != 1 || timeline[0].PostId != erinPost.Id {
+		t.Errorf("want only post of erin in timeline, got %+v", timeline)
+	}
+
+	// mute does not hide the user like block does
+	if _, err = m.UserProfile(ctx, alice, "dave"); err != nil {
+		t.Errorf("want muted user found, got %v", err)
+	}
+
+	if posts, _ := m.Posts(ctx, alice, dave, 10); len(posts) != 2 {
+		t.Errorf("want posts of muted user listed on their profile, got %d", len(posts))
+	}
+
+	for _, actorId := range []int64{dave, erin} {
+		if _, err = m.Notify(ctx, alice, actorId, "like", &erinPost.Id); err != nil {
+			t.Fatalf("could not notify: %v", err)
+		}
+	}
+
+	if _, err = m.Notify(ctx, alice, dave, "follow", nil); err != nil {
+		t.Fatalf("could not notify: %v", err)
+	}
+
+	notifications, err := m.Notifications(ctx, alice, 10, 0)
+	if err != nil {
+		t.Fatalf("could not get notifications: %v", err)
+	}
+
+	if len(notifications) != 1 || fmt.Sprint(notifications[0].Actors) != "[erin]" || notifications[0].ActorsCount != 1 {
+		t.Errorf("want muted actor left out and notification of only them dropped, got %+v", notifications)
+	}
+
+	if unread, _ := m.UnreadNotificationsCount(ctx, alice); unread != 1 {
+		t.Errorf("want 1 unread notification, got %d", unread)
+	}
+
+	if err = m.Unmute(ctx, alice, dave); err != nil {
+		t.Fatalf("could not unmute: %v", err)
+	}
+
+	if timeline, _ = m.Timeline(ctx, alice, 10, 0, 0); len(timeline) != 2 {
+		t.Errorf("want post from before the mute back in timeline, got %+v", timeline)
+	}
+
+	if unread, _ := m.UnreadNotificationsCount(ctx, alice); unread != 2 {
+		t.Errorf("want notifications of dave back after unmute, got %d", unread)
+	}
+}
+
+// usernamesOf usernames of users sorted
+func usernamesOf(users []UserProfile) string {
+	var usernames []string
+	for _, u := range users {
+		usernames = append(usernames, u.Username)
+	}
+
+	sort.Strings(usernames)
+	return fmt.Sprint(usernames)
+}
+
+// authorsOf ids of authors of posts sorted
+func authorsOf(posts []Post) []int64 {
+	var ids []int64
+	for _, p := range posts {
+		ids = append(ids, p.UserId)
+	}
+
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
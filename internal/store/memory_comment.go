@@ -0,0 +1,278 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	. "social/internal/models"
+	"sort"
+	"time"
+)
+
+func (m *Memory) CreateComment(ctx context.Context, c Comment) (Comment, error) {
+	defer m.lock()()
+
+	if _, ok := m.data.posts[c.PostId]; !ok {
+		return c, ErrNotFound
+	}
+
+	if _, ok := m.data.users[c.UserId]; !ok {
+		return c, ErrNotFound
+	}
+
+	if c.ParentId != nil {
+		if _, ok := m.data.comments[*c.ParentId]; !ok {
+			return c, ErrNotFound
+		}
+	}
+
+	c.Id = m.data.nextId("comments")
+	c.ParentId = copyInt64(c.ParentId)
+	c.CreatedAt = time.Now()
+	m.data.comments[c.Id] = Comment{
+		Id:        c.Id,
+		UserId:    c.UserId,
+		PostId:    c.PostId,
+		ParentId:  c.ParentId,
+		Depth:     c.Depth,
+		Content:   c.Content,
+		CreatedAt: c.CreatedAt,
+	}
+
+	return c, nil
+}
+
+func (m *Memory) CommentPostId(ctx context.Context, commentId int64) (int64, error) {
+	defer m.rlock()()
+
+	c, ok := m.data.comments[commentId]
+	if !ok {
+		return 0, ErrNotFound
+	}
+
+	return c.PostId, nil
+}
+
+func (m *Memory) IncrementRepliesCount(ctx context.Context, commentId int64) (Comment, error) {
+	defer m.lock()()
+
+	c, ok := m.data.comments[commentId]
+	if !ok {
+		return c, ErrNotFound
+	}
+
+	c.RepliesCount++
+	m.data.comments[commentId] = c
+
+	return c, nil
+}
+
+func (m *Memory) Comments(ctx context.Context, viewerId, postId int64, last int, after int64, oldestFirst bool) ([]Comment, error) {
+	defer m.rlock()()
+
+	comments := m.data.filterComments(viewerId, func(c Comment) bool {
+		if c.PostId != postId || c.ParentId != nil {
+			return false
+		}
+
+		if after == 0 {
+			return true
+		}
+
+		if oldestFirst {
+			return c.Id > after
+		}
+
+		return c.Id < after
+	})
+
+	if !oldestFirst {
+		reverseComments(comments)
+	}
+
+	if len(comments) > last {
+		comments = comments[:last]
+	}
+
+	return comments, nil
+}
+
+func (m *Memory) CommentReplies(ctx context.Context, viewerId, commentId int64, last int, after int64) ([]Comment, error) {
+	defer m.rlock()()
+
+	replies := m.data.filterComments(viewerId, func(c Comment) bool {
+		return c.ParentId != nil && *c.ParentId == commentId && c.Id > after
+	})
+
+	if len(replies) > last {
+		replies = replies[:last]
+	}
+
+	return replies, nil
+}
+
+func (m *Memory) PreviewReplies(ctx context.Context, viewerId int64, parentIds []int64, limit int) ([]Comment, error) {
+	defer m.rlock()()
+
+	parents := make(map[int64]bool, len(parentIds))
+	for _, id := range parentIds {
+		parents[id] = true
+	}
+
+	replies := m.data.filterComments(viewerId, func(c Comment) bool {
+		return c.ParentId != nil && parents[*c.ParentId]
+	})
+
+	sort.SliceStable(replies, func(i, j int) bool {
+		return *replies[i].ParentId < *replies[j].ParentId
+	})
+
+	preview := []Comment{}
+	shown := make(map[int64]int, len(parentIds))
+	for _, r := range replies {
+		if shown[*r.ParentId] < limit {
+			shown[*r.ParentId]++
+			preview = append(preview, r)
+		}
+	}
+
+	return preview, nil
+}
+
+func (m *Memory) IsCommentLiked(ctx context.Context, userId, commentId int64) (bool, error) {
+	defer m.rlock()()
+
+	_, ok := m.data.commentLikes[memoryPair{userId, commentId}]
+	return ok, nil
+}
+
+func (m *Memory) LikeComment(ctx context.Context, userId, commentId int64) (int, int64, error) {
+	defer m.lock()()
+
+	c, ok := m.data.comments[commentId]
+	if !ok {
+		return 0, 0, ErrNotFound
+	}
+
+	key := memoryPair{userId, commentId}
+	if _, ok = m.data.commentLikes[key]; ok {
+		return 0, 0, fmt.Errorf("could not insert like for comment: already liked")
+	}
+
+	m.data.commentLikes[key] = struct{}{}
+	c.LikesCount++
+	m.data.comments[commentId] = c
+
+	return c.LikesCount, c.UserId, nil
+}
+
+func (m *Memory) UnlikeComment(ctx context.Context, userId, commentId int64) (int, int64, error) {
+	defer m.lock()()
+
+	c, ok := m.data.comments[commentId]
+	if !ok {
+		return 0, 0, ErrNotFound
+	}
+
+	key := memoryPair{userId, commentId}
+	if _, ok = m.data.commentLikes[key]; ok {
+		delete(m.data.commentLikes, key)
+		c.LikesCount--
+		m.data.comments[commentId] = c
+	}
+
+	return c.LikesCount, c.UserId, nil
+}
+
+// filterComments returns matching comments ordered by id as seen by viewer, leaving out hidden authors
+func (d *memoryData) filterComments(viewerId int64, match func(Comment) bool) []Comment {
+	comments := []Comment{}
+	for _, c := range d.comments {
+		if !match(c) || d.hidden(viewerId, c.UserId) {
+			continue
+		}
+
+		user := d.userOf(c.UserId)
+		c.User = &user
+		if viewerId != 0 {
+			_, c.Liked = d.commentLikes[memoryPair{viewerId, c.Id}]
+		}
+		comments = append(comments, c)
+	}
+
+	sort.Slice(comments, func(i, j int) bool {
+		return comments[i].Id < comments[j].Id
+	})
+
+	return comments
+}
+
+// deleteComment removes comment with its likes and replies
+func (d *memoryData) deleteComment(commentId int64) {
+	delete(d.comments, commentId)
+	delete(d.commentMentions, commentId)
+	for key := range d.commentLikes {
+		if key.b == commentId {
+			delete(d.commentLikes, key)
+		}
+	}
+
+	for id, c := range d.comments {
+		if c.ParentId != nil && *c.ParentId == commentId {
+			d.deleteComment(id)
+		}
+	}
+}
+
+// deleteUserComments deletes comments of the user with replies to them and recounts
+// comments of the posts and replies of the comments they were on
+func (d *memoryData) deleteUserComments(userId int64) int {
+	var ids []int64
+	postIds := map[int64]bool{}
+	parentIds := map[int64]bool{}
+	for id, c := range d.comments {
+		if c.UserId != userId {
+			continue
+		}
+
+		ids = append(ids, id)
+		postIds[c.PostId] = true
+		if c.ParentId != nil {
+			parentIds[*c.ParentId] = true
+		}
+	}
+
+	for _, id := range ids {
+		d.deleteComment(id)
+	}
+
+	commentsCount := map[int64]int{}
+	repliesCount := map[int64]int{}
+	for _, c := range d.comments {
+		commentsCount[c.PostId]++
+		if c.ParentId != nil {
+			repliesCount[*c.ParentId]++
+		}
+	}
+
+	for id := range postIds {
+		if post, ok := d.posts[id]; ok {
+			post.CommentsCount = commentsCount[id]
+			d.posts[id] = post
+		}
+	}
+
+	for id := range parentIds {
+		if c, ok := d.comments[id]; ok {
+			c.RepliesCount = repliesCount[id]
+			d.comments[id] = c
+		}
+	}
+
+	return len(ids)
+}
+
+func reverseComments(comments []Comment) {
+	for i, j := 0, len(comments)-1; i < j; i, j = i+1, j-1 {
+		comments[i], comments[j] = comments[j], comments[i]
+	}
+}
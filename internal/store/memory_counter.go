@@ -0,0 +1,137 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"sort"
+)
+
+func (m *Memory) ReconcileCounts(ctx context.Context, counter string, afterId int64, limit int, fix bool) (CountBatch, error) {
+	defer m.lock()()
+
+	var batch CountBatch
+	actual := map[int64]int{}
+	stored := map[int64]int{}
+	var set func(id int64, n int)
+	switch counter {
+	case CounterFollowers, CounterFollowees:
+		for f := range m.data.follows {
+			if counter == CounterFollowers {
+				actual[f.b]++
+			} else {
+				actual[f.a]++
+			}
+		}
+		for id, u := range m.data.users {
+			stored[id] = u.FollowersCount
+			if counter == CounterFollowees {
+				stored[id] = u.FolloweesCount
+			}
+		}
+		set = func(id int64, n int) {
+			u := m.data.users[id]
+			if counter == CounterFollowers {
+				u.FollowersCount = n
+			} else {
+				u.FolloweesCount = n
+			}
+			m.data.users[id] = u
+		}
+	case CounterPostLikes, CounterPostComments, CounterPostReposts:
+		switch counter {
+		case CounterPostLikes:
+			for key := range m.data.postLikes {
+				actual[key.b]++
+			}
+		case CounterPostComments:
+			for _, c := range m.data.comments {
+				actual[c.PostId]++
+			}
+		default:
+			for key := range m.data.reposts {
+				actual[key.b]++
+			}
+		}
+		for id, post := range m.data.posts {
+			switch counter {
+			case CounterPostLikes:
+				stored[id] = post.LikesCount
+			case CounterPostComments:
+				stored[id] = post.CommentsCount
+			default:
+				stored[id] = post.RepostsCount
+			}
+		}
+		set = func(id int64, n int) {
+			post := m.data.posts[id]
+			switch counter {
+			case CounterPostLikes:
+				post.LikesCount = n
+			case CounterPostComments:
+				post.CommentsCount = n
+			default:
+				post.RepostsCount = n
+			}
+			m.data.posts[id] = post
+		}
+	case CounterCommentLikes, CounterCommentReplies:
+		if counter == CounterCommentLikes {
+			for key := range m.data.commentLikes {
+				actual[key.b]++
+			}
+		} else {
+			for _, c := range m.data.comments {
+				if c.ParentId != nil {
+					actual[*c.ParentId]++
+				}
+			}
+		}
+		for id, c := range m.data.comments {
+			stored[id] = c.LikesCount
+			if counter == CounterCommentReplies {
+				stored[id] = c.RepliesCount
+			}
+		}
+		set = func(id int64, n int) {
+			c := m.data.comments[id]
+			if counter == CounterCommentLikes {
+				c.LikesCount = n
+			} else {
+				c.RepliesCount = n
+			}
+			m.data.comments[id] = c
+		}
+	default:
+		return batch, fmt.Errorf("unknown counter %q", counter)
+	}
+
+	ids := make([]int64, 0, len(stored))
+	for id := range stored {
+		if id > afterId {
+			ids = append(ids, id)
+		}
+	}
+
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i] < ids[j]
+	})
+
+	if len(ids) > limit {
+		ids = ids[:limit]
+	}
+
+	for _, id := range ids {
+		batch.Checked++
+		batch.LastId = id
+		if stored[id] == actual[id] {
+			continue
+		}
+
+		batch.Mismatches = append(batch.Mismatches, CountMismatch{Counter: counter, Id: id, Stored: stored[id], Actual: actual[id]})
+		if fix {
+			set(id, actual[id])
+		}
+	}
+
+	return batch, nil
+}
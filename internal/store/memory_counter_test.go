@@ -0,0 +1,80 @@
+package store
+
+import (
+	"context"
+	"testing"
+)
+
+func TestMemoryReconcileCounts(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+	ids := newTestUsers(t, m, "alice", "bob", "carol")
+
+	for _, followerId := range ids[1:] {
+		if _, err := m.Follow(ctx, followerId, ids[0]); err != nil {
+			t.Fatalf("could not follow: %v", err)
+		}
+	}
+
+	post, err := m.CreatePost(ctx, ids[0], "post", nil, false, nil)
+	if err != nil {
+		t.Fatalf("could not create post: %v", err)
+	}
+
+	if _, _, err = m.LikePost(ctx, ids[1], post.Id); err != nil {
+		t.Fatalf("could not like post: %v", err)
+	}
+
+	for _, counter := range Counters {
+		batch, err := m.ReconcileCounts(ctx, counter, 0, 100, false)
+		if err != nil || len(batch.Mismatches) != 0 {
+			t.Fatalf("want %s in sync after regular writes, got %+v, %v", counter, batch, err)
+		}
+	}
+
+	// drift counts as if some update was lost
+	alice := m.data.users[ids[0]]
+	alice.FollowersCount = 5
+	m.data.users[ids[0]] = alice
+	carol := m.data.users[ids[2]]
+	carol.FollowersCount = 1
+	m.data.users[ids[2]] = carol
+	p := m.data.posts[post.Id]
+	p.LikesCount = 0
+	m.data.posts[post.Id] = p
+
+	// batches of 2 go through every user in id order
+	batch, err := m.ReconcileCounts(ctx, CounterFollowers, 0, 2, false)
+	if err != nil || batch.Checked != 2 || batch.LastId != ids[1] {
+		t.Fatalf("want first 2 users checked, got %+v, %v", batch, err)
+	}
+
+	if len(batch.Mismatches) != 1 || batch.Mismatches[0] != (CountMismatch{Counter: CounterFollowers, Id: ids[0], Stored: 5, Actual: 2}) {
+		t.Errorf("want followers of alice reported, got %+v", batch.Mismatches)
+	}
+
+	if batch, err = m.ReconcileCounts(ctx, CounterFollowers, batch.LastId, 2, true); err != nil || batch.Checked != 1 || len(batch.Mismatches) != 1 {
+		t.Fatalf("want carol fixed in the last batch, got %+v, %v", batch, err)
+	}
+
+	if batch, err = m.ReconcileCounts(ctx, CounterFollowers, batch.LastId, 2, true); err != nil || batch.Checked != 0 || batch.LastId != 0 {
+		t.Errorf("want empty batch past the last user, got %+v, %v", batch, err)
+	}
+
+	if m.data.users[ids[0]].FollowersCount != 5 || m.data.users[ids[2]].FollowersCount != 0 {
+		t.Errorf("want only the fixed batch changed, got alice %d, carol %d",
+			m.data.users[ids[0]].FollowersCount, m.data.users[ids[2]].FollowersCount)
+	}
+
+	if batch, err = m.ReconcileCounts(ctx, CounterPostLikes, 0, 100, true); err != nil || len(batch.Mismatches) != 1 {
+		t.Fatalf("want likes of post fixed, got %+v, %v", batch, err)
+	}
+
+	if m.data.posts[post.Id].LikesCount != 1 {
+		t.Errorf("want 1 like, got %d", m.data.posts[post.Id].LikesCount)
+	}
+
+	if _, err = m.ReconcileCounts(ctx, "karma", 0, 100, false); err == nil {
+		t.Error("want unknown counter to fail")
+	}
+}
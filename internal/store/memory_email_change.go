@@ -0,0 +1,47 @@
+package store
+
+import (
+	"context"
+	"time"
+)
+
+func (m *Memory) CreateEmailChange(ctx context.Context, codeHash string, userId int64, email string) error {
+	defer m.lock()()
+
+	if _, ok := m.data.users[userId]; !ok {
+		return ErrNotFound
+	}
+
+	for hash, change := range m.data.emailChanges {
+		if change.UserId == userId {
+			delete(m.data.emailChanges, hash)
+		}
+	}
+
+	m.data.emailChanges[codeHash] = EmailChange{UserId: userId, Email: email, CreatedAt: time.Now()}
+	return nil
+}
+
+func (m *Memory) DeleteEmailChangesBefore(ctx context.Context, t time.Time) error {
+	defer m.lock()()
+
+	for hash, change := range m.data.emailChanges {
+		if change.CreatedAt.Before(t) {
+			delete(m.data.emailChanges, hash)
+		}
+	}
+
+	return nil
+}
+
+func (m *Memory) TakeEmailChange(ctx context.Context, codeHash string) (EmailChange, error) {
+	defer m.lock()()
+
+	change, ok := m.data.emailChanges[codeHash]
+	if !ok {
+		return EmailChange{}, ErrNotFound
+	}
+
+	delete(m.data.emailChanges, codeHash)
+	return change, nil
+}
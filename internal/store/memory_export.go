@@ -0,0 +1,160 @@
+package store
+
+import (
+	"context"
+	. "social/internal/models"
+	"sort"
+	"time"
+)
+
+func (m *Memory) CreateExport(ctx context.Context, userId int64) (UserExport, error) {
+	defer m.lock()()
+
+	if _, ok := m.data.users[userId]; !ok {
+		return UserExport{}, ErrNotFound
+	}
+
+	export := UserExport{Id: m.data.nextId("exports"), UserId: userId, CreatedAt: time.Now()}
+	m.data.exports[export.Id] = export
+	return export, nil
+}
+
+func (m *Memory) Export(ctx context.Context, exportId int64) (UserExport, error) {
+	defer m.rlock()()
+
+	export, ok := m.data.exports[exportId]
+	if !ok {
+		return export, ErrNotFound
+	}
+
+	return export, nil
+}
+
+func (m *Memory) LatestExport(ctx context.Context, userId int64) (UserExport, error) {
+	defer m.rlock()()
+
+	var (
+		latest UserExport
+		found  bool
+	)
+	for _, export := range m.data.exports {
+		if export.UserId != userId {
+			continue
+		}
+
+		if !found || export.CreatedAt.After(latest.CreatedAt) ||
+			(export.CreatedAt.Equal(latest.CreatedAt) && export.Id > latest.Id) {
+			latest, found = export, true
+		}
+	}
+
+	if !found {
+		return latest, ErrNotFound
+	}
+
+	return latest, nil
+}
+
+func (m *Memory) CompleteExport(ctx context.Context, exportId int64, file string) error {
+	defer m.lock()()
+
+	export, ok := m.data.exports[exportId]
+	if !ok {
+		return ErrNotFound
+	}
+
+	now := time.Now()
+	export.File = file
+	export.CompletedAt = &now
+	m.data.exports[exportId] = export
+	return nil
+}
+
+func (m *Memory) UserArchive(ctx context.Context, userId int64) (UserArchive, error) {
+	defer m.rlock()()
+
+	var archive UserArchive
+	profile, ok := m.data.users[userId]
+	if !ok {
+		return archive, ErrNotFound
+	}
+
+	archive.Profile = profile
+
+	archive.Posts = []Post{}
+	for _, post := range m.data.posts {
+		if post.UserId == userId {
+			archive.Posts = append(archive.Posts, m.data.withUser(post))
+		}
+	}
+
+	sort.Slice(archive.Posts, func(i, j int) bool {
+		return archive.Posts[i].Id < archive.Posts[j].Id
+	})
+
+	archive.Revisions = []PostRevision{}
+	for _, revision := range m.data.revisions {
+		if post, ok := m.data.posts[revision.PostId]; ok && post.UserId == userId {
+			archive.Revisions = append(archive.Revisions, revision)
+		}
+	}
+
+	sort.Slice(archive.Revisions, func(i, j int) bool {
+		return archive.Revisions[i].Id < archive.Revisions[j].Id
+	})
+
+	archive.Comments = m.data.filterComments(0, func(c Comment) bool {
+		return c.UserId == userId
+	})
+
+	for _, media := range m.data.media {
+		if media.UserId == userId {
+			archive.Media = append(archive.Media, media.Media)
+		}
+	}
+
+	sort.Slice(archive.Media, func(i, j int) bool {
+		return archive.Media[i].Id < archive.Media[j].Id
+	})
+
+	archive.LikedPosts, archive.LikedComments, archive.Reposts = []int64{}, []int64{}, []int64{}
+	for key := range m.data.postLikes {
+		if key.a == userId {
+			archive.LikedPosts = append(archive.LikedPosts, key.b)
+		}
+	}
+
+	for key := range m.data.commentLikes {
+		if key.a == userId {
+			archive.LikedComments = append(archive.LikedComments, key.b)
+		}
+	}
+
+	for key := range m.data.reposts {
+		if key.a == userId {
+			archive.Reposts = append(archive.Reposts, key.b)
+		}
+	}
+
+	for _, ids := range [][]int64{archive.LikedPosts, archive.LikedComments, archive.Reposts} {
+		sort.Slice(ids, func(i, j int) bool {
+			return ids[i] < ids[j]
+		})
+	}
+
+	archive.Following, archive.Followers = []string{}, []string{}
+	for f := range m.data.follows {
+		if f.a == userId {
+			archive.Following = append(archive.Following, m.data.userOf(f.b).Username)
+		}
+
+		if f.b == userId {
+			archive.Followers = append(archive.Followers, m.data.userOf(f.a).Username)
+		}
+	}
+
+	sort.Strings(archive.Following)
+	sort.Strings(archive.Followers)
+
+	return archive, nil
+}
@@ -0,0 +1,115 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	. "social/internal/models"
+)
+
+func (m *Memory) IsFollowing(ctx context.Context, followerId, followeeId int64) (bool, error) {
+	defer m.rlock()()
+
+	_, ok := m.data.follows[memoryPair{followerId, followeeId}]
+	return ok, nil
+}
+
+func (m *Memory) Follow(ctx context.Context, followerId, followeeId int64) (int, error) {
+	defer m.lock()()
+
+	key := memoryPair{followerId, followeeId}
+	if _, ok := m.data.follows[key]; ok {
+		return 0, fmt.Errorf("cannot add new row to follows: already following")
+	}
+
+	if _, ok := m.data.users[followerId]; !ok {
+		return 0, ErrNotFound
+	}
+
+	if _, ok := m.data.users[followeeId]; !ok {
+		return 0, ErrNotFound
+	}
+
+	m.data.follows[key] = struct{}{}
+	return m.data.updateFollowCounts(followerId, followeeId, 1), nil
+}
+
+func (m *Memory) Unfollow(ctx context.Context, followerId, followeeId int64) (int, error) {
+	defer m.lock()()
+
+	key := memoryPair{followerId, followeeId}
+	if _, ok := m.data.follows[key]; !ok {
+		return m.data.users[followeeId].FollowersCount, nil
+	}
+
+	delete(m.data.follows, key)
+	return m.data.updateFollowCounts(followerId, followeeId, -1), nil
+}
+
+func (m *Memory) Followers(ctx context.Context, viewerId int64, username string, first int, after string) ([]UserProfile, error) {
+	defer m.rlock()()
+
+	return m.data.listFollows(viewerId, username, first, after, true), nil
+}
+
+func (m *Memory) Followees(ctx context.Context, viewerId int64, username string, first int, after string) ([]UserProfile, error) {
+	defer m.rlock()()
+
+	return m.data.listFollows(viewerId, username, first, after, false), nil
+}
+
+func (d *memoryData) updateFollowCounts(followerId, followeeId int64, delta int) int {
+	if follower, ok := d.users[followerId]; ok {
+		follower.FolloweesCount = nonNegative(follower.FolloweesCount + delta)
+		d.users[followerId] = follower
+	}
+
+	followee, ok := d.users[followeeId]
+	if ok {
+		followee.FollowersCount = nonNegative(followee.FollowersCount + delta)
+		d.users[followeeId] = followee
+	}
+
+	return followee.FollowersCount
+}
+
+// nonNegative n or 0 when it is below, counts never go below zero even if they drifted
+func nonNegative(n int) int {
+	if n < 0 {
+		return 0
+	}
+
+	return n
+}
+
+// listFollows lists followers of user with username or, unless followers, users they follow
+func (d *memoryData) listFollows(viewerId int64, username string, first int, after string, followers bool) []UserProfile {
+	of, ok := d.userByUsername(username)
+	if !ok || d.hidden(viewerId, of.Id) {
+		return []UserProfile{}
+	}
+
+	var users []UserProfile
+	for f := range d.follows {
+		listed, other := f.a, f.b
+		if !followers {
+			listed, other = f.b, f.a
+		}
+
+		if other != of.Id {
+			continue
+		}
+
+		u := d.users[listed]
+		if after != "" && u.Username <= after {
+			continue
+		}
+
+		if d.hidden(viewerId, listed) {
+			continue
+		}
+
+		users = append(users, u)
+	}
+
+	return d.profilesPage(viewerId, users, first)
+}
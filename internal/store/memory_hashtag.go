@@ -0,0 +1,119 @@
+package store
+
+import (
+	"context"
+	"math"
+	. "social/internal/models"
+	"sort"
+	"time"
+)
+
+func (m *Memory) SetPostHashtags(ctx context.Context, postId int64, tags []string) error {
+	defer m.lock()()
+
+	if _, ok := m.data.posts[postId]; !ok {
+		return nil
+	}
+
+	if len(tags) == 0 {
+		delete(m.data.hashtags, postId)
+		return nil
+	}
+
+	m.data.hashtags[postId] = append([]string(nil), tags...)
+	return nil
+}
+
+func (m *Memory) HashtagPosts(ctx context.Context, viewerId int64, tag string, last int, before int64) ([]Post, error) {
+	defer m.rlock()()
+
+	posts := []Post{}
+	for postId, tags := range m.data.hashtags {
+		if before != 0 && postId >= before {
+			continue
+		}
+
+		if m.data.hidden(viewerId, m.data.posts[postId].UserId) {
+			continue
+		}
+
+		for _, t := range tags {
+			if t == tag {
+				posts = append(posts, m.data.withUser(m.data.posts[postId]))
+				break
+			}
+		}
+	}
+
+	sort.Slice(posts, func(i, j int) bool {
+		return posts[i].Id > posts[j].Id
+	})
+
+	if len(posts) > last {
+		posts = posts[:last]
+	}
+
+	return posts, nil
+}
+
+func (m *Memory) RefreshTrendingHashtags(ctx context.Context, period string, window time.Duration, now time.Time, limit int) error {
+	defer m.lock()()
+
+	current := map[string]int{}
+	previous := map[string]int{}
+	for postId, tags := range m.data.hashtags {
+		createdAt := m.data.posts[postId].CreateAt
+		if !createdAt.Before(now) || createdAt.Before(now.Add(-2*window)) {
+			continue
+		}
+
+		for _, tag := range tags {
+			if createdAt.Before(now.Add(-window)) {
+				previous[tag]++
+			} else {
+				current[tag]++
+			}
+		}
+	}
+
+	tags := []TrendingHashtag{}
+	for tag, n := range current {
+		score := float64(n-previous[tag]) / math.Sqrt(float64(previous[tag]+1))
+		tags = append(tags, TrendingHashtag{Tag: tag, PostsCount: n, Score: score})
+	}
+
+	sort.Slice(tags, func(i, j int) bool {
+		if tags[i].Score != tags[j].Score {
+			return tags[i].Score > tags[j].Score
+		}
+
+		if tags[i].PostsCount != tags[j].PostsCount {
+			return tags[i].PostsCount > tags[j].PostsCount
+		}
+
+		return tags[i].Tag < tags[j].Tag
+	})
+
+	if len(tags) > limit {
+		tags = tags[:limit]
+	}
+
+	m.data.trending[period] = memoryTrending{tags: tags, computedAt: now}
+	return nil
+}
+
+// LockTrendingHashtags always succeeds, refresh holds the write lock anyway
+func (m *Memory) LockTrendingHashtags(ctx context.Context) (bool, error) {
+	return true, nil
+}
+
+func (m *Memory) TrendingHashtags(ctx context.Context, period string) ([]TrendingHashtag, time.Time, error) {
+	defer m.rlock()()
+
+	t, ok := m.data.trending[period]
+	if !ok || len(t.tags) == 0 {
+		return []TrendingHashtag{}, time.Time{}, nil
+	}
+
+	return append([]TrendingHashtag(nil), t.tags...), t.computedAt, nil
+}
@@ -0,0 +1,79 @@
+package store
+
+import (
+	"context"
+	"math"
+	"reflect"
+	. "social/internal/models"
+	"testing"
+	"time"
+)
+
+func TestMemoryTrendingHashtags(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+	ids := newTestUsers(t, m, "alice")
+
+	now := time.Date(2021, 1, 1, 12, 0, 0, 0, time.UTC)
+	tag := func(tag string, age time.Duration, n int) {
+		for i := 0; i < n; i++ {
+			post, err := m.CreatePost(ctx, ids[0], "#"+tag, nil, false, nil)
+			if err != nil {
+				t.Fatalf("could not create post: %v", err)
+			}
+
+			post.CreateAt = now.Add(-age)
+			m.data.posts[post.Id] = post
+			if err = m.SetPostHashtags(ctx, post.Id, []string{tag}); err != nil {
+				t.Fatalf("could not tag post: %v", err)
+			}
+		}
+	}
+
+	// current window is the last hour, previous one is the hour before
+	tag("rising", 10*time.Minute, 4)
+	tag("alpha", 50*time.Minute, 4)
+	tag("steady", 30*time.Minute, 3)
+	tag("steady", 90*time.Minute, 3)
+	tag("falling", time.Minute, 1)
+	tag("falling", 61*time.Minute, 4)
+	tag("gone", 90*time.Minute, 5)
+	tag("ancient", 3*time.Hour, 9)
+	tag("future", -time.Minute, 9)
+
+	if tags, computedAt, err := m.TrendingHashtags(ctx, "1h"); err != nil || len(tags) != 0 || !computedAt.IsZero() {
+		t.Fatalf("want nothing before first refresh, got %v, %v, %v", tags, computedAt, err)
+	}
+
+	if err := m.RefreshTrendingHashtags(ctx, "1h", time.Hour, now, 10); err != nil {
+		t.Fatalf("could not refresh trending hashtags: %v", err)
+	}
+
+	tags, computedAt, err := m.TrendingHashtags(ctx, "1h")
+	if err != nil || !computedAt.Equal(now) {
+		t.Fatalf("want ranking computed at now, got %v, %v", computedAt, err)
+	}
+
+	// equal score and count tie on tag
+	want := []TrendingHashtag{
+		{Tag: "alpha", PostsCount: 4, Score: 4},
+		{Tag: "rising", PostsCount: 4, Score: 4},
+		{Tag: "steady", PostsCount: 3, Score: 0},
+		{Tag: "falling", PostsCount: 1, Score: -3 / math.Sqrt(5)},
+	}
+	if !reflect.DeepEqual(tags, want) {
+		t.Errorf("want %+v, got %+v", want, tags)
+	}
+
+	if err = m.RefreshTrendingHashtags(ctx, "1h", time.Hour, now, 2); err != nil {
+		t.Fatalf("could not refresh trending hashtags: %v", err)
+	}
+
+	if tags, _, err = m.TrendingHashtags(ctx, "1h"); err != nil || !reflect.DeepEqual(tags, want[:2]) {
+		t.Errorf("want ranking replaced with top 2, got %+v, %v", tags, err)
+	}
+
+	if tags, _, err = m.TrendingHashtags(ctx, "24h"); err != nil || len(tags) != 0 {
+		t.Errorf("want other periods left alone, got %+v, %v", tags, err)
+	}
+}
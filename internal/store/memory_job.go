@@ -0,0 +1,101 @@
+package store
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	jobPending = "pending"
+	jobRunning = "running"
+	jobDone    = "done"
+	jobDead    = "dead"
+)
+
+func (m *Memory) EnqueueJob(ctx context.Context, kind string, payload []byte, maxAttempts int) error {
+	defer m.lock()()
+
+	now := time.Now()
+	id := m.data.nextId("jobs")
+	m.data.jobs[id] = memoryJob{
+		Job:       Job{Id: id, Kind: kind, Payload: append([]byte(nil), payload...), MaxAttempts: maxAttempts},
+		status:    jobPending,
+		runAt:     now,
+		updatedAt: now,
+	}
+
+	return nil
+}
+
+func (m *Memory) ClaimJob(ctx context.Context, lease time.Duration) (Job, error) {
+	defer m.lock()()
+
+	now := time.Now()
+	var (
+		next  memoryJob
+		found bool
+	)
+	for _, job := range m.data.jobs {
+		due := (job.status == jobPending && !job.runAt.After(now)) ||
+			(job.status == jobRunning && job.updatedAt.Before(now.Add(-lease)))
+		if due && (!found || job.runAt.Before(next.runAt)) {
+			next, found = job, true
+		}
+	}
+
+	if !found {
+		return Job{}, ErrNotFound
+	}
+
+	next.status = jobRunning
+	next.Attempts++
+	next.updatedAt = now
+	m.data.jobs[next.Id] = next
+
+	return next.Job, nil
+}
+
+func (m *Memory) CompleteJob(ctx context.Context, jobId int64) error {
+	return m.updateJob(jobId, jobDone, "", time.Time{})
+}
+
+func (m *Memory) RetryJob(ctx context.Context, jobId int64, lastError string, runAt time.Time) error {
+	return m.updateJob(jobId, jobPending, lastError, runAt)
+}
+
+func (m *Memory) KillJob(ctx context.Context, jobId int64, lastError string) error {
+	return m.updateJob(jobId, jobDead, lastError, time.Time{})
+}
+
+func (m *Memory) PurgeDoneJobs(ctx context.Context, before time.Time) (int64, error) {
+	defer m.lock()()
+
+	var n int64
+	for id, job := range m.data.jobs {
+		if job.status == jobDone && job.updatedAt.Before(before) {
+			delete(m.data.jobs, id)
+			n++
+		}
+	}
+
+	return n, nil
+}
+
+func (m *Memory) updateJob(jobId int64, status, lastError string, runAt time.Time) error {
+	defer m.lock()()
+
+	job, ok := m.data.jobs[jobId]
+	if !ok {
+		return nil
+	}
+
+	job.status = status
+	job.lastError = lastError
+	job.updatedAt = time.Now()
+	if !runAt.IsZero() {
+		job.runAt = runAt
+	}
+	m.data.jobs[jobId] = job
+
+	return nil
+}
@@ -0,0 +1,92 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMemoryJobs(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+
+	for _, kind := range []string{"first", "second"} {
+		if err := m.EnqueueJob(ctx, kind, []byte(`{}`), 3); err != nil {
+			t.Fatalf("could not enqueue job: %v", err)
+		}
+	}
+
+	first, err := m.ClaimJob(ctx, time.Hour)
+	if err != nil {
+		t.Fatalf("could not claim job: %v", err)
+	}
+
+	if first.Kind != "first" || first.Attempts != 1 || first.MaxAttempts != 3 {
+		t.Errorf("want first job on its first attempt, got %+v", first)
+	}
+
+	second, err := m.ClaimJob(ctx, time.Hour)
+	if err != nil {
+		t.Fatalf("could not claim job: %v", err)
+	}
+
+	if second.Kind != "second" {
+		t.Errorf("want second job, got %+v", second)
+	}
+
+	if _, err = m.ClaimJob(ctx, time.Hour); !errors.Is(err, ErrNotFound) {
+		t.Errorf("want running jobs left alone within lease, got %v", err)
+	}
+
+	// running job not updated for the lease is claimed again, as if its worker died
+	reclaimed, err := m.ClaimJob(ctx, 0)
+	if err != nil {
+		t.Fatalf("could not reclaim job: %v", err)
+	}
+
+	if reclaimed.Attempts != 2 {
+		t.Errorf("want reclaimed job to count the attempt, got %+v", reclaimed)
+	}
+
+	if err = m.CompleteJob(ctx, first.Id); err != nil {
+		t.Fatalf("could not complete job: %v", err)
+	}
+
+	if err = m.KillJob(ctx, second.Id, "failed"); err != nil {
+		t.Fatalf("could not kill job: %v", err)
+	}
+
+	if _, err = m.ClaimJob(ctx, 0); !errors.Is(err, ErrNotFound) {
+		t.Errorf("want done and dead jobs never claimed, got %v", err)
+	}
+
+	if err = m.EnqueueJob(ctx, "third", nil, 3); err != nil {
+		t.Fatalf("could not enqueue job: %v", err)
+	}
+
+	third, err := m.ClaimJob(ctx, time.Hour)
+	if err != nil {
+		t.Fatalf("could not claim job: %v", err)
+	}
+
+	if err = m.RetryJob(ctx, third.Id, "failed", time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("could not retry job: %v", err)
+	}
+
+	if _, err = m.ClaimJob(ctx, time.Hour); !errors.Is(err, ErrNotFound) {
+		t.Errorf("want retried job to wait for its backoff, got %v", err)
+	}
+
+	if n, err := m.PurgeDoneJobs(ctx, time.Now().Add(-time.Hour)); err != nil || n != 0 {
+		t.Errorf("want recently done jobs kept, got %d purged, %v", n, err)
+	}
+
+	if n, err := m.PurgeDoneJobs(ctx, time.Now().Add(time.Second)); err != nil || n != 1 {
+		t.Errorf("want the done job purged alone, got %d purged, %v", n, err)
+	}
+
+	if len(m.data.jobs) != 2 {
+		t.Errorf("want dead and pending jobs kept, got %d jobs", len(m.data.jobs))
+	}
+}
@@ -0,0 +1,92 @@
+package store
+
+import (
+	"context"
+	. "social/internal/models"
+	"sort"
+	"time"
+)
+
+func (m *Memory) CreateMedia(ctx context.Context, media Media) (Media, error) {
+	defer m.lock()()
+
+	media.Id = m.data.nextId("media")
+	media.PostId = nil
+	media.CreatedAt = time.Now()
+	m.data.media[media.Id] = memoryMedia{Media: media}
+	return media, nil
+}
+
+func (m *Memory) AttachMedia(ctx context.Context, userId, postId int64, mediaIds []int64) error {
+	defer m.lock()()
+
+	for _, id := range mediaIds {
+		media, ok := m.data.media[id]
+		if !ok || media.UserId != userId || media.PostId != nil {
+			return ErrNotFound
+		}
+	}
+
+	for i, id := range mediaIds {
+		media := m.data.media[id]
+		media.PostId = copyInt64(&postId)
+		media.position = i + 1
+		m.data.media[id] = media
+	}
+
+	return nil
+}
+
+func (m *Memory) PostMedia(ctx context.Context, postIds []int64) (map[int64][]Media, error) {
+	defer m.rlock()()
+
+	wanted := make(map[int64]bool, len(postIds))
+	for _, id := range postIds {
+		wanted[id] = true
+	}
+
+	var attached []memoryMedia
+	for _, media := range m.data.media {
+		if media.PostId != nil && wanted[*media.PostId] {
+			attached = append(attached, media)
+		}
+	}
+
+	sort.Slice(attached, func(i, j int) bool {
+		return attached[i].position < attached[j].position
+	})
+
+	media := map[int64][]Media{}
+	for _, a := range attached {
+		media[*a.PostId] = append(media[*a.PostId], a.Media)
+	}
+
+	return media, nil
+}
+
+func (m *Memory) DeleteUnattachedMedia(ctx context.Context, before time.Time, limit int) ([]string, error) {
+	defer m.lock()()
+
+	var ids []int64
+	for id, media := range m.data.media {
+		if media.PostId == nil && media.CreatedAt.Before(before) {
+			ids = append(ids, id)
+		}
+	}
+
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i] < ids[j]
+	})
+
+	if len(ids) > limit {
+		ids = ids[:limit]
+	}
+
+	var files []string
+	for _, id := range ids {
+		files = append(files, m.data.media[id].File, m.data.media[id].Thumbnail)
+		delete(m.data.media, id)
+	}
+
+	return files, nil
+}
@@ -0,0 +1,196 @@
+package store
+
+import (
+	"context"
+	. "social/internal/models"
+	"sort"
+	"time"
+)
+
+func (m *Memory) SetPostMentions(ctx context.Context, postId int64, mentions []Mention) ([]int64, error) {
+	defer m.lock()()
+
+	if _, ok := m.data.posts[postId]; !ok {
+		return nil, nil
+	}
+
+	mm, newUserIds := m.data.replaceMentions(m.data.postMentions[postId], mentions)
+	if len(mm) == 0 {
+		delete(m.data.postMentions, postId)
+	} else {
+		m.data.postMentions[postId] = mm
+	}
+
+	return newUserIds, nil
+}
+
+func (m *Memory) AddCommentMentions(ctx context.Context, commentId int64, mentions []Mention) error {
+	defer m.lock()()
+
+	if _, ok := m.data.comments[commentId]; !ok || len(mentions) == 0 {
+		return nil
+	}
+
+	m.data.commentMentions[commentId], _ = m.data.replaceMentions(m.data.commentMentions[commentId], mentions)
+	return nil
+}
+
+func (m *Memory) PostMentions(ctx context.Context, postIds []int64) (map[int64][]Mention, error) {
+	defer m.rlock()()
+
+	return m.data.mentionsOf(m.data.postMentions, postIds), nil
+}
+
+func (m *Memory) CommentMentions(ctx context.Context, commentIds []int64) (map[int64][]Mention, error) {
+	defer m.rlock()()
+
+	return m.data.mentionsOf(m.data.commentMentions, commentIds), nil
+}
+
+func (m *Memory) Mentions(ctx context.Context, userId int64, last int, before MentionCursor) ([]MentionItem, error) {
+	defer m.rlock()()
+
+	var cursors []MentionCursor
+	for postId, mm := range m.data.postMentions {
+		if m.data.hidden(userId, m.data.posts[postId].UserId) {
+			continue
+		}
+
+		if at, ok := firstMentionOf(mm, userId); ok {
+			cursors = append(cursors, MentionCursor{CreatedAt: at, PostId: postId})
+		}
+	}
+
+	for commentId, mm := range m.data.commentMentions {
+		if m.data.hidden(userId, m.data.comments[commentId].UserId) {
+			continue
+		}
+
+		if at, ok := firstMentionOf(mm, userId); ok {
+			cursors = append(cursors, MentionCursor{CreatedAt: at, PostId: m.data.comments[commentId].PostId, CommentId: commentId})
+		}
+	}
+
+	sort.Slice(cursors, func(i, j int) bool {
+		return mentionCursorLess(cursors[j], cursors[i])
+	})
+
+	items := []MentionItem{}
+	for _, c := range cursors {
+		if len(items) == last {
+			break
+		}
+
+		if !before.CreatedAt.IsZero() && !mentionCursorLess(c, before) {
+			continue
+		}
+
+		item := MentionItem{CreatedAt: c.CreatedAt}
+		if c.CommentId == 0 {
+			post := m.data.withUser(m.data.posts[c.PostId])
+			item.Post = &post
+		} else {
+			comment := m.data.comments[c.CommentId]
+			user := m.data.userOf(comment.UserId)
+			comment.User = &user
+			_, comment.Liked = m.data.commentLikes[memoryPair{userId, comment.Id}]
+			item.Comment = &comment
+		}
+
+		items = append(items, item)
+	}
+
+	return items, nil
+}
+
+// replaceMentions turns mentions into rows replacing previous ones, users that stay mentioned
+// keep when they were first mentioned, it returns the rows and ids of newly mentioned users
+func (d *memoryData) replaceMentions(previous []memoryMention, mentions []Mention) ([]memoryMention, []int64) {
+	mentionedAt := map[int64]time.Time{}
+	for _, m := range previous {
+		if at, ok := mentionedAt[m.userId]; !ok || m.createdAt.Before(at) {
+			mentionedAt[m.userId] = m.createdAt
+		}
+	}
+
+	now := time.Now()
+	var (
+		rows       []memoryMention
+		newUserIds []int64
+	)
+	for _, m := range mentions {
+		at, ok := mentionedAt[m.User.Id]
+		if !ok {
+			at = now
+			mentionedAt[m.User.Id] = now
+			newUserIds = append(newUserIds, m.User.Id)
+		}
+
+		rows = append(rows, memoryMention{start: m.Start, end: m.End, userId: m.User.Id, createdAt: at})
+	}
+
+	sort.Slice(rows, func(i, j int) bool {
+		return rows[i].start < rows[j].start
+	})
+
+	return rows, newUserIds
+}
+
+func (d *memoryData) mentionsOf(rows map[int64][]memoryMention, ids []int64) map[int64][]Mention {
+	mentions := map[int64][]Mention{}
+	for _, id := range ids {
+		for _, m := range rows[id] {
+			mentions[id] = append(mentions[id], Mention{Start: m.start, End: m.end, User: d.userOf(m.userId)})
+		}
+	}
+
+	return mentions
+}
+
+// deleteUserMentions removes mentions of the user like on delete cascade would
+func (d *memoryData) deleteUserMentions(userId int64) {
+	for _, rows := range []map[int64][]memoryMention{d.postMentions, d.commentMentions} {
+		for id, mm := range rows {
+			kept := mm[:0:0]
+			for _, m := range mm {
+				if m.userId != userId {
+					kept = append(kept, m)
+				}
+			}
+
+			if len(kept) == 0 {
+				delete(rows, id)
+			} else {
+				rows[id] = kept
+			}
+		}
+	}
+}
+
+// firstMentionOf when user was first mentioned in rows, if at all
+func firstMentionOf(rows []memoryMention, userId int64) (time.Time, bool) {
+	var (
+		at    time.Time
+		found bool
+	)
+	for _, m := range rows {
+		if m.userId == userId && (!found || m.createdAt.Before(at)) {
+			at, found = m.createdAt, true
+		}
+	}
+
+	return at, found
+}
+
+// mentionCursorLess tells whether a comes before b in ascending order of mentions feed
+func mentionCursorLess(a, b MentionCursor) bool {
+	if !a.CreatedAt.Equal(b.CreatedAt) {
+		return a.CreatedAt.Before(b.CreatedAt)
+	}
+
+	if a.PostId != b.PostId {
+		return a.PostId < b.PostId
+	}
+
+	return a.CommentId < b.CommentId
+}
@@ -0,0 +1,208 @@
+package store
+
+import (
+	"context"
+	. "social/internal/models"
+	"sort"
+	"time"
+)
+
+func (m *Memory) Notify(ctx context.Context, userId, actorId int64, kind string, postId *int64) (int64, error) {
+	defer m.lock()()
+
+	if id, ok := m.data.unreadNotification(userId, kind, postId); ok {
+		n := m.data.notifications[id]
+		n.actorIds = append(removeId(n.actorIds, actorId), actorId)
+		n.IssuedAt = time.Now()
+		m.data.notifications[id] = n
+
+		return id, nil
+	}
+
+	id := m.data.nextId("notifications")
+	m.data.notifications[id] = memoryNotification{
+		Notification: Notification{
+			Id:       id,
+			UserId:   userId,
+			Kind:     kind,
+			PostId:   copyInt64(postId),
+			IssuedAt: time.Now(),
+		},
+		actorIds: []int64{actorId},
+	}
+
+	return id, nil
+}
+
+func (m *Memory) RetractNotification(ctx context.Context, userId, actorId int64, kind string, postId *int64) error {
+	defer m.lock()()
+
+	if id, ok := m.data.unreadNotification(userId, kind, postId); ok {
+		n := m.data.notifications[id]
+		n.actorIds = removeId(n.actorIds, actorId)
+		m.data.notifications[id] = n
+	}
+
+	for id, n := range m.data.notifications {
+		if n.UserId == userId && !n.Read && len(n.actorIds) == 0 {
+			delete(m.data.notifications, id)
+		}
+	}
+
+	return nil
+}
+
+func (m *Memory) Notification(ctx context.Context, notificationId int64) (Notification, error) {
+	defer m.rlock()()
+
+	n, ok := m.data.notifications[notificationId]
+	if !ok || len(m.data.visibleActors(n)) == 0 {
+		return Notification{}, ErrNotFound
+	}
+
+	return m.data.notification(n), nil
+}
+
+func (m *Memory) Notifications(ctx context.Context, userId int64, last int, before int64) ([]Notification, error) {
+	defer m.rlock()()
+
+	var cursor memoryNotification
+	if before != 0 {
+		var ok bool
+		if cursor, ok = m.data.notifications[before]; !ok || cursor.UserId != userId {
+			return []Notification{}, nil
+		}
+	}
+
+	var nn []memoryNotification
+	for _, n := range m.data.notifications {
+		if n.UserId != userId || len(m.data.visibleActors(n)) == 0 {
+			continue
+		}
+
+		if before != 0 && !notificationBefore(n, cursor) {
+			continue
+		}
+
+		nn = append(nn, n)
+	}
+
+	sort.Slice(nn, func(i, j int) bool {
+		return notificationBefore(nn[j], nn[i])
+	})
+
+	if len(nn) > last {
+		nn = nn[:last]
+	}
+
+	notifications := make([]Notification, 0, len(nn))
+	for _, n := range nn {
+		notifications = append(notifications, m.data.notification(n))
+	}
+
+	return notifications, nil
+}
+
+func (m *Memory) UnreadNotificationsCount(ctx context.Context, userId int64) (int, error) {
+	defer m.rlock()()
+
+	var count int
+	for _, n := range m.data.notifications {
+		if n.UserId == userId && !n.Read && len(m.data.visibleActors(n)) != 0 {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+func (m *Memory) MarkNotificationAsRead(ctx context.Context, userId, notificationId int64) error {
+	defer m.lock()()
+
+	n, ok := m.data.notifications[notificationId]
+	if !ok || n.UserId != userId {
+		return ErrNotFound
+	}
+
+	n.Read = true
+	m.data.notifications[notificationId] = n
+
+	return nil
+}
+
+func (m *Memory) MarkNotificationsAsRead(ctx context.Context, userId int64) error {
+	defer m.lock()()
+
+	for id, n := range m.data.notifications {
+		if n.UserId == userId && !n.Read {
+			n.Read = true
+			m.data.notifications[id] = n
+		}
+	}
+
+	return nil
+}
+
+// unreadNotification finds id of the single unread notification of that kind on that post
+func (d *memoryData) unreadNotification(userId int64, kind string, postId *int64) (int64, bool) {
+	for id, n := range d.notifications {
+		if n.UserId != userId || n.Kind != kind || n.Read {
+			continue
+		}
+
+		if (n.PostId == nil) != (postId == nil) || (postId != nil && *n.PostId != *postId) {
+			continue
+		}
+
+		return id, true
+	}
+
+	return 0, false
+}
+
+// notification fills actors of the notification, the most recent first
+func (d *memoryData) notification(n memoryNotification) Notification {
+	actorIds := d.visibleActors(n)
+	n.ActorsCount = len(actorIds)
+	n.Actors = []string{}
+	for i := len(actorIds) - 1; i >= 0 && len(n.Actors) < notificationActorsShown; i-- {
+		if u, ok := d.users[actorIds[i]]; ok {
+			n.Actors = append(n.Actors, u.Username)
+		}
+	}
+
+	return n.Notification
+}
+
+// notificationBefore reports whether a comes before b in (issued_at, id) order
+func notificationBefore(a, b memoryNotification) bool {
+	if !a.IssuedAt.Equal(b.IssuedAt) {
+		return a.IssuedAt.Before(b.IssuedAt)
+	}
+
+	return a.Id < b.Id
+}
+
+// removeId returns copy of ids without id
+func removeId(ids []int64, id int64) []int64 {
+	out := make([]int64, 0, len(ids))
+	for _, i := range ids {
+		if i != id {
+			out = append(out, i)
+		}
+	}
+
+	return out
+}
+
+// visibleActors actors of the notification leaving out users the notified user muted, blocked or was blocked by
+func (d *memoryData) visibleActors(n memoryNotification) []int64 {
+	var ids []int64
+	for _, actorId := range n.actorIds {
+		if !d.muted(n.UserId, actorId) && !d.hidden(n.UserId, actorId) {
+			ids = append(ids, actorId)
+		}
+	}
+
+	return ids
+}
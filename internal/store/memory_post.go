@@ -0,0 +1,368 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	. "social/internal/models"
+	"sort"
+	"time"
+)
+
+func (m *Memory) CreatePost(ctx context.Context, userId int64, content string, spoilerOf *string, nsfw bool, quoteOf *int64) (Post, error) {
+	defer m.lock()()
+
+	if _, ok := m.data.users[userId]; !ok {
+		return Post{}, ErrNotFound
+	}
+
+	if quoteOf != nil {
+		if _, ok := m.data.posts[*quoteOf]; !ok {
+			return Post{}, ErrNotFound
+		}
+	}
+
+	post := Post{
+		Id:        m.data.nextId("posts"),
+		UserId:    userId,
+		Content:   content,
+		SpoilerOf: copyString(spoilerOf),
+		NSFW:      nsfw,
+		CreateAt:  time.Now(),
+		QuoteOfId: copyInt64(quoteOf),
+	}
+	m.data.posts[post.Id] = post
+
+	return post, nil
+}
+
+func (m *Memory) Post(ctx context.Context, postId int64) (Post, error) {
+	defer m.rlock()()
+
+	post, ok := m.data.posts[postId]
+	if !ok {
+		return Post{}, ErrNotFound
+	}
+
+	return m.data.withUser(post), nil
+}
+
+func (m *Memory) PostsByIds(ctx context.Context, postIds []int64) (map[int64]Post, error) {
+	defer m.rlock()()
+
+	posts := map[int64]Post{}
+	for _, id := range postIds {
+		if post, ok := m.data.posts[id]; ok {
+			posts[id] = m.data.withUser(post)
+		}
+	}
+
+	return posts, nil
+}
+
+func (m *Memory) PostExists(ctx context.Context, postId int64) (bool, error) {
+	defer m.rlock()()
+
+	_, ok := m.data.posts[postId]
+	return ok, nil
+}
+
+func (m *Memory) Posts(ctx context.Context, viewerId, userId int64, limit int) ([]Post, error) {
+	defer m.rlock()()
+
+	var posts []Post
+	for _, post := range m.data.posts {
+		if m.data.hidden(viewerId, post.UserId) {
+			continue
+		}
+
+		if userId == 0 || post.UserId == userId {
+			posts = append(posts, m.data.withUser(post))
+		}
+	}
+
+	sort.Slice(posts, func(i, j int) bool {
+		if !posts[i].CreateAt.Equal(posts[j].CreateAt) {
+			return posts[i].CreateAt.After(posts[j].CreateAt)
+		}
+
+		return posts[i].Id > posts[j].Id
+	})
+
+	if len(posts) > limit {
+		posts = posts[:limit]
+	}
+
+	return posts, nil
+}
+
+func (m *Memory) LockPost(ctx context.Context, postId int64) (int64, error) {
+	defer m.rlock()()
+
+	post, ok := m.data.posts[postId]
+	if !ok {
+		return 0, ErrNotFound
+	}
+
+	return post.UserId, nil
+}
+
+func (m *Memory) AddPostRevision(ctx context.Context, postId int64) error {
+	defer m.lock()()
+
+	post, ok := m.data.posts[postId]
+	if !ok {
+		return nil
+	}
+
+	m.data.revisions = append(m.data.revisions, PostRevision{
+		Id:        m.data.nextId("post_revisions"),
+		PostId:    postId,
+		Content:   post.Content,
+		SpoilerOf: post.SpoilerOf,
+		NSFW:      post.NSFW,
+		CreatedAt: time.Now(),
+	})
+
+	return nil
+}
+
+func (m *Memory) UpdatePost(ctx context.Context, postId int64, content string, spoilerOf *string, nsfw bool) (Post, error) {
+	defer m.lock()()
+
+	post, ok := m.data.posts[postId]
+	if !ok {
+		return Post{}, ErrNotFound
+	}
+
+	now := time.Now()
+	post.Content = content
+	post.SpoilerOf = copyString(spoilerOf)
+	post.NSFW = nsfw
+	post.EditedAt = &now
+	m.data.posts[postId] = post
+
+	return post, nil
+}
+
+func (m *Memory) DeletePost(ctx context.Context, postId int64) error {
+	defer m.lock()()
+
+	m.data.deletePost(postId)
+	return nil
+}
+
+func (m *Memory) PostRevisions(ctx context.Context, postId int64) ([]PostRevision, error) {
+	defer m.rlock()()
+
+	revisions := []PostRevision{}
+	for i := len(m.data.revisions) - 1; i >= 0; i-- {
+		if m.data.revisions[i].PostId == postId {
+			revisions = append(revisions, m.data.revisions[i])
+		}
+	}
+
+	return revisions, nil
+}
+
+func (m *Memory) IsPostLiked(ctx context.Context, userId, postId int64) (bool, error) {
+	defer m.rlock()()
+
+	_, ok := m.data.postLikes[memoryPair{userId, postId}]
+	return ok, nil
+}
+
+func (m *Memory) LikePost(ctx context.Context, userId, postId int64) (int, int64, error) {
+	defer m.lock()()
+
+	post, ok := m.data.posts[postId]
+	if !ok {
+		return 0, 0, ErrNotFound
+	}
+
+	key := memoryPair{userId, postId}
+	if _, ok = m.data.postLikes[key]; ok {
+		return 0, 0, fmt.Errorf("could not insert like for post: already liked")
+	}
+
+	m.data.postLikes[key] = struct{}{}
+	post.LikesCount++
+	m.data.posts[postId] = post
+
+	return post.LikesCount, post.UserId, nil
+}
+
+func (m *Memory) UnlikePost(ctx context.Context, userId, postId int64) (int, int64, error) {
+	defer m.lock()()
+
+	post, ok := m.data.posts[postId]
+	if !ok {
+		return 0, 0, ErrNotFound
+	}
+
+	key := memoryPair{userId, postId}
+	if _, ok = m.data.postLikes[key]; ok {
+		delete(m.data.postLikes, key)
+		post.LikesCount--
+		m.data.posts[postId] = post
+	}
+
+	return post.LikesCount, post.UserId, nil
+}
+
+func (m *Memory) IsPostReposted(ctx context.Context, userId, postId int64) (bool, error) {
+	defer m.rlock()()
+
+	_, ok := m.data.reposts[memoryPair{userId, postId}]
+	return ok, nil
+}
+
+func (m *Memory) Repost(ctx context.Context, userId, postId int64) (int, int64, error) {
+	defer m.lock()()
+
+	post, ok := m.data.posts[postId]
+	if !ok {
+		return 0, 0, ErrNotFound
+	}
+
+	key := memoryPair{userId, postId}
+	if _, ok = m.data.reposts[key]; ok {
+		return 0, 0, fmt.Errorf("could not insert repost: already reposted")
+	}
+
+	m.data.reposts[key] = time.Now()
+	post.RepostsCount++
+	m.data.posts[postId] = post
+
+	return post.RepostsCount, post.UserId, nil
+}
+
+func (m *Memory) Unrepost(ctx context.Context, userId, postId int64) (int, int64, error) {
+	defer m.lock()()
+
+	post, ok := m.data.posts[postId]
+	if !ok {
+		return 0, 0, ErrNotFound
+	}
+
+	key := memoryPair{userId, postId}
+	if _, ok = m.data.reposts[key]; ok {
+		delete(m.data.reposts, key)
+		post.RepostsCount--
+		m.data.posts[postId] = post
+	}
+
+	timeline := m.data.timeline[:0:0]
+	for _, item := range m.data.timeline {
+		if item.PostId != postId || item.RepostedBy == nil || item.RepostedBy.Id != userId {
+			timeline = append(timeline, item)
+			continue
+		}
+
+		// fanout skipped timelines having the post already, so other reposts may have no item of their own
+		var (
+			reposterId int64
+			latest     time.Time
+		)
+		for key, at := range m.data.reposts {
+			_, following := m.data.follows[memoryPair{item.UserId, key.a}]
+			if key.b != postId || (key.a != item.UserId && !following) || m.data.muted(item.UserId, key.a) {
+				continue
+			}
+
+			if reposterId == 0 || at.After(latest) {
+				reposterId, latest = key.a, at
+			}
+		}
+
+		if reposterId != 0 {
+			item.RepostedBy = &User{Id: reposterId}
+			timeline = append(timeline, item)
+		}
+	}
+	m.data.timeline = timeline
+
+	return post.RepostsCount, post.UserId, nil
+}
+
+func (m *Memory) IncrementCommentsCount(ctx context.Context, postId int64) (int64, error) {
+	defer m.lock()()
+
+	post, ok := m.data.posts[postId]
+	if !ok {
+		return 0, ErrNotFound
+	}
+
+	post.CommentsCount++
+	m.data.posts[postId] = post
+
+	return post.UserId, nil
+}
+
+func (d *memoryData) withUser(post Post) Post {
+	post.User = d.userOf(post.UserId)
+	return post
+}
+
+// deletePost removes post along with everything that hangs off it like on delete cascade would
+func (d *memoryData) deletePost(postId int64) {
+	if _, ok := d.posts[postId]; !ok {
+		return
+	}
+
+	delete(d.posts, postId)
+	delete(d.hashtags, postId)
+	delete(d.postMentions, postId)
+	for id, m := range d.media {
+		if m.PostId != nil && *m.PostId == postId {
+			delete(d.media, id)
+		}
+	}
+
+	for key := range d.postLikes {
+		if key.b == postId {
+			delete(d.postLikes, key)
+		}
+	}
+
+	for key := range d.reposts {
+		if key.b == postId {
+			delete(d.reposts, key)
+		}
+	}
+
+	// quotes stay, like on delete set null
+	for id, post := range d.posts {
+		if post.QuoteOfId != nil && *post.QuoteOfId == postId {
+			post.QuoteOfId = nil
+			d.posts[id] = post
+		}
+	}
+
+	timeline := d.timeline[:0:0]
+	for _, item := range d.timeline {
+		if item.PostId != postId {
+			timeline = append(timeline, item)
+		}
+	}
+	d.timeline = timeline
+
+	revisions := d.revisions[:0:0]
+	for _, revision := range d.revisions {
+		if revision.PostId != postId {
+			revisions = append(revisions, revision)
+		}
+	}
+	d.revisions = revisions
+
+	for id, c := range d.comments {
+		if c.PostId == postId {
+			d.deleteComment(id)
+		}
+	}
+
+	for id, n := range d.notifications {
+		if n.PostId != nil && *n.PostId == postId {
+			delete(d.notifications, id)
+		}
+	}
+}
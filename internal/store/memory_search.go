@@ -0,0 +1,144 @@
+package store
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// SearchPosts matches words like the simple text search config does, relevance is number of matched terms
+// and phrases, it is close to but not the same as what Postgres ranks
+func (m *Memory) SearchPosts(ctx context.Context, search PostSearch, limit int, afterScore float64, afterId int64) ([]PostMatch, error) {
+	defer m.rlock()()
+
+	var matches []PostMatch
+	for _, post := range m.data.posts {
+		if (search.AuthorId != 0 && post.UserId != search.AuthorId) ||
+			(!search.From.IsZero() && post.CreateAt.Before(search.From)) ||
+			(!search.To.IsZero() && !post.CreateAt.Before(search.To)) ||
+			(search.Spoiler != nil && (post.SpoilerOf != nil) != *search.Spoiler) ||
+			(search.ExcludeNSFW && post.NSFW) ||
+			m.data.hidden(search.ViewerId, post.UserId) {
+			continue
+		}
+
+		hits, spans := matchTerms(post.Content, search.Terms)
+		if hits == 0 {
+			continue
+		}
+
+		age := search.AsOf.Sub(post.CreateAt).Seconds()
+		if age < 0 {
+			age = 0
+		}
+
+		score := float64(hits) / 10 / (1 + age/searchRecencyScale.Seconds())
+		if afterId != 0 && (score > afterScore || (score == afterScore && post.Id >= afterId)) {
+			continue
+		}
+
+		matches = append(matches, PostMatch{Post: m.data.withUser(post), Score: score, Snippet: markSpans(post.Content, spans)})
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Score != matches[j].Score {
+			return matches[i].Score > matches[j].Score
+		}
+
+		return matches[i].Post.Id > matches[j].Post.Id
+	})
+
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+
+	if matches == nil {
+		matches = []PostMatch{}
+	}
+
+	return matches, nil
+}
+
+// matchTerms counts occurrences of terms in content and returns byte spans of matched words,
+// 0 unless every term occurs
+func matchTerms(content string, terms []SearchTerm) (int, [][2]int) {
+	type word struct {
+		text       string
+		start, end int
+	}
+
+	var words []word
+	start := -1
+	for i, r := range content + " " {
+		isWordRune := unicode.IsLetter(r) || unicode.IsDigit(r)
+		if isWordRune && start < 0 {
+			start = i
+		} else if !isWordRune && start >= 0 {
+			words = append(words, word{strings.ToLower(content[start:i]), start, i})
+			start = -1
+		}
+	}
+
+	var (
+		hits  int
+		spans [][2]int
+	)
+	for _, term := range terms {
+		if len(term.Words) == 0 {
+			continue
+		}
+
+		found := false
+		for i := 0; i+len(term.Words) <= len(words); i++ {
+			ok := true
+			for k, w := range term.Words {
+				last := k == len(term.Words)-1
+				if words[i+k].text != w && !(last && term.Prefix && strings.HasPrefix(words[i+k].text, w)) {
+					ok = false
+					break
+				}
+			}
+
+			if !ok {
+				continue
+			}
+
+			found = true
+			hits++
+			for k := range term.Words {
+				spans = append(spans, [2]int{words[i+k].start, words[i+k].end})
+			}
+		}
+
+		if !found {
+			return 0, nil
+		}
+	}
+
+	return hits, spans
+}
+
+// markSpans wraps spans of content in SnippetStart and SnippetStop
+func markSpans(content string, spans [][2]int) string {
+	sort.Slice(spans, func(i, j int) bool {
+		return spans[i][0] < spans[j][0]
+	})
+
+	var b strings.Builder
+	last := 0
+	for _, span := range spans {
+		if span[0] < last {
+			continue
+		}
+
+		b.WriteString(content[last:span[0]])
+		b.WriteString(SnippetStart)
+		b.WriteString(content[span[0]:span[1]])
+		b.WriteString(SnippetStop)
+		last = span[1]
+	}
+	b.WriteString(content[last:])
+
+	return b.String()
+}
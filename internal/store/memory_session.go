@@ -0,0 +1,138 @@
+package store
+
+import (
+	"context"
+	. "social/internal/models"
+	"sort"
+	"time"
+)
+
+func (m *Memory) CreateSession(ctx context.Context, userId int64, session Session, refreshTokenHash string) error {
+	defer m.lock()()
+
+	now := time.Now()
+	session.CreatedAt = now
+	session.LastSeenAt = now
+	session.Current = false
+	m.data.sessions[session.Id] = memorySession{
+		Session:          session,
+		userId:           userId,
+		refreshTokenHash: refreshTokenHash,
+	}
+
+	return nil
+}
+
+func (m *Memory) DeleteExpiredSessions(ctx context.Context, userId int64) error {
+	defer m.lock()()
+
+	now := time.Now()
+	for id, s := range m.data.sessions {
+		if s.userId == userId && s.ExpiresAt.Before(now) {
+			delete(m.data.sessions, id)
+		}
+	}
+
+	return nil
+}
+
+func (m *Memory) RotateRefreshToken(ctx context.Context, refreshTokenHash, newRefreshTokenHash string) (string, User, error) {
+	defer m.lock()()
+
+	now := time.Now()
+	for id, s := range m.data.sessions {
+		if s.refreshTokenHash != refreshTokenHash || !s.ExpiresAt.After(now) {
+			continue
+		}
+
+		s.previousRefreshTokenHash = s.refreshTokenHash
+		s.refreshTokenHash = newRefreshTokenHash
+		s.LastSeenAt = now
+		m.data.sessions[id] = s
+
+		return id, m.data.userOf(s.userId), nil
+	}
+
+	return "", User{}, ErrNotFound
+}
+
+func (m *Memory) RevokeRotatedRefreshToken(ctx context.Context, refreshTokenHash string) (string, error) {
+	defer m.lock()()
+
+	for id, s := range m.data.sessions {
+		if s.previousRefreshTokenHash == refreshTokenHash {
+			delete(m.data.sessions, id)
+			return id, nil
+		}
+	}
+
+	return "", ErrNotFound
+}
+
+func (m *Memory) Sessions(ctx context.Context, userId int64) ([]Session, error) {
+	defer m.rlock()()
+
+	now := time.Now()
+	var sessions []Session
+	for _, s := range m.data.sessions {
+		if s.userId == userId && s.ExpiresAt.After(now) {
+			sessions = append(sessions, s.Session)
+		}
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LastSeenAt.After(sessions[j].LastSeenAt)
+	})
+
+	return sessions, nil
+}
+
+func (m *Memory) SessionLastSeenAt(ctx context.Context, userId int64, sessionId string) (time.Time, error) {
+	defer m.rlock()()
+
+	s, ok := m.data.sessions[sessionId]
+	if !ok || s.userId != userId || !s.ExpiresAt.After(time.Now()) {
+		return time.Time{}, ErrNotFound
+	}
+
+	return s.LastSeenAt, nil
+}
+
+func (m *Memory) TouchSession(ctx context.Context, sessionId, ip string) error {
+	defer m.lock()()
+
+	s, ok := m.data.sessions[sessionId]
+	if !ok {
+		return nil
+	}
+
+	s.LastSeenAt = time.Now()
+	if ip != "" {
+		s.IP = ip
+	}
+	m.data.sessions[sessionId] = s
+
+	return nil
+}
+
+func (m *Memory) DeleteSession(ctx context.Context, userId int64, sessionId string) error {
+	defer m.lock()()
+
+	if s, ok := m.data.sessions[sessionId]; ok && s.userId == userId {
+		delete(m.data.sessions, sessionId)
+	}
+
+	return nil
+}
+
+func (m *Memory) DeleteSessions(ctx context.Context, userId int64) error {
+	defer m.lock()()
+
+	for id, s := range m.data.sessions {
+		if s.userId == userId {
+			delete(m.data.sessions, id)
+		}
+	}
+
+	return nil
+}
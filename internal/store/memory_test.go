@@ -0,0 +1,407 @@
+package store
+
+import (
+	"context"
+	"errors"
+	. "social/internal/models"
+	"testing"
+)
+
+// newTestUsers creates users with usernames and returns their ids in the same order
+func newTestUsers(t *testing.T, m *Memory, usernames ...string) []int64 {
+	t.Helper()
+
+	ids := make([]int64, 0, len(usernames))
+	for _, username := range usernames {
+		id, err := m.CreateUser(context.Background(), username+"@example.org", username)
+		if err != nil {
+			t.Fatalf("could not create user %s: %v", username, err)
+		}
+
+		ids = append(ids, id)
+	}
+
+	return ids
+}
+
+func TestMemoryTx(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+	ids := newTestUsers(t, m, "alice", "bob")
+
+	errRollback := errors.New("rollback")
+	err := m.Tx(ctx, func(tx Store) error {
+		if _, err := tx.Follow(ctx, ids[0], ids[1]); err != nil {
+			return err
+		}
+
+		// nested Tx joins the outer one
+		if err := tx.Tx(ctx, func(tx Store) error {
+			_, err := tx.CreateUser(ctx, "carol@example.org", "carol")
+			return err
+		}); err != nil {
+			return err
+		}
+
+		following, err := tx.IsFollowing(ctx, ids[0], ids[1])
+		if err != nil || !following {
+			t.Errorf("want follow visible within transaction, got %v, %v", following, err)
+		}
+
+		return errRollback
+	})
+	if !errors.Is(err, errRollback) {
+		t.Fatalf("want error of fn returned, got %v", err)
+	}
+
+	if following, _ := m.IsFollowing(ctx, ids[0], ids[1]); following {
+		t.Error("want follow rolled back")
+	}
+
+	if _, err = m.UserByUsername(ctx, "carol"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("want user created in nested Tx rolled back, got %v", err)
+	}
+
+	profile, err := m.UserProfile(ctx, 0, "bob")
+	if err != nil {
+		t.Fatalf("could not get profile: %v", err)
+	}
+
+	if profile.FollowersCount != 0 {
+		t.Errorf("want followers count rolled back, got %d", profile.FollowersCount)
+	}
+
+	err = m.Tx(ctx, func(tx Store) error {
+		_, err := tx.Follow(ctx, ids[0], ids[1])
+		return err
+	})
+	if err != nil {
+		t.Fatalf("could not follow: %v", err)
+	}
+
+	if following, _ := m.IsFollowing(ctx, ids[0], ids[1]); !following {
+		t.Error("want follow committed")
+	}
+}
+
+func TestMemoryTimeline(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+	ids := newTestUsers(t, m, "alice", "bob", "carol")
+	alice, bob, carol := ids[0], ids[1], ids[2]
+
+	for _, follower := range []int64{bob, carol} {
+		if _, err := m.Follow(ctx, follower, alice); err != nil {
+			t.Fatalf("could not follow: %v", err)
+		}
+	}
+
+	var postIds []int64
+	for _, content := range []string{"first", "second", "third"} {
+		post, err := m.CreatePost(ctx, alice, content, nil, false, nil)
+		if err != nil {
+			t.Fatalf("could not create post: %v", err)
+		}
+
+		postIds = append(postIds, post.Id)
+	}
+
+	if _, err := m.AddTimelineItem(ctx, bob, postIds[0]); err != nil {
+		t.Fatalf("could not add timeline item: %v", err)
+	}
+
+	if _, err := m.AddTimelineItem(ctx, bob, postIds[0]); err == nil {
+		t.Error("want adding post twice to the same timeline to fail like the unique constraint does")
+	}
+
+	for _, postId := range postIds {
+		for i := 0; i < 2; i++ {
+			if _, err := m.FanoutPost(ctx, postId, alice); err != nil {
+				t.Fatalf("could not fan out post: %v", err)
+			}
+		}
+	}
+
+	for _, userId := range []int64{bob, carol} {
+		timeline, err := m.Timeline(ctx, userId, 10, 0, 0)
+		if err != nil {
+			t.Fatalf("could not get timeline: %v", err)
+		}
+
+		if len(timeline) != len(postIds) {
+			t.Fatalf("want each post once in timeline of %d, got %+v", userId, timeline)
+		}
+
+		for i, item := range timeline {
+			if want := postIds[len(postIds)-1-i]; item.PostId != want {
+				t.Errorf("want post %d at %d, newest first, got %d", want, i, item.PostId)
+			}
+		}
+	}
+
+	if timeline, _ := m.Timeline(ctx, alice, 10, 0, 0); len(timeline) != 0 {
+		t.Errorf("want fan out to leave author timeline alone, got %+v", timeline)
+	}
+
+	newest, err := m.Timeline(ctx, carol, 1, 0, 0)
+	if err != nil || len(newest) != 1 {
+		t.Fatalf("could not get first page: %+v, %v", newest, err)
+	}
+
+	older, err := m.Timeline(ctx, carol, 10, newest[0].Id, 0)
+	if err != nil {
+		t.Fatalf("could not get next page: %v", err)
+	}
+
+	if len(older) != 2 || older[0].Id >= newest[0].Id || older[1].Id >= older[0].Id {
+		t.Errorf("want two older items, newest first, got %+v", older)
+	}
+
+	missed, err := m.Timeline(ctx, carol, 10, 0, older[1].Id)
+	if err != nil {
+		t.Fatalf("could not get items after: %v", err)
+	}
+
+	if len(missed) != 2 || missed[0].Id != older[0].Id || missed[1].Id != newest[0].Id {
+		t.Errorf("want two newer items, oldest first, got %+v", missed)
+	}
+}
+
+func TestMemoryNotifications(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+	ids := newTestUsers(t, m, "alice", "bob", "carol", "dave")
+	alice, bob, carol, dave := ids[0], ids[1], ids[2], ids[3]
+
+	post, err := m.CreatePost(ctx, alice, "hello", nil, false, nil)
+	if err != nil {
+		t.Fatalf("could not create post: %v", err)
+	}
+
+	var notificationIds []int64
+	for _, actorId := range []int64{bob, carol, dave, bob} {
+		id, err := m.Notify(ctx, alice, actorId, "like", &post.Id)
+		if err != nil {
+			t.Fatalf("could not notify: %v", err)
+		}
+
+		notificationIds = append(notificationIds, id)
+	}
+
+	for _, id := range notificationIds[1:] {
+		if id != notificationIds[0] {
+			t.Fatalf("want likes on the same post coalesced, got ids %v", notificationIds)
+		}
+	}
+
+	if _, err = m.Notify(ctx, alice, bob, "follow", nil); err != nil {
+		t.Fatalf("could not notify: %v", err)
+	}
+
+	notifications, err := m.Notifications(ctx, alice, 10, 0)
+	if err != nil {
+		t.Fatalf("could not get notifications: %v", err)
+	}
+
+	if len(notifications) != 2 || notifications[0].Kind != "follow" {
+		t.Fatalf("want follow and like notifications, newest first, got %+v", notifications)
+	}
+
+	like := notifications[1]
+	if like.ActorsCount != 3 || len(like.Actors) != notificationActorsShown || like.Actors[0] != "bob" || like.Actors[1] != "dave" {
+		t.Errorf("want 3 actors with bob and dave shown, most recent first, got %+v", like)
+	}
+
+	if count, _ := m.UnreadNotificationsCount(ctx, alice); count != 2 {
+		t.Errorf("want 2 unread notifications, got %d", count)
+	}
+
+	if err = m.MarkNotificationAsRead(ctx, bob, like.Id); !errors.Is(err, ErrNotFound) {
+		t.Errorf("marking notification of someone else: want ErrNotFound, got %v", err)
+	}
+
+	if err = m.MarkNotificationAsRead(ctx, alice, like.Id); err != nil {
+		t.Fatalf("could not mark notification as read: %v", err)
+	}
+
+	id, err := m.Notify(ctx, alice, carol, "like", &post.Id)
+	if err != nil {
+		t.Fatalf("could not notify: %v", err)
+	}
+
+	if id == like.Id {
+		t.Error("want new notification once the previous one was read")
+	}
+
+	if err = m.RetractNotification(ctx, alice, carol, "like", &post.Id); err != nil {
+		t.Fatalf("could not retract notification: %v", err)
+	}
+
+	if _, err = m.Notification(ctx, id); !errors.Is(err, ErrNotFound) {
+		t.Errorf("want notification left without actors deleted, got %v", err)
+	}
+
+	if read, err := m.Notification(ctx, like.Id); err != nil || read.ActorsCount != 3 {
+		t.Errorf("want read notification left alone, got %+v, %v", read, err)
+	}
+
+	if count, _ := m.UnreadNotificationsCount(ctx, alice); count != 1 {
+		t.Errorf("want 1 unread notification, got %d", count)
+	}
+}
+
+func TestMemoryUnrepost(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+	ids := newTestUsers(t, m, "alice", "bob", "carol", "dave")
+	alice, bob, carol, dave := ids[0], ids[1], ids[2], ids[3]
+
+	for _, followeeId := range []int64{alice, bob} {
+		if _, err := m.Follow(ctx, carol, followeeId); err != nil {
+			t.Fatalf("could not follow: %v", err)
+		}
+	}
+
+	post, err := m.CreatePost(ctx, dave, "post", nil, false, nil)
+	if err != nil {
+		t.Fatalf("could not create post: %v", err)
+	}
+
+	for _, reposterId := range []int64{alice, bob} {
+		if _, _, err = m.Repost(ctx, reposterId, post.Id); err != nil {
+			t.Fatalf("could not repost: %v", err)
+		}
+
+		if _, err = m.FanoutRepost(ctx, post.Id, reposterId); err != nil {
+			t.Fatalf("could not fan out repost: %v", err)
+		}
+	}
+
+	reposterOf := func(userId int64) int64 {
+		t.Helper()
+
+		timeline, err := m.Timeline(ctx, userId, 10, 0, 0)
+		if err != nil || len(timeline) > 1 {
+			t.Fatalf("want at most one item, got %+v, %v", timeline, err)
+		}
+
+		if len(timeline) == 0 {
+			return 0
+		}
+
+		return timeline[0].RepostedBy.Id
+	}
+
+	// carol already had it from alice when bob reposted
+	if got := reposterOf(carol); got != alice {
+		t.Fatalf("want item of carol from alice, got %d", got)
+	}
+
+	if err = m.Mute(ctx, carol, bob); err != nil {
+		t.Fatalf("could not mute: %v", err)
+	}
+
+	if _, _, err = m.Unrepost(ctx, alice, post.Id); err != nil {
+		t.Fatalf("could not unrepost: %v", err)
+	}
+
+	if got := reposterOf(carol); got != 0 {
+		t.Errorf("want no item credited to muted bob, got %d", got)
+	}
+
+	if got := reposterOf(bob); got != bob {
+		t.Errorf("want bob to keep own repost, got %d", got)
+	}
+
+	if err = m.Unmute(ctx, carol, bob); err != nil {
+		t.Fatalf("could not unmute: %v", err)
+	}
+
+	if _, _, err = m.Repost(ctx, alice, post.Id); err != nil {
+		t.Fatalf("could not repost: %v", err)
+	}
+
+	if _, err = m.FanoutRepost(ctx, post.Id, alice); err != nil {
+		t.Fatalf("could not fan out repost: %v", err)
+	}
+
+	if _, _, err = m.Unrepost(ctx, alice, post.Id); err != nil {
+		t.Fatalf("could not unrepost: %v", err)
+	}
+
+	if got := reposterOf(carol); got != bob {
+		t.Errorf("want item of carol credited to bob, got %d", got)
+	}
+}
+
+func TestMemoryDeleteUser(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+	ids := newTestUsers(t, m, "alice", "bob", "carol")
+	alice, bob, carol := ids[0], ids[1], ids[2]
+
+	for _, f := range [][2]int64{{bob, alice}, {alice, bob}, {carol, alice}} {
+		if _, err := m.Follow(ctx, f[0], f[1]); err != nil {
+			t.Fatalf("could not follow: %v", err)
+		}
+	}
+
+	post, err := m.CreatePost(ctx, alice, "post", nil, false, nil)
+	if err != nil {
+		t.Fatalf("could not create post: %v", err)
+	}
+
+	comment, err := m.CreateComment(ctx, Comment{UserId: alice, PostId: post.Id, Content: "comment"})
+	if err != nil {
+		t.Fatalf("could not create comment: %v", err)
+	}
+
+	if _, _, err = m.LikePost(ctx, bob, post.Id); err != nil {
+		t.Fatalf("could not like post: %v", err)
+	}
+
+	if _, _, err = m.Repost(ctx, bob, post.Id); err != nil {
+		t.Fatalf("could not repost: %v", err)
+	}
+
+	if _, _, err = m.LikeComment(ctx, bob, comment.Id); err != nil {
+		t.Fatalf("could not like comment: %v", err)
+	}
+
+	// drift counts below the rows they count, as if an update was lost
+	a := m.data.users[alice]
+	a.FollowersCount = 0
+	m.data.users[alice] = a
+	p := m.data.posts[post.Id]
+	p.LikesCount = 0
+	m.data.posts[post.Id] = p
+
+	if _, err = m.DeleteUser(ctx, bob); err != nil {
+		t.Fatalf("could not delete user: %v", err)
+	}
+
+	if _, err = m.DeleteUser(ctx, bob); !errors.Is(err, ErrNotFound) {
+		t.Errorf("want deleting user twice not found, got %v", err)
+	}
+
+	profile, err := m.UserProfile(ctx, 0, "alice")
+	if err != nil {
+		t.Fatalf("could not get profile: %v", err)
+	}
+
+	if profile.FollowersCount != 0 || profile.FolloweesCount != 0 {
+		t.Errorf("want follow counts of alice at 0, never below, got %d, %d", profile.FollowersCount, profile.FolloweesCount)
+	}
+
+	if p = m.data.posts[post.Id]; p.LikesCount != 0 || p.RepostsCount != 0 {
+		t.Errorf("want likes and reposts of post at 0, never below, got %d, %d", p.LikesCount, p.RepostsCount)
+	}
+
+	if c := m.data.comments[comment.Id]; c.LikesCount != 0 {
+		t.Errorf("want likes of comment at 0, got %d", c.LikesCount)
+	}
+
+	if following, _ := m.IsFollowing(ctx, carol, alice); !following {
+		t.Error("want follows between remaining users kept")
+	}
+}
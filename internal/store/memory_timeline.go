@@ -0,0 +1,207 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	. "social/internal/models"
+	"sort"
+	"time"
+)
+
+func (m *Memory) AddTimelineItem(ctx context.Context, userId, postId int64) (int64, error) {
+	defer m.lock()()
+
+	if _, ok := m.data.posts[postId]; !ok {
+		return 0, ErrNotFound
+	}
+
+	for _, item := range m.data.timeline {
+		if item.UserId == userId && item.PostId == postId {
+			return 0, fmt.Errorf("cannot insert timelineItem: post already in timeline")
+		}
+	}
+
+	return m.data.addTimelineItem(userId, postId, 0).Id, nil
+}
+
+func (m *Memory) FanoutPost(ctx context.Context, postId, authorId int64) ([]TimelineItem, error) {
+	defer m.lock()()
+
+	if _, ok := m.data.posts[postId]; !ok {
+		return nil, ErrNotFound
+	}
+
+	has := map[int64]bool{}
+	for _, item := range m.data.timeline {
+		if item.PostId == postId {
+			has[item.UserId] = true
+		}
+	}
+
+	var items []TimelineItem
+	for f := range m.data.follows {
+		if f.b == authorId && !has[f.a] && !m.data.muted(f.a, authorId) {
+			items = append(items, m.data.addTimelineItem(f.a, postId, 0))
+		}
+	}
+
+	return items, nil
+}
+
+func (m *Memory) FanoutRepost(ctx context.Context, postId, reposterId int64) ([]TimelineItem, error) {
+	defer m.lock()()
+
+	if _, ok := m.data.posts[postId]; !ok {
+		return nil, ErrNotFound
+	}
+
+	has := map[int64]bool{}
+	for _, item := range m.data.timeline {
+		if item.PostId == postId {
+			has[item.UserId] = true
+		}
+	}
+
+	authorId := m.data.posts[postId].UserId
+	userIds := []int64{reposterId}
+	for f := range m.data.follows {
+		if f.b != reposterId || m.data.muted(f.a, reposterId) || m.data.muted(f.a, authorId) ||
+			m.data.hidden(f.a, authorId) {
+			continue
+		}
+
+		userIds = append(userIds, f.a)
+	}
+
+	var items []TimelineItem
+	for _, userId := range userIds {
+		if !has[userId] {
+			items = append(items, m.data.addTimelineItem(userId, postId, reposterId))
+		}
+	}
+
+	return items, nil
+}
+
+func (m *Memory) Timeline(ctx context.Context, userId int64, last int, before, after int64) ([]TimelineItem, error) {
+	defer m.rlock()()
+
+	timeline := make([]TimelineItem, 0, last)
+	add := func(item TimelineItem) bool {
+		if item.UserId != userId || (before != 0 && item.Id >= before) || item.Id <= after {
+			return true
+		}
+
+		authorId := m.data.posts[item.PostId].UserId
+		if m.data.hidden(userId, authorId) || m.data.muted(userId, authorId) {
+			return true
+		}
+
+		if item.RepostedBy != nil && (m.data.hidden(userId, item.RepostedBy.Id) || m.data.muted(userId, item.RepostedBy.Id)) {
+			return true
+		}
+
+		item.Post = m.data.withUser(m.data.posts[item.PostId])
+		_, item.Post.Liked = m.data.postLikes[memoryPair{userId, item.PostId}]
+		_, item.Post.Reposted = m.data.reposts[memoryPair{userId, item.PostId}]
+		if item.RepostedBy != nil {
+			reposter := m.data.userOf(item.RepostedBy.Id)
+			item.RepostedBy = &reposter
+		}
+		timeline = append(timeline, item)
+
+		return len(timeline) < last
+	}
+
+	// items are kept in id order
+	if after != 0 {
+		for _, item := range m.data.timeline {
+			if !add(item) {
+				break
+			}
+		}
+	} else {
+		for i := len(m.data.timeline) - 1; i >= 0; i-- {
+			if !add(m.data.timeline[i]) {
+				break
+			}
+		}
+	}
+
+	return timeline, nil
+}
+
+// addTimelineItem adds post to timeline of user, brought there by repost of reposter unless it is 0
+func (d *memoryData) addTimelineItem(userId, postId, reposterId int64) TimelineItem {
+	item := TimelineItem{Id: d.nextId("timeline"), UserId: userId, PostId: postId}
+	if reposterId != 0 {
+		item.RepostedBy = &User{Id: reposterId}
+	}
+	d.timeline = append(d.timeline, item)
+
+	return item
+}
+
+func (m *Memory) RebuildTimeline(ctx context.Context, userId int64, limit int) (int, error) {
+	defer m.lock()()
+
+	timeline := m.data.timeline[:0:0]
+	for _, item := range m.data.timeline {
+		if item.UserId != userId {
+			timeline = append(timeline, item)
+		}
+	}
+	m.data.timeline = timeline
+
+	type candidate struct {
+		postId, reposterId int64
+		createdAt          time.Time
+	}
+
+	source := func(id int64) bool {
+		_, ok := m.data.follows[memoryPair{userId, id}]
+		return ok || id == userId
+	}
+
+	// each post once, coming from its author rather than from a repost when it can
+	byPost := map[int64]candidate{}
+	for _, post := range m.data.posts {
+		if source(post.UserId) {
+			byPost[post.Id] = candidate{postId: post.Id, createdAt: post.CreateAt}
+		}
+	}
+
+	for key, at := range m.data.reposts {
+		if !source(key.a) {
+			continue
+		}
+
+		if c, ok := byPost[key.b]; !ok || (c.reposterId != 0 && at.Before(c.createdAt)) {
+			byPost[key.b] = candidate{postId: key.b, reposterId: key.a, createdAt: at}
+		}
+	}
+
+	candidates := make([]candidate, 0, len(byPost))
+	for _, c := range byPost {
+		candidates = append(candidates, c)
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		if !candidates[i].createdAt.Equal(candidates[j].createdAt) {
+			return candidates[i].createdAt.After(candidates[j].createdAt)
+		}
+
+		return candidates[i].postId > candidates[j].postId
+	})
+
+	if len(candidates) > limit {
+		candidates = candidates[:limit]
+	}
+
+	// oldest inserted first so ids keep order of the posts
+	for i := len(candidates) - 1; i >= 0; i-- {
+		m.data.addTimelineItem(userId, candidates[i].postId, candidates[i].reposterId)
+	}
+
+	return len(candidates), nil
+}
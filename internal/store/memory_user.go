@@ -0,0 +1,540 @@
+package store
+
+import (
+	"context"
+	. "social/internal/models"
+	"sort"
+	"strings"
+	"time"
+)
+
+func (m *Memory) CreateUser(ctx context.Context, email, username string) (int64, error) {
+	defer m.lock()()
+
+	for _, u := range m.data.users {
+		if u.Email == email {
+			return 0, ErrEmailTaken
+		}
+
+		if u.Username == username {
+			return 0, ErrUsernameTaken
+		}
+	}
+
+	id := m.data.nextId("users")
+	m.data.users[id] = UserProfile{User: User{Id: id, Username: username}, Email: email}
+
+	return id, nil
+}
+
+func (m *Memory) UserById(ctx context.Context, userId int64) (User, error) {
+	defer m.rlock()()
+
+	u, ok := m.data.users[userId]
+	if !ok {
+		return User{}, ErrNotFound
+	}
+
+	return u.User, nil
+}
+
+func (m *Memory) UserByEmail(ctx context.Context, email string) (User, error) {
+	defer m.rlock()()
+
+	for _, u := range m.data.users {
+		if u.Email == email {
+			return u.User, nil
+		}
+	}
+
+	return User{}, ErrNotFound
+}
+
+func (m *Memory) UserByUsername(ctx context.Context, username string) (User, error) {
+	defer m.rlock()()
+
+	u, ok := m.data.userByUsername(username)
+	if !ok {
+		return User{}, ErrNotFound
+	}
+
+	return u.User, nil
+}
+
+func (m *Memory) UsersByUsernames(ctx context.Context, usernames []string) ([]User, error) {
+	defer m.rlock()()
+
+	var users []User
+	for _, username := range usernames {
+		if u, ok := m.data.userByUsername(username); ok {
+			users = append(users, u.User)
+		}
+	}
+
+	return users, nil
+}
+
+func (m *Memory) UserProfile(ctx context.Context, viewerId int64, username string) (UserProfile, error) {
+	defer m.rlock()()
+
+	u, ok := m.data.userByUsername(username)
+	if !ok || m.data.hidden(viewerId, u.Id) {
+		return UserProfile{}, ErrNotFound
+	}
+
+	return m.data.profile(viewerId, u), nil
+}
+
+func (m *Memory) Users(ctx context.Context, viewerId int64, search string, first int, after string) ([]UserProfile, error) {
+	defer m.rlock()()
+
+	search = strings.ToLower(search)
+	var users []UserProfile
+	for _, u := range m.data.users {
+		if search != "" && !strings.Contains(strings.ToLower(u.Username), search) {
+			continue
+		}
+
+		if after != "" && u.Username <= after {
+			continue
+		}
+
+		if m.data.hidden(viewerId, u.Id) {
+			continue
+		}
+
+		users = append(users, u)
+	}
+
+	return m.data.profilesPage(viewerId, users, first), nil
+}
+
+func (m *Memory) UpdateProfile(ctx context.Context, userId int64, update ProfileUpdate) error {
+	defer m.lock()()
+
+	u, ok := m.data.users[userId]
+	if !ok {
+		return ErrNotFound
+	}
+
+	for _, f := range []struct {
+		value *string
+		field *string
+	}{
+		{update.DisplayName, &u.DisplayName},
+		{update.Bio, &u.Bio},
+		{update.Location, &u.Location},
+		{update.Website, &u.Website},
+		{update.Pronouns, &u.Pronouns},
+	} {
+		if f.value != nil {
+			*f.field = *f.value
+		}
+	}
+
+	m.data.users[userId] = u
+	return nil
+}
+
+func (m *Memory) UpdateUsername(ctx context.Context, userId int64, username string) (string, error) {
+	defer m.lock()()
+
+	u, ok := m.data.users[userId]
+	if !ok {
+		return "", ErrNotFound
+	}
+
+	if other, ok := m.data.userByUsername(username); ok && other.Id != userId {
+		return "", ErrUsernameTaken
+	}
+
+	now := time.Now()
+	previous := u.Username
+	u.Username = username
+	m.data.users[userId] = u
+	m.data.usernameChangedAt[userId] = now
+	delete(m.data.usernameHistory, username)
+	m.data.usernameHistory[previous] = memoryUsernameChange{userId: userId, changedAt: now}
+
+	return previous, nil
+}
+
+func (m *Memory) LastUsernameChange(ctx context.Context, userId int64) (time.Time, error) {
+	defer m.rlock()()
+
+	if _, ok := m.data.users[userId]; !ok {
+		return time.Time{}, ErrNotFound
+	}
+
+	return m.data.usernameChangedAt[userId], nil
+}
+
+func (m *Memory) UserByPreviousUsername(ctx context.Context, username string, since time.Time) (User, error) {
+	defer m.rlock()()
+
+	change, ok := m.data.usernameHistory[username]
+	if !ok || change.changedAt.Before(since) {
+		return User{}, ErrNotFound
+	}
+
+	return m.data.userOf(change.userId), nil
+}
+
+func (m *Memory) UpdateEmail(ctx context.Context, userId int64, email string) error {
+	defer m.lock()()
+
+	u, ok := m.data.users[userId]
+	if !ok {
+		return ErrNotFound
+	}
+
+	for _, other := range m.data.users {
+		if other.Email == email && other.Id != userId {
+			return ErrEmailTaken
+		}
+	}
+
+	u.Email = email
+	m.data.users[userId] = u
+	return nil
+}
+
+func (m *Memory) UpdateCover(ctx context.Context, userId int64, cover string) (string, error) {
+	defer m.lock()()
+
+	u, ok := m.data.users[userId]
+	if !ok {
+		return "", ErrNotFound
+	}
+
+	var oldCover string
+	if u.CoverUrl != nil {
+		oldCover = *u.CoverUrl
+	}
+
+	u.CoverUrl = &cover
+	m.data.users[userId] = u
+
+	return oldCover, nil
+}
+
+func (m *Memory) UpdateAvatar(ctx context.Context, userId int64, avatar string) (string, error) {
+	defer m.lock()()
+
+	u, ok := m.data.users[userId]
+	if !ok {
+		return "", ErrNotFound
+	}
+
+	var oldAvatar string
+	if u.AvatarUrl != nil {
+		oldAvatar = *u.AvatarUrl
+	}
+
+	u.AvatarUrl = &avatar
+	m.data.users[userId] = u
+
+	return oldAvatar, nil
+}
+
+func (m *Memory) Avatars(ctx context.Context) ([]string, error) {
+	defer m.rlock()()
+
+	var avatars []string
+	for _, u := range m.data.users {
+		if u.AvatarUrl != nil {
+			avatars = append(avatars, *u.AvatarUrl)
+		}
+	}
+
+	return avatars, nil
+}
+
+func (m *Memory) SuspendUser(ctx context.Context, userId int64, suspended bool) error {
+	defer m.lock()()
+
+	if _, ok := m.data.users[userId]; !ok {
+		return ErrNotFound
+	}
+
+	if !suspended {
+		delete(m.data.suspended, userId)
+	} else if _, ok := m.data.suspended[userId]; !ok {
+		m.data.suspended[userId] = time.Now()
+	}
+
+	return nil
+}
+
+func (m *Memory) UserSuspended(ctx context.Context, userId int64) (bool, error) {
+	defer m.rlock()()
+
+	if _, ok := m.data.users[userId]; !ok {
+		return false, ErrNotFound
+	}
+
+	_, ok := m.data.suspended[userId]
+	return ok, nil
+}
+
+func (m *Memory) SetAdmin(ctx context.Context, userId int64, admin bool) error {
+	defer m.lock()()
+
+	if _, ok := m.data.users[userId]; !ok {
+		return ErrNotFound
+	}
+
+	if admin {
+		m.data.admins[userId] = true
+	} else {
+		delete(m.data.admins, userId)
+	}
+
+	return nil
+}
+
+func (m *Memory) IsAdmin(ctx context.Context, userId int64) (bool, error) {
+	defer m.rlock()()
+
+	if _, ok := m.data.users[userId]; !ok {
+		return false, ErrNotFound
+	}
+
+	return m.data.admins[userId], nil
+}
+
+func (m *Memory) ScheduleUserDeletion(ctx context.Context, userId int64, at time.Time) error {
+	defer m.lock()()
+
+	if _, ok := m.data.users[userId]; !ok {
+		return ErrNotFound
+	}
+
+	m.data.deletionScheduledAt[userId] = at
+	return nil
+}
+
+func (m *Memory) CancelUserDeletion(ctx context.Context, userId int64) (bool, error) {
+	defer m.lock()()
+
+	_, scheduled := m.data.deletionScheduledAt[userId]
+	delete(m.data.deletionScheduledAt, userId)
+	return scheduled, nil
+}
+
+func (m *Memory) LockUserDeletion(ctx context.Context, userId int64) (time.Time, error) {
+	defer m.rlock()()
+
+	if _, ok := m.data.users[userId]; !ok {
+		return time.Time{}, ErrNotFound
+	}
+
+	return m.data.deletionScheduledAt[userId], nil
+}
+
+func (m *Memory) UsersDueForDeletion(ctx context.Context, now time.Time, limit int) ([]int64, error) {
+	defer m.rlock()()
+
+	var ids []int64
+	for id, at := range m.data.deletionScheduledAt {
+		if !at.After(now) {
+			ids = append(ids, id)
+		}
+	}
+
+	sort.Slice(ids, func(i, j int) bool {
+		return m.data.deletionScheduledAt[ids[i]].Before(m.data.deletionScheduledAt[ids[j]])
+	})
+
+	if len(ids) > limit {
+		ids = ids[:limit]
+	}
+
+	return ids, nil
+}
+
+func (m *Memory) DeleteUser(ctx context.Context, userId int64) (DeletedUser, error) {
+	defer m.lock()()
+
+	var deleted DeletedUser
+	u, ok := m.data.users[userId]
+	if !ok {
+		return deleted, ErrNotFound
+	}
+
+	if u.AvatarUrl != nil {
+		deleted.Avatar = *u.AvatarUrl
+	}
+
+	if u.CoverUrl != nil {
+		deleted.Cover = *u.CoverUrl
+	}
+
+	for f := range m.data.follows {
+		if f.a == userId || f.b == userId {
+			delete(m.data.follows, f)
+			m.data.updateFollowCounts(f.a, f.b, -1)
+		}
+	}
+
+	for _, pairs := range []map[memoryPair]time.Time{m.data.blocks, m.data.mutes} {
+		for key := range pairs {
+			if key.a == userId || key.b == userId {
+				delete(pairs, key)
+			}
+		}
+	}
+
+	for key := range m.data.postLikes {
+		if key.a == userId {
+			delete(m.data.postLikes, key)
+			if post, ok := m.data.posts[key.b]; ok && post.LikesCount > 0 {
+				post.LikesCount--
+				m.data.posts[key.b] = post
+			}
+		}
+	}
+
+	for key := range m.data.commentLikes {
+		if key.a == userId {
+			delete(m.data.commentLikes, key)
+			if c, ok := m.data.comments[key.b]; ok && c.LikesCount > 0 {
+				c.LikesCount--
+				m.data.comments[key.b] = c
+			}
+		}
+	}
+
+	for key := range m.data.reposts {
+		if key.a == userId {
+			delete(m.data.reposts, key)
+			if post, ok := m.data.posts[key.b]; ok && post.RepostsCount > 0 {
+				post.RepostsCount--
+				m.data.posts[key.b] = post
+			}
+		}
+	}
+
+	deleted.Comments = m.data.deleteUserComments(userId)
+	m.data.deleteUserMentions(userId)
+
+	for id, media := range m.data.media {
+		if media.UserId == userId {
+			delete(m.data.media, id)
+			deleted.Media = append(deleted.Media, media.File, media.Thumbnail)
+		}
+	}
+
+	for id, n := range m.data.notifications {
+		if n.UserId == userId {
+			delete(m.data.notifications, id)
+			continue
+		}
+
+		if n.actorIds = removeId(n.actorIds, userId); len(n.actorIds) == 0 {
+			delete(m.data.notifications, id)
+		} else {
+			m.data.notifications[id] = n
+		}
+	}
+
+	timeline := m.data.timeline[:0:0]
+	for _, item := range m.data.timeline {
+		if item.UserId != userId && (item.RepostedBy == nil || item.RepostedBy.Id != userId) {
+			timeline = append(timeline, item)
+		}
+	}
+	m.data.timeline = timeline
+
+	for id, post := range m.data.posts {
+		if post.UserId == userId {
+			m.data.deletePost(id)
+			deleted.Posts++
+		}
+	}
+
+	for id, s := range m.data.sessions {
+		if s.userId == userId {
+			delete(m.data.sessions, id)
+		}
+	}
+
+	for hash, code := range m.data.codes {
+		if code.userId == userId {
+			delete(m.data.codes, hash)
+		}
+	}
+
+	for username, change := range m.data.usernameHistory {
+		if change.userId == userId {
+			delete(m.data.usernameHistory, username)
+		}
+	}
+
+	for hash, change := range m.data.emailChanges {
+		if change.UserId == userId {
+			delete(m.data.emailChanges, hash)
+		}
+	}
+
+	for id, export := range m.data.exports {
+		if export.UserId == userId {
+			delete(m.data.exports, id)
+			if export.File != "" {
+				deleted.Exports = append(deleted.Exports, export.File)
+			}
+		}
+	}
+
+	delete(m.data.usernameChangedAt, userId)
+	delete(m.data.deletionScheduledAt, userId)
+
+	delete(m.data.suspended, userId)
+	delete(m.data.admins, userId)
+	delete(m.data.users, userId)
+
+	return deleted, nil
+}
+
+func (d *memoryData) userByUsername(username string) (UserProfile, bool) {
+	for _, u := range d.users {
+		if u.Username == username {
+			return u, true
+		}
+	}
+
+	return UserProfile{}, false
+}
+
+// profile fills follow flags of the user as seen by viewer
+func (d *memoryData) profile(viewerId int64, u UserProfile) UserProfile {
+	if viewerId != 0 {
+		_, u.Following = d.follows[memoryPair{viewerId, u.Id}]
+		_, u.Followed = d.follows[memoryPair{u.Id, viewerId}]
+	}
+
+	return u
+}
+
+// profilesPage orders users by username and returns first of them as seen by viewer
+func (d *memoryData) profilesPage(viewerId int64, users []UserProfile, first int) []UserProfile {
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].Username < users[j].Username
+	})
+
+	if len(users) > first {
+		users = users[:first]
+	}
+
+	profiles := make([]UserProfile, 0, len(users))
+	for _, u := range users {
+		profiles = append(profiles, d.profile(viewerId, u))
+	}
+
+	return profiles
+}
+
+// userOf user with given id, zero user when it does not exist like left join would
+func (d *memoryData) userOf(userId int64) User {
+	return d.users[userId].User
+}
@@ -0,0 +1,45 @@
+package store
+
+import (
+	"context"
+	"time"
+)
+
+func (m *Memory) CreateVerificationCode(ctx context.Context, codeHash string, userId int64, redirectURI string) error {
+	defer m.lock()()
+
+	if _, ok := m.data.users[userId]; !ok {
+		return ErrNotFound
+	}
+
+	m.data.codes[codeHash] = memoryCode{userId: userId, redirectURI: redirectURI, createdAt: time.Now()}
+	return nil
+}
+
+func (m *Memory) DeleteVerificationCodesBefore(ctx context.Context, t time.Time) error {
+	defer m.lock()()
+
+	for hash, code := range m.data.codes {
+		if code.createdAt.Before(t) {
+			delete(m.data.codes, hash)
+		}
+	}
+
+	return nil
+}
+
+func (m *Memory) TakeVerificationCode(ctx context.Context, codeHash string) (VerificationCode, error) {
+	defer m.lock()()
+
+	code, ok := m.data.codes[codeHash]
+	if !ok {
+		return VerificationCode{}, ErrNotFound
+	}
+
+	delete(m.data.codes, codeHash)
+	return VerificationCode{
+		User:        m.data.userOf(code.userId),
+		RedirectURI: code.redirectURI,
+		CreatedAt:   code.createdAt,
+	}, nil
+}
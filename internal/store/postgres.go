@@ -0,0 +1,109 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/lib/pq"
+	"strings"
+	"sync"
+	"text/template"
+)
+
+var _ Store = (*Postgres)(nil)
+
+// Postgres store backed by postgres database
+type Postgres struct {
+	// db is set outside of transaction, q is either db or the current tx
+	db *sql.DB
+	q  queryer
+}
+
+// NewPostgres creates store on top of db
+func NewPostgres(db *sql.DB) *Postgres {
+	return &Postgres{db: db, q: db}
+}
+
+// Tx runs fn in transaction, nested calls join the outer transaction
+func (p *Postgres) Tx(ctx context.Context, fn func(Store) error) error {
+	if p.db == nil {
+		return fn(p)
+	}
+
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("could not begin tx, %v", err)
+	}
+
+	defer tx.Rollback()
+
+	if err = fn(&Postgres{q: tx}); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("could not commit tx, %v", err)
+	}
+
+	return nil
+}
+
+// queryer is satisfied by both *sql.DB and *sql.Tx
+type queryer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+var (
+	queriesCacheMu sync.Mutex
+	queriesCache   = make(map[string]*template.Template)
+)
+
+func queryBuilder(text string, data map[string]interface{}) (string, []interface{}, error) {
+	queriesCacheMu.Lock()
+	t, ok := queriesCache[text]
+	if !ok {
+		var err error
+		t, err = template.New("query").Parse(text)
+		if err != nil {
+			queriesCacheMu.Unlock()
+			return "", nil, fmt.Errorf("could not parse query template")
+		}
+
+		queriesCache[text] = t
+	}
+	queriesCacheMu.Unlock()
+
+	var wr bytes.Buffer
+	if err := t.Execute(&wr, data); err != nil {
+		return "", nil, fmt.Errorf("could not execute query")
+	}
+
+	query := wr.String()
+	args := []interface{}{}
+	for key, val := range data {
+		if !strings.Contains(query, "@"+key) {
+			continue
+		}
+		args = append(args, val)
+		query = strings.ReplaceAll(query, "@"+key, fmt.Sprintf("$%d", len(args)))
+	}
+	return query, args, nil
+}
+
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
+
+func isForeignKeyViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23503"
+}
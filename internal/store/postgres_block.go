@@ -0,0 +1,219 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	. "social/internal/models"
+)
+
+// hiddenUsers ids of users viewer @uid blocked or was blocked by, for queries made with queryBuilder
+const hiddenUsers = `(SELECT blocked_id FROM blocks WHERE blocker_id = @uid
+	UNION ALL SELECT blocker_id FROM blocks WHERE blocked_id = @uid)`
+
+// mutedUsers ids of users viewer @uid muted, for queries made with queryBuilder
+const mutedUsers = `(SELECT muted_id FROM mutes WHERE muter_id = @uid)`
+
+func (p *Postgres) IsBlocking(ctx context.Context, blockerId, blockedId int64) (bool, error) {
+	var blocking bool
+	query := "select exists (select 1 from blocks where blocker_id = $1 and blocked_id = $2)"
+	if err := p.q.QueryRowContext(ctx, query, blockerId, blockedId).Scan(&blocking); err != nil {
+		return false, fmt.Errorf("could not check block, %v", err)
+	}
+
+	return blocking, nil
+}
+
+func (p *Postgres) Blocked(ctx context.Context, userId, otherId int64) (bool, error) {
+	var blocked bool
+	query := `select exists (select 1 from blocks
+		where (blocker_id = $1 and blocked_id = $2) or (blocker_id = $2 and blocked_id = $1))`
+	if err := p.q.QueryRowContext(ctx, query, userId, otherId).Scan(&blocked); err != nil {
+		return false, fmt.Errorf("could not check blocks between users, %v", err)
+	}
+
+	return blocked, nil
+}
+
+func (p *Postgres) BlockedUserIds(ctx context.Context, userId int64) ([]int64, error) {
+	query := `select blocked_id from blocks where blocker_id = $1
+		union select blocker_id from blocks where blocked_id = $1`
+	rows, err := p.q.QueryContext(ctx, query, userId)
+	if err != nil {
+		return nil, fmt.Errorf("could not query blocked users, %v", err)
+	}
+
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err = rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("could not scan blocked user, %v", err)
+		}
+
+		ids = append(ids, id)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not iterate blocked user rows, %v", err)
+	}
+
+	return ids, nil
+}
+
+func (p *Postgres) Block(ctx context.Context, blockerId, blockedId int64) error {
+	query := "insert into blocks (blocker_id, blocked_id) values ($1, $2) on conflict do nothing"
+	_, err := p.q.ExecContext(ctx, query, blockerId, blockedId)
+	if isForeignKeyViolation(err) {
+		return ErrNotFound
+	}
+
+	if err != nil {
+		return fmt.Errorf("could not insert block, %v", err)
+	}
+
+	for _, f := range [][2]int64{{blockerId, blockedId}, {blockedId, blockerId}} {
+		res, err := p.q.ExecContext(ctx, "delete from follows where follower_id = $1 and followee_id = $2", f[0], f[1])
+		if err != nil {
+			return fmt.Errorf("could not delete follow of blocked user, %v", err)
+		}
+
+		n, err := res.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("could not count deleted follows, %v", err)
+		}
+
+		if n == 0 {
+			continue
+		}
+
+		if _, err = p.updateFollowCounts(ctx, f[0], f[1], -1); err != nil {
+			return err
+		}
+	}
+
+	queries := []string{
+		`with deleted as (delete from post_likes using posts
+			where post_likes.post_id = posts.id and posts.user_id = $1 and post_likes.user_id = $2
+			returning post_likes.post_id)
+		update posts set likes_count = greatest(likes_count - 1, 0) where id in (select post_id from deleted)`,
+		`with deleted as (delete from reposts using posts
+			where reposts.post_id = posts.id and posts.user_id = $1 and reposts.user_id = $2
+			returning reposts.post_id)
+		update posts set reposts_count = greatest(reposts_count - 1, 0) where id in (select post_id from deleted)`,
+		"delete from timeline where reposted_by = $2 and post_id in (select id from posts where user_id = $1)",
+		`with deleted as (delete from comment_likes using comments
+			where comment_likes.comment_id = comments.id and comments.user_id = $1 and comment_likes.user_id = $2
+			returning comment_likes.comment_id)
+		update comments set likes_count = greatest(likes_count - 1, 0) where id in (select comment_id from deleted)`,
+	}
+	for _, query := range queries {
+		if _, err = p.q.ExecContext(ctx, query, blockerId, blockedId); err != nil {
+			return fmt.Errorf("could not remove likes and reposts of blocked user, %v", err)
+		}
+	}
+
+	queries = []string{
+		"update notifications set actor_ids = array_remove(actor_ids, $2) where user_id = $1 and $2 = any(actor_ids)",
+		"update notifications set actor_ids = array_remove(actor_ids, $1) where user_id = $2 and $1 = any(actor_ids)",
+		"delete from notifications where user_id in ($1, $2) and cardinality(actor_ids) = 0",
+	}
+	for _, query := range queries {
+		if _, err = p.q.ExecContext(ctx, query, blockerId, blockedId); err != nil {
+			return fmt.Errorf("could not remove notifications between blocked users, %v", err)
+		}
+	}
+
+	return nil
+}
+
+func (p *Postgres) Unblock(ctx context.Context, blockerId, blockedId int64) error {
+	query := "delete from blocks where blocker_id = $1 and blocked_id = $2"
+	if _, err := p.q.ExecContext(ctx, query, blockerId, blockedId); err != nil {
+		return fmt.Errorf("could not delete block, %v", err)
+	}
+
+	return nil
+}
+
+func (p *Postgres) Blocks(ctx context.Context, userId int64, first int, after string) ([]User, error) {
+	return p.relatedUsers(ctx, "blocks", "blocker_id", "blocked_id", userId, first, after)
+}
+
+func (p *Postgres) IsMuting(ctx context.Context, muterId, mutedId int64) (bool, error) {
+	var muting bool
+	query := "select exists (select 1 from mutes where muter_id = $1 and muted_id = $2)"
+	if err := p.q.QueryRowContext(ctx, query, muterId, mutedId).Scan(&muting); err != nil {
+		return false, fmt.Errorf("could not check mute, %v", err)
+	}
+
+	return muting, nil
+}
+
+func (p *Postgres) Mute(ctx context.Context, muterId, mutedId int64) error {
+	query := "insert into mutes (muter_id, muted_id) values ($1, $2) on conflict do nothing"
+	_, err := p.q.ExecContext(ctx, query, muterId, mutedId)
+	if isForeignKeyViolation(err) {
+		return ErrNotFound
+	}
+
+	if err != nil {
+		return fmt.Errorf("could not insert mute, %v", err)
+	}
+
+	return nil
+}
+
+func (p *Postgres) Unmute(ctx context.Context, muterId, mutedId int64) error {
+	query := "delete from mutes where muter_id = $1 and muted_id = $2"
+	if _, err := p.q.ExecContext(ctx, query, muterId, mutedId); err != nil {
+		return fmt.Errorf("could not delete mute, %v", err)
+	}
+
+	return nil
+}
+
+func (p *Postgres) Mutes(ctx context.Context, userId int64, first int, after string) ([]User, error) {
+	return p.relatedUsers(ctx, "mutes", "muter_id", "muted_id", userId, first, after)
+}
+
+// relatedUsers lists users in column listed of table whose column of is user, ordered by username
+func (p *Postgres) relatedUsers(ctx context.Context, table, of, listed string, userId int64, first int, after string) ([]User, error) {
+	query, args, err := queryBuilder(`SELECT users.id, users.username, users.avatar_url
+		FROM `+table+`
+		INNER JOIN users ON users.id = `+table+`.`+listed+`
+		WHERE `+table+`.`+of+` = @uid
+		{{ if .after }}AND users.username > @after{{ end }}
+		ORDER BY users.username ASC
+		LIMIT @first`, map[string]interface{}{
+		"uid":   userId,
+		"after": after,
+		"first": first,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not build %s query, %v", table, err)
+	}
+
+	rows, err := p.q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("could not query %s, %v", table, err)
+	}
+
+	defer rows.Close()
+
+	users := []User{}
+	for rows.Next() {
+		var user User
+		if err = rows.Scan(&user.Id, &user.Username, &user.AvatarUrl); err != nil {
+			return nil, fmt.Errorf("could not scan user, %v", err)
+		}
+
+		users = append(users, user)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not iterate user rows, %v", err)
+	}
+
+	return users, nil
+}
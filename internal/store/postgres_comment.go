@@ -0,0 +1,235 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/lib/pq"
+	. "social/internal/models"
+)
+
+const commentColumns = `comments.id, comments.post_id, comments.parent_id, comments.depth
+	, comments.user_id, comments.content, comments.likes_count, comments.replies_count, comments.created_at
+	, users.username, users.avatar_url
+	{{ if .auth }}, likes.user_id IS NOT NULL AS liked{{ end }}`
+
+const commentJoins = `INNER JOIN users ON comments.user_id = users.id
+	{{ if .auth }}
+	LEFT JOIN comment_likes AS likes
+		ON likes.comment_id = comments.id AND likes.user_id = @uid
+	{{ end }}`
+
+func (p *Postgres) CreateComment(ctx context.Context, c Comment) (Comment, error) {
+	query := `insert into comments(user_id,post_id,parent_id,depth,content)
+		values($1,$2,$3,$4,$5) returning id, created_at`
+	err := p.q.QueryRowContext(ctx, query, c.UserId, c.PostId, c.ParentId, c.Depth, c.Content).
+		Scan(&c.Id, &c.CreatedAt)
+	if isForeignKeyViolation(err) {
+		return c, ErrNotFound
+	}
+
+	if err != nil {
+		return c, fmt.Errorf("cannot insert comment, %v", err)
+	}
+
+	return c, nil
+}
+
+func (p *Postgres) CommentPostId(ctx context.Context, commentId int64) (int64, error) {
+	var postId int64
+	query := "select post_id from comments where id = $1"
+	err := p.q.QueryRowContext(ctx, query, commentId).Scan(&postId)
+	if err == sql.ErrNoRows {
+		return 0, ErrNotFound
+	}
+
+	if err != nil {
+		return 0, fmt.Errorf("could not fetch post of comment, %v", err)
+	}
+
+	return postId, nil
+}
+
+func (p *Postgres) IncrementRepliesCount(ctx context.Context, commentId int64) (Comment, error) {
+	var (
+		c        Comment
+		parentId sql.NullInt64
+	)
+	query := `update comments set replies_count = replies_count + 1 where id = $1
+		returning id, post_id, parent_id, depth, user_id, content, likes_count, replies_count, created_at`
+	err := p.q.QueryRowContext(ctx, query, commentId).Scan(&c.Id, &c.PostId, &parentId, &c.Depth,
+		&c.UserId, &c.Content, &c.LikesCount, &c.RepliesCount, &c.CreatedAt)
+	if err == sql.ErrNoRows {
+		return c, ErrNotFound
+	}
+
+	if err != nil {
+		return c, fmt.Errorf("cannot update replies count, %v", err)
+	}
+
+	if parentId.Valid {
+		c.ParentId = &parentId.Int64
+	}
+
+	return c, nil
+}
+
+func (p *Postgres) Comments(ctx context.Context, viewerId, postId int64, last int, after int64, oldestFirst bool) ([]Comment, error) {
+	query, args, err := queryBuilder(`SELECT `+commentColumns+`
+		FROM comments
+		`+commentJoins+`
+		WHERE comments.post_id = @postId AND comments.parent_id IS NULL
+		{{ if .auth }}AND comments.user_id NOT IN `+hiddenUsers+`{{ end }}
+		{{ if .after }}AND comments.id {{ if .oldest }}>{{ else }}<{{ end }} @after{{ end }}
+		ORDER BY comments.id {{ if .oldest }}ASC{{ else }}DESC{{ end }}
+		LIMIT @last`, map[string]interface{}{
+		"auth":   viewerId != 0,
+		"uid":    viewerId,
+		"postId": postId,
+		"after":  after,
+		"oldest": oldestFirst,
+		"last":   last,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not build comments query, %v", err)
+	}
+
+	return p.queryComments(ctx, query, args, viewerId)
+}
+
+func (p *Postgres) CommentReplies(ctx context.Context, viewerId, commentId int64, last int, after int64) ([]Comment, error) {
+	query, args, err := queryBuilder(`SELECT `+commentColumns+`
+		FROM comments
+		`+commentJoins+`
+		WHERE comments.parent_id = @commentId
+		{{ if .auth }}AND comments.user_id NOT IN `+hiddenUsers+`{{ end }}
+		{{ if .after }}AND comments.id > @after{{ end }}
+		ORDER BY comments.id ASC
+		LIMIT @last`, map[string]interface{}{
+		"auth":      viewerId != 0,
+		"uid":       viewerId,
+		"commentId": commentId,
+		"after":     after,
+		"last":      last,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not build replies query, %v", err)
+	}
+
+	return p.queryComments(ctx, query, args, viewerId)
+}
+
+func (p *Postgres) PreviewReplies(ctx context.Context, viewerId int64, parentIds []int64, limit int) ([]Comment, error) {
+	query, args, err := queryBuilder(`SELECT `+commentColumns+`
+		FROM unnest(@parentIds::int[]) AS parents(id)
+		CROSS JOIN LATERAL (
+			SELECT * FROM comments WHERE comments.parent_id = parents.id
+			{{ if .auth }}AND comments.user_id NOT IN `+hiddenUsers+`{{ end }}
+			ORDER BY comments.id ASC
+			LIMIT @previewLimit
+		) AS comments
+		`+commentJoins+`
+		ORDER BY comments.parent_id, comments.id ASC`, map[string]interface{}{
+		"auth":         viewerId != 0,
+		"uid":          viewerId,
+		"parentIds":    pq.Array(parentIds),
+		"previewLimit": limit,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not build replies preview query, %v", err)
+	}
+
+	return p.queryComments(ctx, query, args, viewerId)
+}
+
+func (p *Postgres) IsCommentLiked(ctx context.Context, userId, commentId int64) (bool, error) {
+	var liked bool
+	query := "select exists (select 1 from comment_likes where user_id = $1 and comment_id = $2)"
+	if err := p.q.QueryRowContext(ctx, query, userId, commentId).Scan(&liked); err != nil {
+		return false, fmt.Errorf("could not select comment like existence, %v", err)
+	}
+
+	return liked, nil
+}
+
+func (p *Postgres) LikeComment(ctx context.Context, userId, commentId int64) (int, int64, error) {
+	query := `insert into comment_likes (comment_id, post_id, user_id)
+		select id, post_id, $2 from comments where id = $1`
+	res, err := p.q.ExecContext(ctx, query, commentId, userId)
+	if err != nil {
+		return 0, 0, fmt.Errorf("could not insert like for comment, %v", err)
+	}
+
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return 0, 0, ErrNotFound
+	}
+
+	return p.updateCommentLikesCount(ctx, commentId, 1)
+}
+
+func (p *Postgres) UnlikeComment(ctx context.Context, userId, commentId int64) (int, int64, error) {
+	query := "delete from comment_likes where user_id = $1 and comment_id = $2"
+	if _, err := p.q.ExecContext(ctx, query, userId, commentId); err != nil {
+		return 0, 0, fmt.Errorf("could not remove like from comment, %v", err)
+	}
+
+	return p.updateCommentLikesCount(ctx, commentId, -1)
+}
+
+func (p *Postgres) updateCommentLikesCount(ctx context.Context, commentId int64, delta int) (int, int64, error) {
+	var (
+		likesCount int
+		authorId   int64
+	)
+	query := "update comments set likes_count = likes_count + $2 where id = $1 returning likes_count, user_id"
+	err := p.q.QueryRowContext(ctx, query, commentId, delta).Scan(&likesCount, &authorId)
+	if err == sql.ErrNoRows {
+		return 0, 0, ErrNotFound
+	}
+
+	if err != nil {
+		return 0, 0, fmt.Errorf("could not update comment likes count, %v", err)
+	}
+
+	return likesCount, authorId, nil
+}
+
+func (p *Postgres) queryComments(ctx context.Context, query string, args []interface{}, viewerId int64) ([]Comment, error) {
+	rows, err := p.q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("could not query comments, %v", err)
+	}
+
+	defer rows.Close()
+
+	comments := []Comment{}
+	for rows.Next() {
+		var (
+			comment  Comment
+			user     User
+			parentId sql.NullInt64
+		)
+		dest := []interface{}{&comment.Id, &comment.PostId, &parentId, &comment.Depth,
+			&comment.UserId, &comment.Content, &comment.LikesCount, &comment.RepliesCount, &comment.CreatedAt,
+			&user.Username, &user.AvatarUrl}
+		if viewerId != 0 {
+			dest = append(dest, &comment.Liked)
+		}
+		if err = rows.Scan(dest...); err != nil {
+			return nil, fmt.Errorf("could not scan comment, %v", err)
+		}
+
+		if parentId.Valid {
+			comment.ParentId = &parentId.Int64
+		}
+		user.Id = comment.UserId
+		comment.User = &user
+		comments = append(comments, comment)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not iterate comment rows, %v", err)
+	}
+
+	return comments, nil
+}
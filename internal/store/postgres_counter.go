@@ -0,0 +1,98 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"sort"
+)
+
+// counterColumns where each counter is stored and which rows it counts
+var counterColumns = map[string]struct {
+	table, column, source, key string
+}{
+	CounterFollowers:      {"users", "followers_count", "follows", "followee_id"},
+	CounterFollowees:      {"users", "followees_count", "follows", "follower_id"},
+	CounterPostLikes:      {"posts", "likes_count", "post_likes", "post_id"},
+	CounterPostComments:   {"posts", "comments_count", "comments", "post_id"},
+	CounterPostReposts:    {"posts", "reposts_count", "reposts", "post_id"},
+	CounterCommentLikes:   {"comments", "likes_count", "comment_likes", "comment_id"},
+	CounterCommentReplies: {"comments", "replies_count", "comments", "parent_id"},
+}
+
+// countsQuery stored and actual count of rows in id range
+const countsQuery = `select %[1]s.id, %[1]s.%[2]s as stored
+		, (select count(*) from %[3]s as counted where counted.%[4]s = %[1]s.id) as actual
+		from %[1]s where %[1]s.id > $1 and %[1]s.id <= $2`
+
+func (p *Postgres) ReconcileCounts(ctx context.Context, counter string, afterId int64, limit int, fix bool) (CountBatch, error) {
+	var batch CountBatch
+	c, ok := counterColumns[counter]
+	if !ok {
+		return batch, fmt.Errorf("unknown counter %q", counter)
+	}
+
+	query := fmt.Sprintf("select id from %s where id > $1 order by id limit $2", c.table)
+	if fix {
+		query += " for no key update"
+	}
+
+	rows, err := p.q.QueryContext(ctx, query, afterId, limit)
+	if err != nil {
+		return batch, fmt.Errorf("could not query %s batch, %v", c.table, err)
+	}
+
+	for rows.Next() {
+		if err = rows.Scan(&batch.LastId); err != nil {
+			rows.Close()
+			return batch, fmt.Errorf("could not scan %s id, %v", c.table, err)
+		}
+
+		batch.Checked++
+	}
+
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return batch, fmt.Errorf("could not iterate %s batch, %v", c.table, err)
+	}
+
+	if batch.Checked == 0 {
+		return batch, nil
+	}
+
+	counts := fmt.Sprintf(countsQuery, c.table, c.column, c.source, c.key)
+	if fix {
+		// batch rows are locked, so counts read by this statement can not change under it
+		query = fmt.Sprintf(`with counts as (%[3]s)
+			update %[1]s set %[2]s = counts.actual from counts
+			where %[1]s.id = counts.id and counts.stored <> counts.actual
+			returning counts.id, counts.stored, counts.actual`, c.table, c.column, counts)
+	} else {
+		query = `select id, stored, actual from (` + counts + `) as counts where stored <> actual`
+	}
+
+	rows, err = p.q.QueryContext(ctx, query, afterId, batch.LastId)
+	if err != nil {
+		return batch, fmt.Errorf("could not reconcile %s, %v", counter, err)
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		m := CountMismatch{Counter: counter}
+		if err = rows.Scan(&m.Id, &m.Stored, &m.Actual); err != nil {
+			return batch, fmt.Errorf("could not scan count mismatch, %v", err)
+		}
+
+		batch.Mismatches = append(batch.Mismatches, m)
+	}
+
+	if err = rows.Err(); err != nil {
+		return batch, fmt.Errorf("could not iterate count mismatches, %v", err)
+	}
+
+	sort.Slice(batch.Mismatches, func(i, j int) bool {
+		return batch.Mismatches[i].Id < batch.Mismatches[j].Id
+	})
+
+	return batch, nil
+}
@@ -0,0 +1,44 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+func (p *Postgres) CreateEmailChange(ctx context.Context, codeHash string, userId int64, email string) error {
+	if _, err := p.q.ExecContext(ctx, "delete from email_changes where user_id = $1", userId); err != nil {
+		return fmt.Errorf("could not delete pending email changes, %v", err)
+	}
+
+	query := "insert into email_changes (code_hash, user_id, email) values ($1, $2, $3)"
+	if _, err := p.q.ExecContext(ctx, query, codeHash, userId, email); err != nil {
+		return fmt.Errorf("could not insert email change, %v", err)
+	}
+
+	return nil
+}
+
+func (p *Postgres) DeleteEmailChangesBefore(ctx context.Context, t time.Time) error {
+	if _, err := p.q.ExecContext(ctx, "delete from email_changes where created_at < $1", t); err != nil {
+		return fmt.Errorf("could not delete expired email changes, %v", err)
+	}
+
+	return nil
+}
+
+func (p *Postgres) TakeEmailChange(ctx context.Context, codeHash string) (EmailChange, error) {
+	var change EmailChange
+	query := "delete from email_changes where code_hash = $1 returning user_id, email, created_at"
+	err := p.q.QueryRowContext(ctx, query, codeHash).Scan(&change.UserId, &change.Email, &change.CreatedAt)
+	if err == sql.ErrNoRows {
+		return change, ErrNotFound
+	}
+
+	if err != nil {
+		return change, fmt.Errorf("could not delete email change, %v", err)
+	}
+
+	return change, nil
+}
@@ -0,0 +1,317 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	. "social/internal/models"
+)
+
+const exportColumns = "id, user_id, file, created_at, completed_at"
+
+func (p *Postgres) CreateExport(ctx context.Context, userId int64) (UserExport, error) {
+	query := "insert into exports (user_id) values ($1) returning " + exportColumns
+	export, err := scanExport(p.q.QueryRowContext(ctx, query, userId))
+	if isForeignKeyViolation(err) {
+		return export, ErrNotFound
+	}
+
+	if err != nil {
+		return export, fmt.Errorf("could not insert export, %v", err)
+	}
+
+	return export, nil
+}
+
+func (p *Postgres) Export(ctx context.Context, exportId int64) (UserExport, error) {
+	query := "select " + exportColumns + " from exports where id = $1"
+	export, err := scanExport(p.q.QueryRowContext(ctx, query, exportId))
+	if err == sql.ErrNoRows {
+		return export, ErrNotFound
+	}
+
+	if err != nil {
+		return export, fmt.Errorf("could not fetch export, %v", err)
+	}
+
+	return export, nil
+}
+
+func (p *Postgres) LatestExport(ctx context.Context, userId int64) (UserExport, error) {
+	query := "select " + exportColumns + " from exports where user_id = $1 order by created_at desc, id desc limit 1"
+	export, err := scanExport(p.q.QueryRowContext(ctx, query, userId))
+	if err == sql.ErrNoRows {
+		return export, ErrNotFound
+	}
+
+	if err != nil {
+		return export, fmt.Errorf("could not fetch latest export, %v", err)
+	}
+
+	return export, nil
+}
+
+func (p *Postgres) CompleteExport(ctx context.Context, exportId int64, file string) error {
+	query := "update exports set file = $2, completed_at = now() where id = $1"
+	res, err := p.q.ExecContext(ctx, query, exportId, file)
+	if err != nil {
+		return fmt.Errorf("could not complete export, %v", err)
+	}
+
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (p *Postgres) UserArchive(ctx context.Context, userId int64) (UserArchive, error) {
+	var archive UserArchive
+
+	query, args, err := queryBuilder(`SELECT `+profileColumns+` FROM users WHERE users.id = @uid`,
+		map[string]interface{}{"auth": false, "uid": userId})
+	if err != nil {
+		return archive, fmt.Errorf("could not build archived profile query, %v", err)
+	}
+
+	archive.Profile, err = scanProfile(p.q.QueryRowContext(ctx, query, args...), false)
+	if err == sql.ErrNoRows {
+		return archive, ErrNotFound
+	}
+
+	if err != nil {
+		return archive, fmt.Errorf("could not fetch archived profile, %v", err)
+	}
+
+	if archive.Posts, err = p.archivedPosts(ctx, userId); err != nil {
+		return archive, err
+	}
+
+	if archive.Revisions, err = p.archivedRevisions(ctx, userId); err != nil {
+		return archive, err
+	}
+
+	query, args, err = queryBuilder(`SELECT `+commentColumns+`
+		FROM comments
+		`+commentJoins+`
+		WHERE comments.user_id = @uid
+		ORDER BY comments.id`, map[string]interface{}{"auth": false, "uid": userId})
+	if err != nil {
+		return archive, fmt.Errorf("could not build archived comments query, %v", err)
+	}
+
+	if archive.Comments, err = p.queryComments(ctx, query, args, 0); err != nil {
+		return archive, err
+	}
+
+	if archive.Media, err = p.archivedMedia(ctx, userId); err != nil {
+		return archive, err
+	}
+
+	ids := []struct {
+		query string
+		dest  *[]int64
+	}{
+		{"select post_id from post_likes where user_id = $1 order by post_id", &archive.LikedPosts},
+		{"select comment_id from comment_likes where user_id = $1 order by comment_id", &archive.LikedComments},
+		{"select post_id from reposts where user_id = $1 order by post_id", &archive.Reposts},
+	}
+	for _, q := range ids {
+		if *q.dest, err = p.archivedIds(ctx, q.query, userId); err != nil {
+			return archive, err
+		}
+	}
+
+	usernames := []struct {
+		query string
+		dest  *[]string
+	}{
+		{`select users.username from follows inner join users on users.id = follows.followee_id
+			where follows.follower_id = $1 order by users.username`, &archive.Following},
+		{`select users.username from follows inner join users on users.id = follows.follower_id
+			where follows.followee_id = $1 order by users.username`, &archive.Followers},
+	}
+	for _, q := range usernames {
+		if *q.dest, err = p.archivedUsernames(ctx, q.query, userId); err != nil {
+			return archive, err
+		}
+	}
+
+	return archive, nil
+}
+
+func (p *Postgres) archivedPosts(ctx context.Context, userId int64) ([]Post, error) {
+	query := `select ` + postColumns + ` from posts
+		left join users on users.id = posts.user_id where posts.user_id = $1 order by posts.id`
+	rows, err := p.q.QueryContext(ctx, query, userId)
+	if err != nil {
+		return nil, fmt.Errorf("could not query archived posts, %v", err)
+	}
+
+	defer rows.Close()
+
+	posts := []Post{}
+	for rows.Next() {
+		post, err := scanPost(rows)
+		if err != nil {
+			return nil, fmt.Errorf("could not scan archived post, %v", err)
+		}
+
+		posts = append(posts, post)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not iterate archived post rows, %v", err)
+	}
+
+	return posts, nil
+}
+
+func (p *Postgres) archivedRevisions(ctx context.Context, userId int64) ([]PostRevision, error) {
+	query := `select post_revisions.id, post_revisions.post_id, post_revisions.content, post_revisions.spoiler_of
+		, post_revisions.nsfw, post_revisions.created_at
+		from post_revisions
+		inner join posts on posts.id = post_revisions.post_id
+		where posts.user_id = $1
+		order by post_revisions.id`
+	rows, err := p.q.QueryContext(ctx, query, userId)
+	if err != nil {
+		return nil, fmt.Errorf("could not query archived post revisions, %v", err)
+	}
+
+	defer rows.Close()
+
+	revisions := []PostRevision{}
+	for rows.Next() {
+		var revision PostRevision
+		if err = rows.Scan(&revision.Id, &revision.PostId, &revision.Content, &revision.SpoilerOf,
+			&revision.NSFW, &revision.CreatedAt); err != nil {
+			return nil, fmt.Errorf("could not scan archived post revision, %v", err)
+		}
+
+		revisions = append(revisions, revision)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not iterate archived post revision rows, %v", err)
+	}
+
+	return revisions, nil
+}
+
+func (p *Postgres) archivedMedia(ctx context.Context, userId int64) ([]Media, error) {
+	query := `select id, user_id, post_id, file, thumbnail, width, height, blurhash, alt_text, created_at
+		from media where user_id = $1 order by id`
+	rows, err := p.q.QueryContext(ctx, query, userId)
+	if err != nil {
+		return nil, fmt.Errorf("could not query archived media, %v", err)
+	}
+
+	defer rows.Close()
+
+	var media []Media
+	for rows.Next() {
+		var m Media
+		err = rows.Scan(&m.Id, &m.UserId, &m.PostId, &m.File, &m.Thumbnail, &m.Width, &m.Height, &m.Blurhash,
+			&m.AltText, &m.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("could not scan archived media, %v", err)
+		}
+
+		media = append(media, m)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not iterate archived media rows, %v", err)
+	}
+
+	return media, nil
+}
+
+func (p *Postgres) archivedIds(ctx context.Context, query string, userId int64) ([]int64, error) {
+	rows, err := p.q.QueryContext(ctx, query, userId)
+	if err != nil {
+		return nil, fmt.Errorf("could not query archived ids, %v", err)
+	}
+
+	defer rows.Close()
+
+	ids := []int64{}
+	for rows.Next() {
+		var id int64
+		if err = rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("could not scan archived id, %v", err)
+		}
+
+		ids = append(ids, id)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not iterate archived id rows, %v", err)
+	}
+
+	return ids, nil
+}
+
+func (p *Postgres) archivedUsernames(ctx context.Context, query string, userId int64) ([]string, error) {
+	rows, err := p.q.QueryContext(ctx, query, userId)
+	if err != nil {
+		return nil, fmt.Errorf("could not query archived usernames, %v", err)
+	}
+
+	defer rows.Close()
+
+	usernames := []string{}
+	for rows.Next() {
+		var username string
+		if err = rows.Scan(&username); err != nil {
+			return nil, fmt.Errorf("could not scan archived username, %v", err)
+		}
+
+		usernames = append(usernames, username)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not iterate archived username rows, %v", err)
+	}
+
+	return usernames, nil
+}
+
+// deleteUserExports deletes exports of the user and returns names of their archives
+func (p *Postgres) deleteUserExports(ctx context.Context, userId int64) ([]string, error) {
+	rows, err := p.q.QueryContext(ctx, "delete from exports where user_id = $1 returning file", userId)
+	if err != nil {
+		return nil, fmt.Errorf("could not delete exports of user, %v", err)
+	}
+
+	defer rows.Close()
+
+	var files []string
+	for rows.Next() {
+		var file sql.NullString
+		if err = rows.Scan(&file); err != nil {
+			return nil, fmt.Errorf("could not scan deleted export, %v", err)
+		}
+
+		if file.Valid {
+			files = append(files, file.String)
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not iterate deleted export rows, %v", err)
+	}
+
+	return files, nil
+}
+
+func scanExport(row scanner) (UserExport, error) {
+	var (
+		export UserExport
+		file   sql.NullString
+	)
+	err := row.Scan(&export.Id, &export.UserId, &file, &export.CreatedAt, &export.CompletedAt)
+	export.File = file.String
+	return export, err
+}
@@ -0,0 +1,87 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	. "social/internal/models"
+)
+
+func (p *Postgres) IsFollowing(ctx context.Context, followerId, followeeId int64) (bool, error) {
+	var following bool
+	query := "Select exists (select 1 from follows where follower_id = $1 and followee_id = $2)"
+	if err := p.q.QueryRowContext(ctx, query, followerId, followeeId).Scan(&following); err != nil {
+		return false, fmt.Errorf("could not query select existance of follow: %v", err)
+	}
+
+	return following, nil
+}
+
+func (p *Postgres) Follow(ctx context.Context, followerId, followeeId int64) (int, error) {
+	query := "insert into follows (follower_id, followee_id) values($1,$2)"
+	_, err := p.q.ExecContext(ctx, query, followerId, followeeId)
+	if isForeignKeyViolation(err) {
+		return 0, ErrNotFound
+	}
+
+	if err != nil {
+		return 0, fmt.Errorf("cannot add new row to follows: %v", err)
+	}
+
+	return p.updateFollowCounts(ctx, followerId, followeeId, 1)
+}
+
+func (p *Postgres) Unfollow(ctx context.Context, followerId, followeeId int64) (int, error) {
+	query := "Delete from follows where follower_id = $1 and followee_id = $2"
+	if _, err := p.q.ExecContext(ctx, query, followerId, followeeId); err != nil {
+		return 0, fmt.Errorf("could not delete follow: %v", err)
+	}
+
+	return p.updateFollowCounts(ctx, followerId, followeeId, -1)
+}
+
+func (p *Postgres) Followers(ctx context.Context, viewerId int64, username string, first int, after string) ([]UserProfile, error) {
+	return p.follows(ctx, "follows.follower_id", "follows.followee_id", viewerId, username, first, after)
+}
+
+func (p *Postgres) Followees(ctx context.Context, viewerId int64, username string, first int, after string) ([]UserProfile, error) {
+	return p.follows(ctx, "follows.followee_id", "follows.follower_id", viewerId, username, first, after)
+}
+
+func (p *Postgres) updateFollowCounts(ctx context.Context, followerId, followeeId int64, delta int) (int, error) {
+	query := "update users set followees_count = greatest(followees_count + $2, 0) where id = $1"
+	if _, err := p.q.ExecContext(ctx, query, followerId, delta); err != nil {
+		return 0, fmt.Errorf("could not update follower followees count: %v", err)
+	}
+
+	var followersCount int
+	query = "update users set followers_count = greatest(followers_count + $2, 0) where id = $1 returning followers_count"
+	if err := p.q.QueryRowContext(ctx, query, followeeId, delta).Scan(&followersCount); err != nil {
+		return 0, fmt.Errorf("could not update followee followers count: %v", err)
+	}
+
+	return followersCount, nil
+}
+
+// follows lists users in column listed of follows where column of user is user with username
+func (p *Postgres) follows(ctx context.Context, listed, of string, viewerId int64, username string, first int, after string) ([]UserProfile, error) {
+	query, args, err := queryBuilder(`SELECT `+profileColumns+`
+		FROM follows
+		INNER JOIN users ON `+listed+` = users.id
+		`+profileJoins+`
+		WHERE `+of+` = (SELECT id FROM users WHERE username = @username)
+		{{ if .auth }}AND `+of+` NOT IN `+hiddenUsers+` AND users.id NOT IN `+hiddenUsers+`{{ end }}
+		{{ if .after }}AND users.username > @after{{ end }}
+		ORDER BY users.username ASC
+		LIMIT @first`, map[string]interface{}{
+		"auth":     viewerId != 0,
+		"uid":      viewerId,
+		"username": username,
+		"first":    first,
+		"after":    after,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not build follows query , %v", err)
+	}
+
+	return p.queryProfiles(ctx, query, args, viewerId != 0)
+}
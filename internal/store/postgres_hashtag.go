@@ -0,0 +1,155 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/lib/pq"
+	. "social/internal/models"
+	"time"
+)
+
+// trendingLockKey key of the advisory lock held while ranking trending hashtags
+const trendingLockKey = 7418529631
+
+func (p *Postgres) SetPostHashtags(ctx context.Context, postId int64, tags []string) error {
+	if len(tags) != 0 {
+		query := "insert into hashtags (tag) select unnest($1::varchar[]) on conflict do nothing"
+		if _, err := p.q.ExecContext(ctx, query, pq.Array(tags)); err != nil {
+			return fmt.Errorf("could not insert hashtags, %v", err)
+		}
+	}
+
+	query := `delete from post_hashtags where post_id = $1
+		and hashtag_id not in (select id from hashtags where tag = any($2))`
+	if _, err := p.q.ExecContext(ctx, query, postId, pq.Array(tags)); err != nil {
+		return fmt.Errorf("could not delete post hashtags, %v", err)
+	}
+
+	query = `insert into post_hashtags (post_id, hashtag_id, created_at)
+		select posts.id, hashtags.id, posts.created_at from posts, hashtags
+		where posts.id = $1 and hashtags.tag = any($2)
+		on conflict do nothing`
+	if _, err := p.q.ExecContext(ctx, query, postId, pq.Array(tags)); err != nil {
+		return fmt.Errorf("could not insert post hashtags, %v", err)
+	}
+
+	return nil
+}
+
+func (p *Postgres) HashtagPosts(ctx context.Context, viewerId int64, tag string, last int, before int64) ([]Post, error) {
+	query, args, err := queryBuilder(`SELECT `+postColumns+`
+		FROM post_hashtags
+		INNER JOIN hashtags ON hashtags.id = post_hashtags.hashtag_id
+		INNER JOIN posts ON posts.id = post_hashtags.post_id
+		LEFT JOIN users ON users.id = posts.user_id
+		WHERE hashtags.tag = @tag
+		{{ if .before }}AND post_hashtags.post_id < @before{{ end }}
+		{{ if .uid }}AND posts.user_id NOT IN `+hiddenUsers+`{{ end }}
+		ORDER BY post_hashtags.post_id DESC
+		LIMIT @last`, map[string]interface{}{
+		"uid":    viewerId,
+		"tag":    tag,
+		"before": before,
+		"last":   last,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not build hashtag posts query, %v", err)
+	}
+
+	rows, err := p.q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("could not query hashtag posts, %v", err)
+	}
+
+	defer rows.Close()
+
+	posts := []Post{}
+	for rows.Next() {
+		post, err := scanPost(rows)
+		if err != nil {
+			return nil, fmt.Errorf("could not scan post, %v", err)
+		}
+
+		posts = append(posts, post)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not iterate hashtag post rows, %v", err)
+	}
+
+	return posts, nil
+}
+
+func (p *Postgres) RefreshTrendingHashtags(ctx context.Context, period string, window time.Duration, now time.Time, limit int) error {
+	if _, err := p.q.ExecContext(ctx, "delete from trending_hashtags where period = $1", period); err != nil {
+		return fmt.Errorf("could not clear trending hashtags, %v", err)
+	}
+
+	query := `with counts as (
+			select hashtag_id
+				, count(*) filter (where created_at >= $2::timestamptz - make_interval(secs => $3)) as current
+				, count(*) filter (where created_at < $2::timestamptz - make_interval(secs => $3)) as previous
+			from post_hashtags
+			where created_at >= $2::timestamptz - make_interval(secs => $3 * 2) and created_at < $2::timestamptz
+			group by hashtag_id
+		), scored as (
+			select hashtag_id, current, (current - previous)::float8 / sqrt((previous + 1)::float8) as score
+			from counts where current > 0
+			order by score desc, current desc, hashtag_id
+			limit $4
+		)
+		insert into trending_hashtags (period, rank, hashtag_id, posts_count, score, computed_at)
+		select $1, row_number() over (order by score desc, current desc, hashtag_id), hashtag_id, current, score, $2
+		from scored`
+	if _, err := p.q.ExecContext(ctx, query, period, now, window.Seconds(), limit); err != nil {
+		return fmt.Errorf("could not rank trending hashtags, %v", err)
+	}
+
+	return nil
+}
+
+func (p *Postgres) LockTrendingHashtags(ctx context.Context) (bool, error) {
+	var locked bool
+	if err := p.q.QueryRowContext(ctx, "select pg_try_advisory_xact_lock($1)", trendingLockKey).Scan(&locked); err != nil {
+		return false, fmt.Errorf("could not lock trending hashtags, %v", err)
+	}
+
+	return locked, nil
+}
+
+func (p *Postgres) TrendingHashtags(ctx context.Context, period string) ([]TrendingHashtag, time.Time, error) {
+	var computedAt sql.NullTime
+	query := "select max(computed_at) from trending_hashtags where period = $1"
+	if err := p.q.QueryRowContext(ctx, query, period).Scan(&computedAt); err != nil {
+		return nil, time.Time{}, fmt.Errorf("could not check trending hashtags, %v", err)
+	}
+
+	query = `select hashtags.tag, trending_hashtags.posts_count, trending_hashtags.score
+		from trending_hashtags
+		inner join hashtags on hashtags.id = trending_hashtags.hashtag_id
+		where trending_hashtags.period = $1
+		order by trending_hashtags.rank`
+	rows, err := p.q.QueryContext(ctx, query, period)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("could not query trending hashtags, %v", err)
+	}
+
+	defer rows.Close()
+
+	tags := []TrendingHashtag{}
+	for rows.Next() {
+		var t TrendingHashtag
+		if err = rows.Scan(&t.Tag, &t.PostsCount, &t.Score); err != nil {
+			return nil, time.Time{}, fmt.Errorf("could not scan trending hashtag, %v", err)
+		}
+
+		tags = append(tags, t)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, time.Time{}, fmt.Errorf("could not iterate trending hashtag rows, %v", err)
+	}
+
+	return tags, computedAt.Time, nil
+}
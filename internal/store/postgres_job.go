@@ -0,0 +1,84 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+func (p *Postgres) EnqueueJob(ctx context.Context, kind string, payload []byte, maxAttempts int) error {
+	query := "insert into jobs (kind, payload, max_attempts) values ($1, $2, $3)"
+	if _, err := p.q.ExecContext(ctx, query, kind, payload, maxAttempts); err != nil {
+		return fmt.Errorf("could not enqueue job, %v", err)
+	}
+
+	return nil
+}
+
+func (p *Postgres) ClaimJob(ctx context.Context, lease time.Duration) (Job, error) {
+	var job Job
+	query := `update jobs set status = 'running', attempts = attempts + 1, updated_at = now()
+		where id = (
+			select id from jobs
+			where (status = 'pending' and run_at <= now())
+				or (status = 'running' and updated_at < $1)
+			order by run_at
+			limit 1
+			for update skip locked
+		)
+		returning id, kind, payload, attempts, max_attempts`
+	err := p.q.QueryRowContext(ctx, query, time.Now().Add(-lease)).
+		Scan(&job.Id, &job.Kind, &job.Payload, &job.Attempts, &job.MaxAttempts)
+	if err == sql.ErrNoRows {
+		return job, ErrNotFound
+	}
+
+	if err != nil {
+		return job, fmt.Errorf("could not claim job, %v", err)
+	}
+
+	return job, nil
+}
+
+func (p *Postgres) CompleteJob(ctx context.Context, jobId int64) error {
+	query := "update jobs set status = 'done', last_error = null, updated_at = now() where id = $1"
+	if _, err := p.q.ExecContext(ctx, query, jobId); err != nil {
+		return fmt.Errorf("could not mark job %d as done, %v", jobId, err)
+	}
+
+	return nil
+}
+
+func (p *Postgres) RetryJob(ctx context.Context, jobId int64, lastError string, runAt time.Time) error {
+	query := "update jobs set status = 'pending', last_error = $2, run_at = $3, updated_at = now() where id = $1"
+	if _, err := p.q.ExecContext(ctx, query, jobId, lastError, runAt); err != nil {
+		return fmt.Errorf("could not reschedule job %d, %v", jobId, err)
+	}
+
+	return nil
+}
+
+func (p *Postgres) PurgeDoneJobs(ctx context.Context, before time.Time) (int64, error) {
+	query := "delete from jobs where status = 'done' and updated_at < $1"
+	res, err := p.q.ExecContext(ctx, query, before)
+	if err != nil {
+		return 0, fmt.Errorf("could not purge done jobs, %v", err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("could not count purged jobs, %v", err)
+	}
+
+	return n, nil
+}
+
+func (p *Postgres) KillJob(ctx context.Context, jobId int64, lastError string) error {
+	query := "update jobs set status = 'dead', last_error = $2, updated_at = now() where id = $1"
+	if _, err := p.q.ExecContext(ctx, query, jobId, lastError); err != nil {
+		return fmt.Errorf("could not mark job %d as dead, %v", jobId, err)
+	}
+
+	return nil
+}
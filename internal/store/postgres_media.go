@@ -0,0 +1,137 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"github.com/lib/pq"
+	. "social/internal/models"
+	"time"
+)
+
+func (p *Postgres) CreateMedia(ctx context.Context, m Media) (Media, error) {
+	query := `insert into media (user_id, file, thumbnail, width, height, blurhash, alt_text)
+		values ($1, $2, $3, $4, $5, $6, $7) returning id, created_at`
+	err := p.q.QueryRowContext(ctx, query, m.UserId, m.File, m.Thumbnail, m.Width, m.Height, m.Blurhash, m.AltText).
+		Scan(&m.Id, &m.CreatedAt)
+	if err != nil {
+		return m, fmt.Errorf("could not insert media, %v", err)
+	}
+
+	return m, nil
+}
+
+func (p *Postgres) AttachMedia(ctx context.Context, userId, postId int64, mediaIds []int64) error {
+	if len(mediaIds) == 0 {
+		return nil
+	}
+
+	query := `update media set post_id = $2, position = array_position($3::int[], id)
+		where id = any($3) and user_id = $1 and post_id is null`
+	res, err := p.q.ExecContext(ctx, query, userId, postId, pq.Array(mediaIds))
+	if err != nil {
+		return fmt.Errorf("could not attach media, %v", err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("could not count attached media, %v", err)
+	}
+
+	if int(n) != len(mediaIds) {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (p *Postgres) PostMedia(ctx context.Context, postIds []int64) (map[int64][]Media, error) {
+	media := map[int64][]Media{}
+	if len(postIds) == 0 {
+		return media, nil
+	}
+
+	query := `select id, user_id, post_id, file, thumbnail, width, height, blurhash, alt_text, created_at
+		from media where post_id = any($1) order by post_id, position`
+	rows, err := p.q.QueryContext(ctx, query, pq.Array(postIds))
+	if err != nil {
+		return nil, fmt.Errorf("could not query post media, %v", err)
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var m Media
+		err = rows.Scan(&m.Id, &m.UserId, &m.PostId, &m.File, &m.Thumbnail, &m.Width, &m.Height, &m.Blurhash,
+			&m.AltText, &m.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("could not scan media, %v", err)
+		}
+
+		media[*m.PostId] = append(media[*m.PostId], m)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not iterate media rows, %v", err)
+	}
+
+	return media, nil
+}
+
+func (p *Postgres) DeleteUnattachedMedia(ctx context.Context, before time.Time, limit int) ([]string, error) {
+	// post_id is checked again on delete as media may get attached meanwhile
+	query := `delete from media
+		where post_id is null and id in (
+			select id from media where post_id is null and created_at < $1
+			order by id limit $2
+			for update skip locked
+		)
+		returning file, thumbnail`
+	rows, err := p.q.QueryContext(ctx, query, before, limit)
+	if err != nil {
+		return nil, fmt.Errorf("could not delete unattached media, %v", err)
+	}
+
+	defer rows.Close()
+
+	var files []string
+	for rows.Next() {
+		var file, thumbnail string
+		if err = rows.Scan(&file, &thumbnail); err != nil {
+			return nil, fmt.Errorf("could not scan deleted media, %v", err)
+		}
+
+		files = append(files, file, thumbnail)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not iterate deleted media rows, %v", err)
+	}
+
+	return files, nil
+}
+
+// deleteUserMedia deletes media uploaded by user and returns names of its files
+func (p *Postgres) deleteUserMedia(ctx context.Context, userId int64) ([]string, error) {
+	rows, err := p.q.QueryContext(ctx, "delete from media where user_id = $1 returning file, thumbnail", userId)
+	if err != nil {
+		return nil, fmt.Errorf("could not delete media of user, %v", err)
+	}
+
+	defer rows.Close()
+
+	var files []string
+	for rows.Next() {
+		var file, thumbnail string
+		if err = rows.Scan(&file, &thumbnail); err != nil {
+			return nil, fmt.Errorf("could not scan deleted media, %v", err)
+		}
+
+		files = append(files, file, thumbnail)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not iterate deleted media rows, %v", err)
+	}
+
+	return files, nil
+}
@@ -0,0 +1,235 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/lib/pq"
+	. "social/internal/models"
+	"time"
+)
+
+func (p *Postgres) SetPostMentions(ctx context.Context, postId int64, mentions []Mention) ([]int64, error) {
+	return p.setMentions(ctx, "post_mentions", "post_id", postId, mentions)
+}
+
+func (p *Postgres) AddCommentMentions(ctx context.Context, commentId int64, mentions []Mention) error {
+	_, err := p.setMentions(ctx, "comment_mentions", "comment_id", commentId, mentions)
+	return err
+}
+
+func (p *Postgres) PostMentions(ctx context.Context, postIds []int64) (map[int64][]Mention, error) {
+	return p.mentions(ctx, "post_mentions", "post_id", postIds)
+}
+
+func (p *Postgres) CommentMentions(ctx context.Context, commentIds []int64) (map[int64][]Mention, error) {
+	return p.mentions(ctx, "comment_mentions", "comment_id", commentIds)
+}
+
+func (p *Postgres) Mentions(ctx context.Context, userId int64, last int, before MentionCursor) ([]MentionItem, error) {
+	query, args, err := queryBuilder(`SELECT mentions.created_at, mentions.post_id, mentions.comment_id
+		FROM (
+			SELECT min(post_mentions.created_at) AS created_at, post_mentions.post_id, 0 AS comment_id
+			FROM post_mentions
+			INNER JOIN posts ON posts.id = post_mentions.post_id
+			WHERE post_mentions.user_id = @uid AND posts.user_id NOT IN `+hiddenUsers+`
+			GROUP BY post_mentions.post_id
+			UNION ALL
+			SELECT min(comment_mentions.created_at), comments.post_id, comment_mentions.comment_id
+			FROM comment_mentions
+			INNER JOIN comments ON comments.id = comment_mentions.comment_id
+			WHERE comment_mentions.user_id = @uid AND comments.user_id NOT IN `+hiddenUsers+`
+			GROUP BY comment_mentions.comment_id, comments.post_id
+		) AS mentions
+		{{ if .cursor }}
+		WHERE (mentions.created_at, mentions.post_id, mentions.comment_id) < (@at, @postId, @commentId)
+		{{ end }}
+		ORDER BY mentions.created_at DESC, mentions.post_id DESC, mentions.comment_id DESC
+		LIMIT @last`, map[string]interface{}{
+		"uid":       userId,
+		"cursor":    !before.CreatedAt.IsZero(),
+		"at":        before.CreatedAt,
+		"postId":    before.PostId,
+		"commentId": before.CommentId,
+		"last":      last,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not build mentions query, %v", err)
+	}
+
+	rows, err := p.q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("could not query mentions, %v", err)
+	}
+
+	defer rows.Close()
+
+	type mentionRef struct {
+		createdAt         time.Time
+		postId, commentId int64
+	}
+
+	var (
+		refs                []mentionRef
+		postIds, commentIds []int64
+	)
+	for rows.Next() {
+		var ref mentionRef
+		if err = rows.Scan(&ref.createdAt, &ref.postId, &ref.commentId); err != nil {
+			return nil, fmt.Errorf("could not scan mention, %v", err)
+		}
+
+		refs = append(refs, ref)
+		if ref.commentId == 0 {
+			postIds = append(postIds, ref.postId)
+		} else {
+			commentIds = append(commentIds, ref.commentId)
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not iterate mention rows, %v", err)
+	}
+
+	posts, err := p.PostsByIds(ctx, postIds)
+	if err != nil {
+		return nil, err
+	}
+
+	comments := map[int64]Comment{}
+	if len(commentIds) != 0 {
+		query, args, err = queryBuilder(`SELECT `+commentColumns+`
+			FROM comments
+			`+commentJoins+`
+			WHERE comments.id = ANY(@ids)`, map[string]interface{}{
+			"auth": true,
+			"uid":  userId,
+			"ids":  pq.Array(commentIds),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("could not build mentioned comments query, %v", err)
+		}
+
+		cc, err := p.queryComments(ctx, query, args, userId)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, c := range cc {
+			comments[c.Id] = c
+		}
+	}
+
+	items := []MentionItem{}
+	for _, ref := range refs {
+		item := MentionItem{CreatedAt: ref.createdAt}
+		if ref.commentId == 0 {
+			post, ok := posts[ref.postId]
+			if !ok {
+				continue
+			}
+
+			item.Post = &post
+		} else {
+			c, ok := comments[ref.commentId]
+			if !ok {
+				continue
+			}
+
+			item.Comment = &c
+		}
+
+		items = append(items, item)
+	}
+
+	return items, nil
+}
+
+// setMentions replaces mentions in row with id of table whose id column is column
+func (p *Postgres) setMentions(ctx context.Context, table, column string, id int64, mentions []Mention) ([]int64, error) {
+	query := "delete from " + table + " where " + column + " = $1 returning user_id, created_at"
+	rows, err := p.q.QueryContext(ctx, query, id)
+	if err != nil {
+		return nil, fmt.Errorf("could not delete mentions, %v", err)
+	}
+
+	defer rows.Close()
+
+	// mentionedAt when each user was first mentioned
+	mentionedAt := map[int64]time.Time{}
+	for rows.Next() {
+		var (
+			userId    int64
+			createdAt time.Time
+		)
+		if err = rows.Scan(&userId, &createdAt); err != nil {
+			return nil, fmt.Errorf("could not scan deleted mention, %v", err)
+		}
+
+		if at, ok := mentionedAt[userId]; !ok || createdAt.Before(at) {
+			mentionedAt[userId] = createdAt
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not iterate deleted mention rows, %v", err)
+	}
+
+	var newUserIds []int64
+	added := map[int64]bool{}
+	// now() is the same for the whole transaction, so every mention of new user gets the same time
+	query = "insert into " + table + " (" + column + ", user_id, start_offset, end_offset, created_at)" +
+		" values ($1, $2, $3, $4, coalesce($5, now()))"
+	for _, m := range mentions {
+		var createdAt sql.NullTime
+		createdAt.Time, createdAt.Valid = mentionedAt[m.User.Id]
+		if !createdAt.Valid && !added[m.User.Id] {
+			added[m.User.Id] = true
+			newUserIds = append(newUserIds, m.User.Id)
+		}
+
+		if _, err = p.q.ExecContext(ctx, query, id, m.User.Id, m.Start, m.End, createdAt); err != nil {
+			return nil, fmt.Errorf("could not insert mention, %v", err)
+		}
+	}
+
+	return newUserIds, nil
+}
+
+// mentions lists mentions of rows with ids of table whose id column is column
+func (p *Postgres) mentions(ctx context.Context, table, column string, ids []int64) (map[int64][]Mention, error) {
+	mentions := map[int64][]Mention{}
+	if len(ids) == 0 {
+		return mentions, nil
+	}
+
+	query := "select " + table + "." + column + ", " + table + ".start_offset, " + table + ".end_offset" +
+		", users.id, users.username, users.avatar_url from " + table +
+		" inner join users on users.id = " + table + ".user_id" +
+		" where " + table + "." + column + " = any($1)" +
+		" order by " + table + "." + column + ", " + table + ".start_offset"
+	rows, err := p.q.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return nil, fmt.Errorf("could not query mentions, %v", err)
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			id int64
+			m  Mention
+		)
+		if err = rows.Scan(&id, &m.Start, &m.End, &m.User.Id, &m.User.Username, &m.User.AvatarUrl); err != nil {
+			return nil, fmt.Errorf("could not scan mention, %v", err)
+		}
+
+		mentions[id] = append(mentions[id], m)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not iterate mention rows, %v", err)
+	}
+
+	return mentions, nil
+}
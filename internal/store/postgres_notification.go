@@ -0,0 +1,206 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/lib/pq"
+	. "social/internal/models"
+)
+
+// notificationActorsShown how many of the most recent actors are returned by username
+const notificationActorsShown = 2
+
+// notificationsFrom notifications along with visible.ids, their actors in order they acted leaving out users
+// the notified user muted, blocked or was blocked by, notifications with no such actors left are not shown
+const notificationsFrom = `notifications
+	CROSS JOIN LATERAL (
+		SELECT array(
+			SELECT actors.id FROM unnest(notifications.actor_ids) WITH ORDINALITY AS actors(id, ord)
+			WHERE actors.id NOT IN (
+				SELECT muted_id FROM mutes WHERE muter_id = notifications.user_id
+				UNION ALL SELECT blocked_id FROM blocks WHERE blocker_id = notifications.user_id
+				UNION ALL SELECT blocker_id FROM blocks WHERE blocked_id = notifications.user_id
+			)
+			ORDER BY actors.ord
+		) AS ids
+	) AS visible`
+
+const notificationColumns = `notifications.id, notifications.user_id
+	, array(
+		select users.username from unnest(visible.ids) with ordinality as actors(id, ord)
+		inner join users on users.id = actors.id
+		order by actors.ord desc
+		limit @actorsShown
+	) as actors
+	, cardinality(visible.ids) as actors_count
+	, notifications.kind, notifications.post_id
+	, notifications.read_at is not null as read, notifications.issued_at`
+
+func (p *Postgres) Notify(ctx context.Context, userId, actorId int64, kind string, postId *int64) (int64, error) {
+	query, args, err := queryBuilder(`INSERT INTO notifications (user_id, actor_ids, kind, post_id)
+		VALUES (@userId, ARRAY[@actorId::int], @kind, @postId)
+		ON CONFLICT (user_id, kind, coalesce(post_id, 0)) WHERE read_at IS NULL
+		DO UPDATE SET
+			actor_ids = array_append(array_remove(notifications.actor_ids, @actorId::int), @actorId::int),
+			issued_at = now()
+		RETURNING id`, map[string]interface{}{
+		"userId":  userId,
+		"actorId": actorId,
+		"kind":    kind,
+		"postId":  postId,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("could not build notification query, %v", err)
+	}
+
+	var id int64
+	if err = p.q.QueryRowContext(ctx, query, args...).Scan(&id); err != nil {
+		return 0, fmt.Errorf("could not insert %s notification, %v", kind, err)
+	}
+
+	return id, nil
+}
+
+func (p *Postgres) RetractNotification(ctx context.Context, userId, actorId int64, kind string, postId *int64) error {
+	query, args, err := queryBuilder(`UPDATE notifications
+		SET actor_ids = array_remove(actor_ids, @actorId::int)
+		WHERE user_id = @userId AND kind = @kind AND coalesce(post_id, 0) = coalesce(@postId::int, 0)
+		AND read_at IS NULL`, map[string]interface{}{
+		"userId":  userId,
+		"actorId": actorId,
+		"kind":    kind,
+		"postId":  postId,
+	})
+	if err != nil {
+		return fmt.Errorf("could not build notification query, %v", err)
+	}
+
+	if _, err = p.q.ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("could not retract %s notification, %v", kind, err)
+	}
+
+	query = "delete from notifications where user_id = $1 and read_at is null and cardinality(actor_ids) = 0"
+	if _, err = p.q.ExecContext(ctx, query, userId); err != nil {
+		return fmt.Errorf("could not delete empty notifications, %v", err)
+	}
+
+	return nil
+}
+
+func (p *Postgres) Notification(ctx context.Context, notificationId int64) (Notification, error) {
+	var n Notification
+	query, args, err := queryBuilder(`SELECT `+notificationColumns+` FROM `+notificationsFrom+`
+		WHERE notifications.id = @id AND cardinality(visible.ids) > 0`,
+		map[string]interface{}{
+			"id":          notificationId,
+			"actorsShown": notificationActorsShown,
+		})
+	if err != nil {
+		return n, fmt.Errorf("could not build notification query, %v", err)
+	}
+
+	err = scanNotification(p.q.QueryRowContext(ctx, query, args...), &n)
+	if err == sql.ErrNoRows {
+		return n, ErrNotFound
+	}
+
+	if err != nil {
+		return n, fmt.Errorf("could not fetch notification, %v", err)
+	}
+
+	return n, nil
+}
+
+func (p *Postgres) Notifications(ctx context.Context, userId int64, last int, before int64) ([]Notification, error) {
+	query, args, err := queryBuilder(`SELECT `+notificationColumns+`
+		FROM `+notificationsFrom+`
+		WHERE notifications.user_id = @uid
+		AND cardinality(visible.ids) > 0
+		{{ if .before }}
+		AND (notifications.issued_at, notifications.id) < (
+			SELECT issued_at, id FROM notifications WHERE id = @before AND user_id = @uid
+		)
+		{{ end }}
+		ORDER BY notifications.issued_at DESC, notifications.id DESC
+		LIMIT @last`, map[string]interface{}{
+		"uid":         userId,
+		"before":      before,
+		"last":        last,
+		"actorsShown": notificationActorsShown,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not build notifications query, %v", err)
+	}
+
+	rows, err := p.q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("could not query notifications, %v", err)
+	}
+
+	defer rows.Close()
+
+	notifications := make([]Notification, 0, last)
+	for rows.Next() {
+		var n Notification
+		if err = scanNotification(rows, &n); err != nil {
+			return nil, fmt.Errorf("could not scan notification, %v", err)
+		}
+
+		notifications = append(notifications, n)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not iterate notification rows, %v", err)
+	}
+
+	return notifications, nil
+}
+
+func (p *Postgres) UnreadNotificationsCount(ctx context.Context, userId int64) (int, error) {
+	var count int
+	query := `select count(*) from ` + notificationsFrom + `
+		where notifications.user_id = $1 and notifications.read_at is null and cardinality(visible.ids) > 0`
+	if err := p.q.QueryRowContext(ctx, query, userId).Scan(&count); err != nil {
+		return 0, fmt.Errorf("could not count unread notifications, %v", err)
+	}
+
+	return count, nil
+}
+
+func (p *Postgres) MarkNotificationAsRead(ctx context.Context, userId, notificationId int64) error {
+	query := "update notifications set read_at = coalesce(read_at, now()) where id = $1 and user_id = $2"
+	res, err := p.q.ExecContext(ctx, query, notificationId, userId)
+	if err != nil {
+		return fmt.Errorf("could not mark notification as read, %v", err)
+	}
+
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (p *Postgres) MarkNotificationsAsRead(ctx context.Context, userId int64) error {
+	query := "update notifications set read_at = now() where user_id = $1 and read_at is null"
+	if _, err := p.q.ExecContext(ctx, query, userId); err != nil {
+		return fmt.Errorf("could not mark notifications as read, %v", err)
+	}
+
+	return nil
+}
+
+func scanNotification(row scanner, n *Notification) error {
+	var postId sql.NullInt64
+	if err := row.Scan(&n.Id, &n.UserId, pq.Array(&n.Actors), &n.ActorsCount,
+		&n.Kind, &postId, &n.Read, &n.IssuedAt); err != nil {
+		return err
+	}
+
+	if postId.Valid {
+		n.PostId = &postId.Int64
+	}
+
+	return nil
+}
@@ -0,0 +1,359 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/lib/pq"
+	. "social/internal/models"
+)
+
+const postColumns = `posts.id, posts.content, posts.nsfw, posts.spoiler_of, posts.user_id
+	, posts.created_at, posts.edited_at, posts.likes_count, posts.comments_count
+	, posts.reposts_count, posts.quote_of
+	, users.username, users.avatar_url`
+
+func (p *Postgres) CreatePost(ctx context.Context, userId int64, content string, spoilerOf *string, nsfw bool, quoteOf *int64) (Post, error) {
+	post := Post{UserId: userId, Content: content, SpoilerOf: spoilerOf, NSFW: nsfw, QuoteOfId: quoteOf}
+	query := "INSERT INTO posts (user_id, content, spoiler_of, nsfw, quote_of) VALUES ($1, $2, $3, $4, $5) returning id, created_at"
+	err := p.q.QueryRowContext(ctx, query, userId, content, spoilerOf, nsfw, quoteOf).Scan(&post.Id, &post.CreateAt)
+	if isForeignKeyViolation(err) {
+		return post, ErrNotFound
+	}
+
+	if err != nil {
+		return post, fmt.Errorf("cannot insert post to db, %v", err)
+	}
+
+	return post, nil
+}
+
+func (p *Postgres) Post(ctx context.Context, postId int64) (Post, error) {
+	query := `select ` + postColumns + ` from posts
+		left join users on users.id = posts.user_id where posts.id = $1`
+	post, err := scanPost(p.q.QueryRowContext(ctx, query, postId))
+	if err == sql.ErrNoRows {
+		return post, ErrNotFound
+	}
+
+	if err != nil {
+		return post, fmt.Errorf("could not fetch post from db, %v", err)
+	}
+
+	return post, nil
+}
+
+func (p *Postgres) PostsByIds(ctx context.Context, postIds []int64) (map[int64]Post, error) {
+	posts := map[int64]Post{}
+	if len(postIds) == 0 {
+		return posts, nil
+	}
+
+	query := `select ` + postColumns + ` from posts
+		left join users on users.id = posts.user_id where posts.id = any($1)`
+	rows, err := p.q.QueryContext(ctx, query, pq.Array(postIds))
+	if err != nil {
+		return nil, fmt.Errorf("could not query posts by ids, %v", err)
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		post, err := scanPost(rows)
+		if err != nil {
+			return nil, fmt.Errorf("could not scan post, %v", err)
+		}
+
+		posts[post.Id] = post
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not iterate post rows, %v", err)
+	}
+
+	return posts, nil
+}
+
+func (p *Postgres) PostExists(ctx context.Context, postId int64) (bool, error) {
+	var exists bool
+	query := "select exists (select 1 from posts where id = $1)"
+	if err := p.q.QueryRowContext(ctx, query, postId).Scan(&exists); err != nil {
+		return false, fmt.Errorf("could not check post existence, %v", err)
+	}
+
+	return exists, nil
+}
+
+func (p *Postgres) Posts(ctx context.Context, viewerId, userId int64, limit int) ([]Post, error) {
+	query, args, err := queryBuilder(`select `+postColumns+` from posts
+		left join users on users.id = posts.user_id
+		where true
+		{{ if .userId }}and posts.user_id = @userId{{ end }}
+		{{ if .uid }}and posts.user_id not in `+hiddenUsers+`{{ end }}
+		order by posts.created_at desc
+		limit @limit`, map[string]interface{}{
+		"uid":    viewerId,
+		"userId": userId,
+		"limit":  limit,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not generate query, %v", err)
+	}
+
+	rows, err := p.q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("could not query posts, %v", err)
+	}
+
+	defer rows.Close()
+
+	var posts []Post
+	for rows.Next() {
+		post, err := scanPost(rows)
+		if err != nil {
+			return nil, fmt.Errorf("could not scan post, %v", err)
+		}
+
+		posts = append(posts, post)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not iterate post rows, %v", err)
+	}
+
+	return posts, nil
+}
+
+func (p *Postgres) LockPost(ctx context.Context, postId int64) (int64, error) {
+	var authorId int64
+	query := "select user_id from posts where id = $1 for update"
+	err := p.q.QueryRowContext(ctx, query, postId).Scan(&authorId)
+	if err == sql.ErrNoRows {
+		return 0, ErrNotFound
+	}
+
+	if err != nil {
+		return 0, fmt.Errorf("could not fetch post, %v", err)
+	}
+
+	return authorId, nil
+}
+
+func (p *Postgres) AddPostRevision(ctx context.Context, postId int64) error {
+	query := `insert into post_revisions (post_id, content, spoiler_of, nsfw)
+		select id, content, spoiler_of, nsfw from posts where id = $1`
+	if _, err := p.q.ExecContext(ctx, query, postId); err != nil {
+		return fmt.Errorf("could not insert post revision, %v", err)
+	}
+
+	return nil
+}
+
+func (p *Postgres) UpdatePost(ctx context.Context, postId int64, content string, spoilerOf *string, nsfw bool) (Post, error) {
+	post := Post{Id: postId, Content: content, SpoilerOf: spoilerOf, NSFW: nsfw}
+	query := `update posts set content = $2, spoiler_of = $3, nsfw = $4, edited_at = now() where id = $1
+		returning user_id, created_at, edited_at, likes_count, comments_count, reposts_count, quote_of`
+	err := p.q.QueryRowContext(ctx, query, postId, content, spoilerOf, nsfw).
+		Scan(&post.UserId, &post.CreateAt, &post.EditedAt, &post.LikesCount, &post.CommentsCount,
+			&post.RepostsCount, &post.QuoteOfId)
+	if err == sql.ErrNoRows {
+		return post, ErrNotFound
+	}
+
+	if err != nil {
+		return post, fmt.Errorf("could not update post, %v", err)
+	}
+
+	return post, nil
+}
+
+func (p *Postgres) DeletePost(ctx context.Context, postId int64) error {
+	// rows referencing the post are removed by on delete cascade
+	if _, err := p.q.ExecContext(ctx, "delete from posts where id = $1", postId); err != nil {
+		return fmt.Errorf("could not delete post, %v", err)
+	}
+
+	return nil
+}
+
+func (p *Postgres) PostRevisions(ctx context.Context, postId int64) ([]PostRevision, error) {
+	query := `select id, post_id, content, spoiler_of, nsfw, created_at from post_revisions
+		where post_id = $1 order by created_at desc, id desc`
+	rows, err := p.q.QueryContext(ctx, query, postId)
+	if err != nil {
+		return nil, fmt.Errorf("could not query post revisions, %v", err)
+	}
+
+	defer rows.Close()
+
+	revisions := []PostRevision{}
+	for rows.Next() {
+		var revision PostRevision
+		if err = rows.Scan(&revision.Id, &revision.PostId, &revision.Content, &revision.SpoilerOf,
+			&revision.NSFW, &revision.CreatedAt); err != nil {
+			return nil, fmt.Errorf("could not scan post revision, %v", err)
+		}
+
+		revisions = append(revisions, revision)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not iterate post revision rows, %v", err)
+	}
+
+	return revisions, nil
+}
+
+func (p *Postgres) IsPostLiked(ctx context.Context, userId, postId int64) (bool, error) {
+	var liked bool
+	query := "select exists (select 1 from post_likes where user_id = $1 and post_id = $2)"
+	if err := p.q.QueryRowContext(ctx, query, userId, postId).Scan(&liked); err != nil {
+		return false, fmt.Errorf("could not select posts like existance, %v", err)
+	}
+
+	return liked, nil
+}
+
+func (p *Postgres) LikePost(ctx context.Context, userId, postId int64) (int, int64, error) {
+	query := "insert into post_likes (user_id, post_id) values ($1,$2)"
+	_, err := p.q.ExecContext(ctx, query, userId, postId)
+	if isForeignKeyViolation(err) {
+		return 0, 0, ErrNotFound
+	}
+
+	if err != nil {
+		return 0, 0, fmt.Errorf("could not insert like for post, %v", err)
+	}
+
+	return p.updatePostLikesCount(ctx, postId, 1)
+}
+
+func (p *Postgres) UnlikePost(ctx context.Context, userId, postId int64) (int, int64, error) {
+	query := "delete from post_likes where user_id = $1 and post_id = $2"
+	if _, err := p.q.ExecContext(ctx, query, userId, postId); err != nil {
+		return 0, 0, fmt.Errorf("could not remove like from post, %v", err)
+	}
+
+	return p.updatePostLikesCount(ctx, postId, -1)
+}
+
+func (p *Postgres) IsPostReposted(ctx context.Context, userId, postId int64) (bool, error) {
+	var reposted bool
+	query := "select exists (select 1 from reposts where user_id = $1 and post_id = $2)"
+	if err := p.q.QueryRowContext(ctx, query, userId, postId).Scan(&reposted); err != nil {
+		return false, fmt.Errorf("could not check repost existence, %v", err)
+	}
+
+	return reposted, nil
+}
+
+func (p *Postgres) Repost(ctx context.Context, userId, postId int64) (int, int64, error) {
+	query := "insert into reposts (user_id, post_id) values ($1, $2)"
+	_, err := p.q.ExecContext(ctx, query, userId, postId)
+	if isForeignKeyViolation(err) {
+		return 0, 0, ErrNotFound
+	}
+
+	if err != nil {
+		return 0, 0, fmt.Errorf("could not insert repost, %v", err)
+	}
+
+	return p.updatePostRepostsCount(ctx, postId, 1)
+}
+
+func (p *Postgres) Unrepost(ctx context.Context, userId, postId int64) (int, int64, error) {
+	query := "delete from reposts where user_id = $1 and post_id = $2"
+	if _, err := p.q.ExecContext(ctx, query, userId, postId); err != nil {
+		return 0, 0, fmt.Errorf("could not delete repost, %v", err)
+	}
+
+	// fanout skipped timelines having the post already, so other reposts may have no item of their own
+	query = `update timeline set reposted_by = remaining.user_id
+		from (
+			select distinct on (timeline.id) timeline.id, reposts.user_id
+			from timeline
+			inner join reposts on reposts.post_id = timeline.post_id
+			where timeline.reposted_by = $1 and timeline.post_id = $2
+				and (reposts.user_id = timeline.user_id or exists (
+					select 1 from follows
+					where follows.follower_id = timeline.user_id and follows.followee_id = reposts.user_id
+				))
+				and not exists (
+					select 1 from mutes
+					where mutes.muter_id = timeline.user_id and mutes.muted_id = reposts.user_id
+				)
+			order by timeline.id, reposts.created_at desc
+		) as remaining
+		where timeline.id = remaining.id`
+	if _, err := p.q.ExecContext(ctx, query, userId, postId); err != nil {
+		return 0, 0, fmt.Errorf("could not credit reposted timeline items to remaining reposts, %v", err)
+	}
+
+	query = "delete from timeline where reposted_by = $1 and post_id = $2"
+	if _, err := p.q.ExecContext(ctx, query, userId, postId); err != nil {
+		return 0, 0, fmt.Errorf("could not delete reposted timeline items, %v", err)
+	}
+
+	return p.updatePostRepostsCount(ctx, postId, -1)
+}
+
+func (p *Postgres) IncrementCommentsCount(ctx context.Context, postId int64) (int64, error) {
+	var authorId int64
+	query := "update posts set comments_count = comments_count + 1 where id = $1 returning user_id"
+	err := p.q.QueryRowContext(ctx, query, postId).Scan(&authorId)
+	if err == sql.ErrNoRows {
+		return 0, ErrNotFound
+	}
+
+	if err != nil {
+		return 0, fmt.Errorf("cannot update post comments count, %v", err)
+	}
+
+	return authorId, nil
+}
+
+func (p *Postgres) updatePostLikesCount(ctx context.Context, postId int64, delta int) (int, int64, error) {
+	var (
+		likesCount int
+		authorId   int64
+	)
+	query := "update posts set likes_count = likes_count + $2 where id = $1 returning likes_count, user_id"
+	err := p.q.QueryRowContext(ctx, query, postId, delta).Scan(&likesCount, &authorId)
+	if err == sql.ErrNoRows {
+		return 0, 0, ErrNotFound
+	}
+
+	if err != nil {
+		return 0, 0, fmt.Errorf("could not update post likes count, %v", err)
+	}
+
+	return likesCount, authorId, nil
+}
+
+func (p *Postgres) updatePostRepostsCount(ctx context.Context, postId int64, delta int) (int, int64, error) {
+	var (
+		repostsCount int
+		authorId     int64
+	)
+	query := "update posts set reposts_count = reposts_count + $2 where id = $1 returning reposts_count, user_id"
+	err := p.q.QueryRowContext(ctx, query, postId, delta).Scan(&repostsCount, &authorId)
+	if err == sql.ErrNoRows {
+		return 0, 0, ErrNotFound
+	}
+
+	if err != nil {
+		return 0, 0, fmt.Errorf("could not update post reposts count, %v", err)
+	}
+
+	return repostsCount, authorId, nil
+}
+
+func scanPost(row scanner) (Post, error) {
+	var post Post
+	err := row.Scan(&post.Id, &post.Content, &post.NSFW, &post.SpoilerOf, &post.UserId,
+		&post.CreateAt, &post.EditedAt, &post.LikesCount, &post.CommentsCount,
+		&post.RepostsCount, &post.QuoteOfId, &post.User.Username, &post.User.AvatarUrl)
+	post.User.Id = post.UserId
+
+	return post, err
+}
@@ -0,0 +1,113 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// headlineOptions of ts_headline, a few fragments around the matches
+var headlineOptions = fmt.Sprintf(`StartSel="%s", StopSel="%s", MaxFragments=2, MaxWords=20, MinWords=8, FragmentDelimiter=" … "`,
+	SnippetStart, SnippetStop)
+
+func (p *Postgres) SearchPosts(ctx context.Context, search PostSearch, limit int, afterScore float64, afterId int64) ([]PostMatch, error) {
+	// snippets are only made for the page, not for every match
+	query, args, err := queryBuilder(`SELECT `+postColumns+`, matches.score
+		, ts_headline('simple', posts.content, to_tsquery('simple', @query), @headline) AS snippet
+		FROM (
+			SELECT posts.id, ts_rank_cd(posts.search_vector, query)::float8
+				/ (1 + greatest(extract(epoch FROM @asOf::timestamptz - posts.created_at)::float8, 0) / @scale) AS score
+			FROM posts, to_tsquery('simple', @query) AS query
+			WHERE posts.search_vector @@ query
+			{{ if .authorId }}AND posts.user_id = @authorId{{ end }}
+			{{ if .from }}AND posts.created_at >= @from{{ end }}
+			{{ if .to }}AND posts.created_at < @to{{ end }}
+			{{ if .spoiler }}AND posts.spoiler_of IS {{ if .hasSpoiler }}NOT {{ end }}NULL{{ end }}
+			{{ if .excludeNSFW }}AND NOT posts.nsfw{{ end }}
+			{{ if .uid }}AND posts.user_id NOT IN `+hiddenUsers+`{{ end }}
+		) AS matches
+		INNER JOIN posts ON posts.id = matches.id
+		LEFT JOIN users ON users.id = posts.user_id
+		{{ if .afterId }}WHERE (matches.score, matches.id) < (@afterScore::float8, @afterId){{ end }}
+		ORDER BY matches.score DESC, matches.id DESC
+		LIMIT @limit`, map[string]interface{}{
+		"query":       tsQuery(search.Terms),
+		"headline":    headlineOptions,
+		"asOf":        search.AsOf,
+		"scale":       searchRecencyScale.Seconds(),
+		"authorId":    search.AuthorId,
+		"from":        nullTime(search.From),
+		"to":          nullTime(search.To),
+		"spoiler":     search.Spoiler != nil,
+		"hasSpoiler":  search.Spoiler != nil && *search.Spoiler,
+		"excludeNSFW": search.ExcludeNSFW,
+		"uid":         search.ViewerId,
+		"afterScore":  afterScore,
+		"afterId":     afterId,
+		"limit":       limit,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not build post search query, %v", err)
+	}
+
+	rows, err := p.q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("could not search posts, %v", err)
+	}
+
+	defer rows.Close()
+
+	matches := []PostMatch{}
+	for rows.Next() {
+		var m PostMatch
+		if m.Post, err = scanPost(extraScanner{rows, []interface{}{&m.Score, &m.Snippet}}); err != nil {
+			return nil, fmt.Errorf("could not scan post match, %v", err)
+		}
+
+		matches = append(matches, m)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not iterate post match rows, %v", err)
+	}
+
+	return matches, nil
+}
+
+// tsQuery joins terms into tsquery, words hold letters and digits only so they need no quoting
+func tsQuery(terms []SearchTerm) string {
+	parts := make([]string, 0, len(terms))
+	for _, term := range terms {
+		if len(term.Words) == 0 {
+			continue
+		}
+
+		phrase := strings.Join(term.Words, " <-> ")
+		if term.Prefix {
+			phrase += ":*"
+		}
+		parts = append(parts, "("+phrase+")")
+	}
+
+	return strings.Join(parts, " & ")
+}
+
+// nullTime maps zero time to nil, so template conditions on it are false
+func nullTime(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+
+	return t
+}
+
+// extraScanner scans columns following the ones scanned by a shared scan function into extra
+type extraScanner struct {
+	row   scanner
+	extra []interface{}
+}
+
+func (s extraScanner) Scan(dest ...interface{}) error {
+	return s.row.Scan(append(dest, s.extra...)...)
+}
@@ -0,0 +1,138 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	. "social/internal/models"
+	"time"
+)
+
+func (p *Postgres) CreateSession(ctx context.Context, userId int64, session Session, refreshTokenHash string) error {
+	query := `insert into sessions (id, user_id, refresh_token_hash, user_agent, ip, expires_at)
+		values ($1, $2, $3, $4, $5, $6)`
+	if _, err := p.q.ExecContext(ctx, query, session.Id, userId, refreshTokenHash,
+		session.UserAgent, session.IP, session.ExpiresAt); err != nil {
+		return fmt.Errorf("could not insert session, %v", err)
+	}
+
+	return nil
+}
+
+func (p *Postgres) DeleteExpiredSessions(ctx context.Context, userId int64) error {
+	query := "delete from sessions where user_id = $1 and expires_at < now()"
+	if _, err := p.q.ExecContext(ctx, query, userId); err != nil {
+		return fmt.Errorf("could not delete expired sessions, %v", err)
+	}
+
+	return nil
+}
+
+func (p *Postgres) RotateRefreshToken(ctx context.Context, refreshTokenHash, newRefreshTokenHash string) (string, User, error) {
+	var (
+		sessionId string
+		user      User
+	)
+	query := `update sessions set
+			previous_refresh_token_hash = refresh_token_hash,
+			refresh_token_hash = $2,
+			last_seen_at = now()
+		where refresh_token_hash = $1 and expires_at > now()
+		returning id, user_id, (select username from users where id = user_id)`
+	err := p.q.QueryRowContext(ctx, query, refreshTokenHash, newRefreshTokenHash).
+		Scan(&sessionId, &user.Id, &user.Username)
+	if err == sql.ErrNoRows {
+		return "", user, ErrNotFound
+	}
+
+	if err != nil {
+		return "", user, fmt.Errorf("could not rotate refresh token, %v", err)
+	}
+
+	return sessionId, user, nil
+}
+
+func (p *Postgres) RevokeRotatedRefreshToken(ctx context.Context, refreshTokenHash string) (string, error) {
+	var sessionId string
+	query := "delete from sessions where previous_refresh_token_hash = $1 returning id"
+	err := p.q.QueryRowContext(ctx, query, refreshTokenHash).Scan(&sessionId)
+	if err == sql.ErrNoRows {
+		return "", ErrNotFound
+	}
+
+	if err != nil {
+		return "", fmt.Errorf("could not revoke session of reused refresh token, %v", err)
+	}
+
+	return sessionId, nil
+}
+
+func (p *Postgres) Sessions(ctx context.Context, userId int64) ([]Session, error) {
+	query := `select id, user_agent, ip, created_at, last_seen_at, expires_at from sessions
+		where user_id = $1 and expires_at > now()
+		order by last_seen_at desc`
+	rows, err := p.q.QueryContext(ctx, query, userId)
+	if err != nil {
+		return nil, fmt.Errorf("could not query sessions, %v", err)
+	}
+
+	defer rows.Close()
+
+	var sessions []Session
+	for rows.Next() {
+		var session Session
+		if err = rows.Scan(&session.Id, &session.UserAgent, &session.IP,
+			&session.CreatedAt, &session.LastSeenAt, &session.ExpiresAt); err != nil {
+			return nil, fmt.Errorf("could not scan session, %v", err)
+		}
+
+		sessions = append(sessions, session)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not iterate session rows, %v", err)
+	}
+
+	return sessions, nil
+}
+
+func (p *Postgres) SessionLastSeenAt(ctx context.Context, userId int64, sessionId string) (time.Time, error) {
+	var lastSeenAt time.Time
+	query := "select last_seen_at from sessions where id = $1 and user_id = $2 and expires_at > now()"
+	err := p.q.QueryRowContext(ctx, query, sessionId, userId).Scan(&lastSeenAt)
+	if err == sql.ErrNoRows {
+		return lastSeenAt, ErrNotFound
+	}
+
+	if err != nil {
+		return lastSeenAt, fmt.Errorf("could not fetch session, %v", err)
+	}
+
+	return lastSeenAt, nil
+}
+
+func (p *Postgres) TouchSession(ctx context.Context, sessionId, ip string) error {
+	query := "update sessions set last_seen_at = now(), ip = coalesce(nullif($2, ''), ip) where id = $1"
+	if _, err := p.q.ExecContext(ctx, query, sessionId, ip); err != nil {
+		return fmt.Errorf("could not update session, %v", err)
+	}
+
+	return nil
+}
+
+func (p *Postgres) DeleteSession(ctx context.Context, userId int64, sessionId string) error {
+	query := "delete from sessions where id = $1 and user_id = $2"
+	if _, err := p.q.ExecContext(ctx, query, sessionId, userId); err != nil {
+		return fmt.Errorf("could not delete session, %v", err)
+	}
+
+	return nil
+}
+
+func (p *Postgres) DeleteSessions(ctx context.Context, userId int64) error {
+	if _, err := p.q.ExecContext(ctx, "delete from sessions where user_id = $1", userId); err != nil {
+		return fmt.Errorf("could not delete sessions, %v", err)
+	}
+
+	return nil
+}
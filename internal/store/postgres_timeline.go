@@ -0,0 +1,199 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	. "social/internal/models"
+)
+
+func (p *Postgres) AddTimelineItem(ctx context.Context, userId, postId int64) (int64, error) {
+	var id int64
+	query := "insert into timeline (user_id, post_id) values ($1, $2) returning id"
+	if err := p.q.QueryRowContext(ctx, query, userId, postId).Scan(&id); err != nil {
+		return 0, fmt.Errorf("cannot insert timelineItem to db, %v", err)
+	}
+
+	return id, nil
+}
+
+func (p *Postgres) FanoutPost(ctx context.Context, postId, authorId int64) ([]TimelineItem, error) {
+	query := "insert into timeline (user_id,post_id) " +
+		"Select follower_id, $1 from follows where followee_id = $2 " +
+		"and follower_id not in (select muter_id from mutes where muted_id = $2) " +
+		"on conflict (user_id, post_id) do nothing " +
+		"returning id, user_id"
+	rows, err := p.q.QueryContext(ctx, query, postId, authorId)
+	if err != nil {
+		return nil, fmt.Errorf("cannot insert timeline: %v", err)
+	}
+
+	defer rows.Close()
+
+	var items []TimelineItem
+	for rows.Next() {
+		var item TimelineItem
+		if err = rows.Scan(&item.Id, &item.UserId); err != nil {
+			return nil, fmt.Errorf("cannot scan timeline item, %v", err)
+		}
+		item.PostId = postId
+		items = append(items, item)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("cannot iterate list of posts, %v", err)
+	}
+
+	return items, nil
+}
+
+func (p *Postgres) FanoutRepost(ctx context.Context, postId, reposterId int64) ([]TimelineItem, error) {
+	query := `insert into timeline (user_id, post_id, reposted_by)
+		select follower_id, $1::int, $2::int from follows where followee_id = $2
+			and follower_id not in (
+				select muter_id from mutes
+				where muted_id = $2 or muted_id = (select user_id from posts where id = $1)
+				union all select blocker_id from blocks where blocked_id = (select user_id from posts where id = $1)
+				union all select blocked_id from blocks where blocker_id = (select user_id from posts where id = $1)
+			)
+		union select $2::int, $1::int, $2::int
+		on conflict (user_id, post_id) do nothing
+		returning id, user_id`
+	rows, err := p.q.QueryContext(ctx, query, postId, reposterId)
+	if err != nil {
+		return nil, fmt.Errorf("cannot insert reposted timeline items, %v", err)
+	}
+
+	defer rows.Close()
+
+	var items []TimelineItem
+	for rows.Next() {
+		var item TimelineItem
+		if err = rows.Scan(&item.Id, &item.UserId); err != nil {
+			return nil, fmt.Errorf("cannot scan timeline item, %v", err)
+		}
+		item.PostId = postId
+		item.RepostedBy = &User{Id: reposterId}
+		items = append(items, item)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("cannot iterate reposted timeline items, %v", err)
+	}
+
+	return items, nil
+}
+
+func (p *Postgres) Timeline(ctx context.Context, userId int64, last int, before, after int64) ([]TimelineItem, error) {
+	query, args, err := queryBuilder(`SELECT timeline.id, posts.id, posts.content, posts.spoiler_of, posts.nsfw
+		, posts.likes_count, posts.comments_count, posts.created_at, posts.edited_at, posts.user_id
+		, posts.reposts_count, posts.quote_of
+		, likes.user_id IS NOT NULL AS liked
+		, reposts.user_id IS NOT NULL AS reposted
+		, users.username, users.avatar_url
+		, timeline.reposted_by, reposters.username, reposters.avatar_url
+		FROM timeline
+		INNER JOIN posts ON timeline.post_id = posts.id
+		INNER JOIN users ON posts.user_id = users.id
+		LEFT JOIN post_likes AS likes
+			ON likes.user_id = @uid AND likes.post_id = posts.id
+		LEFT JOIN reposts
+			ON reposts.user_id = @uid AND reposts.post_id = posts.id
+		LEFT JOIN users AS reposters ON reposters.id = timeline.reposted_by
+		WHERE timeline.user_id = @uid
+		AND posts.user_id NOT IN `+hiddenUsers+`
+		AND posts.user_id NOT IN `+mutedUsers+`
+		AND (timeline.reposted_by IS NULL OR (timeline.reposted_by NOT IN `+hiddenUsers+`
+			AND timeline.reposted_by NOT IN `+mutedUsers+`))
+		{{ if .before }}AND timeline.id < @before{{ end }}
+		{{ if .after }}AND timeline.id > @after{{ end }}
+		ORDER BY timeline.id {{ if .after }}ASC{{ else }}DESC{{ end }}
+		LIMIT @last`, map[string]interface{}{
+		"uid":    userId,
+		"last":   last,
+		"before": before,
+		"after":  after,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not build timeline query, %v", err)
+	}
+
+	rows, err := p.q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("could not query timeline, %v", err)
+	}
+
+	defer rows.Close()
+
+	timeline := make([]TimelineItem, 0, last)
+	for rows.Next() {
+		var (
+			item             TimelineItem
+			repostedBy       sql.NullInt64
+			reposterUsername sql.NullString
+			reposterAvatar   *string
+		)
+		if err = rows.Scan(&item.Id, &item.Post.Id, &item.Post.Content, &item.Post.SpoilerOf, &item.Post.NSFW,
+			&item.Post.LikesCount, &item.Post.CommentsCount, &item.Post.CreateAt, &item.Post.EditedAt, &item.Post.UserId,
+			&item.Post.RepostsCount, &item.Post.QuoteOfId, &item.Post.Liked, &item.Post.Reposted,
+			&item.Post.User.Username, &item.Post.User.AvatarUrl,
+			&repostedBy, &reposterUsername, &reposterAvatar); err != nil {
+			return nil, fmt.Errorf("could not scan timeline item, %v", err)
+		}
+
+		if repostedBy.Valid {
+			item.RepostedBy = &User{Id: repostedBy.Int64, Username: reposterUsername.String, AvatarUrl: reposterAvatar}
+		}
+
+		item.UserId = userId
+		item.PostId = item.Post.Id
+		item.Post.User.Id = item.Post.UserId
+		timeline = append(timeline, item)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not iterate timeline rows, %v", err)
+	}
+
+	return timeline, nil
+}
+
+func (p *Postgres) RebuildTimeline(ctx context.Context, userId int64, limit int) (int, error) {
+	if _, err := p.q.ExecContext(ctx, "delete from timeline where user_id = $1", userId); err != nil {
+		return 0, fmt.Errorf("could not clear timeline, %v", err)
+	}
+
+	// each post once, coming from its author rather than from a repost when it can,
+	// oldest inserted first so ids keep order of the posts
+	query := `with sources as (
+			select id as user_id from users where id = $1
+			union select followee_id from follows where follower_id = $1
+		), candidates as (
+			select distinct on (post_id) post_id, reposted_by, created_at from (
+				select posts.id as post_id, null::int as reposted_by, posts.created_at from posts
+				where posts.user_id in (select user_id from sources)
+				union all
+				select reposts.post_id, reposts.user_id, reposts.created_at from reposts
+				where reposts.user_id in (select user_id from sources)
+			) as items
+			order by post_id, reposted_by is not null, created_at
+		)
+		insert into timeline (user_id, post_id, reposted_by)
+		select $1, newest.post_id, newest.reposted_by from (
+			select * from candidates
+			order by created_at desc, post_id desc
+			limit $2
+		) as newest
+		order by newest.created_at asc, newest.post_id asc`
+	res, err := p.q.ExecContext(ctx, query, userId, limit)
+	if err != nil {
+		return 0, fmt.Errorf("could not fill timeline, %v", err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("could not count timeline items, %v", err)
+	}
+
+	return int(n), nil
+}
@@ -0,0 +1,607 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/lib/pq"
+	. "social/internal/models"
+	"strings"
+	"time"
+)
+
+const profileColumns = `users.id, users.email, users.username, users.avatar_url
+	, users.display_name, users.bio, users.location, users.website, users.pronouns, users.cover_url
+	, users.followers_count, users.followees_count
+	{{ if .auth }}
+	, followers.follower_id IS NOT NULL AS following
+	, followees.followee_id IS NOT NULL AS followeed
+	{{ end }}`
+
+const profileJoins = `{{ if .auth }}
+	LEFT JOIN follows AS followers
+		ON followers.follower_id = @uid AND followers.followee_id = users.id
+	LEFT JOIN follows AS followees
+		ON followees.follower_id = users.id AND followees.followee_id = @uid
+	{{ end }}`
+
+func (p *Postgres) CreateUser(ctx context.Context, email, username string) (int64, error) {
+	var id int64
+	query := "Insert into public.users(email,username) values($1,$2) returning id"
+	err := p.q.QueryRowContext(ctx, query, email, username).Scan(&id)
+
+	if isUniqueViolation(err) {
+		if strings.Contains(err.Error(), "email") {
+			return 0, ErrEmailTaken
+		}
+
+		return 0, ErrUsernameTaken
+	}
+
+	if err != nil {
+		return 0, fmt.Errorf("could not insert user, %v", err)
+	}
+
+	return id, nil
+}
+
+func (p *Postgres) UserById(ctx context.Context, userId int64) (User, error) {
+	return p.user(ctx, "id = $1", userId)
+}
+
+func (p *Postgres) UserByEmail(ctx context.Context, email string) (User, error) {
+	return p.user(ctx, "email = $1", email)
+}
+
+func (p *Postgres) UserByUsername(ctx context.Context, username string) (User, error) {
+	return p.user(ctx, "username = $1", username)
+}
+
+func (p *Postgres) UsersByUsernames(ctx context.Context, usernames []string) ([]User, error) {
+	query := "select id, username, avatar_url from users where username = any($1)"
+	rows, err := p.q.QueryContext(ctx, query, pq.Array(usernames))
+	if err != nil {
+		return nil, fmt.Errorf("could not query users by usernames, %v", err)
+	}
+
+	defer rows.Close()
+
+	var users []User
+	for rows.Next() {
+		var user User
+		if err = rows.Scan(&user.Id, &user.Username, &user.AvatarUrl); err != nil {
+			return nil, fmt.Errorf("could not scan user, %v", err)
+		}
+
+		users = append(users, user)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not iterate user rows, %v", err)
+	}
+
+	return users, nil
+}
+
+func (p *Postgres) UserProfile(ctx context.Context, viewerId int64, username string) (UserProfile, error) {
+	query, args, err := queryBuilder(`SELECT `+profileColumns+`
+		FROM users
+		`+profileJoins+`
+		WHERE users.username = @username
+		{{ if .auth }}AND users.id NOT IN `+hiddenUsers+`{{ end }}`, map[string]interface{}{
+		"auth":     viewerId != 0,
+		"uid":      viewerId,
+		"username": username,
+	})
+	if err != nil {
+		return UserProfile{}, fmt.Errorf("could not build user profile query, %v", err)
+	}
+
+	profile, err := scanProfile(p.q.QueryRowContext(ctx, query, args...), viewerId != 0)
+	if err == sql.ErrNoRows {
+		return profile, ErrNotFound
+	}
+
+	if err != nil {
+		return profile, fmt.Errorf("error while fetching user profile, %v", err)
+	}
+
+	return profile, nil
+}
+
+func (p *Postgres) Users(ctx context.Context, viewerId int64, search string, first int, after string) ([]UserProfile, error) {
+	query, args, err := queryBuilder(`SELECT `+profileColumns+`
+		FROM users
+		`+profileJoins+`
+		WHERE true
+		{{ if .search }}AND users.username ILIKE '%' || @search || '%'{{ end }}
+		{{ if .auth }}AND users.id NOT IN `+hiddenUsers+`{{ end }}
+		{{ if .after }}AND users.username > @after{{ end }}
+		ORDER BY users.username ASC
+		LIMIT @first`, map[string]interface{}{
+		"auth":   viewerId != 0,
+		"uid":    viewerId,
+		"search": search,
+		"first":  first,
+		"after":  after,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not build users query , %v", err)
+	}
+
+	return p.queryProfiles(ctx, query, args, viewerId != 0)
+}
+
+func (p *Postgres) UpdateProfile(ctx context.Context, userId int64, update ProfileUpdate) error {
+	query := `update users set
+		display_name = coalesce($2, display_name),
+		bio = coalesce($3, bio),
+		location = coalesce($4, location),
+		website = coalesce($5, website),
+		pronouns = coalesce($6, pronouns)
+		where id = $1`
+	res, err := p.q.ExecContext(ctx, query, userId, update.DisplayName, update.Bio, update.Location, update.Website,
+		update.Pronouns)
+	if err != nil {
+		return fmt.Errorf("could not update profile, %v", err)
+	}
+
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (p *Postgres) UpdateUsername(ctx context.Context, userId int64, username string) (string, error) {
+	var previous string
+	err := p.q.QueryRowContext(ctx, "select username from users where id = $1 for update", userId).Scan(&previous)
+	if err == sql.ErrNoRows {
+		return "", ErrNotFound
+	}
+
+	if err != nil {
+		return "", fmt.Errorf("could not lock user, %v", err)
+	}
+
+	query := "update users set username = $2, username_changed_at = now() where id = $1"
+	_, err = p.q.ExecContext(ctx, query, userId, username)
+	if isUniqueViolation(err) {
+		return "", ErrUsernameTaken
+	}
+
+	if err != nil {
+		return "", fmt.Errorf("could not update username, %v", err)
+	}
+
+	if _, err = p.q.ExecContext(ctx, "delete from username_history where username = $1", username); err != nil {
+		return "", fmt.Errorf("could not delete username history, %v", err)
+	}
+
+	query = `insert into username_history (username, user_id) values ($1, $2)
+		on conflict (username) do update set user_id = excluded.user_id, changed_at = now()`
+	if _, err = p.q.ExecContext(ctx, query, previous, userId); err != nil {
+		return "", fmt.Errorf("could not insert username history, %v", err)
+	}
+
+	return previous, nil
+}
+
+func (p *Postgres) LastUsernameChange(ctx context.Context, userId int64) (time.Time, error) {
+	var changedAt sql.NullTime
+	err := p.q.QueryRowContext(ctx, "select username_changed_at from users where id = $1", userId).Scan(&changedAt)
+	if err == sql.ErrNoRows {
+		return time.Time{}, ErrNotFound
+	}
+
+	if err != nil {
+		return time.Time{}, fmt.Errorf("could not query last username change, %v", err)
+	}
+
+	return changedAt.Time, nil
+}
+
+func (p *Postgres) UserByPreviousUsername(ctx context.Context, username string, since time.Time) (User, error) {
+	var user User
+	query := `select users.id, users.username, users.avatar_url from username_history
+		inner join users on users.id = username_history.user_id
+		where username_history.username = $1 and username_history.changed_at >= $2`
+	err := p.q.QueryRowContext(ctx, query, username, since).Scan(&user.Id, &user.Username, &user.AvatarUrl)
+	if err == sql.ErrNoRows {
+		return user, ErrNotFound
+	}
+
+	if err != nil {
+		return user, fmt.Errorf("could not query user by previous username, %v", err)
+	}
+
+	return user, nil
+}
+
+func (p *Postgres) UpdateEmail(ctx context.Context, userId int64, email string) error {
+	res, err := p.q.ExecContext(ctx, "update users set email = $2 where id = $1", userId, email)
+	if isUniqueViolation(err) {
+		return ErrEmailTaken
+	}
+
+	if err != nil {
+		return fmt.Errorf("could not update email, %v", err)
+	}
+
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (p *Postgres) UpdateCover(ctx context.Context, userId int64, cover string) (string, error) {
+	var oldCover sql.NullString
+	query := `update users set cover_url = $2 where id = $1
+		returning (select cover_url from users where id = $1) as old_cover`
+	err := p.q.QueryRowContext(ctx, query, userId, cover).Scan(&oldCover)
+	if err == sql.ErrNoRows {
+		return "", ErrNotFound
+	}
+
+	if err != nil {
+		return "", fmt.Errorf("could not update cover: %v", err)
+	}
+
+	return oldCover.String, nil
+}
+
+func (p *Postgres) UpdateAvatar(ctx context.Context, userId int64, avatar string) (string, error) {
+	var oldAvatar sql.NullString
+	query := `update users set avatar_url = $2 where id = $1
+		returning (select avatar_url from users where id = $1) as old_avatar`
+	err := p.q.QueryRowContext(ctx, query, userId, avatar).Scan(&oldAvatar)
+	if err == sql.ErrNoRows {
+		return "", ErrNotFound
+	}
+
+	if err != nil {
+		return "", fmt.Errorf("could not update avatar: %v", err)
+	}
+
+	return oldAvatar.String, nil
+}
+
+func (p *Postgres) Avatars(ctx context.Context) ([]string, error) {
+	rows, err := p.q.QueryContext(ctx, "select avatar_url from users where avatar_url is not null")
+	if err != nil {
+		return nil, fmt.Errorf("could not query avatars, %v", err)
+	}
+
+	defer rows.Close()
+
+	var avatars []string
+	for rows.Next() {
+		var avatar string
+		if err = rows.Scan(&avatar); err != nil {
+			return nil, fmt.Errorf("could not scan avatar, %v", err)
+		}
+
+		avatars = append(avatars, avatar)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not iterate avatar rows, %v", err)
+	}
+
+	return avatars, nil
+}
+
+func (p *Postgres) SuspendUser(ctx context.Context, userId int64, suspended bool) error {
+	query := `update users set suspended_at = case when $2 then coalesce(suspended_at, now()) end where id = $1`
+	res, err := p.q.ExecContext(ctx, query, userId, suspended)
+	if err != nil {
+		return fmt.Errorf("could not update user suspension, %v", err)
+	}
+
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (p *Postgres) UserSuspended(ctx context.Context, userId int64) (bool, error) {
+	var suspended bool
+	query := "select suspended_at is not null from users where id = $1"
+	err := p.q.QueryRowContext(ctx, query, userId).Scan(&suspended)
+	if err == sql.ErrNoRows {
+		return false, ErrNotFound
+	}
+
+	if err != nil {
+		return false, fmt.Errorf("could not check user suspension, %v", err)
+	}
+
+	return suspended, nil
+}
+
+func (p *Postgres) SetAdmin(ctx context.Context, userId int64, admin bool) error {
+	res, err := p.q.ExecContext(ctx, "update users set admin = $2 where id = $1", userId, admin)
+	if err != nil {
+		return fmt.Errorf("could not update user admin, %v", err)
+	}
+
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (p *Postgres) IsAdmin(ctx context.Context, userId int64) (bool, error) {
+	var admin bool
+	err := p.q.QueryRowContext(ctx, "select admin from users where id = $1", userId).Scan(&admin)
+	if err == sql.ErrNoRows {
+		return false, ErrNotFound
+	}
+
+	if err != nil {
+		return false, fmt.Errorf("could not check user admin, %v", err)
+	}
+
+	return admin, nil
+}
+
+func (p *Postgres) ScheduleUserDeletion(ctx context.Context, userId int64, at time.Time) error {
+	res, err := p.q.ExecContext(ctx, "update users set deletion_scheduled_at = $2 where id = $1", userId, at)
+	if err != nil {
+		return fmt.Errorf("could not schedule user deletion, %v", err)
+	}
+
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (p *Postgres) CancelUserDeletion(ctx context.Context, userId int64) (bool, error) {
+	query := `update users set deletion_scheduled_at = null
+		where id = $1 and deletion_scheduled_at is not null`
+	res, err := p.q.ExecContext(ctx, query, userId)
+	if err != nil {
+		return false, fmt.Errorf("could not cancel user deletion, %v", err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("could not count cancelled user deletions, %v", err)
+	}
+
+	return n != 0, nil
+}
+
+func (p *Postgres) LockUserDeletion(ctx context.Context, userId int64) (time.Time, error) {
+	var at sql.NullTime
+	err := p.q.QueryRowContext(ctx, "select deletion_scheduled_at from users where id = $1 for update", userId).
+		Scan(&at)
+	if err == sql.ErrNoRows {
+		return time.Time{}, ErrNotFound
+	}
+
+	if err != nil {
+		return time.Time{}, fmt.Errorf("could not lock user deletion, %v", err)
+	}
+
+	return at.Time, nil
+}
+
+func (p *Postgres) UsersDueForDeletion(ctx context.Context, now time.Time, limit int) ([]int64, error) {
+	query := `select id from users where deletion_scheduled_at <= $1
+		order by deletion_scheduled_at limit $2`
+	rows, err := p.q.QueryContext(ctx, query, now, limit)
+	if err != nil {
+		return nil, fmt.Errorf("could not query users due for deletion, %v", err)
+	}
+
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err = rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("could not scan user due for deletion, %v", err)
+		}
+
+		ids = append(ids, id)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not iterate users due for deletion, %v", err)
+	}
+
+	return ids, nil
+}
+
+func (p *Postgres) DeleteUser(ctx context.Context, userId int64) (DeletedUser, error) {
+	var (
+		deleted       DeletedUser
+		avatar, cover sql.NullString
+	)
+	err := p.q.QueryRowContext(ctx, "select avatar_url, cover_url from users where id = $1 for update", userId).
+		Scan(&avatar, &cover)
+	if err == sql.ErrNoRows {
+		return deleted, ErrNotFound
+	}
+
+	if err != nil {
+		return deleted, fmt.Errorf("could not lock user, %v", err)
+	}
+
+	deleted.Avatar = avatar.String
+	deleted.Cover = cover.String
+
+	// counts of what stays are updated before rows they count are gone, never below zero
+	// should they have drifted from the rows already
+	queries := []string{
+		"update users set followers_count = greatest(followers_count - 1, 0) where id in (select followee_id from follows where follower_id = $1)",
+		"update users set followees_count = greatest(followees_count - 1, 0) where id in (select follower_id from follows where followee_id = $1)",
+		"delete from follows where follower_id = $1 or followee_id = $1",
+		"update posts set likes_count = greatest(likes_count - 1, 0) where id in (select post_id from post_likes where user_id = $1)",
+		"delete from post_likes where user_id = $1",
+		"update comments set likes_count = greatest(likes_count - 1, 0) where id in (select comment_id from comment_likes where user_id = $1)",
+		"delete from comment_likes where user_id = $1",
+		"update posts set reposts_count = greatest(reposts_count - 1, 0) where id in (select post_id from reposts where user_id = $1)",
+		"delete from reposts where user_id = $1",
+	}
+	for _, query := range queries {
+		if _, err = p.q.ExecContext(ctx, query, userId); err != nil {
+			return deleted, fmt.Errorf("could not delete follows, likes and reposts of user, %v", err)
+		}
+	}
+
+	if deleted.Comments, err = p.deleteUserComments(ctx, userId); err != nil {
+		return deleted, err
+	}
+
+	queries = []string{
+		"delete from notifications where user_id = $1",
+		"update notifications set actor_ids = array_remove(actor_ids, $1) where $1 = any(actor_ids)",
+		"delete from notifications where cardinality(actor_ids) = 0",
+		"delete from timeline where user_id = $1 or reposted_by = $1",
+	}
+	for _, query := range queries {
+		if _, err = p.q.ExecContext(ctx, query, userId); err != nil {
+			return deleted, fmt.Errorf("could not delete notifications and timeline of user, %v", err)
+		}
+	}
+
+	if deleted.Media, err = p.deleteUserMedia(ctx, userId); err != nil {
+		return deleted, err
+	}
+
+	// rows referencing the posts are removed by on delete cascade
+	res, err := p.q.ExecContext(ctx, "delete from posts where user_id = $1", userId)
+	if err != nil {
+		return deleted, fmt.Errorf("could not delete posts of user, %v", err)
+	}
+
+	if n, err := res.RowsAffected(); err == nil {
+		deleted.Posts = int(n)
+	}
+
+	if deleted.Exports, err = p.deleteUserExports(ctx, userId); err != nil {
+		return deleted, err
+	}
+
+	queries = []string{
+		"delete from sessions where user_id = $1",
+		"delete from verification_codes where user_id = $1",
+		"delete from users where id = $1",
+	}
+	for _, query := range queries {
+		if _, err = p.q.ExecContext(ctx, query, userId); err != nil {
+			return deleted, fmt.Errorf("could not delete user, %v", err)
+		}
+	}
+
+	return deleted, nil
+}
+
+// deleteUserComments deletes comments of the user, replies to them go along by on delete cascade,
+// and recounts comments of the posts and replies of the comments they were on
+func (p *Postgres) deleteUserComments(ctx context.Context, userId int64) (int, error) {
+	rows, err := p.q.QueryContext(ctx, "delete from comments where user_id = $1 returning post_id, parent_id", userId)
+	if err != nil {
+		return 0, fmt.Errorf("could not delete comments of user, %v", err)
+	}
+
+	defer rows.Close()
+
+	var (
+		count     int
+		postIds   []int64
+		parentIds []int64
+	)
+	for rows.Next() {
+		var (
+			postId   int64
+			parentId sql.NullInt64
+		)
+		if err = rows.Scan(&postId, &parentId); err != nil {
+			return 0, fmt.Errorf("could not scan deleted comment, %v", err)
+		}
+
+		count++
+		postIds = append(postIds, postId)
+		if parentId.Valid {
+			parentIds = append(parentIds, parentId.Int64)
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return 0, fmt.Errorf("could not iterate deleted comment rows, %v", err)
+	}
+
+	query := `update posts set comments_count = (select count(*) from comments where comments.post_id = posts.id)
+		where id = any($1)`
+	if _, err = p.q.ExecContext(ctx, query, pq.Array(postIds)); err != nil {
+		return 0, fmt.Errorf("could not recount comments of posts, %v", err)
+	}
+
+	query = `update comments set replies_count = (select count(*) from comments as replies where replies.parent_id = comments.id)
+		where id = any($1)`
+	if _, err = p.q.ExecContext(ctx, query, pq.Array(parentIds)); err != nil {
+		return 0, fmt.Errorf("could not recount replies of comments, %v", err)
+	}
+
+	return count, nil
+}
+
+func (p *Postgres) user(ctx context.Context, where string, arg interface{}) (User, error) {
+	var user User
+	query := "select id, username, avatar_url from users where " + where
+	err := p.q.QueryRowContext(ctx, query, arg).Scan(&user.Id, &user.Username, &user.AvatarUrl)
+	if err == sql.ErrNoRows {
+		return user, ErrNotFound
+	}
+
+	if err != nil {
+		return user, fmt.Errorf("cannot find user, %v", err)
+	}
+
+	return user, nil
+}
+
+func (p *Postgres) queryProfiles(ctx context.Context, query string, args []interface{}, auth bool) ([]UserProfile, error) {
+	rows, err := p.q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("could not execute query : %v", err)
+	}
+
+	defer rows.Close()
+
+	profiles := []UserProfile{}
+	for rows.Next() {
+		profile, err := scanProfile(rows, auth)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse results, %v", err)
+		}
+
+		profiles = append(profiles, profile)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not iterate user rows, %v", err)
+	}
+
+	return profiles, nil
+}
+
+func scanProfile(row scanner, auth bool) (UserProfile, error) {
+	var profile UserProfile
+	dest := []interface{}{&profile.Id, &profile.Email, &profile.Username, &profile.AvatarUrl,
+		&profile.DisplayName, &profile.Bio, &profile.Location, &profile.Website, &profile.Pronouns, &profile.CoverUrl,
+		&profile.FollowersCount, &profile.FolloweesCount}
+	if auth {
+		dest = append(dest, &profile.Following, &profile.Followed)
+	}
+
+	return profile, row.Scan(dest...)
+}
@@ -0,0 +1,48 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+func (p *Postgres) CreateVerificationCode(ctx context.Context, codeHash string, userId int64, redirectURI string) error {
+	query := "insert into verification_codes (code_hash, user_id, redirect_uri) values ($1, $2, $3)"
+	if _, err := p.q.ExecContext(ctx, query, codeHash, userId,
+		sql.NullString{String: redirectURI, Valid: redirectURI != ""}); err != nil {
+		return fmt.Errorf("could not insert verification code, %v", err)
+	}
+
+	return nil
+}
+
+func (p *Postgres) DeleteVerificationCodesBefore(ctx context.Context, t time.Time) error {
+	query := "delete from verification_codes where created_at < $1"
+	if _, err := p.q.ExecContext(ctx, query, t); err != nil {
+		return fmt.Errorf("could not delete expired verification codes, %v", err)
+	}
+
+	return nil
+}
+
+func (p *Postgres) TakeVerificationCode(ctx context.Context, codeHash string) (VerificationCode, error) {
+	var (
+		code        VerificationCode
+		redirectURI sql.NullString
+	)
+	query := `delete from verification_codes where code_hash = $1
+		returning user_id, redirect_uri, created_at, (select username from users where id = user_id)`
+	err := p.q.QueryRowContext(ctx, query, codeHash).
+		Scan(&code.User.Id, &redirectURI, &code.CreatedAt, &code.User.Username)
+	if err == sql.ErrNoRows {
+		return code, ErrNotFound
+	}
+
+	if err != nil {
+		return code, fmt.Errorf("could not delete verification code, %v", err)
+	}
+
+	code.RedirectURI = redirectURI.String
+	return code, nil
+}
@@ -0,0 +1,470 @@
+// Package store keeps data of the app behind interfaces, Postgres backs the app
+// and Memory is a drop in replacement for running the services without a database
+package store
+
+import (
+	"context"
+	"errors"
+	. "social/internal/models"
+	"time"
+)
+
+var (
+	// ErrNotFound returned when requested record does not exist
+	ErrNotFound = errors.New("not found")
+	// ErrEmailTaken returned when user with the email already exists
+	ErrEmailTaken = errors.New("email taken")
+	// ErrUsernameTaken returned when user with the username already exists
+	ErrUsernameTaken = errors.New("username taken")
+)
+
+// Store gives access to every store, Tx runs fn with the stores bound to a single transaction,
+// the transaction is committed when fn returns nil and rolled back otherwise
+type Store interface {
+	UserStore
+	FollowStore
+	BlockStore
+	PostStore
+	CommentStore
+	HashtagStore
+	MentionStore
+	MediaStore
+	TimelineStore
+	CounterStore
+	NotificationStore
+	JobStore
+	SessionStore
+	VerificationCodeStore
+	EmailChangeStore
+	ExportStore
+
+	Tx(ctx context.Context, fn func(Store) error) error
+}
+
+// UserStore users, viewerId is id of the authenticated user or 0 for anonymous requests,
+// profiles only tell whether viewer follows the user and the other way round when it is set,
+// users viewer blocked or was blocked by are left out as if they did not exist
+type UserStore interface {
+	CreateUser(ctx context.Context, email, username string) (int64, error)
+	UserById(ctx context.Context, userId int64) (User, error)
+	UserByEmail(ctx context.Context, email string) (User, error)
+	UserByUsername(ctx context.Context, username string) (User, error)
+	// UsersByUsernames lists users with any of the usernames, ones that do not exist are left out
+	UsersByUsernames(ctx context.Context, usernames []string) ([]User, error)
+	UserProfile(ctx context.Context, viewerId int64, username string) (UserProfile, error)
+	// Users lists users ordered by username, first ones after given username
+	Users(ctx context.Context, viewerId int64, search string, first int, after string) ([]UserProfile, error)
+	// UpdateAvatar sets avatar of the user and returns the previous one, empty if there was none
+	UpdateAvatar(ctx context.Context, userId int64, avatar string) (string, error)
+	// Avatars lists avatar files in use
+	Avatars(ctx context.Context) ([]string, error)
+	UpdateProfile(ctx context.Context, userId int64, update ProfileUpdate) error
+	// UpdateUsername renames user and returns the previous username, which is kept in username history
+	// while the new one is taken out of it
+	UpdateUsername(ctx context.Context, userId int64, username string) (string, error)
+	// LastUsernameChange when user last changed username, zero if they never did
+	LastUsernameChange(ctx context.Context, userId int64) (time.Time, error)
+	// UserByPreviousUsername user who changed username away from the given one since then
+	UserByPreviousUsername(ctx context.Context, username string, since time.Time) (User, error)
+	UpdateEmail(ctx context.Context, userId int64, email string) error
+	// UpdateCover sets cover image of the user and returns the previous one, empty if there was none
+	UpdateCover(ctx context.Context, userId int64, cover string) (string, error)
+	SuspendUser(ctx context.Context, userId int64, suspended bool) error
+	UserSuspended(ctx context.Context, userId int64) (bool, error)
+	SetAdmin(ctx context.Context, userId int64, admin bool) error
+	IsAdmin(ctx context.Context, userId int64) (bool, error)
+	// ScheduleUserDeletion marks user to be deleted at the given time
+	ScheduleUserDeletion(ctx context.Context, userId int64, at time.Time) error
+	// CancelUserDeletion unmarks user scheduled for deletion and tells whether they were
+	CancelUserDeletion(ctx context.Context, userId int64) (bool, error)
+	// LockUserDeletion locks user for the rest of transaction and returns when they are to be deleted,
+	// zero when they are not scheduled for deletion
+	LockUserDeletion(ctx context.Context, userId int64) (time.Time, error)
+	// UsersDueForDeletion ids of at most limit users scheduled for deletion at or before now
+	UsersDueForDeletion(ctx context.Context, now time.Time, limit int) ([]int64, error)
+	// DeleteUser removes user with everything they created, their follows and likes,
+	// counts of what remains are kept in sync
+	DeleteUser(ctx context.Context, userId int64) (DeletedUser, error)
+}
+
+// ProfileUpdate profile fields to change, nil ones stay as they are
+type ProfileUpdate struct {
+	DisplayName *string
+	Bio         *string
+	Location    *string
+	Website     *string
+	Pronouns    *string
+}
+
+// DeletedUser what was removed along with user, Avatar, Cover, Media and Exports files are left for the caller to remove
+type DeletedUser struct {
+	Avatar   string   `json:"-"`
+	Cover    string   `json:"-"`
+	Media    []string `json:"-"`
+	Exports  []string `json:"-"`
+	Posts    int      `json:"posts"`
+	Comments int      `json:"comments"`
+}
+
+// FollowStore follows between users, Follow and Unfollow keep follow counts of both users
+// in sync and return new followers count of the followee
+type FollowStore interface {
+	IsFollowing(ctx context.Context, followerId, followeeId int64) (bool, error)
+	Follow(ctx context.Context, followerId, followeeId int64) (int, error)
+	Unfollow(ctx context.Context, followerId, followeeId int64) (int, error)
+	Followers(ctx context.Context, viewerId int64, username string, first int, after string) ([]UserProfile, error)
+	Followees(ctx context.Context, viewerId int64, username string, first int, after string) ([]UserProfile, error)
+}
+
+// BlockStore blocks and mutes between users, a block hides both users from each other in every listing
+// that takes viewerId, a mute only hides posts and notifications of the muted user from the muter
+type BlockStore interface {
+	// IsBlocking tells whether blocker blocked user with blockedId
+	IsBlocking(ctx context.Context, blockerId, blockedId int64) (bool, error)
+	// Blocked tells whether either of the users blocked the other
+	Blocked(ctx context.Context, userId, otherId int64) (bool, error)
+	// BlockedUserIds ids of users user blocked or was blocked by
+	BlockedUserIds(ctx context.Context, userId int64) ([]int64, error)
+	// Block blocks user and removes follows between the two of them both ways, keeping follow counts
+	// in sync, likes and reposts of blocked user on posts and comments of blocker, keeping their counts
+	// and reposted timeline items in sync, along with each of them from actors of notifications of the other
+	Block(ctx context.Context, blockerId, blockedId int64) error
+	Unblock(ctx context.Context, blockerId, blockedId int64) error
+	// Blocks lists users user blocked ordered by username, first ones after given username
+	Blocks(ctx context.Context, userId int64, first int, after string) ([]User, error)
+	// IsMuting tells whether muter muted user with mutedId
+	IsMuting(ctx context.Context, muterId, mutedId int64) (bool, error)
+	Mute(ctx context.Context, muterId, mutedId int64) error
+	Unmute(ctx context.Context, muterId, mutedId int64) error
+	// Mutes lists users user muted ordered by username, first ones after given username
+	Mutes(ctx context.Context, userId int64, first int, after string) ([]User, error)
+}
+
+// PostStore posts, their likes, reposts and revisions, listings leave out posts of users
+// viewer blocked or was blocked by
+type PostStore interface {
+	// CreatePost inserts post, quoting post with id quoteOf when it is set
+	CreatePost(ctx context.Context, userId int64, content string, spoilerOf *string, nsfw bool, quoteOf *int64) (Post, error)
+	Post(ctx context.Context, postId int64) (Post, error)
+	// PostsByIds fetches posts with given ids by id, ones that do not exist are left out
+	PostsByIds(ctx context.Context, postIds []int64) (map[int64]Post, error)
+	PostExists(ctx context.Context, postId int64) (bool, error)
+	// Posts lists newest posts of the user, or of everyone when userId is 0, as seen by viewer
+	Posts(ctx context.Context, viewerId, userId int64, limit int) ([]Post, error)
+	// LockPost locks post for the rest of transaction and returns id of its author
+	LockPost(ctx context.Context, postId int64) (int64, error)
+	// AddPostRevision saves current version of the post before it gets updated
+	AddPostRevision(ctx context.Context, postId int64) error
+	// UpdatePost changes content of the post, returned post lacks user
+	UpdatePost(ctx context.Context, postId int64, content string, spoilerOf *string, nsfw bool) (Post, error)
+	// DeletePost removes post along with everything that hangs off it
+	DeletePost(ctx context.Context, postId int64) error
+	PostRevisions(ctx context.Context, postId int64) ([]PostRevision, error)
+	IsPostLiked(ctx context.Context, userId, postId int64) (bool, error)
+	// LikePost and UnlikePost return new likes count and id of the post author
+	LikePost(ctx context.Context, userId, postId int64) (int, int64, error)
+	UnlikePost(ctx context.Context, userId, postId int64) (int, int64, error)
+	IsPostReposted(ctx context.Context, userId, postId int64) (bool, error)
+	// Repost and Unrepost return new reposts count and id of the post author, Unrepost also takes
+	// the post out of timelines the repost brought it to, unless another repost followed by the timeline
+	// owner would have brought it as well, then the item is credited to the latest such repost instead
+	Repost(ctx context.Context, userId, postId int64) (int, int64, error)
+	Unrepost(ctx context.Context, userId, postId int64) (int, int64, error)
+	// IncrementCommentsCount returns id of the post author
+	IncrementCommentsCount(ctx context.Context, postId int64) (int64, error)
+	// SearchPosts lists at most limit posts matching search, best first, starting after the one
+	// with afterScore and afterId when afterId is set
+	SearchPosts(ctx context.Context, search PostSearch, limit int, afterScore float64, afterId int64) ([]PostMatch, error)
+}
+
+// Matched words in PostMatch.Snippet are wrapped in these, characters from private use area
+// so they never clash with content
+const (
+	SnippetStart = "\ue000"
+	SnippetStop  = "\ue001"
+)
+
+// searchRecencyScale posts this old score half of what the same new post would
+const searchRecencyScale = time.Hour * 24 * 7
+
+// PostSearch terms and filters of post search, every term has to match, zero filters are not applied
+type PostSearch struct {
+	// ViewerId posts of users viewer blocked or was blocked by are left out
+	ViewerId    int64
+	Terms       []SearchTerm
+	AuthorId    int64
+	From        time.Time
+	To          time.Time
+	Spoiler     *bool
+	ExcludeNSFW bool
+	// AsOf moment recency is measured from, it has to stay the same across pages
+	AsOf time.Time
+}
+
+// SearchTerm word or phrase of words following each other, each word is made of letters and digits only,
+// last word matches as prefix when Prefix is set
+type SearchTerm struct {
+	Words  []string
+	Prefix bool
+}
+
+// PostMatch post found by search, Score combines relevance and recency
+type PostMatch struct {
+	Post    Post
+	Score   float64
+	Snippet string
+}
+
+// CommentStore comments and replies, viewerId is id of the authenticated user or 0,
+// comments are only marked as liked when it is set and listings leave out comments
+// of users viewer blocked or was blocked by
+type CommentStore interface {
+	// CreateComment inserts comment from its UserId, PostId, ParentId, Depth and Content
+	// and returns it with Id and CreatedAt set
+	CreateComment(ctx context.Context, c Comment) (Comment, error)
+	// CommentPostId id of the post comment belongs to
+	CommentPostId(ctx context.Context, commentId int64) (int64, error)
+	// IncrementRepliesCount returns the comment without user
+	IncrementRepliesCount(ctx context.Context, commentId int64) (Comment, error)
+	// Comments lists top level comments of post after comment with id after, newest first unless oldestFirst
+	Comments(ctx context.Context, viewerId, postId int64, last int, after int64, oldestFirst bool) ([]Comment, error)
+	// CommentReplies lists direct replies of comment after reply with id after, oldest first
+	CommentReplies(ctx context.Context, viewerId, commentId int64, last int, after int64) ([]Comment, error)
+	// PreviewReplies lists at most limit first replies of each comment, ordered by parent and then by id
+	PreviewReplies(ctx context.Context, viewerId int64, parentIds []int64, limit int) ([]Comment, error)
+	IsCommentLiked(ctx context.Context, userId, commentId int64) (bool, error)
+	// LikeComment and UnlikeComment return new likes count and id of the comment author
+	LikeComment(ctx context.Context, userId, commentId int64) (int, int64, error)
+	UnlikeComment(ctx context.Context, userId, commentId int64) (int, int64, error)
+}
+
+// HashtagStore hashtags of posts, tags are lower cased and without the leading #
+type HashtagStore interface {
+	// SetPostHashtags replaces hashtags of the post with tags, creating hashtags that do not exist yet
+	SetPostHashtags(ctx context.Context, postId int64, tags []string) error
+	// HashtagPosts lists newest posts tagged with tag, older than post before when it is set, as seen by viewer
+	HashtagPosts(ctx context.Context, viewerId int64, tag string, last int, before int64) ([]Post, error)
+	// RefreshTrendingHashtags ranks hashtags used in window ending at now by velocity, that is
+	// (current - previous) / sqrt(previous + 1) where current and previous count posts tagged in the window
+	// and in the one before it, and replaces stored ranking of period with at most limit of them
+	RefreshTrendingHashtags(ctx context.Context, period string, window time.Duration, now time.Time, limit int) error
+	// LockTrendingHashtags takes lock on the ranking held until Tx it runs in ends, without waiting for it,
+	// false when another instance holds it and is refreshing the ranking already
+	LockTrendingHashtags(ctx context.Context) (bool, error)
+	// TrendingHashtags returns stored ranking of period and when it was computed, zero time when it is empty
+	TrendingHashtags(ctx context.Context, period string) ([]TrendingHashtag, time.Time, error)
+}
+
+// MentionStore mentions of users in posts and comments, a mention is made when the user is first
+// mentioned in the post or comment, returned mentions are ordered by Start and carry user with it
+type MentionStore interface {
+	// SetPostMentions replaces mentions of the post, keeping when users that stay mentioned were mentioned,
+	// and returns ids of users that were not mentioned in the post before
+	SetPostMentions(ctx context.Context, postId int64, mentions []Mention) ([]int64, error)
+	// AddCommentMentions adds mentions of the new comment
+	AddCommentMentions(ctx context.Context, commentId int64, mentions []Mention) error
+	PostMentions(ctx context.Context, postIds []int64) (map[int64][]Mention, error)
+	CommentMentions(ctx context.Context, commentIds []int64) (map[int64][]Mention, error)
+	// Mentions lists posts and comments user is mentioned in, most recently mentioned first, starting
+	// after before unless it is zero, comments are marked as liked by the user, items lack Cursor and Mentions,
+	// mentions by users the user blocked or was blocked by are left out
+	Mentions(ctx context.Context, userId int64, last int, before MentionCursor) ([]MentionItem, error)
+}
+
+// MentionCursor position in mentions feed, which is ordered by when users were mentioned, then by post
+// and then by comment, CommentId is 0 for mentions in posts
+type MentionCursor struct {
+	CreatedAt time.Time
+	PostId    int64
+	CommentId int64
+}
+
+// MediaStore images uploaded by users and attached to their posts, media of a post is ordered
+// as it was attached and goes away with the post
+type MediaStore interface {
+	// CreateMedia inserts media from its UserId, File, Thumbnail, Width, Height, Blurhash and AltText
+	// and returns it with Id and CreatedAt set
+	CreateMedia(ctx context.Context, m Media) (Media, error)
+	// AttachMedia attaches media with mediaIds to the post in that order, ErrNotFound is returned
+	// unless every one of them was uploaded by user and is not attached yet
+	AttachMedia(ctx context.Context, userId, postId int64, mediaIds []int64) error
+	PostMedia(ctx context.Context, postIds []int64) (map[int64][]Media, error)
+	// DeleteUnattachedMedia deletes at most limit uploads created before before and never attached to a post,
+	// it returns names of their files
+	DeleteUnattachedMedia(ctx context.Context, before time.Time, limit int) ([]string, error)
+}
+
+// TimelineStore home feeds of users
+type TimelineStore interface {
+	AddTimelineItem(ctx context.Context, userId, postId int64) (int64, error)
+	// FanoutPost adds post to timelines of author followers that do not have it yet and did not mute the author,
+	// returned items only have Id, UserId and PostId set
+	FanoutPost(ctx context.Context, postId, authorId int64) ([]TimelineItem, error)
+	// FanoutRepost adds post reposted by user to timelines of the user and their followers that do not
+	// have it yet, followers who muted either the reposter or the author and ones blocked with the author
+	// are skipped, returned items only have Id, UserId, PostId and RepostedBy with Id set
+	FanoutRepost(ctx context.Context, postId, reposterId int64) ([]TimelineItem, error)
+	// Timeline lists timeline of user, newest first or, when after is set, oldest first starting after it,
+	// items by or reposted by users the user muted, blocked or was blocked by are left out
+	Timeline(ctx context.Context, userId int64, last int, before, after int64) ([]TimelineItem, error)
+	// RebuildTimeline replaces timeline of user with at most limit newest posts and reposts of the user
+	// and of users they follow, each post once, it returns number of items in the new timeline
+	RebuildTimeline(ctx context.Context, userId int64, limit int) (int, error)
+}
+
+// Counters denormalized counts CounterStore reconciles, each is a column counting rows of another table
+const (
+	CounterFollowers      = "followers_count"
+	CounterFollowees      = "followees_count"
+	CounterPostLikes      = "post_likes_count"
+	CounterPostComments   = "post_comments_count"
+	CounterPostReposts    = "post_reposts_count"
+	CounterCommentLikes   = "comment_likes_count"
+	CounterCommentReplies = "comment_replies_count"
+)
+
+// Counters every counter in the order they are reconciled
+var Counters = []string{CounterFollowers, CounterFollowees, CounterPostLikes, CounterPostComments,
+	CounterPostReposts, CounterCommentLikes, CounterCommentReplies}
+
+// CountMismatch row whose stored count differs from the actual one
+type CountMismatch struct {
+	Counter string `json:"counter"`
+	Id      int64  `json:"id"`
+	Stored  int    `json:"stored"`
+	Actual  int    `json:"actual"`
+}
+
+// CountBatch result of reconciling single batch, LastId is 0 when there were no rows left
+type CountBatch struct {
+	Checked    int
+	LastId     int64
+	Mismatches []CountMismatch
+}
+
+// CounterStore maintenance of denormalized counts
+type CounterStore interface {
+	// ReconcileCounts checks counter of at most limit rows with id greater than afterId in id order
+	// and, when fix is set, sets wrong ones to the actual count, run it in Tx so fixed rows stay locked
+	// until commit and concurrent updates of the count are not lost
+	ReconcileCounts(ctx context.Context, counter string, afterId int64, limit int, fix bool) (CountBatch, error)
+}
+
+// NotificationStore notifications, actors of the same kind on the same post are coalesced
+// into a single unread notification, Actors holds usernames of the most recent ones
+type NotificationStore interface {
+	// Notify adds actor to the unread notification or creates new one and returns its id
+	Notify(ctx context.Context, userId, actorId int64, kind string, postId *int64) (int64, error)
+	// RetractNotification removes actor from the unread notification, dropping it when no actors are left
+	RetractNotification(ctx context.Context, userId, actorId int64, kind string, postId *int64) error
+	// Notification, Notifications and UnreadNotificationsCount leave out actors the notified user muted,
+	// blocked or was blocked by, along with notifications that have no other actors
+	Notification(ctx context.Context, notificationId int64) (Notification, error)
+	// Notifications lists notifications of the user, most recent first, older than notification before
+	Notifications(ctx context.Context, userId int64, last int, before int64) ([]Notification, error)
+	UnreadNotificationsCount(ctx context.Context, userId int64) (int, error)
+	MarkNotificationAsRead(ctx context.Context, userId, notificationId int64) error
+	MarkNotificationsAsRead(ctx context.Context, userId int64) error
+}
+
+// Job single queued job
+type Job struct {
+	Id          int64
+	Kind        string
+	Payload     []byte
+	Attempts    int
+	MaxAttempts int
+}
+
+// JobStore durable job queue
+type JobStore interface {
+	EnqueueJob(ctx context.Context, kind string, payload []byte, maxAttempts int) error
+	// ClaimJob marks the next due job as running and counts the attempt, running jobs not
+	// updated for lease are claimed again, ErrNotFound is returned when no job is due
+	ClaimJob(ctx context.Context, lease time.Duration) (Job, error)
+	CompleteJob(ctx context.Context, jobId int64) error
+	// RetryJob schedules failed job to run again at runAt
+	RetryJob(ctx context.Context, jobId int64, lastError string, runAt time.Time) error
+	// KillJob gives up on failed job
+	KillJob(ctx context.Context, jobId int64, lastError string) error
+	// PurgeDoneJobs deletes jobs done before the given time and returns how many were deleted,
+	// dead jobs are kept for inspection
+	PurgeDoneJobs(ctx context.Context, before time.Time) (int64, error)
+}
+
+// SessionStore sessions of logged in devices, only hashes of refresh tokens are stored
+type SessionStore interface {
+	CreateSession(ctx context.Context, userId int64, session Session, refreshTokenHash string) error
+	DeleteExpiredSessions(ctx context.Context, userId int64) error
+	// RotateRefreshToken replaces refresh token of active session, keeping the old one to detect its reuse,
+	// it returns id of the session and its user
+	RotateRefreshToken(ctx context.Context, refreshTokenHash, newRefreshTokenHash string) (string, User, error)
+	// RevokeRotatedRefreshToken deletes session whose refresh token was already rotated and returns its id
+	RevokeRotatedRefreshToken(ctx context.Context, refreshTokenHash string) (string, error)
+	// Sessions lists active sessions of the user, most recently seen first
+	Sessions(ctx context.Context, userId int64) ([]Session, error)
+	// SessionLastSeenAt returns when active session of the user was last seen
+	SessionLastSeenAt(ctx context.Context, userId int64, sessionId string) (time.Time, error)
+	// TouchSession updates when session was last seen and, unless empty, its ip
+	TouchSession(ctx context.Context, sessionId, ip string) error
+	DeleteSession(ctx context.Context, userId int64, sessionId string) error
+	DeleteSessions(ctx context.Context, userId int64) error
+}
+
+// VerificationCode single use code sent in magic link
+type VerificationCode struct {
+	User        User
+	RedirectURI string
+	CreatedAt   time.Time
+}
+
+// EmailChange email change waiting for the new address to be verified
+type EmailChange struct {
+	UserId    int64
+	Email     string
+	CreatedAt time.Time
+}
+
+// EmailChangeStore pending email changes, only hashes of codes are stored
+type EmailChangeStore interface {
+	// CreateEmailChange replaces pending email change of the user
+	CreateEmailChange(ctx context.Context, codeHash string, userId int64, email string) error
+	DeleteEmailChangesBefore(ctx context.Context, t time.Time) error
+	// TakeEmailChange deletes the change and returns it, so each code is used at most once
+	TakeEmailChange(ctx context.Context, codeHash string) (EmailChange, error)
+}
+
+// ExportStore data exports of users
+type ExportStore interface {
+	CreateExport(ctx context.Context, userId int64) (UserExport, error)
+	Export(ctx context.Context, exportId int64) (UserExport, error)
+	// LatestExport most recently requested export of the user
+	LatestExport(ctx context.Context, userId int64) (UserExport, error)
+	// CompleteExport sets file of the built archive
+	CompleteExport(ctx context.Context, exportId int64, file string) error
+	// UserArchive collects everything user created, ordered by id
+	UserArchive(ctx context.Context, userId int64) (UserArchive, error)
+}
+
+// UserArchive what goes into data export of a user, Media lists every upload of the user
+// and LikedPosts, LikedComments and Reposts ids of what they liked and reposted
+type UserArchive struct {
+	Profile       UserProfile    `json:"profile"`
+	Posts         []Post         `json:"posts"`
+	Revisions     []PostRevision `json:"revisions"`
+	Comments      []Comment      `json:"comments"`
+	Media         []Media        `json:"-"`
+	LikedPosts    []int64        `json:"likedPosts"`
+	LikedComments []int64        `json:"likedComments"`
+	Reposts       []int64        `json:"reposts"`
+	Following     []string       `json:"following"`
+	Followers     []string       `json:"followers"`
+}
+
+// VerificationCodeStore magic link codes, only hashes of codes are stored
+type VerificationCodeStore interface {
+	CreateVerificationCode(ctx context.Context, codeHash string, userId int64, redirectURI string) error
+	DeleteVerificationCodesBefore(ctx context.Context, t time.Time) error
+	// TakeVerificationCode deletes the code and returns it, so each code is used at most once
+	TakeVerificationCode(ctx context.Context, codeHash string) (VerificationCode, error)
+}
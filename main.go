@@ -1,14 +1,32 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"github.com/hako/branca"
 	_ "github.com/lib/pq"
+	"io/fs"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"social/internal/blob"
 	"social/internal/handlers"
+	"social/internal/mailing"
 	"social/internal/services"
+	"social/internal/store"
+	"social/web"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	jobWorkers      = 4
+	shutdownTimeout = time.Second * 30
 )
 
 func main() {
@@ -17,6 +35,38 @@ func main() {
 		databaseURL = env("DATABASE_URL", "host=localhost port=5432 user=postgres password=postgres dbname=nakama sslmode=disable")
 		origin      = env("ORIGIN", "http://localhost:"+port)
 		brancaKey   = env("BRANCA_KEY", "YEk9b2KT7Hv6bYuthSzckXKkqkYZawhq")
+		devLogin    = env("DEV_LOGIN", "false") == "true"
+		mailFrom    = env("MAIL_FROM", "noreply@localhost")
+		smtpHost    = env("SMTP_HOST", "")
+		smtpPort    = env("SMTP_PORT", "587")
+		smtpUser    = env("SMTP_USERNAME", "")
+		smtpPass    = env("SMTP_PASSWORD", "")
+		mailDir     = env("MAIL_DIR", "")
+		// mails, login links included, are only logged instead of sent when opted in for development
+		logMails    = env("LOG_MAILS", "false") == "true"
+		autoMigrate = env("AUTO_MIGRATE", "false") == "true"
+		// how often denormalized counts are reconciled, 0 disables it
+		countsInterval = env("COUNTS_RECONCILE_INTERVAL", "1h")
+		// how often trending hashtags are ranked again
+		trendingInterval = env("TRENDING_REFRESH_INTERVAL", "1m")
+		// how often accounts whose deletion grace period is over are deleted
+		deletionInterval = env("ACCOUNT_DELETION_INTERVAL", "1h")
+		// where avatars and media are stored, fs or s3, blobDir has to be outside of staticDir
+		// so blobs are neither served as static assets nor embedded with them
+		blobStore      = env("BLOB_STORE", "fs")
+		blobDir        = env("BLOB_DIR", path.Join("data", "blobs"))
+		blobURL        = env("BLOB_URL", origin+"/img")
+		blobSigningKey = env("BLOB_SIGNING_KEY", brancaKey)
+		s3Endpoint     = env("S3_ENDPOINT", "http://localhost:9000")
+		s3Region       = env("S3_REGION", "us-east-1")
+		s3Bucket       = env("S3_BUCKET", "nakama")
+		s3AccessKey    = env("S3_ACCESS_KEY", "")
+		s3SecretKey    = env("S3_SECRET_KEY", "")
+		s3PathStyle    = env("S3_PATH_STYLE", "true") == "true"
+		s3PublicURL    = env("S3_PUBLIC_URL", "")
+		// frontend assets are served from staticDir unless they are embedded into the binary
+		staticDir   = env("STATIC_DIR", path.Join("web", "static"))
+		embedStatic = env("EMBED_STATIC", "false") == "true"
 	)
 
 	db, err := sql.Open("postgres", databaseURL)
@@ -31,15 +81,160 @@ func main() {
 		return
 	}
 
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err = migrateCommand(ctx, db, os.Args[2:]); err != nil {
+			log.Fatalf("could not migrate: %v", err)
+			return
+		}
+		return
+	}
+
+	if len(os.Args) > 1 {
+		if _, ok := adminCommands[os.Args[1]]; !ok {
+			log.Fatalf("unknown command %q, usage: %s [migrate up|down [N]|status|goto N|force N]%s",
+				os.Args[1], os.Args[0], adminUsage())
+			return
+		}
+	}
+
+	if autoMigrate {
+		if err = migrateCommand(ctx, db, []string{"up"}); err != nil {
+			log.Fatalf("could not migrate: %v", err)
+			return
+		}
+	}
+
 	codec := branca.NewBranca(brancaKey)
-	codec.SetTTL(uint32(services.TokenLifeSpan.Seconds()))
-	s := services.New(db, codec, origin)
+	codec.SetTTL(uint32(services.AccessTokenLifeSpan.Seconds()))
+
+	var mailer mailing.Mailer
+	if smtpHost != "" {
+		p, err := strconv.Atoi(smtpPort)
+		if err != nil {
+			log.Fatalf("could not parse smtp port : %s", err)
+			return
+		}
+		mailer = mailing.NewSMTPMailer(mailFrom, smtpHost, p, smtpUser, smtpPass)
+	} else if logMails {
+		log.Println("LOG_MAILS set, mails will be logged instead of sent")
+		mailer = &mailing.LogMailer{From: mailFrom, Dir: mailDir}
+	} else {
+		log.Fatalln("SMTP_HOST not set, set it or LOG_MAILS=true to log mails in development")
+		return
+	}
+
+	var blobs blob.Store
+	switch blobStore {
+	case "fs":
+		if within(blobDir, staticDir) {
+			log.Fatalf("BLOB_DIR %s must be outside of STATIC_DIR %s", blobDir, staticDir)
+			return
+		}
+
+		fsBlobs := blob.NewFSStore(blobDir, blobURL, []byte(blobSigningKey))
+		fsBlobs.Private = []string{services.ExportsPrefix}
+		blobs = fsBlobs
+	case "s3":
+		// the bucket policy has to keep services.ExportsPrefix private, exports are only shared through signed urls
+		blobs, err = blob.NewS3Store(blob.S3Config{
+			Endpoint:  s3Endpoint,
+			Region:    s3Region,
+			Bucket:    s3Bucket,
+			AccessKey: s3AccessKey,
+			SecretKey: s3SecretKey,
+			PathStyle: s3PathStyle,
+			PublicURL: s3PublicURL,
+		})
+		if err != nil {
+			log.Fatalf("could not create s3 blob store : %s", err)
+			return
+		}
+	default:
+		log.Fatalf("unknown blob store %q, must be fs or s3", blobStore)
+		return
+	}
+
+	s := services.New(store.NewPostgres(db), codec, origin, mailer, blobs)
+	s.DevLogin = devLogin
+
+	if len(os.Args) > 1 {
+		if err = runAdminCommand(ctx, s, os.Args[1], os.Args[2:]); err != nil {
+			log.Fatalf("could not %s: %v", os.Args[1], err)
+			return
+		}
+		return
+	}
+
+	reconcileInterval, err := time.ParseDuration(countsInterval)
+	if err != nil {
+		log.Fatalf("could not parse counts reconcile interval : %s", err)
+		return
+	}
+
+	if reconcileInterval > 0 {
+		go s.RunCountsReconciler(ctx, reconcileInterval)
+	}
+
+	trendingRefresh, err := time.ParseDuration(trendingInterval)
+	if err != nil {
+		log.Fatalf("could not parse trending refresh interval : %s", err)
+		return
+	}
+
+	if trendingRefresh <= 0 {
+		log.Fatalf("trending refresh interval must be positive")
+		return
+	}
+
+	go s.RunTrendingHashtags(ctx, trendingRefresh)
+
+	accountDeletion, err := time.ParseDuration(deletionInterval)
+	if err != nil {
+		log.Fatalf("could not parse account deletion interval : %s", err)
+		return
+	}
+
+	if accountDeletion <= 0 {
+		log.Fatalf("account deletion interval must be positive")
+		return
+	}
+
+	go s.RunAccountDeletions(ctx, accountDeletion)
+
+	jobsDone := make(chan struct{})
+	go func() {
+		defer close(jobsDone)
+		s.RunJobs(ctx, jobWorkers)
+	}()
+
+	static := os.DirFS(staticDir)
+	if embedStatic {
+		if static, err = fs.Sub(web.Static, "static"); err != nil {
+			log.Fatalf("could not read embedded static files : %s", err)
+			return
+		}
+	}
+
+	server := &http.Server{Addr: ":" + port, Handler: handlers.New(s, static)}
+	go func() {
+		<-ctx.Done()
+		log.Println("shutting down")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			log.Printf("could not shutdown server gracefully: %v", err)
+		}
+	}()
 
-	h := handlers.New(s)
 	log.Printf("app running on port %s", port)
-	if err := http.ListenAndServe(":"+port, h); err != nil {
-		log.Fatalf("could not start app")
+	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.Fatalf("could not start app: %v", err)
 	}
+
+	<-jobsDone
 }
 
 func env(key, fallbackValue string) string {
@@ -50,3 +245,19 @@ func env(key, fallbackValue string) string {
 
 	return s
 }
+
+// within tells whether dir is parent or inside of it
+func within(dir, parent string) bool {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return false
+	}
+
+	absParent, err := filepath.Abs(parent)
+	if err != nil {
+		return false
+	}
+
+	rel, err := filepath.Rel(absParent, absDir)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
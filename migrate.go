@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"social/db/migration"
+	"social/internal/migrate"
+	"strconv"
+)
+
+// migrateCommand runs migrate subcommand: up, down [N], status, goto N or force N
+func migrateCommand(ctx context.Context, db *sql.DB, args []string) error {
+	m, err := migrate.New(db, migration.FS)
+	if err != nil {
+		return err
+	}
+
+	if len(args) == 0 {
+		return fmt.Errorf("missing migrate command, one of up, down, status, goto, force")
+	}
+
+	switch args[0] {
+	case "up":
+		return m.Up(ctx)
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			if steps, err = strconv.Atoi(args[1]); err != nil || steps < 1 {
+				return fmt.Errorf("number of steps must be positive integer")
+			}
+		}
+		return m.Down(ctx, steps)
+	case "goto", "force":
+		if len(args) < 2 {
+			return fmt.Errorf("missing version")
+		}
+		version, err := strconv.ParseUint(args[1], 10, 64)
+		if err != nil {
+			return fmt.Errorf("bad version %q", args[1])
+		}
+		if args[0] == "force" {
+			return m.Force(ctx, uint(version))
+		}
+		return m.Goto(ctx, uint(version))
+	case "status":
+		status, err := m.Status(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("version %d", status.Version)
+		if status.Dirty {
+			fmt.Print(" (dirty)")
+		}
+		fmt.Println()
+		for _, ms := range status.Migrations {
+			state := "pending"
+			if ms.Applied {
+				state = "applied"
+			}
+			fmt.Printf("%06d %-8s %s\n", ms.Version, state, ms.Name)
+		}
+		return nil
+	}
+
+	return fmt.Errorf("unknown migrate command %q", args[0])
+}
@@ -0,0 +1,9 @@
+// Package web holds the frontend served by the app, embedded when it runs with EMBED_STATIC
+package web
+
+import "embed"
+
+// Static files of web/static, read them through fs.Sub(Static, "static")
+//
+//go:embed static
+var Static embed.FS